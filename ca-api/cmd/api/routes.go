@@ -2,32 +2,147 @@
 package api
 
 import (
+	"expvar"
+
 	"github.com/dhruvpatel-10/signee/ca-api/db"
+	authz "github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
 	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/batch"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/enroll"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/gitsign"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/offline"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/translog"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine, q *db.Queries) {
+func SetupRoutes(r *gin.Engine, q *db.Queries, jwtManager *jwt.JWTManager, tlog *translog.Log, authService *auth.AuthService, enroller *enroll.Service, offlineCA *offline.Service, gitSigner *gitsign.Service, batchManager *batch.Manager) {
+
+	// Public keys for verifying access tokens, at the path verifiers look for them
+	r.GET("/.well-known/jwks.json", jwtManager.GetJWKS)
 
 	v1 := r.Group("/api/v1")
-	authService := &auth.AuthService{DB: q}
 	// Public endpoints
 	public := v1.Group("/")
+	public.Use(middleware.DPoPProof(jwtManager))
 	{
 		public.POST("/auth/login", authService.Login)
-		// public.POST("/auth/refresh", handlers.RefreshToken)
+		public.POST("/auth/refresh", authService.Refresh)
+		public.POST("/auth/mfa/verify", authService.VerifyMFA)
+		public.POST("/auth/mfa/passkey/options", authService.BeginPasskeyMFA)
+		public.POST("/auth/passkey/login/begin", authService.BeginPasskeyLogin)
+		public.POST("/auth/passkey/login/finish", authService.FinishPasskeyLogin)
 		public.POST("/auth/signup", authService.Signup)
+		public.POST("/auth/invitations/accept", authService.AcceptInvitation)
+		public.POST("/auth/email/verify", authService.VerifyEmail)
+		public.POST("/auth/email/verify/resend", authService.RequestEmailVerification)
+		public.POST("/auth/password/reset", authService.ResetPassword)
+		public.POST("/auth/password/reset/request", authService.RequestPasswordReset)
+		public.GET("/auth/oidc/:provider/login", authService.BeginOIDCLogin)
+		public.GET("/auth/oidc/:provider/callback", authService.FinishOIDCLogin)
+		public.GET("/auth/saml/:provider/metadata", authService.SAMLMetadata)
+		public.GET("/auth/saml/:provider/login", authService.BeginSAMLLogin)
+		public.POST("/auth/saml/:provider/acs", authService.FinishSAMLLogin)
 		// public.GET("/healthz", auth.AuthService.HealthCheck)
 	}
 
+	// Certificate transparency log (public so anyone can audit issuance)
+	logGroup := v1.Group("/log")
+	{
+		logGroup.GET("/sth", tlog.GetSignedTreeHead)
+		logGroup.GET("/public-key", tlog.GetPublicKey)
+		logGroup.GET("/entries", tlog.GetEntries)
+		logGroup.GET("/proof/inclusion", tlog.GetInclusionProof)
+		logGroup.GET("/proof/consistency", tlog.GetConsistencyProof)
+	}
+
+	// Host enrollment (public: hosts prove control of their hostname instead of signing in)
+	enrollGroup := v1.Group("/enroll")
+	{
+		enrollGroup.POST("/challenges", enroller.CreateChallenge)
+		enrollGroup.GET("/challenges/:id", enroller.GetChallenge)
+		enrollGroup.POST("/challenges/:id/finalize", enroller.FinalizeChallenge)
+	}
+
 	// Protected endpoints
-	// protected := v1.Group("/")
-	// protected.Use(middleware.AuthRequired())
+	protected := v1.Group("/")
+	protected.Use(middleware.AuthRequired(jwtManager, auth.LoadPrincipal(q), auth.LoadAPIKeyPrincipal(q)))
+	{
+		// An API key acts for a service account, never on a person's own account
+		account := protected.Group("/")
+		account.Use(middleware.SessionRequired())
+		{
+			// Sessions
+			account.POST("/auth/logout", authService.Logout)
+			account.GET("/sessions", authService.ListMySessions)
+			account.DELETE("/sessions", authService.RevokeAllMySessions)
+			account.DELETE("/sessions/:sessionID", authService.RevokeMySession)
+
+			// Account
+			account.POST("/users/me/password", authService.ChangePassword)
+
+			// MFA enrollment
+			account.POST("/users/me/mfa/enable", authService.EnableMFA)
+			account.POST("/users/me/mfa/confirm", authService.ConfirmMFA)
+			account.POST("/users/me/mfa/recovery-codes", authService.RegenerateRecoveryCodes)
+
+			// Passkeys
+			account.GET("/users/me/passkeys", authService.ListPasskeys)
+			account.POST("/users/me/passkeys/register/begin", authService.BeginPasskeyRegistration)
+			account.POST("/users/me/passkeys/register/finish", authService.FinishPasskeyRegistration)
+			account.DELETE("/users/me/passkeys/:credentialID", authService.DeletePasskey)
+
+			// Linking an identity provider to an existing account needs its owner signed in
+			account.POST("/users/me/identities/oidc/:provider", authService.LinkOIDCIdentity)
+			account.POST("/users/me/identities/saml/:provider", authService.LinkSAMLIdentity)
+
+			// Commit signing certificates are issued to a person for their own email
+			account.POST("/gitsign/certificates", middleware.RequirePermission(authz.CertRequest), gitSigner.IssueCertificate)
+		}
+
+		// allowed_signers for a repository's contributors, e.g. fetched by CI before verifying commits
+		protected.POST("/gitsign/allowed-signers", middleware.RequirePermission(authz.CertView), gitSigner.AllowedSigners)
+
+		// Bulk host signing skips enrollment challenges and approval, so it is for admins only.
+		// Jobs run in the background and are polled by whoever submitted them.
+		protected.POST("/certificates/batch", middleware.RequirePermission(authz.CertIssueHost), batchManager.SubmitBatch)
+		protected.GET("/certificates/batch/:id", batchManager.GetBatch)
+
+		// Offline CA: approved requests are exported to the air-gapped signer and its response imported
+		protected.GET("/offline/requests", middleware.RequirePermission(authz.CertView), offlineCA.ListRequests)
+		protected.POST("/offline/requests", middleware.RequirePermission(authz.CertRequest), offlineCA.CreateRequest)
+		protected.POST("/offline/requests/:id/approve", middleware.RequirePermission(authz.CertApprove), offlineCA.ApproveRequest)
+		protected.POST("/offline/requests/:id/reject", middleware.RequirePermission(authz.CertApprove), offlineCA.RejectRequest)
+		protected.GET("/offline/export-key", middleware.RequirePermission(authz.CertApprove), offlineCA.GetExportKey)
+		protected.POST("/offline/export", middleware.RequirePermission(authz.CertApprove), offlineCA.ExportBundle)
+		protected.POST("/offline/import", middleware.RequirePermission(authz.CertApprove), offlineCA.ImportBundle)
+
+		// Admin endpoints
+		admin := protected.Group("/admin")
+		admin.Use(middleware.RequireRole("admin"))
+		{
+			admin.GET("/users/:id/sessions", authService.ListUserSessions)
+			admin.DELETE("/users/:id/sessions", authService.RevokeAllUserSessions)
+			admin.DELETE("/users/:id/sessions/:sessionID", authService.RevokeUserSession)
+			admin.POST("/users/:id/unlock", authService.UnlockUser)
+			admin.GET("/invitations", authService.ListInvitations)
+			admin.POST("/invitations", authService.CreateInvitation)
+			admin.DELETE("/invitations/:id", authService.RevokeInvitation)
+			admin.GET("/service-accounts", authService.ListServiceAccounts)
+			admin.POST("/service-accounts", authService.CreateServiceAccount)
+			admin.GET("/service-accounts/:id/keys", authService.ListAPIKeys)
+			admin.POST("/service-accounts/:id/keys", authService.CreateAPIKey)
+			admin.POST("/service-accounts/:id/keys/:keyID/rotate", authService.RotateAPIKey)
+			admin.DELETE("/service-accounts/:id/keys/:keyID", authService.RevokeAPIKey)
+			admin.GET("/metrics", gin.WrapH(expvar.Handler()))
+		}
+	}
+
 	// {
 	// 	// User management
 	// 	protected.GET("/users/me", handlers.GetCurrentUser)
 	// 	protected.PUT("/users/me", handlers.UpdateCurrentUser)
-	// 	protected.POST("/users/me/mfa/enable", handlers.EnableMFA)
 
 	// 	// Certificate Authorities
 	// 	protected.GET("/cas", handlers.ListCAs)
@@ -48,11 +163,11 @@ func SetupRoutes(r *gin.Engine, q *db.Queries) {
 
 	// 	// Certificate Requests (approval workflow)
 	// 	protected.GET("/requests", handlers.ListRequests)
-	// 	protected.POST("/requests/:id/approve", middleware.RequirePermission("request:approve"), handlers.ApproveRequest)
-	// 	protected.POST("/requests/:id/reject", middleware.RequirePermission("request:approve"), handlers.RejectRequest)
+	// 	protected.POST("/requests/:id/approve", middleware.RequirePermission("cert:approve"), handlers.ApproveRequest)
+	// 	protected.POST("/requests/:id/reject", middleware.RequirePermission("cert:approve"), handlers.RejectRequest)
 
 	// 	// Audit logs
-	// 	protected.GET("/audit", middleware.RequirePermission("audit:read"), handlers.GetAuditLogs)
+	// 	protected.GET("/audit", middleware.RequirePermission("audit:view"), handlers.GetAuditLogs)
 
 	// 	// Admin endpoints
 	// 	admin := protected.Group("/admin")
@@ -0,0 +1,158 @@
+// signee-keyring manages the keyring that encrypts token claims and secrets
+// at rest. Running API instances reload it on their own, so keys can be
+// rotated without a restart or logging anyone out.
+//
+//	signee-keyring list
+//	signee-keyring rotate  -wait 1m
+//	signee-keyring add
+//	signee-keyring promote VERSION
+//	signee-keyring retire  VERSION
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: signee-keyring <list|rotate|add|promote|retire> [flags] [VERSION]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "list":
+		runList(os.Args[2:])
+	case "rotate":
+		runRotate(os.Args[2:])
+	case "add":
+		runAdd(os.Args[2:])
+	case "promote":
+		runPromote(os.Args[2:])
+	case "retire":
+		runRetire(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	defaultPath := os.Getenv("CHACHA20_KEY_PATH")
+	if defaultPath == "" {
+		defaultPath = "chacha20_key.bin"
+	}
+	path := fs.String("keyring", defaultPath, "keyring file the API loads")
+	return fs, path
+}
+
+func runList(args []string) {
+	fs, path := newFlagSet("list")
+	fs.Parse(args)
+
+	ring := loadKeyring(*path)
+	for _, key := range ring.Versions() {
+		fmt.Printf("%d\t%s\n", key.Version, key.State)
+	}
+}
+
+// runRotate stages a new key, gives every instance time to load it, then
+// makes it active. Instances reseal stored secrets once they see the change.
+func runRotate(args []string) {
+	fs, path := newFlagSet("rotate")
+	wait := fs.Duration("wait", time.Minute, "how long instances get to load the new key before it becomes active")
+	fs.Parse(args)
+
+	ring := loadKeyring(*path)
+	added, err := ring.Add()
+	if err != nil {
+		log.Fatalf("add key: %v", err)
+	}
+	saveKeyring(ring, *path)
+	log.Printf("added key version %d; activating in %s", added.Version, *wait)
+
+	time.Sleep(*wait)
+
+	// Reload in case the file changed while we waited
+	ring = loadKeyring(*path)
+	if err := ring.Promote(added.Version); err != nil {
+		log.Fatalf("promote key: %v", err)
+	}
+	saveKeyring(ring, *path)
+	log.Printf("key version %d is active", added.Version)
+}
+
+func runAdd(args []string) {
+	fs, path := newFlagSet("add")
+	fs.Parse(args)
+
+	ring := loadKeyring(*path)
+	added, err := ring.Add()
+	if err != nil {
+		log.Fatalf("add key: %v", err)
+	}
+	saveKeyring(ring, *path)
+	log.Printf("added key version %d as %s; promote it once every instance has loaded it", added.Version, added.State)
+}
+
+func runPromote(args []string) {
+	fs, path := newFlagSet("promote")
+	fs.Parse(args)
+	version := versionArg(fs)
+
+	ring := loadKeyring(*path)
+	if err := ring.Promote(version); err != nil {
+		log.Fatalf("promote key: %v", err)
+	}
+	saveKeyring(ring, *path)
+	log.Printf("key version %d is active", version)
+}
+
+func runRetire(args []string) {
+	fs, path := newFlagSet("retire")
+	fs.Parse(args)
+	version := versionArg(fs)
+
+	ring := loadKeyring(*path)
+	if err := ring.Retire(version); err != nil {
+		log.Fatalf("retire key: %v", err)
+	}
+	saveKeyring(ring, *path)
+	log.Printf("retired key version %d; tokens and secrets still sealed with it can no longer be opened", version)
+}
+
+func versionArg(fs *flag.FlagSet) int {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	version, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("invalid version %q", fs.Arg(0))
+	}
+	return version
+}
+
+func loadKeyring(path string) *jwt.Keyring {
+	ring, err := jwt.LoadKeyring(path)
+	if err != nil {
+		log.Fatalf("load keyring: %v", err)
+	}
+	return ring
+}
+
+func saveKeyring(ring *jwt.Keyring, path string) {
+	if err := ring.Save(path); err != nil {
+		log.Fatalf("save keyring: %v", err)
+	}
+}
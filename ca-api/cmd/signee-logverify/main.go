@@ -0,0 +1,219 @@
+// signee-logverify replays the certificate transparency log and checks it
+// against the signed tree head, a previously verified head and an inventory.
+//
+//	signee-logverify -api http://localhost:8080/api/v1 -pubkey tlog.pub \
+//	    [-state sth.json] [-inventory certs.txt]
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	domain "github.com/dhruvpatel-10/signee/ca-api/internal/domain/translog"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/translog"
+)
+
+const pageSize = 1000
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+func main() {
+	apiURL := flag.String("api", "http://localhost:8080/api/v1", "base URL of the Signee API")
+	pubKeyPath := flag.String("pubkey", "", "PEM encoded log public key")
+	statePath := flag.String("state", "", "file holding the last verified tree head; updated on success")
+	inventoryPath := flag.String("inventory", "", "file of issued certificates, one per line")
+	flag.Parse()
+
+	if *pubKeyPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pub, err := loadPublicKey(*pubKeyPath)
+	if err != nil {
+		log.Fatalf("load public key: %v", err)
+	}
+
+	var sth domain.SignedTreeHead
+	if err := getJSON(*apiURL+"/log/sth", &sth); err != nil {
+		log.Fatalf("fetch tree head: %v", err)
+	}
+	if !translog.VerifyTreeHead(pub, &sth) {
+		log.Fatalf("tree head signature does not verify")
+	}
+
+	// Replay every entry and rebuild the tree
+	leaves := make([][]byte, 0, sth.TreeSize)
+	logged := make(map[string]bool, sth.TreeSize)
+	for start := int64(0); start < sth.TreeSize; start += pageSize {
+		end := min(start+pageSize, sth.TreeSize)
+		var page struct {
+			Entries []domain.LogEntry `json:"entries"`
+		}
+		if err := getJSON(fmt.Sprintf("%s/log/entries?start=%d&end=%d", *apiURL, start, end), &page); err != nil {
+			log.Fatalf("fetch entries %d-%d: %v", start, end, err)
+		}
+		for _, e := range page.Entries {
+			if e.LeafIndex != int64(len(leaves)) {
+				log.Fatalf("entry %d returned out of order", e.LeafIndex)
+			}
+			leaf := translog.LeafHash([]byte(e.Certificate))
+			if !bytes.Equal(leaf, e.LeafHash) {
+				log.Fatalf("entry %d: stored leaf hash does not match certificate", e.LeafIndex)
+			}
+			leaves = append(leaves, leaf)
+			logged[e.Certificate] = true
+		}
+		if len(page.Entries) == 0 {
+			break
+		}
+	}
+
+	if int64(len(leaves)) != sth.TreeSize {
+		log.Fatalf("replayed %d entries, tree head claims %d", len(leaves), sth.TreeSize)
+	}
+	if !bytes.Equal(translog.RootHash(leaves), sth.RootHash) {
+		log.Fatalf("replayed root does not match signed tree head")
+	}
+	log.Printf("replayed %d entries; root matches signed tree head", sth.TreeSize)
+
+	if *statePath != "" {
+		if err := checkConsistency(*apiURL, *statePath, pub, &sth); err != nil {
+			log.Fatalf("consistency: %v", err)
+		}
+	}
+
+	if *inventoryPath != "" {
+		if err := checkInventory(*inventoryPath, logged); err != nil {
+			log.Fatalf("inventory: %v", err)
+		}
+	}
+
+	if *statePath != "" {
+		data, _ := json.MarshalIndent(sth, "", "  ")
+		if err := os.WriteFile(*statePath, data, 0644); err != nil {
+			log.Fatalf("save state: %v", err)
+		}
+	}
+}
+
+// checkConsistency proves the previously verified tree is a prefix of the current one
+func checkConsistency(apiURL, statePath string, pub ed25519.PublicKey, sth *domain.SignedTreeHead) error {
+	data, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		log.Printf("no previous tree head in %s; trusting this one", statePath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var prev domain.SignedTreeHead
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return err
+	}
+	if !translog.VerifyTreeHead(pub, &prev) {
+		return fmt.Errorf("stored tree head signature does not verify")
+	}
+	if prev.TreeSize > sth.TreeSize {
+		return fmt.Errorf("log shrank from %d to %d entries", prev.TreeSize, sth.TreeSize)
+	}
+	if prev.TreeSize == 0 {
+		return nil
+	}
+
+	var proof domain.ConsistencyProof
+	if err := getJSON(fmt.Sprintf("%s/log/proof/consistency?first=%d&second=%d", apiURL, prev.TreeSize, sth.TreeSize), &proof); err != nil {
+		return err
+	}
+	if err := translog.VerifyConsistency(uint64(prev.TreeSize), uint64(sth.TreeSize), prev.RootHash, sth.RootHash, proof.Proof); err != nil {
+		return err
+	}
+	log.Printf("tree at %d entries is consistent with previous tree at %d", sth.TreeSize, prev.TreeSize)
+	return nil
+}
+
+// checkInventory confirms the log and the inventory hold exactly the same certificates
+func checkInventory(path string, logged map[string]bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	missing := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		cert := strings.TrimSpace(scanner.Text())
+		if cert == "" {
+			continue
+		}
+		seen[cert] = true
+		if !logged[cert] {
+			missing++
+			log.Printf("not in log: %.80s", cert)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	offBooks := 0
+	for cert := range logged {
+		if !seen[cert] {
+			offBooks++
+			log.Printf("not in inventory: %.80s", cert)
+		}
+	}
+
+	if missing > 0 || offBooks > 0 {
+		return fmt.Errorf("%d certificates missing from log, %d logged but not in inventory", missing, offBooks)
+	}
+	log.Printf("inventory of %d certificates matches the log", len(seen))
+	return nil
+}
+
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("invalid PEM block in %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("log key is not Ed25519")
+	}
+	return pub, nil
+}
+
+func getJSON(url string, v any) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
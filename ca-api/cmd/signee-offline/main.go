@@ -0,0 +1,165 @@
+// signee-offline signs exported request bundles on an air-gapped machine.
+//
+//	signee-offline sign   -bundle requests.json -export-key api.pub -ca-key ca -out signed.json
+//	signee-offline verify -bundle requests.json -export-key api.pub -response signed.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	domain "github.com/dhruvpatel-10/signee/ca-api/internal/domain/offline"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/offline"
+	"golang.org/x/crypto/ssh"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: signee-offline <sign|verify> [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "sign":
+		runSign(os.Args[2:])
+	case "verify":
+		runVerify(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func runSign(args []string) {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	bundlePath := fs.String("bundle", "", "request bundle exported by the API")
+	exportKeyPath := fs.String("export-key", "", "public key the API signs exports with")
+	caKeyPath := fs.String("ca-key", "", "offline CA private key (OpenSSH format)")
+	outPath := fs.String("out", "signed.json", "where to write the signed response bundle")
+	fs.Parse(args)
+
+	if *bundlePath == "" || *exportKeyPath == "" || *caKeyPath == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	bundle, payload := openRequestBundle(*bundlePath, *exportKeyPath)
+
+	ca, err := loadSigner(*caKeyPath)
+	if err != nil {
+		log.Fatalf("load CA key: %v", err)
+	}
+
+	resp, err := offline.SignRequests(bundle, payload, ca)
+	if err != nil {
+		log.Fatalf("sign requests: %v", err)
+	}
+
+	env, err := offline.Seal(resp, ca)
+	if err != nil {
+		log.Fatalf("seal response: %v", err)
+	}
+
+	if err := writeJSON(*outPath, env); err != nil {
+		log.Fatalf("write response: %v", err)
+	}
+	log.Printf("signed %d certificates for bundle %s -> %s", len(resp.Certificates), bundle.ID, *outPath)
+}
+
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	bundlePath := fs.String("bundle", "", "request bundle exported by the API")
+	exportKeyPath := fs.String("export-key", "", "public key the API signs exports with")
+	responsePath := fs.String("response", "", "signed response bundle")
+	fs.Parse(args)
+
+	if *bundlePath == "" || *exportKeyPath == "" || *responsePath == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	bundle, payload := openRequestBundle(*bundlePath, *exportKeyPath)
+
+	caKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(bundle.CAKey))
+	if err != nil {
+		log.Fatalf("invalid CA key in bundle: %v", err)
+	}
+
+	var env domain.Envelope
+	if err := readJSON(*responsePath, &env); err != nil {
+		log.Fatalf("read response: %v", err)
+	}
+
+	var resp domain.ResponseBundle
+	if _, err := offline.Open(&env, caKey, &resp); err != nil {
+		log.Fatalf("open response: %v", err)
+	}
+
+	_, certs, err := offline.VerifyImport(payload, &resp)
+	if err != nil {
+		log.Fatalf("verify response: %v", err)
+	}
+	log.Printf("response for bundle %s verified: %d certificates", bundle.ID, len(certs))
+}
+
+func openRequestBundle(bundlePath, exportKeyPath string) (*domain.RequestBundle, []byte) {
+	exportKeyData, err := os.ReadFile(exportKeyPath)
+	if err != nil {
+		log.Fatalf("read export key: %v", err)
+	}
+	exportKey, _, _, _, err := ssh.ParseAuthorizedKey(exportKeyData)
+	if err != nil {
+		log.Fatalf("parse export key: %v", err)
+	}
+
+	var env domain.Envelope
+	if err := readJSON(bundlePath, &env); err != nil {
+		log.Fatalf("read bundle: %v", err)
+	}
+
+	var bundle domain.RequestBundle
+	payload, err := offline.Open(&env, exportKey, &bundle)
+	if err != nil {
+		log.Fatalf("open bundle: %v", err)
+	}
+	return &bundle, payload
+}
+
+func loadSigner(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		passphrase := os.Getenv("SIGNEE_CA_PASSPHRASE")
+		if passphrase == "" {
+			return nil, fmt.Errorf("key is encrypted; set SIGNEE_CA_PASSPHRASE")
+		}
+		return ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	return signer, err
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,108 @@
+// Package dbtest serves the sqlc queries through a database/sql driver backed
+// by a function, so handlers and workers can run against in-memory tables.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"testing"
+)
+
+// Handler answers one query, named by its sqlc "-- name:" comment. The rows
+// it returns are the query's result; for execs their count is the number of
+// rows affected.
+type Handler func(name string, args []driver.Value) ([][]driver.Value, error)
+
+// Open returns a database whose every query goes to h. Transactions are not
+// isolated and rollbacks undo nothing; h sees each statement as it runs.
+func Open(t *testing.T, h Handler) *sql.DB {
+	conn := sql.OpenDB(connector{t: t, h: h})
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Unexpected fails the test for a query the fake doesn't answer
+func Unexpected(t *testing.T, name string) error {
+	t.Errorf("dbtest: unexpected query %s", name)
+	return fmt.Errorf("dbtest: unexpected query %s", name)
+}
+
+type connector struct {
+	t *testing.T
+	h Handler
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn(c), nil }
+func (c connector) Driver() driver.Driver                        { return nil }
+
+type conn connector
+
+var queryName = regexp.MustCompile(`^-- name: (\w+)`)
+
+func (c conn) run(query string, args []driver.NamedValue) ([][]driver.Value, error) {
+	m := queryName.FindStringSubmatch(query)
+	if m == nil {
+		c.t.Errorf("dbtest: query without a name: %s", query)
+		return nil, fmt.Errorf("dbtest: unknown query")
+	}
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return c.h(m[1], values)
+}
+
+func (c conn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("dbtest: prepared statements are not supported")
+}
+func (c conn) Close() error              { return nil }
+func (c conn) Begin() (driver.Tx, error) { return tx{}, nil }
+
+func (c conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.run(query, args)
+	return driver.RowsAffected(len(rows)), err
+}
+
+func (c conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{rows: r}, nil
+}
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type rows struct {
+	rows [][]driver.Value
+	next int
+}
+
+func (r *rows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	cols := make([]string, len(r.rows[0]))
+	for i := range cols {
+		cols[i] = fmt.Sprintf("c%d", i)
+	}
+	return cols
+}
+
+func (r *rows) Close() error { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
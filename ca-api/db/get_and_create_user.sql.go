@@ -12,6 +12,22 @@ import (
 	"github.com/google/uuid"
 )
 
+const activateUser = `-- name: ActivateUser :execrows
+UPDATE users
+SET status = 'active',
+    updated_at = NOW()
+WHERE id = $1
+  AND status = 'pending'
+`
+
+func (q *Queries) ActivateUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, activateUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
     first_name,
@@ -20,11 +36,12 @@ INSERT INTO users (
     password_hash,
     mfa_secret,
     mfa_enabled,
-    created_by
+    created_by,
+    status
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7
+    $1, $2, $3, $4, $5, $6, $7, $8
 )
-RETURNING id, first_name, last_name, email, password_hash, mfa_secret, mfa_enabled, created_at, updated_at, created_by
+RETURNING id, first_name, last_name, email, password_hash, mfa_secret, mfa_enabled, created_at, updated_at, created_by, mfa_last_step, status, kind
 `
 
 type CreateUserParams struct {
@@ -35,6 +52,7 @@ type CreateUserParams struct {
 	MfaSecret    sql.NullString
 	MfaEnabled   sql.NullBool
 	CreatedBy    uuid.NullUUID
+	Status       string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -46,6 +64,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.MfaSecret,
 		arg.MfaEnabled,
 		arg.CreatedBy,
+		arg.Status,
 	)
 	var i User
 	err := row.Scan(
@@ -59,12 +78,15 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.CreatedBy,
+		&i.MfaLastStep,
+		&i.Status,
+		&i.Kind,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, first_name, last_name, email, password_hash, mfa_secret, mfa_enabled, created_at, updated_at, created_by
+SELECT id, first_name, last_name, email, password_hash, mfa_secret, mfa_enabled, created_at, updated_at, created_by, mfa_last_step, status, kind
 FROM users
 WHERE LOWER(email) = LOWER($1)
 `
@@ -83,12 +105,42 @@ func (q *Queries) GetUserByEmail(ctx context.Context, lower string) (User, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.CreatedBy,
+		&i.MfaLastStep,
+		&i.Status,
+		&i.Kind,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, first_name, last_name, email, password_hash, mfa_secret, mfa_enabled, created_at, updated_at, created_by, mfa_last_step, status, kind
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.PasswordHash,
+		&i.MfaSecret,
+		&i.MfaEnabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CreatedBy,
+		&i.MfaLastStep,
+		&i.Status,
+		&i.Kind,
 	)
 	return i, err
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT id, first_name, last_name, email, password_hash, mfa_secret, mfa_enabled, created_at, updated_at, created_by
+SELECT id, first_name, last_name, email, password_hash, mfa_secret, mfa_enabled, created_at, updated_at, created_by, mfa_last_step, status, kind
 FROM users
 ORDER BY created_at DESC
 `
@@ -113,6 +165,9 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.CreatedBy,
+			&i.MfaLastStep,
+			&i.Status,
+			&i.Kind,
 		); err != nil {
 			return nil, err
 		}
@@ -126,3 +181,39 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 	}
 	return items, nil
 }
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users
+SET password_hash = $1
+WHERE id = $2
+  AND password_hash = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+// Only replaces the hash it was computed from, so a concurrent password change wins
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID           uuid.UUID
+	PasswordHash string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.PasswordHash)
+	return err
+}
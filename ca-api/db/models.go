@@ -6,11 +6,224 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Name        string
+	Prefix      string
+	SecretHash  []byte
+	Permissions json.RawMessage
+	RotatedFrom uuid.NullUUID
+	CreatedBy   uuid.NullUUID
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LastUsedAt  sql.NullTime
+	RevokedAt   sql.NullTime
+}
+
+type AuditEvent struct {
+	ID        int64
+	EventType string
+	ActorID   uuid.NullUUID
+	SubjectID uuid.NullUUID
+	IpAddress sql.NullString
+	UserAgent sql.NullString
+	Metadata  json.RawMessage
+	CreatedAt time.Time
+}
+
+type BatchItem struct {
+	JobID         uuid.UUID
+	Line          int32
+	Hostname      string
+	PublicKey     string
+	Status        string
+	Error         sql.NullString
+	CertificateID uuid.NullUUID
+}
+
+type BatchJob struct {
+	ID          uuid.UUID
+	Template    string
+	Status      string
+	Total       int32
+	Signed      int32
+	Failed      int32
+	SubmittedBy uuid.UUID
+	CreatedAt   time.Time
+	FinishedAt  sql.NullTime
+}
+
+type Certificate struct {
+	ID             uuid.UUID
+	Serial         string
+	CertType       string
+	KeyID          string
+	Principals     json.RawMessage
+	KeyFingerprint string
+	CaFingerprint  string
+	Certificate    string
+	Source         string
+	RequestedBy    uuid.NullUUID
+	LeafIndex      int64
+	ValidAfter     time.Time
+	ValidBefore    time.Time
+	CreatedAt      time.Time
+}
+
+type EnrollmentChallenge struct {
+	ID            uuid.UUID
+	Type          string
+	Hostname      string
+	PublicKey     string
+	Token         string
+	Status        string
+	Error         sql.NullString
+	CertificateID uuid.NullUUID
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	ValidatedAt   sql.NullTime
+}
+
+type Invitation struct {
+	ID             uuid.UUID
+	TokenHash      []byte
+	Email          string
+	OrganizationID uuid.NullUUID
+	Roles          json.RawMessage
+	InvitedBy      uuid.UUID
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	AcceptedAt     sql.NullTime
+	RevokedAt      sql.NullTime
+}
+
+type JwtSigningKey struct {
+	Kid         string
+	PrivateKey  string
+	CreatedAt   time.Time
+	ActivatedAt sql.NullTime
+	RetiredAt   sql.NullTime
+}
+
+type LoginThrottle struct {
+	Key               string
+	Failures          int32
+	LastFailureAt     time.Time
+	PreviousFailureAt sql.NullTime
+}
+
+type MfaChallenge struct {
+	TokenHash []byte
+	UserID    uuid.UUID
+	Attempts  int32
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type MfaRecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type OfflineBundle struct {
+	ID         string
+	Payload    []byte
+	ExportedBy uuid.NullUUID
+	CreatedAt  time.Time
+	ImportedAt sql.NullTime
+}
+
+type OfflineRequest struct {
+	ID              uuid.UUID
+	PublicKey       string
+	CertType        string
+	KeyID           string
+	Principals      json.RawMessage
+	ValiditySeconds int32
+	Status          string
+	RequestedBy     uuid.UUID
+	DecidedBy       uuid.NullUUID
+	BundleID        sql.NullString
+	CertificateID   uuid.NullUUID
+	CreatedAt       time.Time
+}
+
+type OidcLoginState struct {
+	StateHash    []byte
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	LinkUserID   uuid.NullUUID
+}
+
+type RefreshToken struct {
+	Jti       string
+	FamilyID  uuid.UUID
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshTokenFamily struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	CreatedAt     time.Time
+	RevokedAt     sql.NullTime
+	RevokedReason sql.NullString
+}
+
+type Role struct {
+	ID          uuid.UUID
+	Name        string
+	Permissions json.RawMessage
+	IsSystem    bool
+	CreatedAt   time.Time
+}
+
+type SamlRequest struct {
+	RelayStateHash []byte
+	RequestID      string
+	Provider       string
+	ExpiresAt      time.Time
+	LinkUserID     uuid.NullUUID
+}
+
+type Session struct {
+	FamilyID   uuid.UUID
+	UserID     uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+type TransparencyLog struct {
+	LeafIndex   int64
+	Certificate string
+	LeafHash    []byte
+	CreatedAt   time.Time
+}
+
+type TransparencyLogHead struct {
+	TreeSize    int64
+	TimestampMs int64
+	RootHash    []byte
+	Signature   []byte
+	CreatedAt   time.Time
+}
+
 type User struct {
 	ID           uuid.UUID
 	FirstName    string
@@ -22,4 +235,49 @@ type User struct {
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	CreatedBy    uuid.NullUUID
+	MfaLastStep  sql.NullInt64
+	Status       string
+	Kind         string
+}
+
+type UserIdentity struct {
+	Provider    string
+	Subject     string
+	UserID      uuid.UUID
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type UserRole struct {
+	UserID    uuid.UUID
+	RoleID    uuid.UUID
+	GrantedBy uuid.NullUUID
+	GrantedAt time.Time
+	ExpiresAt sql.NullTime
+	Source    string
+}
+
+type WebauthnChallenge struct {
+	Challenge    []byte
+	Ceremony     string
+	UserID       uuid.NullUUID
+	MfaTokenHash []byte
+	ExpiresAt    time.Time
+	UsedAt       sql.NullTime
+}
+
+type WebauthnCredential struct {
+	ID                uuid.UUID
+	UserID            uuid.UUID
+	Name              string
+	CredentialID      []byte
+	PublicKey         []byte
+	SignCount         int64
+	Aaguid            []byte
+	AttestationFormat string
+	AttestationType   string
+	BackupEligible    bool
+	CreatedAt         time.Time
+	LastUsedAt        sql.NullTime
 }
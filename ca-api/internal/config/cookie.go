@@ -8,11 +8,12 @@ import (
 )
 
 func DefaultCookieConfig() auth.SecureCookieConfig {
+	// __Host- cookies are only accepted by browsers with Path=/ and no Domain
 	return auth.SecureCookieConfig{
 		TokenName: "__Host-refresh-token",
 		Domain:    "",
-		Path:      "/auth/refresh",
-		MaxAge:    15 * 60,
+		Path:      "/",
+		MaxAge:    uint32(7 * 24 * time.Hour / time.Second),
 		Secure:    true,
 		HttpOnly:  true,
 		SameSite:  http.SameSiteStrictMode,
@@ -26,11 +27,25 @@ func SetTokenCookies(w http.ResponseWriter, refreshToken string, config auth.Sec
 		Name:     config.TokenName,
 		Value:    refreshToken,
 		Domain:   config.Domain,
-		Path:     "/auth/refresh",
-		MaxAge:   int(7 * 24 * time.Hour / time.Second),
+		Path:     config.Path,
+		MaxAge:   int(config.MaxAge),
 		Secure:   config.Secure,
 		HttpOnly: config.HttpOnly,
 		SameSite: config.SameSite,
 	}
 	http.SetCookie(w, refreshCookie)
 }
+
+// ClearTokenCookies expires the refresh token cookie
+func ClearTokenCookies(w http.ResponseWriter, config auth.SecureCookieConfig) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     config.TokenName,
+		Value:    "",
+		Domain:   config.Domain,
+		Path:     config.Path,
+		MaxAge:   -1,
+		Secure:   config.Secure,
+		HttpOnly: config.HttpOnly,
+		SameSite: config.SameSite,
+	})
+}
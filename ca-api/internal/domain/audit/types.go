@@ -0,0 +1,42 @@
+// internal/domain/audit/types.go
+package audit
+
+import "github.com/google/uuid"
+
+type EventType string
+
+const (
+	APIKeyCreated               EventType = "api_key.created"
+	APIKeyRevoked               EventType = "api_key.revoked"
+	APIKeyRotated               EventType = "api_key.rotated"
+	CertificateRequestApproved  EventType = "certificate_request.approved"
+	CertificateRequestRejected  EventType = "certificate_request.rejected"
+	EmailVerified               EventType = "email.verified"
+	GitSigningCertificateIssued EventType = "git_signing_certificate.issued"
+	IdentityLinked              EventType = "identity.linked"
+	InvitationAccepted          EventType = "invitation.accepted"
+	InvitationCreated           EventType = "invitation.created"
+	InvitationRevoked           EventType = "invitation.revoked"
+	LoginLocked                 EventType = "login.locked"
+	LoginUnlocked               EventType = "login.unlocked"
+	MFARecoveryCodeUsed         EventType = "mfa.recovery_code_used"
+	MFARecoveryCodesRegenerated EventType = "mfa.recovery_codes_regenerated"
+	OfflineBundleExported       EventType = "offline_bundle.exported"
+	OfflineBundleImported       EventType = "offline_bundle.imported"
+	PasskeyRegistered           EventType = "passkey.registered"
+	PasskeyRemoved              EventType = "passkey.removed"
+	PasswordChanged             EventType = "password.changed"
+	PasswordReset               EventType = "password.reset"
+	ServiceAccountCreated       EventType = "service_account.created"
+	UserProvisioned             EventType = "user.provisioned"
+)
+
+// Event is one security-relevant action worth keeping a record of
+type Event struct {
+	Type      EventType
+	ActorID   uuid.UUID // user who acted; uuid.Nil when unauthenticated
+	SubjectID uuid.UUID // user acted upon; uuid.Nil when not user-specific
+	IPAddress string
+	UserAgent string
+	Metadata  map[string]any
+}
@@ -16,6 +16,8 @@ const (
 	CertRequest Permission = "cert:request"
 	CertApprove Permission = "cert:approve"
 	CertRevoke  Permission = "cert:revoke"
+	// Signs host certificates for any permitted name without enrollment or approval
+	CertIssueHost Permission = "cert:issue-host"
 
 	// Template permissions
 	TemplateView   Permission = "template:view"
@@ -27,10 +29,18 @@ const (
 	AuditExport Permission = "audit:export"
 )
 
+// AllPermissions lists every permission, in the order above
+var AllPermissions = []Permission{
+	CAView, CACreate, CAUpdate, CARotate, CADelete,
+	CertView, CertRequest, CertApprove, CertRevoke, CertIssueHost,
+	TemplateView, TemplateCreate, TemplateUpdate,
+	AuditView, AuditExport,
+}
+
 var DefaultRoles = map[string][]Permission{
 	"admin": {
 		CAView, CACreate, CAUpdate, CARotate, CADelete,
-		CertView, CertRequest, CertApprove, CertRevoke,
+		CertView, CertRequest, CertApprove, CertRevoke, CertIssueHost,
 		TemplateView, TemplateCreate, TemplateUpdate,
 		AuditView, AuditExport,
 	},
@@ -0,0 +1,31 @@
+// internal/domain/auth/principal.go
+package auth
+
+import (
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a protected request
+type Principal struct {
+	UserID      uuid.UUID
+	Email       string
+	FamilyID    string    // session (refresh token family) the access token belongs to
+	APIKeyID    uuid.UUID // key the caller authenticated with; uuid.Nil for sessions
+	Roles       []string
+	Permissions map[Permission]bool
+}
+
+func (p *Principal) HasPermission(perm Permission) bool {
+	return p.Permissions[perm]
+}
+
+// IsAPIKey reports whether the caller authenticated with an API key rather than a session
+func (p *Principal) IsAPIKey() bool {
+	return p.APIKeyID != uuid.Nil
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
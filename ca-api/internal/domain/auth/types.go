@@ -5,12 +5,31 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/webauthn"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Account statuses; a self-registered user stays pending until they verify
+// their email. Only active users may sign in or use their tokens.
+const (
+	UserStatusPending   = "pending"
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusDisabled  = "disabled"
+)
+
+// Kinds of user; service accounts have no usable password and sign in with API keys only
+const (
+	UserKindHuman   = "human"
+	UserKindService = "service"
+)
+
+// APIKeyPrefix starts every API key, so a bearer token can be told apart from a JWT
+const APIKeyPrefix = "sgn_"
+
 type SignupRequest struct {
 	Email           string `json:"email" binding:"required,email"`
-	Password        string `json:"password" binding:"required,min=8"`
+	Password        string `json:"password" binding:"required"` // strength is checked by the password policy
 	ConfirmPassword string `json:"confirm_password" binding:"required,eqfield=Password"`
 	FirstName       string `json:"fname" binding:"required"`
 	LastName        string `json:"lname" binding:"required"`
@@ -23,16 +42,23 @@ type LoginRequest struct {
 
 // SecureClaims for JWT with encrypted fields
 type SecureClaims struct {
-	UserIDEnc       string `json:"uid_enc"` // Encrypted UserID
-	RoleEnc         string `json:"rol_enc"` // Encrypted Role
-	TokenType       string `json:"typ"`     // "access" or "refresh"
-	Fingerprint     string `json:"fp"`      // Browser fingerprint hash
-	IPHash          string `json:"iph"`     // IP address hash
-	DecryptedUserID string // Not serialized, used after decryption
-	DecryptedRole   string // Not serialized, used after decryption
+	UserIDEnc       string        `json:"uid_enc"`       // Encrypted UserID
+	RoleEnc         string        `json:"rol_enc"`       // Encrypted Role
+	TokenType       string        `json:"typ"`           // "access" or "refresh"
+	Fingerprint     string        `json:"fp"`            // Browser fingerprint hash
+	IPHash          string        `json:"iph"`           // IP address hash
+	FamilyID        string        `json:"fam"`           // Refresh token family the token descends from
+	Cnf             *Confirmation `json:"cnf,omitempty"` // Key the token is bound to; nil for bearer tokens
+	DecryptedUserID string        // Not serialized, used after decryption
+	DecryptedRole   string        // Not serialized, used after decryption
 	jwt.RegisteredClaims
 }
 
+// Confirmation binds a token to a DPoP key (RFC 9449)
+type Confirmation struct {
+	JKT string `json:"jkt"` // RFC 7638 thumbprint of the client's public key
+}
+
 // SecureCookieConfig for secure cookies
 type SecureCookieConfig struct {
 	TokenName string
@@ -44,6 +70,35 @@ type SecureCookieConfig struct {
 	SameSite  http.SameSite
 }
 
+// IssuedTokens is what JWTManager hands back so the refresh token can be tracked
+type IssuedTokens struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshJTI       string
+	RefreshExpiresAt time.Time
+	TokenType        string // "DPoP" when bound to the client's key, otherwise "Bearer"
+}
+
+// JWK is the public half of a token signing key, as RFC 7517 describes it
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+// JWKS lists every key a live token may be signed with
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type TokenPair struct {
 	AccessToken  string    `json:"access_token"`
 	RefreshToken string    `json:"refresh_token"`
@@ -52,11 +107,169 @@ type TokenPair struct {
 	ExpiresAt    time.Time `json:"expires_at"`
 }
 
+type UserInfo struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
 type AuthResponse struct {
-	// User         *UserInfo  `json:"user"`
+	User         *UserInfo  `json:"user"`
 	Tokens       *TokenPair `json:"tokens"`
 	RequiresMFA  bool       `json:"requires_mfa,omitempty"`
 	MFAChallenge string     `json:"mfa_challenge,omitempty"`
+	MFAMethods   []string   `json:"mfa_methods,omitempty"` // ways the challenge can be answered
+}
+
+// MFAEnrollResponse carries a new TOTP secret; it is only shown once
+type MFAEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// MFAVerifyRequest redeems the challenge returned by Login when MFA is enabled.
+// Exactly one of Code, RecoveryCode and Passkey must be set.
+type MFAVerifyRequest struct {
+	MFAChallenge string                        `json:"mfa_challenge" binding:"required"`
+	Code         string                        `json:"code" binding:"omitempty,len=6,numeric"`
+	RecoveryCode string                        `json:"recovery_code"`
+	Passkey      *webauthn.AssertionCredential `json:"passkey"`
+}
+
+// ReauthRequest confirms a sensitive change with the current password
+type ReauthRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// ChangePasswordRequest replaces the caller's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// EmailRequest asks for a verification or password reset email
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// VerifyEmailRequest redeems the token from a verification email
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResetPasswordRequest redeems the token from a password reset email
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// CreateInvitationRequest invites someone to create an account (admin)
+type CreateInvitationRequest struct {
+	Email          string   `json:"email" binding:"required,email"`
+	OrganizationID string   `json:"organization_id" binding:"omitempty,uuid"`
+	Roles          []string `json:"roles" binding:"required,min=1,dive,required"`
+	ExpiresInHours int      `json:"expires_in_hours" binding:"omitempty,min=1,max=720"` // defaults to 72
+}
+
+// AcceptInvitationRequest creates the invited account
+type AcceptInvitationRequest struct {
+	Token     string `json:"token" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+	FirstName string `json:"fname" binding:"required"`
+	LastName  string `json:"lname" binding:"required"`
+}
+
+// InvitationInfo describes a pending invitation; the token is only ever emailed
+type InvitationInfo struct {
+	ID             string    `json:"id"`
+	Email          string    `json:"email"`
+	OrganizationID string    `json:"organization_id,omitempty"`
+	Roles          []string  `json:"roles"`
+	InvitedBy      string    `json:"invited_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// CreateServiceAccountRequest creates a non-human user for automation (admin)
+type CreateServiceAccountRequest struct {
+	Name  string   `json:"name" binding:"required,max=100"`
+	Roles []string `json:"roles" binding:"required,min=1,dive,required"`
+}
+
+// ServiceAccountInfo describes a service account
+type ServiceAccountInfo struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateAPIKeyRequest issues a key for a service account, limited to Permissions (admin)
+type CreateAPIKeyRequest struct {
+	Name          string       `json:"name" binding:"required,max=100"`
+	Permissions   []Permission `json:"permissions" binding:"required,min=1,dive,required"`
+	ExpiresInDays int          `json:"expires_in_days" binding:"omitempty,min=1,max=365"` // defaults to 90
+}
+
+// RotateAPIKeyRequest replaces a key; the old one keeps working for OverlapHours
+type RotateAPIKeyRequest struct {
+	OverlapHours  int `json:"overlap_hours" binding:"omitempty,min=1,max=720"`   // defaults to 24
+	ExpiresInDays int `json:"expires_in_days" binding:"omitempty,min=1,max=365"` // defaults to 90
+}
+
+// APIKeyInfo describes an API key; the secret is never stored
+type APIKeyInfo struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Prefix      string       `json:"prefix"`
+	Permissions []Permission `json:"permissions"`
+	RotatedFrom string       `json:"rotated_from,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	LastUsedAt  *time.Time   `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time   `json:"revoked_at,omitempty"`
+}
+
+// APIKeyResponse carries a new key; it is only shown once
+type APIKeyResponse struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+// RecoveryCodesResponse carries new recovery codes; they are only shown once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ExternalIdentity is a user as vouched for by an external identity provider
+type ExternalIdentity struct {
+	Source    string // provider key, e.g. "oidc:corp"; also tags the roles it grants
+	Subject   string // provider's stable user id
+	Email     string // must already be verified by the provider
+	FirstName string
+	LastName  string
+	Roles     []string // Signee roles the provider's groups map to
+
+	// Authoritative sources own Email's domain outright, so an account that
+	// already has the email is taken to be this identity's. Others may only
+	// be linked to an existing account by its owner, from a session.
+	Authoritative bool
+}
+
+// SessionInfo describes one logged-in device
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
 }
 
 type PassConfig struct {
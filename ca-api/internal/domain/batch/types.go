@@ -0,0 +1,57 @@
+// internal/domain/batch/types.go
+package batch
+
+import "time"
+
+// HostTemplate constrains what a batch may issue
+type HostTemplate struct {
+	Name            string        `json:"name"`
+	AllowedDomains  []string      `json:"allowed_domains"` // hostname must equal or end in one of these
+	AllowedKeyTypes []string      `json:"allowed_key_types"`
+	ValidityHours   int           `json:"validity_hours"`
+	Validity        time.Duration `json:"-"` // derived from ValidityHours when loaded
+}
+
+// Item is one host key to sign, parsed from a JSONL or CSV upload
+type Item struct {
+	Line      int    `json:"line"`
+	Hostname  string `json:"hostname"`
+	PublicKey string `json:"public_key"`
+	ParseErr  string `json:"-"` // set when the line itself could not be read
+}
+
+type ItemStatus string
+
+const (
+	ItemPending ItemStatus = "pending"
+	ItemSigned  ItemStatus = "signed"
+	ItemFailed  ItemStatus = "failed"
+)
+
+type ItemResult struct {
+	Line        int        `json:"line"`
+	Hostname    string     `json:"hostname"`
+	Status      ItemStatus `json:"status"`
+	Certificate string     `json:"certificate,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+)
+
+type Job struct {
+	ID         string       `json:"id"`
+	Template   string       `json:"template"`
+	Status     JobStatus    `json:"status"`
+	Total      int          `json:"total"`
+	Signed     int          `json:"signed"`
+	Failed     int          `json:"failed"`
+	CreatedAt  time.Time    `json:"created_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Results    []ItemResult `json:"results,omitempty"`
+}
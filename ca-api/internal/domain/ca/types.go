@@ -0,0 +1,28 @@
+// internal/domain/ca/types.go
+package ca
+
+import "time"
+
+// Source records which path a certificate was issued through
+type Source string
+
+const (
+	SourceEnroll  Source = "enroll"  // host proved control of its hostname
+	SourceOffline Source = "offline" // signed by the air-gapped CA and imported
+	SourceBatch   Source = "batch"   // bulk host signing job
+	SourceGitSign Source = "git_signing"
+)
+
+// Certificate is an issued certificate as kept in the inventory
+type Certificate struct {
+	ID          string    `json:"id"`
+	Serial      string    `json:"serial"`
+	CertType    string    `json:"cert_type"` // "user" or "host"
+	KeyID       string    `json:"key_id"`
+	Principals  []string  `json:"principals"`
+	Certificate string    `json:"certificate"` // authorized_keys format
+	Source      Source    `json:"source"`
+	LeafIndex   int64     `json:"leaf_index"` // position in the transparency log
+	ValidAfter  time.Time `json:"valid_after"`
+	ValidBefore time.Time `json:"valid_before"`
+}
@@ -0,0 +1,45 @@
+// internal/domain/enroll/types.go
+package enroll
+
+import "time"
+
+type ChallengeType string
+
+const (
+	// HTTP01 requires the host to serve the key authorization on a well-known path
+	HTTP01 ChallengeType = "http-01"
+	// SSHHostKey has Signee connect back over SSH and compare the presented host key
+	SSHHostKey ChallengeType = "ssh-hostkey"
+)
+
+// WellKnownPath is where hosts serve HTTP01 key authorizations
+const WellKnownPath = "/.well-known/signee-challenge/"
+
+type ChallengeStatus string
+
+const (
+	ChallengePending ChallengeStatus = "pending"
+	ChallengeValid   ChallengeStatus = "valid"
+	ChallengeInvalid ChallengeStatus = "invalid"
+	ChallengeExpired ChallengeStatus = "expired"
+)
+
+// Challenge binds a hostname and the host public key awaiting a certificate
+type Challenge struct {
+	ID               string          `json:"id"`
+	Type             ChallengeType   `json:"type"`
+	Hostname         string          `json:"hostname"`
+	PublicKey        string          `json:"public_key"` // authorized_keys format
+	Token            string          `json:"token"`
+	KeyAuthorization string          `json:"key_authorization,omitempty"` // what HTTP01 hosts serve at WellKnownPath+Token
+	Status           ChallengeStatus `json:"status"`
+	Error            string          `json:"error,omitempty"`       // why verification failed
+	Certificate      string          `json:"certificate,omitempty"` // host certificate, once valid
+	ExpiresAt        time.Time       `json:"expires_at"`
+}
+
+type NewChallengeRequest struct {
+	Hostname  string        `json:"hostname" binding:"required,hostname_rfc1123"`
+	PublicKey string        `json:"public_key" binding:"required"`
+	Type      ChallengeType `json:"type" binding:"required,oneof=http-01 ssh-hostkey"`
+}
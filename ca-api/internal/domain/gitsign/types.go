@@ -0,0 +1,45 @@
+// internal/domain/gitsign/types.go
+package gitsign
+
+import "time"
+
+// TemplateType identifies SSH signing certificates among certificate templates
+const TemplateType = "ssh_signing"
+
+// DefaultNamespace is the ssh-keygen -Y namespace git uses for commit signatures
+const DefaultNamespace = "git"
+
+// SigningTemplate describes SSH certificates issued for commit signing
+type SigningTemplate struct {
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace"`
+	Validity  time.Duration `json:"validity"`
+}
+
+// Contributor is someone whose commits the allowed_signers file should accept
+type Contributor struct {
+	Email       string    `json:"email"`
+	ValidAfter  time.Time `json:"valid_after"`  // zero accepts signatures from any time
+	ValidBefore time.Time `json:"valid_before"` // zero means the CA's own expiry applies
+}
+
+// NewCertificateRequest asks for a signing certificate for the caller's own email
+type NewCertificateRequest struct {
+	PublicKey string `json:"public_key" binding:"required"` // authorized_keys format
+}
+
+// AllowedSignersRequest names a repository's contributors, typically the
+// output of git log --format=%ae
+type AllowedSignersRequest struct {
+	Namespace    string   `json:"namespace"` // DefaultNamespace when empty
+	Contributors []string `json:"contributors" binding:"required,min=1,max=10000,dive,required,email"`
+}
+
+// AllowedSigner is a single line of an allowed_signers file
+type AllowedSigner struct {
+	Principals  []string
+	Namespaces  []string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	CAKey       string // authorized_keys format, without comment
+}
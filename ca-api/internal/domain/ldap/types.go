@@ -0,0 +1,46 @@
+// internal/domain/ldap/types.go
+package ldap
+
+// DirectoryConfig describes one LDAP or Active Directory server and the email
+// domains whose users it authenticates
+type DirectoryConfig struct {
+	Name    string   `json:"name"`    // used to tag the roles it grants
+	Domains []string `json:"domains"` // email domains this directory owns; their users never use local passwords
+
+	URL        string `json:"url"`          // ldaps://host:636 or ldap://host:389
+	StartTLS   bool   `json:"start_tls"`    // upgrade an ldap:// connection; plaintext binds are refused
+	CACertFile string `json:"ca_cert_file"` // PEM bundle; empty to use the system roots
+	Timeout    int    `json:"timeout"`      // seconds, defaults to 10
+
+	// Direct bind: the user's DN (or AD UPN) built from their login, e.g.
+	// "uid={username},ou=people,dc=example,dc=com" or "{email}"
+	UserDNTemplate string `json:"user_dn_template"`
+
+	// Search-then-bind, used when no template is set
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	BaseDN       string `json:"base_dn"`
+	UserFilter   string `json:"user_filter"` // defaults to "(mail={email})"
+
+	// Groups come from GroupsAttribute on the user, or from a search under GroupBaseDN when set
+	GroupsAttribute string `json:"groups_attribute"` // defaults to "memberOf"
+	GroupBaseDN     string `json:"group_base_dn"`
+	GroupFilter     string `json:"group_filter"` // defaults to "(member={dn})"
+
+	FirstNameAttribute string `json:"first_name_attribute"` // defaults to "givenName"
+	LastNameAttribute  string `json:"last_name_attribute"`  // defaults to "sn"
+	IDAttribute        string `json:"id_attribute"`         // stable id such as entryUUID or objectGUID; empty to use the DN
+
+	RoleMapping map[string]string `json:"role_mapping"` // group DN -> Signee role, matched case-insensitively
+	DefaultRole string            `json:"default_role"` // granted when no group matches
+}
+
+// UserEntry is what a successful authentication learns about the user
+type UserEntry struct {
+	DN        string
+	ID        string
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    []string // group DNs, lower-cased
+}
@@ -0,0 +1,18 @@
+// internal/domain/mail/types.go
+package mail
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// SMTPConfig is the relay outgoing mail is handed to
+type SMTPConfig struct {
+	Host     string
+	Port     int    // 465 for implicit TLS; anything else must offer STARTTLS
+	Username string // empty to send without authenticating
+	Password string
+	From     string
+}
@@ -0,0 +1,9 @@
+// internal/domain/notify/types.go
+package notify
+
+// Message is a plain-text notice for a user, typically delivered by email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
@@ -0,0 +1,82 @@
+// internal/domain/offline/types.go
+package offline
+
+import "time"
+
+const BundleVersion = 1
+
+// Request statuses: approved requests wait for the next export, and exported
+// ones are issued once the response for their bundle is imported
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+	RequestExported = "exported"
+	RequestIssued   = "issued"
+)
+
+// NewRequest asks for a certificate from the offline CA
+type NewRequest struct {
+	PublicKey     string   `json:"public_key" binding:"required"` // authorized_keys format
+	CertType      string   `json:"cert_type" binding:"required,oneof=user host"`
+	Principals    []string `json:"principals" binding:"required,min=1,max=32,dive,required"`
+	ValidityHours int      `json:"validity_hours" binding:"required,min=1,max=8760"` // counted from export
+}
+
+// RequestInfo describes a queued request
+type RequestInfo struct {
+	ID            string    `json:"id"`
+	PublicKey     string    `json:"public_key"`
+	CertType      string    `json:"cert_type"`
+	KeyID         string    `json:"key_id"`
+	Principals    []string  `json:"principals"`
+	ValidityHours int       `json:"validity_hours"`
+	Status        string    `json:"status"`
+	RequestedBy   string    `json:"requested_by"`
+	BundleID      string    `json:"bundle_id,omitempty"`
+	CertificateID string    `json:"certificate_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CertRequest is an approved request waiting for the offline CA
+type CertRequest struct {
+	ID          string    `json:"id"`
+	PublicKey   string    `json:"public_key"` // authorized_keys format
+	CertType    string    `json:"cert_type"`  // "user" or "host"
+	KeyID       string    `json:"key_id"`
+	Principals  []string  `json:"principals"`
+	ValidAfter  time.Time `json:"valid_after"`
+	ValidBefore time.Time `json:"valid_before"`
+}
+
+// SignedCert is the offline CA's answer to a CertRequest
+type SignedCert struct {
+	RequestID   string `json:"request_id"`
+	Certificate string `json:"certificate"` // authorized_keys format
+}
+
+// RequestBundle is exported by the API and carried to the offline machine
+type RequestBundle struct {
+	Version   int           `json:"version"`
+	ID        string        `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	CAKey     string        `json:"ca_key"` // public key expected to sign the requests
+	Requests  []CertRequest `json:"requests"`
+}
+
+// ResponseBundle is produced offline and imported back into the API
+type ResponseBundle struct {
+	Version        int          `json:"version"`
+	RequestBundle  string       `json:"request_bundle"`  // ID of the bundle being answered
+	RequestsDigest string       `json:"requests_digest"` // SHA-256 of the request payload
+	SignedAt       time.Time    `json:"signed_at"`
+	Certificates   []SignedCert `json:"certificates"`
+}
+
+// Envelope carries a payload and the signature over its exact bytes
+type Envelope struct {
+	Payload   string `json:"payload"`   // base64
+	SignKey   string `json:"sign_key"`  // authorized_keys format
+	Format    string `json:"format"`    // SSH signature algorithm
+	Signature string `json:"signature"` // base64
+}
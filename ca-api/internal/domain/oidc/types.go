@@ -0,0 +1,37 @@
+// internal/domain/oidc/types.go
+package oidc
+
+// ProviderConfig describes one OpenID Connect identity provider
+type ProviderConfig struct {
+	Name         string            `json:"name"` // used in URLs and to tag the roles it grants
+	Issuer       string            `json:"issuer"`
+	ClientID     string            `json:"client_id"`
+	ClientSecret string            `json:"client_secret"` // empty for public clients relying on PKCE alone
+	RedirectURL  string            `json:"redirect_url"`  // must point at /api/v1/auth/oidc/{name}/callback
+	Scopes       []string          `json:"scopes"`        // "openid" is always requested
+	EmailClaim   string            `json:"email_claim"`   // defaults to "email"
+	GroupsClaim  string            `json:"groups_claim"`  // defaults to "groups"
+	RoleMapping  map[string]string `json:"role_mapping"`  // provider group -> Signee role
+	DefaultRole  string            `json:"default_role"`  // granted when no group matches
+
+	// AllowedDomains are the email domains the provider may vouch for; its
+	// logins with any other email are refused. Required.
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// Discovery is the subset of the provider metadata document we use
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// UserClaims are the ID token claims Signee cares about
+type UserClaims struct {
+	Subject    string
+	Email      string
+	GivenName  string
+	FamilyName string
+	Groups     []string
+}
@@ -0,0 +1,30 @@
+// internal/domain/password/types.go
+package password
+
+// PolicyConfig is the password policy applied wherever a password is chosen
+type PolicyConfig struct {
+	MinLength         int     `json:"min_length"`          // characters, defaults to 8
+	MaxLength         int     `json:"max_length"`          // characters, defaults to 128; bounds the hashing cost
+	MinEntropyBits    float64 `json:"min_entropy_bits"`    // estimated guessing entropy, defaults to 35
+	AllowPersonalInfo bool    `json:"allow_personal_info"` // skip the email/name substring check
+
+	// Directory of HIBP-style range files: one file per five-hex-digit SHA-1
+	// prefix (e.g. "5BAA6"), each line "SUFFIX:COUNT". Empty falls back to a
+	// built-in list of a couple of hundred common passwords, so production
+	// deployments should point this at a full corpus.
+	BreachedPasswordsDir string `json:"breached_passwords_dir"`
+}
+
+// UserInfo is what the policy knows about the account choosing the password
+type UserInfo struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// Violation is one reason a password was rejected
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
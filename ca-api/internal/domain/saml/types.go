@@ -0,0 +1,35 @@
+// internal/domain/saml/types.go
+package saml
+
+// ProviderConfig describes one SAML 2.0 identity provider and the service
+// provider Signee presents to it
+type ProviderConfig struct {
+	Name string `json:"name"` // used in URLs and to tag the roles it grants
+
+	// Service provider side
+	EntityID string `json:"entity_id"` // usually the metadata URL
+	ACSURL   string `json:"acs_url"`   // must point at /api/v1/auth/saml/{name}/acs
+
+	// Identity provider side, copied from its metadata
+	IdPEntityID    string `json:"idp_entity_id"`
+	IdPSSOURL      string `json:"idp_sso_url"`     // HTTP-Redirect binding endpoint
+	IdPCertificate string `json:"idp_certificate"` // PEM; the only key assertions are checked against
+
+	EmailAttribute     string            `json:"email_attribute"` // empty to use an emailAddress NameID
+	FirstNameAttribute string            `json:"first_name_attribute"`
+	LastNameAttribute  string            `json:"last_name_attribute"`
+	GroupsAttribute    string            `json:"groups_attribute"`
+	RoleMapping        map[string]string `json:"role_mapping"` // IdP group -> Signee role
+	DefaultRole        string            `json:"default_role"` // granted when no group matches
+
+	// AllowedDomains are the email domains the IdP may vouch for; assertions
+	// for any other email are refused. Required.
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// Assertion is the verified content of a SAML assertion
+type Assertion struct {
+	NameID       string
+	NameIDFormat string
+	Attributes   map[string][]string
+}
@@ -0,0 +1,44 @@
+// internal/domain/translog/types.go
+package translog
+
+// SignedTreeHead commits to the log contents at TreeSize
+type SignedTreeHead struct {
+	TreeSize  int64  `json:"tree_size"`
+	Timestamp int64  `json:"timestamp"` // milliseconds since epoch
+	RootHash  []byte `json:"root_hash"`
+	Signature []byte `json:"signature"` // Ed25519 over the RFC 6962 TreeHeadSignature
+}
+
+type InclusionProof struct {
+	LeafIndex int64    `json:"leaf_index"`
+	TreeSize  int64    `json:"tree_size"`
+	LeafHash  []byte   `json:"leaf_hash"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+type ConsistencyProof struct {
+	First  int64    `json:"first"`
+	Second int64    `json:"second"`
+	Proof  [][]byte `json:"consistency"`
+}
+
+type LogEntry struct {
+	LeafIndex   int64  `json:"leaf_index"`
+	Certificate string `json:"certificate"`
+	LeafHash    []byte `json:"leaf_hash"`
+}
+
+type InclusionProofQuery struct {
+	LeafIndex int64 `form:"leaf_index" binding:"min=0"`
+	TreeSize  int64 `form:"tree_size" binding:"required,min=1"`
+}
+
+type ConsistencyProofQuery struct {
+	First  int64 `form:"first" binding:"required,min=1"`
+	Second int64 `form:"second" binding:"required,min=1"`
+}
+
+type EntriesQuery struct {
+	Start int64 `form:"start" binding:"min=0"`
+	End   int64 `form:"end" binding:"required,min=1"`
+}
@@ -0,0 +1,107 @@
+// internal/domain/webauthn/types.go
+package webauthn
+
+import "time"
+
+// Binary fields are base64url (unpadded) strings, matching the WebAuthn JSON
+// serialization that browsers' toJSON() and most client libraries produce.
+
+type RPEntity struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is passed to navigator.credentials.create({publicKey: ...})
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is passed to navigator.credentials.get({publicKey: ...})
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type AttestationResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+}
+
+// CreationResponse is the credential returned by navigator.credentials.create
+type CreationResponse struct {
+	ID       string              `json:"id"`
+	RawID    string              `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+type AssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// AssertionCredential is the credential returned by navigator.credentials.get
+type AssertionCredential struct {
+	ID       string            `json:"id"`
+	RawID    string            `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+type RegistrationRequest struct {
+	Name       string           `json:"name" binding:"max=100"`
+	Credential CreationResponse `json:"credential" binding:"required"`
+}
+
+type LoginRequest struct {
+	Credential AssertionCredential `json:"credential" binding:"required"`
+}
+
+// MFAOptionsRequest asks for assertion options to answer a login MFA challenge
+type MFAOptionsRequest struct {
+	MFAChallenge string `json:"mfa_challenge" binding:"required"`
+}
+
+// CredentialInfo describes a registered passkey without exposing key material
+type CredentialInfo struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	AttestationFormat string     `json:"attestation_format"`
+	AAGUID            string     `json:"aaguid"`
+	BackupEligible    bool       `json:"backup_eligible"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastUsedAt        *time.Time `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// Gin context key holding the *auth.Principal
+const PrincipalKey = "principal"
+
+// PrincipalLoader resolves validated claims into a principal with its effective
+// permissions. It returns sql.ErrNoRows when the user no longer exists.
+type PrincipalLoader func(ctx context.Context, claims *auth.SecureClaims) (*auth.Principal, error)
+
+// APIKeyLoader resolves an API key into a principal limited to the key's
+// permissions. It returns sql.ErrNoRows when the key is unknown, expired or revoked.
+type APIKeyLoader func(ctx context.Context, key string) (*auth.Principal, error)
+
+// AuthRequired rejects requests without a valid access token or API key.
+// Access tokens bound to a DPoP key must come with the DPoP scheme and a proof.
+func AuthRequired(jwtManager *jwt.JWTManager, load PrincipalLoader, loadKey APIKeyLoader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		scheme, token, ok := strings.Cut(header, " ")
+		dpop := strings.EqualFold(scheme, "DPoP")
+		if !ok || !(dpop || strings.EqualFold(scheme, "Bearer")) || token == "" {
+			unauthorized(c)
+			return
+		}
+		if dpop {
+			c.Header("DPoP-Nonce", jwtManager.DPoPNonce())
+		}
+
+		var principal *auth.Principal
+		var err error
+		if !dpop && strings.HasPrefix(token, auth.APIKeyPrefix) {
+			principal, err = loadKey(c, token)
+		} else {
+			var claims *auth.SecureClaims
+			claims, err = jwtManager.ValidateAccessToken(token, c.Request)
+			if err != nil {
+				log.Printf("ValidateAccessToken failed: %v", err)
+				if errors.Is(err, jwt.ErrDPoPNonce) {
+					c.Header("WWW-Authenticate", `DPoP error="use_dpop_nonce", error_description="Resource server requires nonce in DPoP proof"`)
+				}
+				unauthorized(c)
+				return
+			}
+			principal, err = load(c, claims)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			unauthorized(c)
+			return
+		}
+		if err != nil {
+			log.Printf("PrincipalLoader failed: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"code":    "INTERNAL_SERVER_ERROR",
+					"message": "Something went wrong. Please try again later.",
+					"status":  http.StatusInternalServerError,
+				},
+			})
+			return
+		}
+
+		c.Set(PrincipalKey, principal)
+		c.Next()
+	}
+}
+
+// SessionRequired rejects API key callers; use after AuthRequired on routes that
+// manage a person's own account and sessions
+func SessionRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := CurrentPrincipal(c)
+		if principal == nil {
+			unauthorized(c)
+			return
+		}
+		if principal.IsAPIKey() {
+			forbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission rejects principals lacking perm; use after AuthRequired
+func RequirePermission(perm auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := CurrentPrincipal(c)
+		if principal == nil {
+			unauthorized(c)
+			return
+		}
+		if !principal.HasPermission(perm) {
+			forbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole rejects principals that don't hold role; use after AuthRequired
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := CurrentPrincipal(c)
+		if principal == nil {
+			unauthorized(c)
+			return
+		}
+		if !principal.HasRole(role) {
+			forbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentPrincipal returns the caller stored by AuthRequired, or nil
+func CurrentPrincipal(c *gin.Context) *auth.Principal {
+	principal, _ := c.Get(PrincipalKey)
+	p, _ := principal.(*auth.Principal)
+	return p
+}
+
+func unauthorized(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error": gin.H{
+			"code":    "UNAUTHORIZED",
+			"message": "Authentication required.",
+			"status":  http.StatusUnauthorized,
+		},
+	})
+}
+
+func forbidden(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error": gin.H{
+			"code":    "FORBIDDEN",
+			"message": "You do not have permission to perform this action.",
+			"status":  http.StatusForbidden,
+		},
+	})
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Callers known to the stub loaders below
+var (
+	testAdmin    = uuid.MustParse("00000000-0000-0000-0000-00000000000a")
+	testViewer   = uuid.MustParse("00000000-0000-0000-0000-00000000000b")
+	testDisabled = uuid.MustParse("00000000-0000-0000-0000-00000000000c")
+	testBroken   = uuid.MustParse("00000000-0000-0000-0000-00000000000d")
+)
+
+const testAPIKey = auth.APIKeyPrefix + "0123456789ab_secret"
+
+func testJWTManager(t *testing.T) *jwt.JWTManager {
+	t.Helper()
+	dir := t.TempDir()
+	j, err := jwt.NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// loadPrincipal stands in for the database: the admin holds every
+// permission, the viewer only cert:view, and the disabled user is refused as
+// LoadPrincipal refuses anyone who isn't active
+func loadPrincipal(_ context.Context, claims *auth.SecureClaims) (*auth.Principal, error) {
+	switch uuid.MustParse(claims.DecryptedUserID) {
+	case testAdmin:
+		p := &auth.Principal{UserID: testAdmin, Roles: []string{"admin"}, Permissions: make(map[auth.Permission]bool)}
+		for _, perm := range auth.DefaultRoles["admin"] {
+			p.Permissions[perm] = true
+		}
+		return p, nil
+	case testViewer:
+		return &auth.Principal{UserID: testViewer, Roles: []string{"viewer"}, Permissions: map[auth.Permission]bool{auth.CertView: true}}, nil
+	case testBroken:
+		return nil, errors.New("database unavailable")
+	}
+	return nil, sql.ErrNoRows
+}
+
+// loadAPIKey knows one key, which carries every admin permission but, like
+// every API key principal, no roles
+func loadAPIKey(_ context.Context, key string) (*auth.Principal, error) {
+	if key != testAPIKey {
+		return nil, sql.ErrNoRows
+	}
+	p := &auth.Principal{UserID: uuid.New(), APIKeyID: uuid.New(), Permissions: make(map[auth.Permission]bool)}
+	for _, perm := range auth.DefaultRoles["admin"] {
+		p.Permissions[perm] = true
+	}
+	return p, nil
+}
+
+func testRouter(j *jwt.JWTManager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+
+	router := gin.New()
+	protected := router.Group("/", AuthRequired(j, loadPrincipal, loadAPIKey))
+	protected.GET("/me", ok)
+	protected.GET("/account", SessionRequired(), ok)
+	protected.GET("/audit", RequirePermission(auth.AuditView), ok)
+	protected.GET("/admin", RequireRole("admin"), ok)
+	return router
+}
+
+// accessToken is a session token for userID
+func accessToken(t *testing.T, j *jwt.JWTManager, userID uuid.UUID) string {
+	t.Helper()
+	tokens, err := j.GenerateTokens(userID.String(), "user@example.com", "", uuid.NewString(), httptest.NewRequest(http.MethodPost, "/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens.AccessToken
+}
+
+func TestAuthRequired(t *testing.T) {
+	j := testJWTManager(t)
+	router := testRouter(j)
+	refresh, err := j.GenerateTokens(testAdmin.String(), "admin@example.com", "admin", uuid.NewString(), httptest.NewRequest(http.MethodPost, "/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		header string
+		want   int
+	}{
+		"no header":          {"", http.StatusUnauthorized},
+		"no token":           {"Bearer ", http.StatusUnauthorized},
+		"other scheme":       {"Basic " + accessToken(t, j, testAdmin), http.StatusUnauthorized},
+		"garbage":            {"Bearer not-a-token", http.StatusUnauthorized},
+		"refresh token":      {"Bearer " + refresh.RefreshToken, http.StatusUnauthorized},
+		"another issuer":     {"Bearer " + accessToken(t, testJWTManager(t), testAdmin), http.StatusUnauthorized},
+		"unknown user":       {"Bearer " + accessToken(t, j, uuid.New()), http.StatusUnauthorized},
+		"disabled user":      {"Bearer " + accessToken(t, j, testDisabled), http.StatusUnauthorized},
+		"loader failure":     {"Bearer " + accessToken(t, j, testBroken), http.StatusInternalServerError},
+		"unknown api key":    {"Bearer " + auth.APIKeyPrefix + "0123456789ab_guess", http.StatusUnauthorized},
+		"valid token":        {"Bearer " + accessToken(t, j, testViewer), http.StatusNoContent},
+		"scheme in any case": {"bearer " + accessToken(t, j, testViewer), http.StatusNoContent},
+		"api key":            {"Bearer " + testAPIKey, http.StatusNoContent},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("GET /me = %d: %s, want %d", w.Code, w.Body, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermissionAndRole(t *testing.T) {
+	j := testJWTManager(t)
+	router := testRouter(j)
+	admin, viewer := "Bearer "+accessToken(t, j, testAdmin), "Bearer "+accessToken(t, j, testViewer)
+
+	for name, tc := range map[string]struct {
+		path, header string
+		want         int
+	}{
+		"permission held":    {"/audit", admin, http.StatusNoContent},
+		"permission missing": {"/audit", viewer, http.StatusForbidden},
+		"role held":          {"/admin", admin, http.StatusNoContent},
+		"role missing":       {"/admin", viewer, http.StatusForbidden},
+		// A key may carry admin permissions, but never the admin role
+		"api key permission": {"/audit", "Bearer " + testAPIKey, http.StatusNoContent},
+		"api key role":       {"/admin", "Bearer " + testAPIKey, http.StatusForbidden},
+		"api key session":    {"/account", "Bearer " + testAPIKey, http.StatusForbidden},
+		"session":            {"/account", viewer, http.StatusNoContent},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("Authorization", tc.header)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("GET %s = %d: %s, want %d", tc.path, w.Code, w.Body, tc.want)
+			}
+		})
+	}
+
+	// Mounted without AuthRequired, the checks refuse rather than pass
+	unguarded := gin.New()
+	unguarded.GET("/audit", RequirePermission(auth.AuditView), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	w := httptest.NewRecorder()
+	unguarded.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/audit", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("RequirePermission without a principal = %d, want 401", w.Code)
+	}
+}
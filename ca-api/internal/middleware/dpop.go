@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// DPoPProof verifies the DPoP proof (RFC 9449) sent to token endpoints, so the
+// tokens issued are bound to the client's key. Requests without a proof get
+// plain bearer tokens. Every response carries a nonce for the next proof.
+func DPoPProof(jwtManager *jwt.JWTManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("DPoP-Nonce", jwtManager.DPoPNonce())
+		if len(c.Request.Header.Values("DPoP")) == 0 {
+			c.Next()
+			return
+		}
+
+		jkt, err := jwtManager.VerifyDPoPProof(c.Request, "")
+		if errors.Is(err, jwt.ErrDPoPNonce) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "USE_DPOP_NONCE",
+					"message": "Retry with the nonce from the DPoP-Nonce header.",
+					"status":  http.StatusBadRequest,
+				},
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("VerifyDPoPProof failed: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_DPOP_PROOF",
+					"message": "Invalid DPoP proof.",
+					"status":  http.StatusBadRequest,
+				},
+			})
+			return
+		}
+
+		c.Request = c.Request.WithContext(jwt.WithDPoPKey(c.Request.Context(), jkt))
+		c.Next()
+	}
+}
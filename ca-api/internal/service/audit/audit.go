@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/google/uuid"
+)
+
+// Record writes an audit event. Pass transaction-bound queries so the event
+// commits or rolls back together with the action it describes.
+func Record(ctx context.Context, q *db.Queries, event audit.Event) error {
+	metadata := event.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit metadata: %v", err)
+	}
+
+	return q.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		EventType: string(event.Type),
+		ActorID:   nullUUID(event.ActorID),
+		SubjectID: nullUUID(event.SubjectID),
+		IpAddress: nullString(event.IPAddress),
+		UserAgent: nullString(event.UserAgent),
+		Metadata:  raw,
+	})
+}
+
+func nullUUID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: id != uuid.Nil}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/google/uuid"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	key, prefix, _, err := newAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, ok := parseAPIKey(key); !ok || got != prefix {
+		t.Fatalf("parseAPIKey(newAPIKey()) = %q, %v; want %q", got, ok, prefix)
+	}
+
+	for name, key := range map[string]string{
+		"empty":          "",
+		"no scheme":      "0123456789ab_secret",
+		"other scheme":   "ghp_0123456789ab_secret",
+		"no secret":      auth.APIKeyPrefix + "0123456789ab_",
+		"no separator":   auth.APIKeyPrefix + "0123456789absecret",
+		"short prefix":   auth.APIKeyPrefix + "0123_secret",
+		"long prefix":    auth.APIKeyPrefix + "0123456789abcd_secret",
+		"scheme only":    auth.APIKeyPrefix,
+		"session token":  "eyJhbGciOiJFUzI1NiJ9.e30.sig",
+		"prefix no tail": auth.APIKeyPrefix + "0123456789ab",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, ok := parseAPIKey(key); ok {
+				t.Fatalf("parseAPIKey(%q) accepted", key)
+			}
+		})
+	}
+}
+
+// apiKeyTest holds a fake database with a deployer role granting
+// cert:view and cert:request
+type apiKeyTest struct {
+	t       *testing.T
+	db      *fakeDB
+	queries *db.Queries
+}
+
+func newAPIKeyTest(t *testing.T) *apiKeyTest {
+	t.Helper()
+	fake, _, queries := newFakeDB(t, "deployer")
+	perms, err := json.Marshal([]auth.Permission{auth.CertView, auth.CertRequest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.roles[0].Permissions = perms
+	return &apiKeyTest{t: t, db: fake, queries: queries}
+}
+
+// account adds a user holding the deployer role
+func (a *apiKeyTest) account(u db.User) uuid.UUID {
+	id := a.db.addUser(u)
+	a.db.grants = append(a.db.grants, fakeGrant{userID: id, roleID: a.db.roles[0].ID, source: "local"})
+	return id
+}
+
+// issue stores a key for owner with perms, valid for a day, and returns it
+func (a *apiKeyTest) issue(owner uuid.UUID, perms ...auth.Permission) (string, *db.ApiKey) {
+	a.t.Helper()
+	key, prefix, secretHash, err := newAPIKey()
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	raw, err := json.Marshal(perms)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	a.db.apiKeys = append(a.db.apiKeys, db.ApiKey{
+		ID: uuid.New(), UserID: owner, Name: "deploy", Prefix: prefix, SecretHash: secretHash,
+		Permissions: raw, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(24 * time.Hour),
+	})
+	return key, &a.db.apiKeys[len(a.db.apiKeys)-1]
+}
+
+func (a *apiKeyTest) load(key string) (*auth.Principal, error) {
+	return LoadAPIKeyPrincipal(a.queries)(context.Background(), key)
+}
+
+// TestAPIKeyScopes checks that a key carries only the permissions it was
+// issued with that its account's roles still grant
+func TestAPIKeyScopes(t *testing.T) {
+	a := newAPIKeyTest(t)
+	robot := a.account(db.User{Email: "deploy@service.signee", Status: auth.UserStatusActive, Kind: auth.UserKindService})
+
+	for name, tc := range map[string]struct {
+		perms, want []auth.Permission
+	}{
+		"subset":          {[]auth.Permission{auth.CertView}, []auth.Permission{auth.CertView}},
+		"all held":        {[]auth.Permission{auth.CertRequest, auth.CertView}, []auth.Permission{auth.CertRequest, auth.CertView}},
+		"beyond the role": {[]auth.Permission{auth.CertView, auth.AuditView, auth.CADelete}, []auth.Permission{auth.CertView}},
+		"none held":       {[]auth.Permission{auth.AuditView}, nil},
+		"unscoped":        {nil, nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, apiKey := a.issue(robot, tc.perms...)
+			principal, err := a.load(key)
+			if err != nil {
+				t.Fatalf("LoadAPIKeyPrincipal() = %v", err)
+			}
+			got := slices.Sorted(maps.Keys(principal.Permissions))
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("permissions = %v, want %v", got, tc.want)
+			}
+			if principal.UserID != robot || principal.APIKeyID != apiKey.ID || len(principal.Roles) != 0 {
+				t.Fatalf("LoadAPIKeyPrincipal() = %+v, want the key's account without roles", principal)
+			}
+			if !apiKey.LastUsedAt.Valid {
+				t.Fatal("key not marked used")
+			}
+		})
+	}
+
+	// Narrowing the role narrows keys already issued under it
+	key, _ := a.issue(robot, auth.CertView, auth.CertRequest)
+	a.db.roles[0].Permissions = json.RawMessage(`["cert:view"]`)
+	principal, err := a.load(key)
+	if err != nil {
+		t.Fatalf("LoadAPIKeyPrincipal() = %v", err)
+	}
+	if got := slices.Sorted(maps.Keys(principal.Permissions)); !slices.Equal(got, []auth.Permission{auth.CertView}) {
+		t.Fatalf("permissions after narrowing the role = %v, want [cert:view]", got)
+	}
+}
+
+func TestAPIKeyRefused(t *testing.T) {
+	a := newAPIKeyTest(t)
+	robot := a.account(db.User{Email: "deploy@service.signee", Status: auth.UserStatusActive, Kind: auth.UserKindService})
+	human := a.account(db.User{Email: "alice@example.com", Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+	disabled := a.account(db.User{Email: "old@service.signee", Status: auth.UserStatusDisabled, Kind: auth.UserKindService})
+
+	for name, key := range map[string]func() string{
+		"revoked": func() string {
+			key, apiKey := a.issue(robot, auth.CertView)
+			apiKey.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return key
+		},
+		"expired": func() string {
+			key, apiKey := a.issue(robot, auth.CertView)
+			apiKey.ExpiresAt = time.Now().Add(-time.Minute)
+			return key
+		},
+		"wrong secret": func() string {
+			key, _ := a.issue(robot, auth.CertView)
+			return key + "x"
+		},
+		"unknown prefix": func() string {
+			key, _ := a.issue(robot, auth.CertView)
+			return auth.APIKeyPrefix + "000000000000" + key[len(auth.APIKeyPrefix)+12:]
+		},
+		"human owner": func() string {
+			key, _ := a.issue(human, auth.CertView)
+			return key
+		},
+		"disabled account": func() string {
+			key, _ := a.issue(disabled, auth.CertView)
+			return key
+		},
+		"malformed": func() string { return auth.APIKeyPrefix + "not-a-key" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			principal, err := a.load(key())
+			if !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("LoadAPIKeyPrincipal() = %+v, %v; want sql.ErrNoRows", principal, err)
+			}
+		})
+	}
+}
@@ -1,7 +1,54 @@
 package auth
 
-import "github.com/dhruvpatel-10/signee/ca-api/db"
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/notify"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/ldap"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/oidc"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/password"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/saml"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/webauthn"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/mail"
+	notifier "github.com/dhruvpatel-10/signee/ca-api/internal/service/notify"
+)
 
 type AuthService struct {
-	DB *db.Queries
+	Conn     *sql.DB
+	DB       *db.Queries
+	JWT      *jwt.JWTManager
+	Notifier notifier.Notifier
+	WebAuthn *webauthn.RelyingParty
+	OIDC     map[string]*oidc.Provider        // keyed by provider name
+	SAML     map[string]*saml.ServiceProvider // keyed by provider name
+
+	Directories map[string]*ldap.Directory // keyed by the email domains each owns
+	Passwords   *password.Policy           // applied wherever a password is chosen
+
+	// HashLimit bounds concurrent argon2id work and must be set. Peppers are
+	// server-side secrets mixed into every new hash, so a database dump alone
+	// can't be cracked; nil leaves hashes unpeppered.
+	HashLimit *HashLimiter
+	Peppers   *PepperRing
+
+	Mailer        mail.Mailer
+	EmailTokenKey []byte // signs email verification and password reset links
+	AppURL        string // frontend base URL the links and SSO logins point at
+
+	OpenSignup bool // when false, accounts are created only by invitation
+}
+
+// notifyUser sends a security notice; delivery failures are logged, never surfaced
+func (s *AuthService) notifyUser(ctx context.Context, user db.User, msg notify.Message) {
+	if s.Notifier == nil {
+		return
+	}
+	msg.To = user.Email
+	if err := s.Notifier.Notify(ctx, msg); err != nil {
+		log.Printf("Notify failed: %v", err)
+	}
 }
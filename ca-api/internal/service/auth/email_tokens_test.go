@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	domainpassword "github.com/dhruvpatel-10/signee/ca-api/internal/domain/password"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/password"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/mail"
+	"github.com/google/uuid"
+)
+
+// newMailTest is a tokenTest that mails links to an in-memory outbox
+func newMailTest(t *testing.T) (*tokenTest, *mail.MemoryMailer) {
+	t.Helper()
+	tt := newTokenTest(t)
+	policy, err := password.NewPolicy(domainpassword.PolicyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := &mail.MemoryMailer{}
+	tt.s.Mailer = outbox
+	tt.s.EmailTokenKey = []byte("email token test key")
+	tt.s.AppURL = "https://signee.example.com"
+	tt.s.Passwords = policy
+
+	tt.router.POST("/verify-email/request", tt.s.RequestEmailVerification)
+	tt.router.POST("/verify-email", tt.s.VerifyEmail)
+	tt.router.POST("/password/reset/request", tt.s.RequestPasswordReset)
+	tt.router.POST("/password/reset", tt.s.ResetPassword)
+	return tt, outbox
+}
+
+// mailedToken waits for the outbox to hold n messages and returns the token
+// linked from the last, failing the test if it isn't addressed to to
+func mailedToken(t *testing.T, outbox *mail.MemoryMailer, n int, to string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(outbox.Messages()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("outbox holds %d messages, want %d", len(outbox.Messages()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	msg := outbox.Messages()[n-1]
+	if msg.To != to {
+		t.Fatalf("message %d went to %s, want %s", n, msg.To, to)
+	}
+	_, link, ok := strings.Cut(msg.Body, "?token=")
+	if !ok {
+		t.Fatalf("message %d has no link: %s", n, msg.Body)
+	}
+	link, _, _ = strings.Cut(link, "\n")
+	token, err := url.QueryUnescape(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestEmailTokenRejected(t *testing.T) {
+	tt, _ := newMailTest(t)
+	alice := tt.alice
+	sign := func(s *AuthService, purpose string, user db.User, ttl time.Duration) string {
+		t.Helper()
+		token, err := s.signEmailToken(purpose, user, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := sign(tt.s, tokenResetPassword, alice, time.Hour)
+	otherKey := *tt.s
+	otherKey.EmailTokenKey = []byte("another deployment")
+	payload, mac, _ := strings.Cut(valid, ".")
+
+	for name, token := range map[string]string{
+		"expired":       sign(tt.s, tokenResetPassword, alice, -2*time.Second),
+		"other purpose": sign(tt.s, tokenVerifyEmail, alice, time.Hour),
+		"other key":     sign(&otherKey, tokenResetPassword, alice, time.Hour),
+		"unknown user":  sign(tt.s, tokenResetPassword, db.User{ID: uuid.New(), Email: alice.Email}, time.Hour),
+		"other payload": strings.Split(sign(tt.s, tokenResetPassword, alice, 2*time.Hour), ".")[0] + "." + mac,
+		"truncated mac": payload + "." + mac[:len(mac)-2],
+		"no mac":        payload,
+		"garbage":       "not.a-token",
+		"empty":         "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tt.s.readEmailToken(context.Background(), token, tokenResetPassword); !errors.Is(err, errInvalidEmailToken) {
+				t.Fatalf("readEmailToken() = %v, want errInvalidEmailToken", err)
+			}
+		})
+	}
+
+	if user, err := tt.s.readEmailToken(context.Background(), valid, tokenResetPassword); err != nil || user.ID != alice.ID {
+		t.Fatalf("readEmailToken(valid) = %v, %v; want alice", user.ID, err)
+	}
+}
+
+func TestVerifyEmailSingleUse(t *testing.T) {
+	tt, outbox := newMailTest(t)
+	tt.db.addUser(db.User{Email: "bob@example.com", FirstName: "Bob", Status: auth.UserStatusPending, Kind: auth.UserKindHuman})
+
+	if w := tt.post("/verify-email/request", auth.EmailRequest{Email: "bob@example.com"}); w.Code != http.StatusAccepted {
+		t.Fatalf("RequestEmailVerification = %d: %s", w.Code, w.Body)
+	}
+	token := mailedToken(t, outbox, 1, "bob@example.com")
+
+	if w := tt.post("/verify-email", auth.VerifyEmailRequest{Token: token}); w.Code != http.StatusNoContent {
+		t.Fatalf("VerifyEmail = %d: %s", w.Code, w.Body)
+	}
+	if status := tt.db.user("bob@example.com").Status; status != auth.UserStatusActive {
+		t.Fatalf("bob is %s after verifying, want active", status)
+	}
+	if !slices.Contains(tt.db.events, string(audit.EmailVerified)) {
+		t.Fatalf("audit events = %v, want the verification recorded", tt.db.events)
+	}
+
+	w := tt.post("/verify-email", auth.VerifyEmailRequest{Token: token})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "INVALID_TOKEN") {
+		t.Fatalf("VerifyEmail replayed = %d: %s, want 400 INVALID_TOKEN", w.Code, w.Body)
+	}
+
+	// Verified accounts aren't sent another link
+	tt.post("/verify-email/request", auth.EmailRequest{Email: "bob@example.com"})
+	tt.db.addUser(db.User{Email: "carol@example.com", Status: auth.UserStatusPending, Kind: auth.UserKindHuman})
+	tt.post("/verify-email/request", auth.EmailRequest{Email: "carol@example.com"})
+	mailedToken(t, outbox, 2, "carol@example.com")
+	if n := len(outbox.Messages()); n != 2 {
+		t.Fatalf("outbox holds %d messages, want bob's second request ignored", n)
+	}
+}
+
+// TestResetPasswordSingleUse checks that a reset link works once and signs
+// out every session the old password opened
+func TestResetPasswordSingleUse(t *testing.T) {
+	tt, outbox := newMailTest(t)
+	const newPassword = "a quite different passphrase"
+	sessions := []*auth.IssuedTokens{tt.signIn(), tt.signIn()}
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	if _, err := tt.s.JWT.ValidateAccessToken(sessions[0].AccessToken, r); err != nil {
+		t.Fatalf("ValidateAccessToken() before the reset = %v", err)
+	}
+
+	if w := tt.post("/password/reset/request", auth.EmailRequest{Email: "alice@example.com"}); w.Code != http.StatusAccepted {
+		t.Fatalf("RequestPasswordReset = %d: %s", w.Code, w.Body)
+	}
+	token := mailedToken(t, outbox, 1, "alice@example.com")
+
+	if w := tt.post("/password/reset", auth.ResetPasswordRequest{Token: token, NewPassword: newPassword}); w.Code != http.StatusNoContent {
+		t.Fatalf("ResetPassword = %d: %s", w.Code, w.Body)
+	}
+	if ok, err := tt.s.verifyPassword(context.Background(), newPassword, tt.db.user("alice@example.com").PasswordHash); err != nil || !ok {
+		t.Fatalf("verifyPassword(new password) = %v, %v", ok, err)
+	}
+
+	for i, tokens := range sessions {
+		if family := tt.familyOf(tokens.RefreshToken); !family.RevokedAt.Valid || family.RevokedReason.String != "password_reset" {
+			t.Fatalf("session %d = %+v, want it revoked by the reset", i, family)
+		}
+		if w := tt.refresh(tokens.RefreshToken); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Refresh in session %d after the reset = %d: %s, want 401", i, w.Code, w.Body)
+		}
+		if _, err := tt.s.JWT.ValidateAccessToken(tokens.AccessToken, r); err == nil {
+			t.Fatalf("ValidateAccessToken() in session %d after the reset succeeded", i)
+		}
+	}
+
+	w := tt.post("/password/reset", auth.ResetPasswordRequest{Token: token, NewPassword: "yet another fine passphrase"})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "INVALID_TOKEN") {
+		t.Fatalf("ResetPassword replayed = %d: %s, want 400 INVALID_TOKEN", w.Code, w.Body)
+	}
+
+	// Sessions started after the reset are unaffected
+	refreshed(t, tt.refresh(tt.signIn().RefreshToken))
+}
@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/config"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/notify"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	// errAccountExists means the identity is new but its email already belongs
+	// to an account, which only that account's owner may link it to
+	errAccountExists = errors.New("email belongs to an account the identity is not linked to")
+	errLinkRefused   = errors.New("account can't have external identities linked")
+	errIdentityInUse = errors.New("identity is linked to another account")
+)
+
+// provisionExternalUser finds or just-in-time creates the Signee user behind an
+// external identity and re-syncs the roles that provider manages for them
+func (s *AuthService) provisionExternalUser(ctx context.Context, ext auth.ExternalIdentity) (db.User, error) {
+	if ext.Subject == "" || ext.Email == "" {
+		return db.User{}, errors.New("external identity is missing subject or email")
+	}
+
+	tx, err := s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return db.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	user, err := linkedUser(ctx, q, ext)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = s.createExternalUser(ctx, q, ext)
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+
+	if err := syncSourceRoles(ctx, q, user.ID, ext.Source, ext.Roles); err != nil {
+		return db.User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+// linkedUser resolves the identity through an existing link. An account that
+// merely shares the email is only claimed for an authoritative source, and
+// never when it is a service account; anything else is errAccountExists.
+func linkedUser(ctx context.Context, q *db.Queries, ext auth.ExternalIdentity) (db.User, error) {
+	identity, err := q.GetUserIdentity(ctx, db.GetUserIdentityParams{Provider: ext.Source, Subject: ext.Subject})
+	if err == nil {
+		err = q.TouchUserIdentity(ctx, db.TouchUserIdentityParams{
+			Provider: ext.Source,
+			Subject:  ext.Subject,
+			Email:    ext.Email,
+		})
+		if err != nil {
+			return db.User{}, err
+		}
+		return q.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return db.User{}, err
+	}
+
+	user, err := q.GetUserByEmail(ctx, ext.Email)
+	if err != nil {
+		return db.User{}, err
+	}
+	if !ext.Authoritative || user.Kind != auth.UserKindHuman {
+		return db.User{}, errAccountExists
+	}
+	err = q.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		Provider: ext.Source,
+		Subject:  ext.Subject,
+		UserID:   user.ID,
+		Email:    ext.Email,
+	})
+	return user, err
+}
+
+// linkExternalIdentity links ext to the account of the signed-in user who
+// started the flow. Service accounts and accounts a directory owns take no links.
+func (s *AuthService) linkExternalIdentity(c *gin.Context, userID uuid.UUID, ext auth.ExternalIdentity) (db.User, error) {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return db.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	user, err := q.GetUserByID(c, userID)
+	if err != nil {
+		return db.User{}, err
+	}
+	if user.Kind != auth.UserKindHuman || s.directoryFor(user.Email) != nil {
+		return db.User{}, errLinkRefused
+	}
+
+	identity, err := q.GetUserIdentity(c, db.GetUserIdentityParams{Provider: ext.Source, Subject: ext.Subject})
+	if err == nil {
+		if identity.UserID != user.ID {
+			return db.User{}, errIdentityInUse
+		}
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return db.User{}, err
+	}
+
+	err = q.CreateUserIdentity(c, db.CreateUserIdentityParams{
+		Provider: ext.Source,
+		Subject:  ext.Subject,
+		UserID:   user.ID,
+		Email:    ext.Email,
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+	err = auditlog.Record(c, q, audit.Event{
+		Type:      audit.IdentityLinked,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"source": ext.Source, "subject": ext.Subject},
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func (s *AuthService) createExternalUser(ctx context.Context, q *db.Queries, ext auth.ExternalIdentity) (db.User, error) {
+	// Accounts created here never get a usable local password
+	passwordHash, err := unusablePasswordHash(s.Peppers.CurrentID())
+	if err != nil {
+		return db.User{}, err
+	}
+
+	firstName, lastName := ext.FirstName, ext.LastName
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(ext.Email, "@")
+	}
+
+	user, err := q.CreateUser(ctx, db.CreateUserParams{
+		FirstName:    firstName,
+		LastName:     lastName,
+		Email:        ext.Email,
+		PasswordHash: passwordHash,
+		MfaSecret:    sql.NullString{},
+		MfaEnabled:   sql.NullBool{},
+		CreatedBy:    uuid.NullUUID{},
+		Status:       auth.UserStatusActive, // the provider vouched for the email
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+
+	err = q.CreateUserIdentity(ctx, db.CreateUserIdentityParams{
+		Provider: ext.Source,
+		Subject:  ext.Subject,
+		UserID:   user.ID,
+		Email:    ext.Email,
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+
+	err = auditlog.Record(ctx, q, audit.Event{
+		Type:      audit.UserProvisioned,
+		SubjectID: user.ID,
+		Metadata:  map[string]any{"source": ext.Source},
+	})
+	return user, err
+}
+
+// syncSourceRoles makes the roles granted by source exactly roles. Grants from
+// other sources, including local ones, are left untouched.
+func syncSourceRoles(ctx context.Context, q *db.Queries, userID uuid.UUID, source string, roles []string) error {
+	err := q.DeleteUserRolesBySource(ctx, db.DeleteUserRolesBySourceParams{UserID: userID, Source: source})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range roles {
+		role, err := q.GetRoleByName(ctx, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("%s maps to unknown role %q; skipping", source, name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = q.GrantUserRoleFromSource(ctx, db.GrantUserRoleFromSourceParams{
+			UserID: userID,
+			RoleID: role.ID,
+			Source: source,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapGroups translates provider groups into Signee roles, falling back to
+// defaultRole when none match. Results are deduplicated.
+func mapGroups(groups []string, mapping map[string]string, defaultRole string) []string {
+	var roles []string
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		role, ok := mapping[group]
+		if !ok || seen[role] {
+			continue
+		}
+		seen[role] = true
+		roles = append(roles, role)
+	}
+	if len(roles) == 0 && defaultRole != "" {
+		roles = append(roles, defaultRole)
+	}
+	return roles
+}
+
+// unusablePasswordHash is a well-formed argon2id hash that no password matches.
+// Its hash bytes are random rather than computed, so it costs nothing to make
+// but as much as a real hash to check. keyID is the pepper version it claims.
+func unusablePasswordHash(keyID int) (string, error) {
+	salt, err := generateSalt(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password: %v", err)
+	}
+	hash := make([]byte, DefaultPassConfig.KeyLen)
+	if _, err := rand.Read(hash); err != nil {
+		return "", fmt.Errorf("failed to generate password: %v", err)
+	}
+	return encodeHash(salt, hash, keyID), nil
+}
+
+// completeSSOLogin is completeLogin for a browser coming back from a provider.
+// Nothing is rendered to that page: the refresh token goes into its cookie and
+// the browser moves on to the frontend, which redeems it at /auth/refresh. An
+// MFA challenge travels in the fragment so it stays out of logs and referrers.
+func (s *AuthService) completeSSOLogin(c *gin.Context, user db.User) {
+	switch user.Status {
+	case auth.UserStatusActive:
+	case auth.UserStatusPending:
+		s.ssoRedirectError(c, "EMAIL_NOT_VERIFIED")
+		return
+	default:
+		s.ssoRedirectError(c, "ACCOUNT_DISABLED")
+		return
+	}
+
+	methods, err := s.mfaMethods(c, user)
+	if err != nil {
+		log.Printf("mfaMethods failed: %v", err)
+		s.ssoRedirectError(c, "INTERNAL_SERVER_ERROR")
+		return
+	}
+	if len(methods) > 0 {
+		challenge, err := s.createMFAChallenge(c, user.ID)
+		if err != nil {
+			log.Printf("createMFAChallenge failed: %v", err)
+			s.ssoRedirectError(c, "INTERNAL_SERVER_ERROR")
+			return
+		}
+		fragment := url.Values{"challenge": {challenge}, "methods": {strings.Join(methods, ",")}}
+		c.Redirect(http.StatusFound, s.AppURL+"/login/mfa#"+fragment.Encode())
+		return
+	}
+
+	tokens, err := s.startTokenFamily(c, user)
+	if err != nil {
+		log.Printf("startTokenFamily failed: %v", err)
+		s.ssoRedirectError(c, "INTERNAL_SERVER_ERROR")
+		return
+	}
+	config.SetTokenCookies(c.Writer, tokens.RefreshToken, config.DefaultCookieConfig())
+	c.Redirect(http.StatusFound, s.AppURL+"/")
+}
+
+// finishSSOLink ends a link flow on the frontend's account page
+func (s *AuthService) finishSSOLink(c *gin.Context, userID uuid.UUID, ext auth.ExternalIdentity) {
+	user, err := s.linkExternalIdentity(c, userID, ext)
+	code := ""
+	switch {
+	case errors.Is(err, errLinkRefused):
+		code = "LINK_NOT_ALLOWED"
+	case errors.Is(err, errIdentityInUse):
+		code = "IDENTITY_IN_USE"
+	case err != nil:
+		log.Printf("linkExternalIdentity failed: %v", err)
+		code = "INTERNAL_SERVER_ERROR"
+	}
+	if code != "" {
+		c.Redirect(http.StatusFound, s.AppURL+"/account/identities?error="+url.QueryEscape(code))
+		return
+	}
+
+	s.notifyUser(c, user, notify.Message{
+		Subject: "A sign-in method was linked to your account",
+		Body:    "Your Signee account can now be signed in to through " + ext.Source + ". If this wasn't you, change your password and contact an administrator.",
+	})
+	c.Redirect(http.StatusFound, s.AppURL+"/account/identities?linked="+url.QueryEscape(ext.Source))
+}
+
+// emailAllowed reports whether a provider limited to domains may vouch for
+// email. A directory's domains are left to the directory.
+func (s *AuthService) emailAllowed(email string, domains []string) bool {
+	_, domain, ok := strings.Cut(email, "@")
+	return ok && slices.Contains(domains, strings.ToLower(domain)) && s.directoryFor(email) == nil
+}
+
+// ssoRedirectError sends the browser back to the frontend's login page with
+// an error code in place of the JSON error an API client would get
+func (s *AuthService) ssoRedirectError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, s.AppURL+"/login?error="+url.QueryEscape(code))
+}
+
+func ssoProviderNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"code":    "NOT_FOUND",
+			"message": "Unknown identity provider.",
+			"status":  http.StatusNotFound,
+		},
+	})
+}
@@ -0,0 +1,558 @@
+package auth
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/db/dbtest"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/google/uuid"
+)
+
+// fakeDB answers the sqlc queries behind logins from in-memory tables, so
+// the flows run end to end without Postgres. Queries it doesn't know fail the test.
+type fakeDB struct {
+	t *testing.T
+
+	mu         sync.Mutex
+	users      []db.User
+	identities []db.UserIdentity
+	roles      []db.Role
+	grants     []fakeGrant
+	oidcStates []db.OidcLoginState
+	challenges []db.MfaChallenge
+	recovery   []db.MfaRecoveryCode
+	families   []db.RefreshTokenFamily
+	refresh    []db.RefreshToken
+	sessions   []db.Session
+	samlReqs   []db.SamlRequest
+	apiKeys    []db.ApiKey
+	invites    []db.Invitation
+	throttles  map[string]db.LoginThrottle
+	events     []string // audit event types, in order
+
+	// after, if set, runs once each query has been answered, outside the
+	// lock, so a test can hold requests at a chosen point
+	after func(name string)
+}
+
+type fakeGrant struct {
+	userID, roleID uuid.UUID
+	source         string
+}
+
+// newFakeDB returns the fake with the given roles defined and a *sql.DB and
+// *db.Queries reading from it
+func newFakeDB(t *testing.T, roles ...string) (*fakeDB, *sql.DB, *db.Queries) {
+	t.Helper()
+	f := &fakeDB{t: t, throttles: make(map[string]db.LoginThrottle)}
+	for _, name := range roles {
+		f.roles = append(f.roles, db.Role{ID: uuid.New(), Name: name, Permissions: json.RawMessage("[]"), CreatedAt: time.Now()})
+	}
+	conn := dbtest.Open(t, f.run)
+	return f, conn, db.New(conn)
+}
+
+// addUser stores u under a new ID and returns the ID
+func (f *fakeDB) addUser(u db.User) uuid.UUID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u.ID = uuid.New()
+	f.users = append(f.users, u)
+	return u.ID
+}
+
+// user returns the user with email, failing the test if there isn't one
+func (f *fakeDB) user(email string) db.User {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, u := range f.users {
+		if u.Email == email {
+			return u
+		}
+	}
+	f.t.Fatalf("no user %s", email)
+	return db.User{}
+}
+
+// rolesOf lists the names of the roles source granted to userID
+func (f *fakeDB) rolesOf(userID uuid.UUID, source string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, g := range f.grants {
+		if g.userID == userID && g.source == source {
+			names = append(names, f.roleByID(g.roleID).Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (f *fakeDB) roleByID(id uuid.UUID) db.Role {
+	for _, r := range f.roles {
+		if r.ID == id {
+			return r
+		}
+	}
+	return db.Role{}
+}
+
+// run executes one sqlc query by name and returns its result rows
+func (f *fakeDB) run(name string, args []driver.Value) ([][]driver.Value, error) {
+	f.mu.Lock()
+	rows, err := f.answer(name, args)
+	after := f.after
+	f.mu.Unlock()
+	if after != nil {
+		after(name)
+	}
+	return rows, err
+}
+
+func (f *fakeDB) answer(name string, args []driver.Value) ([][]driver.Value, error) {
+	str := func(i int) string { s, _ := args[i].(string); return s }
+	id := func(i int) uuid.UUID { return uuid.MustParse(str(i)) }
+
+	switch name {
+	case "AcceptInvitation", "GetOpenInvitationByTokenHash":
+		hash, _ := args[0].([]byte)
+		for i, inv := range f.invites {
+			if string(inv.TokenHash) == string(hash) && !inv.AcceptedAt.Valid && !inv.RevokedAt.Valid && inv.ExpiresAt.After(time.Now()) {
+				if name == "AcceptInvitation" {
+					f.invites[i].AcceptedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				}
+				return [][]driver.Value{invitationRow(f.invites[i])}, nil
+			}
+		}
+		return nil, nil
+
+	case "ActivateUser":
+		for i, u := range f.users {
+			if u.ID == id(0) && u.Status == auth.UserStatusPending {
+				f.users[i].Status = auth.UserStatusActive
+				return [][]driver.Value{{}}, nil
+			}
+		}
+		return nil, nil
+
+	case "ClearLoginThrottle":
+		delete(f.throttles, str(0))
+		return nil, nil
+
+	case "ConsumeTOTPStep":
+		step, _ := args[0].(int64)
+		for i, u := range f.users {
+			if u.ID == id(1) && (!u.MfaLastStep.Valid || u.MfaLastStep.Int64 < step) {
+				f.users[i].MfaLastStep = sql.NullInt64{Int64: step, Valid: true}
+				return [][]driver.Value{{}}, nil
+			}
+		}
+		return nil, nil
+
+	case "CountWebAuthnCredentialsByUser":
+		return [][]driver.Value{{int64(0)}}, nil
+
+	case "CreateAuditEvent":
+		f.events = append(f.events, str(0))
+		return nil, nil
+
+	case "ConsumeOIDCLoginState":
+		hash, _ := args[0].([]byte)
+		for i, s := range f.oidcStates {
+			if string(s.StateHash) == string(hash) {
+				f.oidcStates = slices.Delete(f.oidcStates, i, i+1)
+				return [][]driver.Value{{s.StateHash, s.Provider, s.Nonce, s.CodeVerifier, s.ExpiresAt, nullable(s.LinkUserID)}}, nil
+			}
+		}
+		return nil, nil
+
+	case "CreateOIDCLoginState":
+		hash, _ := args[0].([]byte)
+		expires, _ := args[4].(time.Time)
+		var link uuid.NullUUID
+		if err := link.Scan(args[5]); err != nil {
+			return nil, err
+		}
+		f.oidcStates = append(f.oidcStates, db.OidcLoginState{
+			StateHash: hash, Provider: str(1), Nonce: str(2), CodeVerifier: str(3), ExpiresAt: expires, LinkUserID: link,
+		})
+		return nil, nil
+
+	case "ConsumeSAMLRequest":
+		hash, _ := args[0].([]byte)
+		for i, r := range f.samlReqs {
+			if string(r.RelayStateHash) == string(hash) {
+				f.samlReqs = slices.Delete(f.samlReqs, i, i+1)
+				return [][]driver.Value{{r.RelayStateHash, r.RequestID, r.Provider, r.ExpiresAt, nullable(r.LinkUserID)}}, nil
+			}
+		}
+		return nil, nil
+
+	case "CreateInvitation":
+		hash, _ := args[0].([]byte)
+		roles, _ := args[3].([]byte)
+		expires, _ := args[5].(time.Time)
+		var org uuid.NullUUID
+		if err := org.Scan(args[2]); err != nil {
+			return nil, err
+		}
+		inv := db.Invitation{
+			ID: uuid.New(), TokenHash: hash, Email: str(1), OrganizationID: org, Roles: roles, InvitedBy: id(4),
+			CreatedAt: time.Now(), ExpiresAt: expires,
+		}
+		f.invites = append(f.invites, inv)
+		return [][]driver.Value{invitationRow(inv)}, nil
+
+	case "CreateMFAChallenge":
+		hash, _ := args[0].([]byte)
+		expires, _ := args[2].(time.Time)
+		f.challenges = append(f.challenges, db.MfaChallenge{TokenHash: hash, UserID: id(1), CreatedAt: time.Now(), ExpiresAt: expires})
+		return nil, nil
+
+	case "CreateMFARecoveryCode":
+		f.recovery = append(f.recovery, db.MfaRecoveryCode{ID: uuid.New(), UserID: id(0), CodeHash: str(1), CreatedAt: time.Now()})
+		return nil, nil
+
+	case "CreateSAMLRequest":
+		hash, _ := args[0].([]byte)
+		expires, _ := args[3].(time.Time)
+		var link uuid.NullUUID
+		if err := link.Scan(args[4]); err != nil {
+			return nil, err
+		}
+		f.samlReqs = append(f.samlReqs, db.SamlRequest{
+			RelayStateHash: hash, RequestID: str(1), Provider: str(2), ExpiresAt: expires, LinkUserID: link,
+		})
+		return nil, nil
+
+	case "CreateSession":
+		f.sessions = append(f.sessions, db.Session{
+			FamilyID: id(0), UserID: id(1), UserAgent: str(2), IpAddress: str(3), CreatedAt: time.Now(), LastSeenAt: time.Now(),
+		})
+		return nil, nil
+
+	case "DeleteExpiredMFAChallenges", "DeleteExpiredOIDCLoginStates", "DeleteExpiredSAMLRequests", "DeleteStaleLoginThrottles":
+		return nil, nil
+
+	case "CreateRefreshToken":
+		expires, _ := args[2].(time.Time)
+		f.refresh = append(f.refresh, db.RefreshToken{Jti: str(0), FamilyID: id(1), IssuedAt: time.Now(), ExpiresAt: expires})
+		return nil, nil
+
+	case "CreateRefreshTokenFamily":
+		family := db.RefreshTokenFamily{ID: uuid.New(), UserID: id(0), CreatedAt: time.Now()}
+		f.families = append(f.families, family)
+		return [][]driver.Value{{family.ID.String(), family.UserID.String(), family.CreatedAt, nil, nil}}, nil
+
+	case "CreateUser":
+		u := db.User{
+			ID: uuid.New(), FirstName: str(0), LastName: str(1), Email: str(2), PasswordHash: str(3),
+			CreatedAt: time.Now(), UpdatedAt: time.Now(), Status: str(7), Kind: auth.UserKindHuman,
+		}
+		f.users = append(f.users, u)
+		return [][]driver.Value{userRow(u)}, nil
+
+	case "CreateUserIdentity":
+		f.identities = append(f.identities, db.UserIdentity{
+			Provider: str(0), Subject: str(1), UserID: id(2), Email: str(3), CreatedAt: time.Now(), LastLoginAt: time.Now(),
+		})
+		return nil, nil
+
+	case "DeleteMFARecoveryCodes":
+		f.recovery = slices.DeleteFunc(f.recovery, func(r db.MfaRecoveryCode) bool { return r.UserID == id(0) })
+		return nil, nil
+
+	case "DeleteUserRolesBySource":
+		f.grants = slices.DeleteFunc(f.grants, func(g fakeGrant) bool { return g.userID == id(0) && g.source == str(1) })
+		return nil, nil
+
+	case "EnsureLoginThrottle":
+		if _, ok := f.throttles[str(0)]; !ok {
+			f.throttles[str(0)] = db.LoginThrottle{Key: str(0), LastFailureAt: time.Now()}
+		}
+		return nil, nil
+
+	case "GetActiveAPIKeyByPrefix":
+		for _, k := range f.apiKeys {
+			if k.Prefix == str(0) && !k.RevokedAt.Valid && k.ExpiresAt.After(time.Now()) {
+				return [][]driver.Value{{
+					k.ID.String(), k.UserID.String(), k.Name, k.Prefix, k.SecretHash, []byte(k.Permissions),
+					nullable(k.RotatedFrom), nullable(k.CreatedBy), k.CreatedAt, k.ExpiresAt, nullable(k.LastUsedAt), nullable(k.RevokedAt),
+				}}, nil
+			}
+		}
+		return nil, nil
+
+	case "GetLoginThrottleForUpdate":
+		t, ok := f.throttles[str(0)]
+		if !ok {
+			return nil, nil
+		}
+		return [][]driver.Value{throttleRow(t)}, nil
+
+	case "GetMFAChallengeForUpdate":
+		if ch := f.challenge(args[0]); ch != nil {
+			return [][]driver.Value{{ch.TokenHash, ch.UserID.String(), int64(ch.Attempts), ch.CreatedAt, ch.ExpiresAt, nullable(ch.UsedAt)}}, nil
+		}
+		return nil, nil
+
+	case "GetRefreshTokenForUpdate":
+		for _, rt := range f.refresh {
+			if rt.Jti == str(0) {
+				family := f.family(rt.FamilyID)
+				return [][]driver.Value{{
+					rt.Jti, rt.FamilyID.String(), rt.IssuedAt, rt.ExpiresAt, nullable(rt.UsedAt), family.UserID.String(), nullable(family.RevokedAt),
+				}}, nil
+			}
+		}
+		return nil, nil
+
+	case "GetRoleByName":
+		for _, r := range f.roles {
+			if r.Name == str(0) {
+				return [][]driver.Value{{r.ID.String(), r.Name, []byte(r.Permissions), r.IsSystem, r.CreatedAt}}, nil
+			}
+		}
+		return nil, nil
+
+	case "GetUserByEmail", "GetUserByID":
+		for _, u := range f.users {
+			if u.Email == str(0) || u.ID.String() == str(0) {
+				return [][]driver.Value{userRow(u)}, nil
+			}
+		}
+		return nil, nil
+
+	case "GetUserIdentity":
+		for _, i := range f.identities {
+			if i.Provider == str(0) && i.Subject == str(1) {
+				return [][]driver.Value{{i.Provider, i.Subject, i.UserID.String(), i.Email, i.CreatedAt, i.LastLoginAt}}, nil
+			}
+		}
+		return nil, nil
+
+	case "GrantUserRole":
+		f.grants = append(f.grants, fakeGrant{userID: id(0), roleID: id(1), source: "local"})
+		return nil, nil
+
+	case "GrantUserRoleFromSource":
+		f.grants = append(f.grants, fakeGrant{userID: id(0), roleID: id(1), source: str(2)})
+		return nil, nil
+
+	case "IsRefreshTokenFamilyRevoked":
+		for _, family := range f.families {
+			if family.ID == id(0) {
+				return [][]driver.Value{{family.RevokedAt.Valid}}, nil
+			}
+		}
+		return nil, nil
+
+	case "ListActiveSessionsByUser":
+		seenAfter, _ := args[1].(time.Time)
+		var rows [][]driver.Value
+		for _, session := range f.sessions {
+			if session.UserID == id(0) && !f.family(session.FamilyID).RevokedAt.Valid && session.LastSeenAt.After(seenAfter) {
+				rows = append(rows, []driver.Value{
+					session.FamilyID.String(), session.UserID.String(), session.UserAgent, session.IpAddress, session.CreatedAt, session.LastSeenAt,
+				})
+			}
+		}
+		return rows, nil
+
+	case "ListUnusedMFARecoveryCodes":
+		var rows [][]driver.Value
+		for _, r := range f.recovery {
+			if r.UserID == id(0) && !r.UsedAt.Valid {
+				rows = append(rows, []driver.Value{r.ID.String(), r.UserID.String(), r.CodeHash, r.CreatedAt, nil})
+			}
+		}
+		return rows, nil
+
+	case "ListUserRoles":
+		var rows [][]driver.Value
+		for _, g := range f.grants {
+			if g.userID == id(0) {
+				r := f.roleByID(g.roleID)
+				rows = append(rows, []driver.Value{r.ID.String(), r.Name, []byte(r.Permissions), r.IsSystem, r.CreatedAt})
+			}
+		}
+		return rows, nil
+
+	case "MarkMFAChallengeUsed":
+		if ch := f.challenge(args[0]); ch != nil {
+			ch.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+		return nil, nil
+
+	case "MarkMFARecoveryCodeUsed":
+		for i, r := range f.recovery {
+			if r.ID == id(0) && !r.UsedAt.Valid {
+				f.recovery[i].UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				return [][]driver.Value{{}}, nil
+			}
+		}
+		return nil, nil
+
+	case "MarkRefreshTokenUsed":
+		for i, rt := range f.refresh {
+			if rt.Jti == str(0) && !rt.UsedAt.Valid {
+				f.refresh[i].UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				return [][]driver.Value{{}}, nil
+			}
+		}
+		return nil, nil
+
+	case "RecordLoginFailure":
+		resetBefore, _ := args[1].(time.Time)
+		t, ok := f.throttles[str(0)]
+		switch {
+		case !ok:
+			t = db.LoginThrottle{Key: str(0), Failures: 1}
+		case t.LastFailureAt.Before(resetBefore):
+			t.Failures, t.PreviousFailureAt = 1, sql.NullTime{Time: t.LastFailureAt, Valid: true}
+		default:
+			t.Failures, t.PreviousFailureAt = t.Failures+1, sql.NullTime{Time: t.LastFailureAt, Valid: true}
+		}
+		t.LastFailureAt = time.Now()
+		f.throttles[str(0)] = t
+		return [][]driver.Value{throttleRow(t)}, nil
+
+	case "RecordMFAChallengeAttempt":
+		if ch := f.challenge(args[0]); ch != nil {
+			ch.Attempts++
+		}
+		return nil, nil
+
+	case "RefundLoginAttempt":
+		if t, ok := f.throttles[str(0)]; ok {
+			t.Failures = max(t.Failures-1, 0)
+			if t.PreviousFailureAt.Valid {
+				t.LastFailureAt = t.PreviousFailureAt.Time
+			}
+			t.PreviousFailureAt = sql.NullTime{}
+			f.throttles[str(0)] = t
+		}
+		return nil, nil
+
+	case "RevokeOpenInvitationsForEmail":
+		for i, inv := range f.invites {
+			if strings.EqualFold(inv.Email, str(0)) && !inv.AcceptedAt.Valid && !inv.RevokedAt.Valid {
+				f.invites[i].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			}
+		}
+		return nil, nil
+
+	case "RevokeRefreshTokenFamily":
+		if family := f.family(id(0)); !family.RevokedAt.Valid {
+			family.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			family.RevokedReason = sql.NullString{String: str(1), Valid: true}
+		}
+		return nil, nil
+
+	case "RevokeAllUserSessions", "RevokeUserSession":
+		var rows [][]driver.Value
+		for i, family := range f.families {
+			if family.RevokedAt.Valid || (name == "RevokeUserSession" && family.ID != id(0)) {
+				continue
+			}
+			userID, reason := id(0), str(1)
+			if name == "RevokeUserSession" {
+				userID, reason = id(1), str(2)
+			}
+			if family.UserID == userID {
+				f.families[i].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				f.families[i].RevokedReason = sql.NullString{String: reason, Valid: true}
+				rows = append(rows, []driver.Value{family.ID.String()})
+			}
+		}
+		return rows, nil
+
+	case "TouchAPIKey":
+		for i := range f.apiKeys {
+			if f.apiKeys[i].ID == id(0) {
+				f.apiKeys[i].LastUsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			}
+		}
+		return nil, nil
+
+	case "TouchSession":
+		for i := range f.sessions {
+			if f.sessions[i].FamilyID == id(0) {
+				f.sessions[i].UserAgent, f.sessions[i].IpAddress, f.sessions[i].LastSeenAt = str(1), str(2), time.Now()
+			}
+		}
+		return nil, nil
+
+	case "TouchUserIdentity":
+		for i := range f.identities {
+			if f.identities[i].Provider == str(0) && f.identities[i].Subject == str(1) {
+				f.identities[i].Email, f.identities[i].LastLoginAt = str(2), time.Now()
+			}
+		}
+		return nil, nil
+
+	case "UpdateUserPassword":
+		for i := range f.users {
+			if f.users[i].ID == id(0) {
+				f.users[i].PasswordHash, f.users[i].UpdatedAt = str(1), time.Now()
+			}
+		}
+		return nil, nil
+	}
+	return nil, dbtest.Unexpected(f.t, name)
+}
+
+// family returns the refresh token family with id, failing the test if there isn't one
+func (f *fakeDB) family(id uuid.UUID) *db.RefreshTokenFamily {
+	for i := range f.families {
+		if f.families[i].ID == id {
+			return &f.families[i]
+		}
+	}
+	f.t.Errorf("no refresh token family %s", id)
+	return &db.RefreshTokenFamily{}
+}
+
+// challenge finds the MFA challenge whose token hashes to hash
+func (f *fakeDB) challenge(hash driver.Value) *db.MfaChallenge {
+	b, _ := hash.([]byte)
+	for i := range f.challenges {
+		if string(f.challenges[i].TokenHash) == string(b) {
+			return &f.challenges[i]
+		}
+	}
+	return nil
+}
+
+func throttleRow(t db.LoginThrottle) []driver.Value {
+	return []driver.Value{t.Key, int64(t.Failures), t.LastFailureAt, nullable(t.PreviousFailureAt)}
+}
+
+func invitationRow(inv db.Invitation) []driver.Value {
+	return []driver.Value{
+		inv.ID.String(), inv.TokenHash, inv.Email, nullable(inv.OrganizationID), []byte(inv.Roles), inv.InvitedBy.String(),
+		inv.CreatedAt, inv.ExpiresAt, nullable(inv.AcceptedAt), nullable(inv.RevokedAt),
+	}
+}
+
+func userRow(u db.User) []driver.Value {
+	return []driver.Value{
+		u.ID.String(), u.FirstName, u.LastName, u.Email, u.PasswordHash, nullable(u.MfaSecret), nullable(u.MfaEnabled),
+		u.CreatedAt, u.UpdatedAt, nil, nullable(u.MfaLastStep), u.Status, u.Kind,
+	}
+}
+
+// nullable is v's value as the driver would return it
+func nullable(v driver.Valuer) driver.Value {
+	value, _ := v.Value()
+	return value
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrHashBusy means no hashing slot freed up in time
+var ErrHashBusy = errors.New("password hashing is at capacity")
+
+const (
+	hashQueueTimeout = 3 * time.Second
+	hashQueuePerSlot = 8 // waiters allowed per slot before requests are turned away outright
+	hashRetryAfter   = 2 * time.Second
+)
+
+// HashLimiter bounds concurrent argon2id work. Each hash allocates its memory
+// parameter (64 MiB by default), so an unbounded burst of logins can OOM the API.
+// It is a counting semaphore with a bounded, time-limited queue.
+type HashLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+
+	queued    atomic.Int64
+	rejected  atomic.Int64
+	completed atomic.Int64
+}
+
+// HashStats is a snapshot for metrics
+type HashStats struct {
+	Concurrency int   `json:"concurrency"`
+	InFlight    int   `json:"in_flight"`
+	Queued      int64 `json:"queued"`
+	Rejected    int64 `json:"rejected"`
+	Completed   int64 `json:"completed"`
+}
+
+func NewHashLimiter(concurrency int) *HashLimiter {
+	concurrency = max(concurrency, 1)
+	return &HashLimiter{
+		slots:    make(chan struct{}, concurrency),
+		maxQueue: int64(concurrency * hashQueuePerSlot),
+	}
+}
+
+// acquire waits for a slot; the returned func gives it back
+func (l *HashLimiter) acquire(ctx context.Context) (func(), error) {
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueue {
+		l.queued.Add(-1)
+		l.rejected.Add(1)
+		return nil, ErrHashBusy
+	}
+	defer l.queued.Add(-1)
+
+	timer := time.NewTimer(hashQueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-timer.C:
+		l.rejected.Add(1)
+		return nil, ErrHashBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *HashLimiter) release() {
+	<-l.slots
+	l.completed.Add(1)
+}
+
+func (l *HashLimiter) Stats() HashStats {
+	return HashStats{
+		Concurrency: cap(l.slots),
+		InFlight:    len(l.slots),
+		Queued:      l.queued.Load(),
+		Rejected:    l.rejected.Load(),
+		Completed:   l.completed.Load(),
+	}
+}
+
+// DefaultHashConcurrency lets hashing use at most half the memory available to
+// the process, and no more hashes at once than there are CPUs to run them
+func DefaultHashConcurrency() int {
+	perHash := uint64(DefaultPassConfig.Memory) * 1024
+	byMemory := runtime.NumCPU()
+	if available := availableMemory(); available > 0 {
+		byMemory = int(available / 2 / perHash)
+	}
+	return max(1, min(byMemory, runtime.NumCPU()))
+}
+
+// availableMemory is the cgroup limit when there is one, else MemAvailable; 0 if unknown
+func availableMemory() uint64 {
+	// cgroup v2, then v1; an unlimited v1 group reports a huge number
+	for _, path := range []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err == nil && limit < 1<<62 {
+			return limit
+		}
+	}
+
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kib, err := strconv.ParseUint(fields[1], 10, 64)
+			if err == nil {
+				return kib * 1024
+			}
+		}
+	}
+	return 0
+}
+
+// hashingBusy answers a request the hashing limiter turned away
+func hashingBusy(c *gin.Context) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(hashRetryAfter.Seconds()))))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": gin.H{
+			"code":    "SERVER_BUSY",
+			"message": "The server is busy. Please try again shortly.",
+			"status":  http.StatusServiceUnavailable,
+		},
+	})
+}
@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
@@ -19,62 +22,133 @@ var DefaultPassConfig = auth.PassConfig{
 	KeyLen:  32,
 }
 
-// Password verification function
-func verifyPassword(password, encodedHash string) (bool, error) {
-	// Parse PHC format: $argon2id$v=19$m=65536,t=1,p=4$salt$hash
+// phcHash is a parsed argon2id hash in PHC string format
+type phcHash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	keyID   int // pepper version; 0 when the hash predates peppering
+	salt    []byte
+	hash    []byte
+}
+
+// parseHash reads $argon2id$v=19$m=65536,t=3,p=4[,keyid=N]$salt$hash
+func parseHash(encodedHash string) (*phcHash, error) {
 	parts := strings.Split(encodedHash, "$")
 	if len(parts) != 6 || parts[1] != "argon2id" {
-		return false, fmt.Errorf("invalid hash format")
+		return nil, fmt.Errorf("invalid hash format")
 	}
 
 	// Parse version
 	version, err := strconv.Atoi(strings.TrimPrefix(parts[2], "v="))
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	// Verify version matches
+	if version != argon2.Version {
+		return nil, fmt.Errorf("argon2 version mismatch")
 	}
 
 	// Parse parameters
 	params := strings.Split(parts[3], ",")
-	if len(params) != 3 {
-		return false, fmt.Errorf("invalid parameters format")
+	if len(params) != 3 && len(params) != 4 {
+		return nil, fmt.Errorf("invalid parameters format")
 	}
 
-	memory, err := strconv.Atoi(strings.TrimPrefix(params[0], "m="))
+	memory, err := strconv.ParseUint(strings.TrimPrefix(params[0], "m="), 10, 32)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	time, err := strconv.Atoi(strings.TrimPrefix(params[1], "t="))
+	time, err := strconv.ParseUint(strings.TrimPrefix(params[1], "t="), 10, 32)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	threads, err := strconv.Atoi(strings.TrimPrefix(params[2], "p="))
+	threads, err := strconv.ParseUint(strings.TrimPrefix(params[2], "p="), 10, 8)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	keyID := 0
+	if len(params) == 4 {
+		value, ok := strings.CutPrefix(params[3], "keyid=")
+		if !ok {
+			return nil, fmt.Errorf("invalid parameters format")
+		}
+		if keyID, err = strconv.Atoi(value); err != nil || keyID < 1 {
+			return nil, fmt.Errorf("invalid pepper key id")
+		}
 	}
 
 	// Decode salt and hash
 	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	storedHash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, err
+	}
+
+	return &phcHash{
+		memory:  uint32(memory),
+		time:    uint32(time),
+		threads: uint8(threads),
+		keyID:   keyID,
+		salt:    salt,
+		hash:    storedHash,
+	}, nil
+}
+
+// Password verification function
+func (s *AuthService) verifyPassword(ctx context.Context, password, encodedHash string) (bool, error) {
+	stored, err := parseHash(encodedHash)
 	if err != nil {
 		return false, err
 	}
 
-	// Verify version matches
-	if version != argon2.Version {
-		return false, fmt.Errorf("argon2 version mismatch")
+	input, err := s.pepperPassword(password, stored.keyID)
+	if err != nil {
+		return false, err
 	}
 
 	// Hash the input password with extracted parameters
-	inputHash := argon2.IDKey([]byte(password), salt, uint32(time), uint32(memory), uint8(threads), uint32(len(storedHash)))
+	inputHash, err := s.idKey(ctx, input, stored.salt, stored.time, stored.memory, stored.threads, uint32(len(stored.hash)))
+	if err != nil {
+		return false, err
+	}
 
 	// Constant-time comparison
-	return subtle.ConstantTimeCompare(storedHash, inputHash) == 1, nil
+	return subtle.ConstantTimeCompare(stored.hash, inputHash) == 1, nil
+}
+
+// needsRehash reports whether a hash was made with weaker parameters than
+// DefaultPassConfig or with an old (or no) pepper
+func (s *AuthService) needsRehash(encodedHash string) bool {
+	stored, err := parseHash(encodedHash)
+	if err != nil {
+		return false
+	}
+	return stored.memory < DefaultPassConfig.Memory ||
+		stored.time < DefaultPassConfig.Time ||
+		uint32(len(stored.hash)) < DefaultPassConfig.KeyLen ||
+		stored.keyID != s.Peppers.CurrentID()
+}
+
+// pepperPassword mixes in pepper keyID; 0 leaves the password as is
+func (s *AuthService) pepperPassword(password string, keyID int) ([]byte, error) {
+	if keyID == 0 {
+		return []byte(password), nil
+	}
+	key, ok := s.Peppers.Key(keyID)
+	if !ok {
+		return nil, fmt.Errorf("unknown pepper key id %d", keyID)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+	return mac.Sum(nil), nil
 }
 
 // Salting
@@ -85,21 +159,45 @@ func generateSalt(length int) ([]byte, error) {
 }
 
 // Hashing password with argon2id
-func hashPassword(password string) (string, error) {
+func (s *AuthService) hashPassword(ctx context.Context, password string) (string, error) {
 	salt, err := generateSalt(32)
 	if err != nil {
 		return "", err
 	}
 
-	hash := argon2.IDKey([]byte(password), salt, DefaultPassConfig.Time, DefaultPassConfig.Memory, DefaultPassConfig.Threads, DefaultPassConfig.KeyLen)
+	keyID := s.Peppers.CurrentID()
+	input, err := s.pepperPassword(password, keyID)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := s.idKey(ctx, input, salt, DefaultPassConfig.Time, DefaultPassConfig.Memory, DefaultPassConfig.Threads, DefaultPassConfig.KeyLen)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeHash(salt, hash, keyID), nil
+}
+
+// encodeHash formats a hash made with DefaultPassConfig in PHC string format
+func encodeHash(salt, hash []byte, keyID int) string {
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", DefaultPassConfig.Memory, DefaultPassConfig.Time, DefaultPassConfig.Threads)
+	if keyID != 0 {
+		params += fmt.Sprintf(",keyid=%d", keyID)
+	}
 
-	// Store in PHC string format
-	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
-		argon2.Version, DefaultPassConfig.Memory, DefaultPassConfig.Time, DefaultPassConfig.Threads,
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s",
+		argon2.Version, params,
 		base64.RawStdEncoding.EncodeToString(salt),
 		base64.RawStdEncoding.EncodeToString(hash))
-
-	return encoded, nil
 }
 
-// tests moved to hash_pass_test.go
+// idKey runs argon2id once a HashLimit slot is free
+func (s *AuthService) idKey(ctx context.Context, password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	release, err := s.HashLimit.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return argon2.IDKey(password, salt, time, memory, threads, keyLen), nil
+}
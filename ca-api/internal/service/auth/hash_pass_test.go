@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testPeppers(versions ...int) *PepperRing {
+	ring := &PepperRing{keys: make(map[int][]byte)}
+	for _, v := range versions {
+		ring.keys[v] = bytes.Repeat([]byte{byte(v)}, minPepperLen)
+		ring.current = max(ring.current, v)
+	}
+	return ring
+}
+
+func TestHashPasswordPeppers(t *testing.T) {
+	ctx := context.Background()
+	old := &AuthService{HashLimit: NewHashLimiter(1), Peppers: testPeppers(1)}
+
+	hash, err := old.hashPassword(ctx, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := old.verifyPassword(ctx, "correct horse battery staple", hash); !ok || err != nil {
+		t.Fatalf("verifyPassword() = %v, %v; want true", ok, err)
+	}
+	if ok, _ := old.verifyPassword(ctx, "wrong", hash); ok {
+		t.Fatal("verifyPassword() accepted the wrong password")
+	}
+	if old.needsRehash(hash) {
+		t.Fatal("needsRehash() = true for a hash with the current pepper")
+	}
+
+	// After rotation the old pepper still verifies, and the hash asks to be upgraded
+	rotated := &AuthService{HashLimit: old.HashLimit, Peppers: testPeppers(1, 2)}
+	if ok, err := rotated.verifyPassword(ctx, "correct horse battery staple", hash); !ok || err != nil {
+		t.Fatalf("verifyPassword() after rotation = %v, %v; want true", ok, err)
+	}
+	if !rotated.needsRehash(hash) {
+		t.Fatal("needsRehash() = false for a hash with a retired pepper")
+	}
+
+	// Each service uses its own keyring: one without the pepper can't check the hash
+	unpeppered := &AuthService{HashLimit: old.HashLimit}
+	if _, err := unpeppered.verifyPassword(ctx, "correct horse battery staple", hash); err == nil {
+		t.Fatal("verifyPassword() without the pepper = nil error, want one")
+	}
+}
+
+func TestHashLimiterBoundsWork(t *testing.T) {
+	const concurrency, callers = 2, 20
+	limiter := NewHashLimiter(concurrency)
+	release := make(chan struct{})
+
+	var inFlight, peak, busy atomic.Int64
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := limiter.acquire(context.Background())
+			if errors.Is(err, ErrHashBusy) {
+				busy.Add(1)
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := inFlight.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			<-release
+			inFlight.Add(-1)
+			done()
+		}()
+	}
+
+	// Hold the slots until every caller has either queued or been turned away
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := limiter.Stats()
+		if int64(stats.InFlight)+stats.Queued+stats.Rejected == callers {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("callers never settled: %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if peak.Load() > concurrency {
+		t.Fatalf("%d hashes ran at once, limit is %d", peak.Load(), concurrency)
+	}
+	if want := int64(callers - concurrency - concurrency*hashQueuePerSlot); busy.Load() != want {
+		t.Fatalf("%d callers turned away, want %d", busy.Load(), want)
+	}
+	if stats := limiter.Stats(); stats.Completed != callers-busy.Load() {
+		t.Fatalf("completed = %d, want %d", stats.Completed, callers-busy.Load())
+	}
+}
+
+// BenchmarkHashUnderLoad hashes with more and more callers than hashing slots.
+// Each argon2id hash allocates DefaultPassConfig.Memory, so peak-heap-MiB should
+// stay near concurrency × 64 MiB however many callers there are; callers past
+// the queue are turned away (busy/op) instead of adding to the heap.
+func BenchmarkHashUnderLoad(b *testing.B) {
+	const concurrency = 2
+	for _, callers := range []int{2, 8, 32} {
+		b.Run(fmt.Sprintf("callers=%d", callers), func(b *testing.B) {
+			s := &AuthService{HashLimit: NewHashLimiter(concurrency), Peppers: testPeppers(1)}
+			runtime.GC()
+			base := heapBytes()
+			stop := watchPeakHeap()
+
+			var busy atomic.Int64
+			b.ResetTimer()
+			for range b.N {
+				var wg sync.WaitGroup
+				for range callers {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						_, err := s.hashPassword(context.Background(), "correct horse battery staple")
+						if errors.Is(err, ErrHashBusy) {
+							busy.Add(1)
+						} else if err != nil {
+							b.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+			}
+			b.StopTimer()
+
+			peak := stop()
+			b.ReportMetric(float64(peak-min(base, peak))/(1<<20), "peak-heap-MiB")
+			b.ReportMetric(float64(busy.Load())/float64(b.N), "busy/op")
+		})
+	}
+}
+
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// heapBytes is the memory held by heap objects, live or not yet collected
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// watchPeakHeap samples the heap every millisecond; the returned func stops
+// sampling and reports the largest value seen
+func watchPeakHeap() func() uint64 {
+	var peak atomic.Uint64
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			if n := heapBytes(); n > peak.Load() {
+				peak.Store(n)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		<-stopped
+		return peak.Load()
+	}
+}
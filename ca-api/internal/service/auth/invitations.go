@@ -0,0 +1,409 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/mail"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultInvitationTTL = 72 * time.Hour
+
+var errInvalidInvitation = errors.New("invalid or expired invitation")
+
+// CreateInvitation emails a single-use link to create an account with the given roles (admin)
+func (s *AuthService) CreateInvitation(c *gin.Context) {
+	var req auth.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	if !s.knownRoles(c, req.Roles) {
+		return
+	}
+
+	_, err := s.DB.GetUserByEmail(c, req.Email)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": gin.H{
+				"code":    "USER_ALREADY_EXISTS",
+				"message": "A user with this email already exists.",
+				"status":  http.StatusConflict,
+			},
+		})
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("GetUserByEmail failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	ttl := defaultInvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	var orgID uuid.NullUUID
+	if req.OrganizationID != "" {
+		orgID = uuid.NullUUID{UUID: uuid.MustParse(req.OrganizationID), Valid: true}
+	}
+
+	invitation, token, err := s.createInvitation(c, req, orgID, ttl)
+	if err != nil {
+		log.Printf("CreateInvitation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	s.sendMail(mail.Message{
+		To:      invitation.Email,
+		Subject: "You're invited to Signee",
+		Body: "You've been invited to create a Signee account. To accept, open:\n\n" +
+			s.AppURL + "/accept-invite?token=" + url.QueryEscape(token) + "\n\n" +
+			"The invitation expires on " + invitation.ExpiresAt.UTC().Format(time.RFC1123) + ".\n",
+	})
+	c.JSON(http.StatusCreated, invitationInfo(invitation))
+}
+
+// createInvitation stores the invitation, replacing any open one for the same address
+func (s *AuthService) createInvitation(c *gin.Context, req auth.CreateInvitationRequest, orgID uuid.NullUUID, ttl time.Duration) (db.Invitation, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return db.Invitation{}, "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	roles, err := json.Marshal(req.Roles)
+	if err != nil {
+		return db.Invitation{}, "", err
+	}
+
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return db.Invitation{}, "", err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	if err := q.RevokeOpenInvitationsForEmail(c, req.Email); err != nil {
+		return db.Invitation{}, "", err
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	invitation, err := q.CreateInvitation(c, db.CreateInvitationParams{
+		TokenHash:      invitationTokenHash(token),
+		Email:          req.Email,
+		OrganizationID: orgID,
+		Roles:          roles,
+		InvitedBy:      principal.UserID,
+		ExpiresAt:      time.Now().Add(ttl),
+	})
+	if err != nil {
+		return db.Invitation{}, "", err
+	}
+
+	err = auditlog.Record(c, q, audit.Event{
+		Type:      audit.InvitationCreated,
+		ActorID:   principal.UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"invitation_id": invitation.ID, "email": invitation.Email, "roles": req.Roles},
+	})
+	if err != nil {
+		return db.Invitation{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.Invitation{}, "", err
+	}
+	return invitation, token, nil
+}
+
+// ListInvitations lists invitations that can still be accepted (admin)
+func (s *AuthService) ListInvitations(c *gin.Context) {
+	invitations, err := s.DB.ListPendingInvitations(c)
+	if err != nil {
+		log.Printf("ListPendingInvitations failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	infos := make([]auth.InvitationInfo, 0, len(invitations))
+	for _, invitation := range invitations {
+		infos = append(infos, invitationInfo(invitation))
+	}
+	c.JSON(http.StatusOK, gin.H{"invitations": infos})
+}
+
+// RevokeInvitation cancels a pending invitation (admin)
+func (s *AuthService) RevokeInvitation(c *gin.Context) {
+	invitationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		invitationNotFound(c)
+		return
+	}
+
+	revoked, err := s.DB.RevokeInvitation(c, invitationID)
+	if err != nil {
+		log.Printf("RevokeInvitation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if revoked == 0 {
+		invitationNotFound(c)
+		return
+	}
+
+	s.recordAudit(c, audit.Event{
+		Type:      audit.InvitationRevoked,
+		ActorID:   middleware.CurrentPrincipal(c).UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"invitation_id": invitationID},
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// AcceptInvitation creates the invited account. The emailed link proves the
+// address, so the account starts active.
+func (s *AuthService) AcceptInvitation(c *gin.Context) {
+	var req auth.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	tokenHash := invitationTokenHash(req.Token)
+	invitation, err := s.DB.GetOpenInvitationByTokenHash(c, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		invalidInvitation(c)
+		return
+	}
+	if err != nil {
+		log.Printf("GetOpenInvitationByTokenHash failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	if !s.checkNewPassword(c, "password", req.Password, db.User{
+		Email:     invitation.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	}) {
+		return
+	}
+
+	_, err = s.DB.GetUserByEmail(c, invitation.Email)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": gin.H{
+				"code":    "USER_ALREADY_EXISTS",
+				"message": "A user with this email already exists.",
+				"status":  http.StatusConflict,
+			},
+		})
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("GetUserByEmail failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	hashedPassword, err := s.hashPassword(c, req.Password)
+	var user db.User
+	if err == nil {
+		user, err = s.acceptInvitation(c, tokenHash, db.CreateUserParams{
+			FirstName:    req.FirstName,
+			LastName:     req.LastName,
+			PasswordHash: hashedPassword,
+			Status:       auth.UserStatusActive,
+		})
+	}
+	switch {
+	case errors.Is(err, errInvalidInvitation):
+		invalidInvitation(c)
+		return
+	case errors.Is(err, ErrHashBusy):
+		hashingBusy(c)
+		return
+	case err != nil:
+		log.Printf("AcceptInvitation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Welcome! Your account is ready; you can log in now.",
+		"username": user.FirstName + " " + user.LastName,
+	})
+}
+
+// acceptInvitation consumes the invitation and creates the user with its roles,
+// credited to the inviter, in one transaction
+func (s *AuthService) acceptInvitation(c *gin.Context, tokenHash []byte, params db.CreateUserParams) (db.User, error) {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return db.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	// Consuming it here, not at lookup, means two racing accepts can't both succeed
+	invitation, err := q.AcceptInvitation(c, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.User{}, errInvalidInvitation
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+
+	var roles []string
+	if err := json.Unmarshal(invitation.Roles, &roles); err != nil {
+		return db.User{}, err
+	}
+
+	inviter := uuid.NullUUID{UUID: invitation.InvitedBy, Valid: true}
+	params.Email = invitation.Email
+	params.CreatedBy = inviter
+	user, err := q.CreateUser(c, params)
+	if err != nil {
+		return db.User{}, err
+	}
+	for _, role := range roles {
+		if err := grantRole(c, q, user.ID, role, inviter); err != nil {
+			return db.User{}, err
+		}
+	}
+
+	err = auditlog.Record(c, q, audit.Event{
+		Type:      audit.InvitationAccepted,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"invitation_id": invitation.ID, "invited_by": invitation.InvitedBy, "roles": roles},
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
+
+func invitationInfo(invitation db.Invitation) auth.InvitationInfo {
+	var roles []string
+	if err := json.Unmarshal(invitation.Roles, &roles); err != nil {
+		log.Printf("invitation %s has malformed roles: %v", invitation.ID, err)
+	}
+	info := auth.InvitationInfo{
+		ID:        invitation.ID.String(),
+		Email:     invitation.Email,
+		Roles:     roles,
+		InvitedBy: invitation.InvitedBy.String(),
+		CreatedAt: invitation.CreatedAt,
+		ExpiresAt: invitation.ExpiresAt,
+	}
+	if invitation.OrganizationID.Valid {
+		info.OrganizationID = invitation.OrganizationID.UUID.String()
+	}
+	return info
+}
+
+func invitationTokenHash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+func invitationNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"code":    "INVITATION_NOT_FOUND",
+			"message": "Invitation not found.",
+			"status":  http.StatusNotFound,
+		},
+	})
+}
+
+func invalidInvitation(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_INVITATION",
+			"message": "The invitation is invalid, has expired or was already used.",
+			"status":  http.StatusBadRequest,
+		},
+	})
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const invitedPassword = "a long enough invited passphrase"
+
+// newInvitationTest is a mailTest where alice, as an admin, can invite.
+// Open signup is off, as it is by default.
+func newInvitationTest(t *testing.T) (*tokenTest, func(email string) string) {
+	t.Helper()
+	tt, outbox := newMailTest(t)
+	asAlice := func(c *gin.Context) { c.Set(middleware.PrincipalKey, &auth.Principal{UserID: tt.alice.ID}) }
+	tt.router.POST("/invitations", asAlice, tt.s.CreateInvitation)
+	tt.router.POST("/invitations/accept", tt.s.AcceptInvitation)
+	tt.router.POST("/signup", tt.s.Signup)
+
+	// invite invites email to the viewer role and returns the mailed token
+	sent := 0
+	invite := func(email string) string {
+		t.Helper()
+		w := tt.post("/invitations", auth.CreateInvitationRequest{Email: email, Roles: []string{"viewer"}})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("CreateInvitation = %d: %s", w.Code, w.Body)
+		}
+		sent++
+		return mailedToken(t, outbox, sent, email)
+	}
+	return tt, invite
+}
+
+func (tt *tokenTest) accept(token string) *httptest.ResponseRecorder {
+	return tt.post("/invitations/accept", auth.AcceptInvitationRequest{
+		Token: token, Password: invitedPassword, FirstName: "Dave", LastName: "Example",
+	})
+}
+
+func TestInvitationSingleUse(t *testing.T) {
+	tt, invite := newInvitationTest(t)
+	token := invite("dave@example.com")
+
+	if w := tt.accept(token); w.Code != http.StatusCreated {
+		t.Fatalf("AcceptInvitation = %d: %s", w.Code, w.Body)
+	}
+	dave := tt.db.user("dave@example.com")
+	if dave.Status != auth.UserStatusActive {
+		t.Fatalf("dave is %s, want active: the link proved the address", dave.Status)
+	}
+	if roles := tt.db.rolesOf(dave.ID, "local"); !slices.Equal(roles, []string{"viewer"}) {
+		t.Fatalf("dave's roles = %v, want [viewer]", roles)
+	}
+	if !slices.Contains(tt.db.events, string(audit.InvitationAccepted)) {
+		t.Fatalf("audit events = %v, want the acceptance recorded", tt.db.events)
+	}
+
+	w := tt.accept(token)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "INVALID_INVITATION") {
+		t.Fatalf("AcceptInvitation replayed = %d: %s, want 400 INVALID_INVITATION", w.Code, w.Body)
+	}
+}
+
+func TestInvitationRefused(t *testing.T) {
+	for name, tc := range map[string]func(tt *tokenTest, invite func(string) string) string{
+		"expired": func(tt *tokenTest, invite func(string) string) string {
+			token := invite("dave@example.com")
+			tt.db.invites[0].ExpiresAt = time.Now().Add(-time.Minute)
+			return token
+		},
+		// Re-inviting an address replaces its open invitation
+		"replaced": func(tt *tokenTest, invite func(string) string) string {
+			token := invite("dave@example.com")
+			invite("Dave@example.com")
+			return token
+		},
+		"unknown": func(tt *tokenTest, invite func(string) string) string {
+			invite("dave@example.com")
+			return "not-the-token"
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tt, invite := newInvitationTest(t)
+			w := tt.accept(tc(tt, invite))
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "INVALID_INVITATION") {
+				t.Fatalf("AcceptInvitation = %d: %s, want 400 INVALID_INVITATION", w.Code, w.Body)
+			}
+			if len(tt.db.users) != 1 {
+				t.Fatalf("%d users, want no account created", len(tt.db.users))
+			}
+		})
+	}
+
+	// The invitation that replaced the first still works
+	tt, invite := newInvitationTest(t)
+	invite("dave@example.com")
+	if w := tt.accept(invite("dave@example.com")); w.Code != http.StatusCreated {
+		t.Fatalf("AcceptInvitation(replacement) = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSignupByInvitationOnly(t *testing.T) {
+	tt, _ := newInvitationTest(t)
+	signup := auth.SignupRequest{
+		Email: "eve@example.com", Password: invitedPassword, ConfirmPassword: invitedPassword, FirstName: "Eve", LastName: "Uninvited",
+	}
+
+	w := tt.post("/signup", signup)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "SIGNUP_DISABLED") {
+		t.Fatalf("Signup without open signup = %d: %s, want 403 SIGNUP_DISABLED", w.Code, w.Body)
+	}
+	if len(tt.db.users) != 1 {
+		t.Fatalf("%d users, want no account created", len(tt.db.users))
+	}
+
+	tt.db.roles = append(tt.db.roles, db.Role{ID: uuid.New(), Name: signupRole, Permissions: json.RawMessage("[]"), CreatedAt: time.Now()})
+	tt.s.OpenSignup = true
+	if w := tt.post("/signup", signup); w.Code != http.StatusCreated {
+		t.Fatalf("Signup with open signup = %d: %s", w.Code, w.Body)
+	}
+	if status := tt.db.user("eve@example.com").Status; status != auth.UserStatusPending {
+		t.Fatalf("eve is %s, want pending until the address is verified", status)
+	}
+}
@@ -0,0 +1,328 @@
+package jwt
+
+import (
+	"container/heap"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	dpopProofLifetime    = 5 * time.Minute // how old a proof's iat may be
+	dpopClockSkew        = 1 * time.Minute // how far ahead a client's clock may run
+	dpopNonceWindow      = 5 * time.Minute // nonces stay valid for this window and the next
+	dpopMaxJTILength     = 256             // longer jti values are refused rather than cached
+	dpopMaxReplayEntries = 100000          // proofs remembered per instance, about 40 MB at the longest jti
+	dpopSigningMethod    = "ES256"
+)
+
+// ErrDPoPNonce means the proof lacked a current nonce; the client should
+// retry with the one sent in the DPoP-Nonce response header
+var ErrDPoPNonce = errors.New("dpop proof needs a fresh nonce")
+
+// TokenBinding says how access tokens are tied to the client they were issued to
+type TokenBinding struct {
+	DPoPBaseURL       string // external URL of the API that proofs' htu must name; DPoP proofs are refused without it
+	DPoPRequired      bool   // reject access tokens that aren't bound to a DPoP key
+	LegacyFingerprint bool   // check unbound tokens against the User-Agent/Accept-* fingerprint they were issued to
+}
+
+// SetTokenBinding sets how tokens are bound; without it DPoP proofs are
+// refused and unbound tokens are plain bearer tokens. The base URL is
+// configured rather than read from Host or X-Forwarded-* headers, which the
+// client controls and could point at whatever URL a captured proof names.
+func (j *JWTManager) SetTokenBinding(b TokenBinding) error {
+	b.DPoPBaseURL = strings.TrimSuffix(b.DPoPBaseURL, "/")
+	if b.DPoPBaseURL == "" {
+		if b.DPoPRequired {
+			return fmt.Errorf("DPoP is required but no base URL is configured")
+		}
+	} else {
+		base, err := url.Parse(b.DPoPBaseURL)
+		if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" ||
+			base.User != nil || base.RawQuery != "" || base.Fragment != "" {
+			return fmt.Errorf("DPoP base URL %q must be an http(s) URL without query or fragment", b.DPoPBaseURL)
+		}
+	}
+	j.binding = b
+	return nil
+}
+
+// dpopClaims is the payload of a DPoP proof (RFC 9449 section 4.2)
+type dpopClaims struct {
+	HTM   string `json:"htm"`
+	HTU   string `json:"htu"`
+	Nonce string `json:"nonce"`
+	ATH   string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type dpopKeyContextKey struct{}
+
+// WithDPoPKey records the thumbprint of the key a verified proof was signed
+// with, so GenerateTokens binds the tokens it issues to that key
+func WithDPoPKey(ctx context.Context, jkt string) context.Context {
+	return context.WithValue(ctx, dpopKeyContextKey{}, jkt)
+}
+
+// DPoPKey returns the thumbprint stored by WithDPoPKey, or ""
+func DPoPKey(ctx context.Context) string {
+	jkt, _ := ctx.Value(dpopKeyContextKey{}).(string)
+	return jkt
+}
+
+// VerifyDPoPProof checks the request's DPoP proof and returns the thumbprint
+// of the key that signed it. accessToken is the token the proof must be bound
+// to through ath; pass "" at token endpoints, where there is none yet.
+func (j *JWTManager) VerifyDPoPProof(r *http.Request, accessToken string) (string, error) {
+	if j.binding.DPoPBaseURL == "" {
+		return "", fmt.Errorf("DPoP proofs are not accepted: no base URL is configured")
+	}
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return "", fmt.Errorf("expected one DPoP proof, got %d", len(proofs))
+	}
+
+	var publicKey *ecdsa.PublicKey
+	claims := &dpopClaims{}
+	_, err := jwt.ParseWithClaims(proofs[0], claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("unexpected proof type %q", typ)
+		}
+		key, err := parseProofJWK(token.Header["jwk"])
+		publicKey = key
+		return key, err
+	}, jwt.WithValidMethods([]string{dpopSigningMethod}))
+	if err != nil {
+		return "", fmt.Errorf("invalid DPoP proof: %v", err)
+	}
+
+	now := time.Now()
+	if claims.IssuedAt == nil || now.Sub(claims.IssuedAt.Time) > dpopProofLifetime || claims.IssuedAt.Sub(now) > dpopClockSkew {
+		return "", fmt.Errorf("DPoP proof iat is missing or out of range")
+	}
+	if claims.ID == "" || len(claims.ID) > dpopMaxJTILength {
+		return "", fmt.Errorf("DPoP proof jti is missing or too long")
+	}
+	if claims.HTM != r.Method {
+		return "", fmt.Errorf("DPoP proof is for method %q", claims.HTM)
+	}
+	if !sameHTU(claims.HTU, j.requestHTU(r)) {
+		return "", fmt.Errorf("DPoP proof is for URL %q", claims.HTU)
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", fmt.Errorf("DPoP proof is not for this access token")
+		}
+	}
+	if !j.dpopNonceValid(claims.Nonce, now) {
+		return "", ErrDPoPNonce
+	}
+
+	jkt, err := thumbprint(publicKey)
+	if err != nil {
+		return "", err
+	}
+	if !j.proofs.use(jkt+"."+claims.ID, claims.IssuedAt.Add(dpopProofLifetime)) {
+		return "", fmt.Errorf("DPoP proof replayed")
+	}
+	return jkt, nil
+}
+
+// checkAccessBinding enforces an access token's DPoP binding or, for
+// unbound tokens in legacy mode, its fingerprint
+func (j *JWTManager) checkAccessBinding(tokenString string, claims *auth.SecureClaims, r *http.Request) error {
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	dpop := strings.EqualFold(scheme, "DPoP")
+
+	switch {
+	case claims.Cnf != nil:
+		if !dpop {
+			return fmt.Errorf("DPoP-bound token presented as a bearer token")
+		}
+		jkt, err := j.VerifyDPoPProof(r, tokenString)
+		if err != nil {
+			return err
+		}
+		if jkt != claims.Cnf.JKT {
+			return fmt.Errorf("DPoP proof signed by a key the token isn't bound to")
+		}
+	case dpop:
+		return fmt.Errorf("token presented with DPoP is not DPoP-bound")
+	case j.binding.DPoPRequired:
+		return fmt.Errorf("token is not DPoP-bound")
+	case j.binding.LegacyFingerprint && claims.Fingerprint != j.generateFingerprint(r):
+		return fmt.Errorf("token fingerprint mismatch")
+	}
+	return nil
+}
+
+// checkRefreshBinding requires a bound refresh token to come with a proof from
+// its key, already verified into the request context. An unbound one may come
+// with a proof too: the pair issued for it is then bound, which is how clients
+// that logged in through a redirect get DPoP tokens.
+func (j *JWTManager) checkRefreshBinding(claims *auth.SecureClaims, r *http.Request) error {
+	switch {
+	case claims.Cnf != nil:
+		if DPoPKey(r.Context()) != claims.Cnf.JKT {
+			return fmt.Errorf("refresh token is DPoP-bound to another key")
+		}
+	case j.binding.LegacyFingerprint && claims.Fingerprint != j.generateFingerprint(r):
+		return fmt.Errorf("refresh token fingerprint mismatch")
+	}
+	return nil
+}
+
+// parseProofJWK reads the public key from a proof's jwk header
+func parseProofJWK(header any) (*ecdsa.PublicKey, error) {
+	jwk, ok := header.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("proof has no jwk header")
+	}
+	if _, private := jwk["d"]; private {
+		return nil, fmt.Errorf("proof jwk contains a private key")
+	}
+	if jwk["kty"] != "EC" || jwk["crv"] != "P-256" {
+		return nil, fmt.Errorf("proof jwk must be an EC P-256 key")
+	}
+	xs, _ := jwk["x"].(string)
+	ys, _ := jwk["y"].(string)
+	x, errX := base64.RawURLEncoding.DecodeString(xs)
+	y, errY := base64.RawURLEncoding.DecodeString(ys)
+	if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("proof jwk has malformed coordinates")
+	}
+	point := append(append([]byte{4}, x...), y...)
+	return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+}
+
+// requestHTU is the URL a proof for r must name: no query or fragment
+func (j *JWTManager) requestHTU(r *http.Request) string {
+	return j.binding.DPoPBaseURL + r.URL.Path
+}
+
+// sameHTU compares URLs as RFC 9449 asks: ignoring query and fragment, with
+// the case-insensitive scheme and host normalized
+func sameHTU(htu, expected string) bool {
+	got, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	want, err := url.Parse(expected)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(got.Scheme, want.Scheme) &&
+		strings.EqualFold(got.Host, want.Host) &&
+		got.EscapedPath() == want.EscapedPath()
+}
+
+// DPoPNonce returns a nonce for clients to put in their proofs. Nonces are a
+// MAC over the current time window, so every instance accepts every other's.
+func (j *JWTManager) DPoPNonce() string {
+	key := j.ring().Active()
+	window := time.Now().Unix() / int64(dpopNonceWindow/time.Second)
+	return versionPrefix(key.Version) + nonceMAC(key.Key, window)
+}
+
+func (j *JWTManager) dpopNonceValid(nonce string, now time.Time) bool {
+	version, encoded := sealedVersion(nonce)
+	key, ok := j.ring().Key(version)
+	if !ok {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(data) < 8 {
+		return false
+	}
+	window := int64(binary.BigEndian.Uint64(data))
+	current := now.Unix() / int64(dpopNonceWindow/time.Second)
+	if window != current && window != current-1 {
+		return false
+	}
+	return hmac.Equal([]byte(nonce), []byte(versionPrefix(version)+nonceMAC(key, window)))
+}
+
+func nonceMAC(key []byte, window int64) string {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(window))
+	mac := hmac.New(sha256.New, deriveKey(key, "signee dpop nonce"))
+	mac.Write(data[:])
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(data[:])[:8+16])
+}
+
+// proofReplayCache remembers proofs until they are too old to be accepted.
+// It is per instance; the nonce, which expires within two windows on every
+// instance, bounds how long a captured proof is useful elsewhere. It holds at
+// most dpopMaxReplayEntries; when full, the proof closest to expiry is
+// forgotten first, so a flood of fresh proofs can't grow it without bound.
+type proofReplayCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time // proof ID to when it expires
+	expiry proofExpiryHeap      // the same proofs, soonest expiry first
+}
+
+// use records id and reports whether it was new
+func (pc *proofReplayCache) use(id string, expires time.Time) bool {
+	now := time.Now()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.seen == nil {
+		pc.seen = make(map[string]time.Time)
+	}
+	if expiry, ok := pc.seen[id]; ok && now.Before(expiry) {
+		return false
+	}
+
+	for len(pc.expiry) > 0 && !now.Before(pc.expiry[0].expires) {
+		pc.forget(heap.Pop(&pc.expiry).(proofExpiry))
+	}
+	for len(pc.expiry) >= dpopMaxReplayEntries {
+		pc.forget(heap.Pop(&pc.expiry).(proofExpiry))
+	}
+	pc.seen[id] = expires
+	heap.Push(&pc.expiry, proofExpiry{id: id, expires: expires})
+	return true
+}
+
+// forget drops a popped entry from seen unless id was recorded again since
+func (pc *proofReplayCache) forget(e proofExpiry) {
+	if pc.seen[e.id].Equal(e.expires) {
+		delete(pc.seen, e.id)
+	}
+}
+
+type proofExpiry struct {
+	id      string
+	expires time.Time
+}
+
+// proofExpiryHeap is a container/heap of proofs ordered by expiry
+type proofExpiryHeap []proofExpiry
+
+func (h proofExpiryHeap) Len() int           { return len(h) }
+func (h proofExpiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h proofExpiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *proofExpiryHeap) Push(x any)        { *h = append(*h, x.(proofExpiry)) }
+func (h *proofExpiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,84 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProofReplayCache(t *testing.T) {
+	var pc proofReplayCache
+	now := time.Now()
+
+	if !pc.use("a", now.Add(time.Minute)) {
+		t.Fatal("first use of a proof was refused")
+	}
+	if pc.use("a", now.Add(time.Minute)) {
+		t.Fatal("replayed proof was accepted")
+	}
+	// An expired entry no longer blocks its ID and is swept on the next use
+	if !pc.use("b", now.Add(-time.Second)) || !pc.use("b", now.Add(time.Minute)) {
+		t.Fatal("proof ID was still blocked after its entry expired")
+	}
+	if pc.use("b", now.Add(time.Minute)) {
+		t.Fatal("re-recorded proof was accepted twice")
+	}
+}
+
+func TestProofReplayCacheCap(t *testing.T) {
+	var pc proofReplayCache
+	now := time.Now()
+
+	for i := range dpopMaxReplayEntries + 10 {
+		if !pc.use(fmt.Sprint(i), now.Add(time.Minute+time.Duration(i)*time.Millisecond)) {
+			t.Fatalf("proof %d was refused", i)
+		}
+	}
+	if len(pc.seen) != dpopMaxReplayEntries || len(pc.expiry) != dpopMaxReplayEntries {
+		t.Fatalf("cache holds %d/%d entries, cap is %d", len(pc.seen), len(pc.expiry), dpopMaxReplayEntries)
+	}
+	// The proofs closest to expiry went first; the newest are still remembered
+	if _, ok := pc.seen["0"]; ok {
+		t.Fatal("oldest proof was kept past the cap")
+	}
+	if pc.use(fmt.Sprint(dpopMaxReplayEntries+9), now.Add(time.Hour)) {
+		t.Fatal("newest proof was forgotten")
+	}
+}
+
+func TestRequestHTU(t *testing.T) {
+	j := &JWTManager{}
+	if err := j.SetTokenBinding(TokenBinding{DPoPBaseURL: "https://ca.example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "http://internal:8080/api/v1/auth/refresh?x=1", nil)
+	r.Header.Set("X-Forwarded-Proto", "http")
+	r.Header.Set("X-Forwarded-Host", "attacker.example")
+	if got, want := j.requestHTU(r), "https://ca.example.com/api/v1/auth/refresh"; got != want {
+		t.Fatalf("requestHTU() = %q, want %q", got, want)
+	}
+}
+
+func TestSetTokenBinding(t *testing.T) {
+	for _, b := range []TokenBinding{
+		{DPoPRequired: true},
+		{DPoPBaseURL: "ca.example.com"},
+		{DPoPBaseURL: "ftp://ca.example.com"},
+		{DPoPBaseURL: "https://ca.example.com/?x=1"},
+	} {
+		if err := (&JWTManager{}).SetTokenBinding(b); err == nil {
+			t.Errorf("SetTokenBinding(%+v) = nil, want an error", b)
+		}
+	}
+
+	j := &JWTManager{}
+	if err := j.SetTokenBinding(TokenBinding{}); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+	r.Header.Set("DPoP", "proof")
+	if _, err := j.VerifyDPoPProof(r, ""); err == nil {
+		t.Fatal("proof accepted without a configured base URL")
+	}
+}
@@ -1,47 +1,40 @@
 package jwt
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"golang.org/x/crypto/chacha20poly1305"
 )
 
-// loadOrGenerateEncryptionKey loads or generates ChaCha20-Poly1305 key
-func loadOrGenerateEncryptionKey(filename string) ([]byte, error) {
+// loadOrGenerateKeyring loads the claim encryption keyring, creating one with a single key if missing
+func loadOrGenerateKeyring(filename string) (*Keyring, error) {
 	if _, err := os.Stat(filename); err == nil {
-		data, err := os.ReadFile(filename)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read encryption key file: %v", err)
-		}
-		if len(data) != chacha20poly1305.KeySize {
-			return nil, fmt.Errorf("invalid encryption key length")
-		}
-		return data, nil
+		return LoadKeyring(filename)
 	}
 
-	// Generate new 32-byte key
-	key := make([]byte, chacha20poly1305.KeySize)
-	if _, err := rand.Read(key); err != nil {
-		return nil, fmt.Errorf("failed to generate encryption key: %v", err)
+	ring, err := NewKeyring()
+	if err != nil {
+		return nil, err
 	}
-
-	// Save the key
-	if err := os.WriteFile(filename, key, 0600); err != nil {
-		return nil, fmt.Errorf("failed to save encryption key: %v", err)
+	if err := ring.Save(filename); err != nil {
+		return nil, err
 	}
-
-	return key, nil
+	return ring, nil
 }
 
-// encryptData encrypts data with ChaCha20-Poly1305
-func encryptData(data, key []byte) (string, error) {
-	aead, err := chacha20poly1305.NewX(key)
+// encryptData encrypts data with ChaCha20-Poly1305 under the active key,
+// prefixing the result with the key's version
+func encryptData(data []byte, ring *Keyring) (string, error) {
+	key := ring.Active()
+	aead, err := chacha20poly1305.NewX(key.Key)
 	if err != nil {
 		return "", fmt.Errorf("failed to create AEAD cipher: %v", err)
 	}
@@ -50,12 +43,17 @@ func encryptData(data, key []byte) (string, error) {
 		return "", fmt.Errorf("failed to generate nonce: %v", err)
 	}
 	ciphertext := aead.Seal(nonce, nonce, data, nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return versionPrefix(key.Version) + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// decryptData decrypts data with ChaCha20-Poly1305
-func decryptData(encrypted string, key []byte) ([]byte, error) {
-	data, err := base64.StdEncoding.DecodeString(encrypted)
+// decryptData decrypts data with ChaCha20-Poly1305, using the key version it names
+func decryptData(encrypted string, ring *Keyring) ([]byte, error) {
+	version, encoded := sealedVersion(encrypted)
+	key, ok := ring.Key(version)
+	if !ok {
+		return nil, fmt.Errorf("sealed with unknown key version %d", version)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode encrypted data: %v", err)
 	}
@@ -70,6 +68,25 @@ func decryptData(encrypted string, key []byte) ([]byte, error) {
 	return aead.Open(nil, nonce, ciphertext, nil)
 }
 
+func versionPrefix(version int) string {
+	return "v" + strconv.Itoa(version) + ":"
+}
+
+// sealedVersion splits a versioned value into its key version and the rest.
+// Values from before the keyring have no prefix and belong to version 1;
+// standard base64 never contains ':', so the two can't be confused.
+func sealedVersion(sealed string) (int, string) {
+	prefix, rest, ok := strings.Cut(sealed, ":")
+	if !ok || !strings.HasPrefix(prefix, "v") {
+		return 1, sealed
+	}
+	version, err := strconv.Atoi(prefix[1:])
+	if err != nil {
+		return 0, sealed
+	}
+	return version, rest
+}
+
 // generateFingerprint creates a browser fingerprint hash
 func (j *JWTManager) generateFingerprint(r *http.Request) string {
 	fingerprint := r.Header.Get("User-Agent") +
@@ -79,10 +96,35 @@ func (j *JWTManager) generateFingerprint(r *http.Request) string {
 	return base64.StdEncoding.EncodeToString(hash[:16])
 }
 
-// hashIP hashes the client IP address
+// hashIP hashes the client IP address with an HMAC keyed from the active
+// keyring version, which it names so the hash can be checked after a rotation
 func (j *JWTManager) hashIP(ip string) string {
-	hash := sha256.Sum256([]byte(ip + "your-secret-salt")) // Use secure salt in production
-	return base64.StdEncoding.EncodeToString(hash[:16])
+	key := j.ring().Active()
+	return versionPrefix(key.Version) + ipMAC(key.Key, ip)
+}
+
+// ipMatches reports whether hash, from hashIP, was computed from ip
+func (j *JWTManager) ipMatches(hash, ip string) bool {
+	version, _ := sealedVersion(hash)
+	key, ok := j.ring().Key(version)
+	if !ok {
+		return false
+	}
+	return hmac.Equal([]byte(hash), []byte(versionPrefix(version)+ipMAC(key, ip)))
+}
+
+func ipMAC(key []byte, ip string) string {
+	mac := hmac.New(sha256.New, deriveKey(key, "signee ip hash"))
+	mac.Write([]byte(ip))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// deriveKey derives a MAC key for one purpose from a keyring key, so the
+// encryption key itself is never used for anything else
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
 }
 
 // getRealIP extracts the client's real IP address
@@ -101,3 +143,20 @@ func generateJTI() string {
 	rand.Read(b)
 	return base64.StdEncoding.EncodeToString(b)
 }
+
+// EncryptSecret seals a server-side secret (such as a TOTP seed) for storage at rest
+func (j *JWTManager) EncryptSecret(plaintext []byte) (string, error) {
+	return encryptData(plaintext, j.ring())
+}
+
+// DecryptSecret opens a value sealed by EncryptSecret
+func (j *JWTManager) DecryptSecret(encrypted string) ([]byte, error) {
+	return decryptData(encrypted, j.ring())
+}
+
+// NeedsReseal reports whether a value from EncryptSecret was sealed with
+// a key other than the active one
+func (j *JWTManager) NeedsReseal(encrypted string) bool {
+	version, _ := sealedVersion(encrypted)
+	return version != j.ring().Active().Version
+}
@@ -1,76 +1,99 @@
 package jwt
 
 import (
-	"crypto/ecdsa"
 	"fmt"
 	"net/http"
-	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/joho/godotenv"
 )
 
 // JWT Manager with elliptic keys for better security
 type JWTManager struct {
-	privateKey        *ecdsa.PrivateKey
-	publicKey         *ecdsa.PublicKey
+	keys              keySet
+	store             KeyStore // nil until UseKeyStore; keys then come from it
+	rotation          KeyRotation
 	accessExpiration  time.Duration
 	refreshExpiration time.Duration
 	issuer            string
-	encryptionKey     []byte
+	keyring           atomic.Pointer[Keyring] // swapped whole when the file changes
+	keyringPath       string
+	revocations       RevocationChecker
+	binding           TokenBinding
+	proofs            proofReplayCache
 }
 
-func NewJWTManager(issuer string) (*JWTManager, error) {
-	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		return nil, fmt.Errorf("failed to load .env file: %v", err)
-	}
-
+// NewJWTManager loads (or creates) the signing and claim-encryption keys.
+// It is built once at startup and shared by every handler that issues or checks tokens.
+// The key at privateKeyPath signs until UseKeyStore takes over.
+func NewJWTManager(issuer, privateKeyPath, encryptionKeyPath string) (*JWTManager, error) {
 	// Load or generate ECDSA key
-	privateKeyPath := os.Getenv("ECDSA_PRIVATE_KEY_PATH")
-	if privateKeyPath == "" {
-		privateKeyPath = "ecdsa_private.pem" // Default path
-	}
 	privateKey, err := loadOrGenerateECDSAKey(privateKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize ECDSA key: %v", err)
 	}
 
-	// Load or generate ChaCha20-Poly1305 key
-	encryptionKeyPath := os.Getenv("CHACHA20_KEY_PATH")
-	if encryptionKeyPath == "" {
-		encryptionKeyPath = "chacha20_key.bin" // Default path
+	// Load or generate the ChaCha20-Poly1305 keyring
+	keyring, err := loadOrGenerateKeyring(encryptionKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize encryption keyring: %v", err)
 	}
-	encryptionKey, err := loadOrGenerateEncryptionKey(encryptionKeyPath)
+
+	kid, err := thumbprint(&privateKey.PublicKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize encryption key: %v", err)
+		return nil, fmt.Errorf("failed to initialize ECDSA key: %v", err)
 	}
 
-	return &JWTManager{
-		privateKey:        privateKey,
-		publicKey:         &privateKey.PublicKey,
+	j := &JWTManager{
 		accessExpiration:  15 * time.Minute,
 		refreshExpiration: 7 * 24 * time.Hour,
 		issuer:            issuer,
-		encryptionKey:     encryptionKey,
-	}, nil
+		keyringPath:       encryptionKeyPath,
+	}
+	j.keyring.Store(keyring)
+	j.keys.set([]SigningKey{{ID: kid, PrivateKey: privateKey, ActivatedAt: time.Now()}})
+	return j, nil
+}
+
+// ring returns the current claim encryption keyring
+func (j *JWTManager) ring() *Keyring {
+	return j.keyring.Load()
+}
+
+// AccessExpiration is how long issued access tokens stay valid
+func (j *JWTManager) AccessExpiration() time.Duration {
+	return j.accessExpiration
+}
+
+// RefreshExpiration is how long issued refresh tokens stay valid
+func (j *JWTManager) RefreshExpiration() time.Duration {
+	return j.refreshExpiration
 }
 
-func (j *JWTManager) GenerateTokens(userID, username, role string, r *http.Request) (string, string, error) {
+// GenerateTokens issues an access/refresh pair belonging to the given refresh token family
+func (j *JWTManager) GenerateTokens(userID, username, role, familyID string, r *http.Request) (*auth.IssuedTokens, error) {
 	now := time.Now()
 	fingerprint := j.generateFingerprint(r)
 	ipHash := j.hashIP(getRealIP(r))
 
+	// Bind both tokens to the client's key when it proved possession of one
+	var cnf *auth.Confirmation
+	tokenType := "Bearer"
+	if jkt := DPoPKey(r.Context()); jkt != "" {
+		cnf = &auth.Confirmation{JKT: jkt}
+		tokenType = "DPoP"
+	}
+
 	// Encrypt UserID and Role
-	userIDEnc, err := encryptData([]byte(userID), j.encryptionKey)
+	userIDEnc, err := encryptData([]byte(userID), j.ring())
 	if err != nil {
-		return "", "", fmt.Errorf("failed to encrypt UserID: %v", err)
+		return nil, fmt.Errorf("failed to encrypt UserID: %v", err)
 	}
-	roleEnc, err := encryptData([]byte(role), j.encryptionKey)
+	roleEnc, err := encryptData([]byte(role), j.ring())
 	if err != nil {
-		return "", "", fmt.Errorf("failed to encrypt Role: %v", err)
+		return nil, fmt.Errorf("failed to encrypt Role: %v", err)
 	}
 
 	// Access Token
@@ -80,6 +103,8 @@ func (j *JWTManager) GenerateTokens(userID, username, role string, r *http.Reque
 		TokenType:   "access",
 		Fingerprint: fingerprint,
 		IPHash:      ipHash,
+		FamilyID:    familyID,
+		Cnf:         cnf,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(j.accessExpiration)),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -90,10 +115,9 @@ func (j *JWTManager) GenerateTokens(userID, username, role string, r *http.Reque
 		},
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodES256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(j.privateKey)
+	accessTokenString, err := j.sign(accessClaims)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to sign access token: %v", err)
+		return nil, fmt.Errorf("failed to sign access token: %v", err)
 	}
 
 	// Refresh Token
@@ -102,6 +126,8 @@ func (j *JWTManager) GenerateTokens(userID, username, role string, r *http.Reque
 		TokenType:   "refresh",
 		Fingerprint: fingerprint,
 		IPHash:      ipHash,
+		FamilyID:    familyID,
+		Cnf:         cnf,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(j.refreshExpiration)),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -112,23 +138,23 @@ func (j *JWTManager) GenerateTokens(userID, username, role string, r *http.Reque
 		},
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodES256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(j.privateKey)
+	refreshTokenString, err := j.sign(refreshClaims)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to sign refresh token: %v", err)
+		return nil, fmt.Errorf("failed to sign refresh token: %v", err)
 	}
 
-	return accessTokenString, refreshTokenString, nil
+	return &auth.IssuedTokens{
+		AccessToken:      accessTokenString,
+		RefreshToken:     refreshTokenString,
+		RefreshJTI:       refreshClaims.ID,
+		RefreshExpiresAt: refreshClaims.ExpiresAt.Time,
+		TokenType:        tokenType,
+	}, nil
 }
 
 // ValidateAccessToken validates an access token
 func (j *JWTManager) ValidateAccessToken(tokenString string, r *http.Request) (*auth.SecureClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &auth.SecureClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return j.publicKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &auth.SecureClaims{}, j.verificationKey)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %v", err)
@@ -144,40 +170,82 @@ func (j *JWTManager) ValidateAccessToken(tokenString string, r *http.Request) (*
 	}
 
 	// Decrypt UserID and Role
-	userID, err := decryptData(claims.UserIDEnc, j.encryptionKey)
+	userID, err := decryptData(claims.UserIDEnc, j.ring())
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt userID: %v", err)
 	}
 	claims.DecryptedUserID = string(userID)
 
-	role, err := decryptData(claims.RoleEnc, j.encryptionKey)
+	role, err := decryptData(claims.RoleEnc, j.ring())
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt role: %v", err)
 	}
 	claims.DecryptedRole = string(role)
 
-	// Verify fingerprint
-	if claims.Fingerprint != j.generateFingerprint(r) {
-		return nil, fmt.Errorf("token fingerprint mismatch")
+	// Verify the DPoP binding, or the fingerprint in legacy mode
+	if err := j.checkAccessBinding(tokenString, claims, r); err != nil {
+		return nil, err
+	}
+
+	// Reject tokens whose session has been logged out
+	if j.revocations != nil {
+		if claims.FamilyID == "" {
+			return nil, fmt.Errorf("token has no session")
+		}
+		revoked, err := j.revocations.IsFamilyRevoked(r.Context(), claims.FamilyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check revocation: %v", err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("token has been revoked")
+		}
 	}
 
 	// Log IP mismatch (no logout)
-	currentIPHash := j.hashIP(getRealIP(r))
-	if claims.IPHash != currentIPHash {
+	if !j.ipMatches(claims.IPHash, getRealIP(r)) {
 		fmt.Printf("Warning: IP mismatch for user %s\n", claims.DecryptedUserID)
 	}
 
 	return claims, nil
 }
 
+// sign signs claims with the active key and names it in the kid header
+func (j *JWTManager) sign(claims auth.SecureClaims) (string, error) {
+	key, ok := j.keys.signing()
+	if !ok {
+		return "", fmt.Errorf("no active signing key")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// verificationKey returns the key a token's kid names, if it is still trusted
+func (j *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// Tokens issued before signing keys were versioned carry no kid
+		var set jwt.VerificationKeySet
+		for _, key := range j.keys.all() {
+			set.Keys = append(set.Keys, &key.PrivateKey.PublicKey)
+		}
+		return set, nil
+	}
+
+	publicKey, ok := j.keys.verification(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return publicKey, nil
+}
+
 // ValidateRefreshToken validates a refresh token
 func (j *JWTManager) ValidateRefreshToken(tokenString string, r *http.Request) (*auth.SecureClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &auth.SecureClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return j.publicKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &auth.SecureClaims{}, j.verificationKey)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %v", err)
@@ -193,19 +261,18 @@ func (j *JWTManager) ValidateRefreshToken(tokenString string, r *http.Request) (
 	}
 
 	// Decrypt UserID
-	userID, err := decryptData(claims.UserIDEnc, j.encryptionKey)
+	userID, err := decryptData(claims.UserIDEnc, j.ring())
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt userID: %v", err)
 	}
 	claims.DecryptedUserID = string(userID)
 
-	if claims.Fingerprint != j.generateFingerprint(r) {
-		return nil, fmt.Errorf("refresh token fingerprint mismatch")
+	if err := j.checkRefreshBinding(claims, r); err != nil {
+		return nil, err
 	}
 
 	// Log IP mismatch (no logout)
-	currentIPHash := j.hashIP(getRealIP(r))
-	if claims.IPHash != currentIPHash {
+	if !j.ipMatches(claims.IPHash, getRealIP(r)) {
 		fmt.Printf("Warning: IP mismatch for user %s\n", claims.DecryptedUserID)
 	}
 
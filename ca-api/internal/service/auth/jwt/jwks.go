@@ -0,0 +1,48 @@
+package jwt
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// jwksMaxAge is how long verifiers may cache the key set. It stays below the
+// rotation lead, so a cached copy always has the next key in it.
+const jwksMaxAge = time.Hour
+
+// GetJWKS publishes every signing key that isn't retired, including the one
+// about to take over, so other services can verify Signee tokens
+func (j *JWTManager) GetJWKS(c *gin.Context) {
+	keys := j.keys.all()
+	set := auth.JWKS{Keys: make([]auth.JWK, 0, len(keys))}
+	for _, key := range keys {
+		x, y, err := publicKeyCoordinates(&key.PrivateKey.PublicKey)
+		if err != nil {
+			log.Printf("publicKeyCoordinates failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"code":    "INTERNAL_SERVER_ERROR",
+					"message": "Something went wrong. Please try again later.",
+					"status":  http.StatusInternalServerError,
+				},
+			})
+			return
+		}
+		set.Keys = append(set.Keys, auth.JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   x,
+			Y:   y,
+			Kid: key.ID,
+			Use: "sig",
+			Alg: "ES256",
+		})
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	c.JSON(http.StatusOK, set)
+}
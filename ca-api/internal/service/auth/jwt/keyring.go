@@ -0,0 +1,311 @@
+package jwt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// KeyState says what a keyring version may be used for
+type KeyState string
+
+const (
+	KeyActive      KeyState = "active"       // seals new data; exactly one version is active
+	KeyDecryptOnly KeyState = "decrypt-only" // opens data sealed before a rotation
+)
+
+// KeyVersion is one claim encryption key
+type KeyVersion struct {
+	Version int
+	State   KeyState
+	Key     []byte
+}
+
+// Keyring holds every claim encryption key whose ciphertexts may still be
+// around. Ciphertexts name the version that sealed them, so the active key
+// can change without invalidating live tokens or stored secrets.
+//
+// On disk it is one "version:state:base64key" per line; blank lines and
+// # comments are ignored. A file of exactly 32 raw bytes is the key from
+// before versioning and loads as version 1.
+type Keyring struct {
+	keys []KeyVersion // ordered by version
+}
+
+// NewKeyring returns a keyring with a fresh active key as version 1
+func NewKeyring() (*Keyring, error) {
+	key, err := newEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{keys: []KeyVersion{{Version: 1, State: KeyActive, Key: key}}}, nil
+}
+
+// LoadKeyring reads a keyring file
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption keyring: %v", err)
+	}
+	return ParseKeyring(data)
+}
+
+// ParseKeyring parses the contents of a keyring file
+func ParseKeyring(data []byte) (*Keyring, error) {
+	if len(data) == chacha20poly1305.KeySize {
+		return &Keyring{keys: []KeyVersion{{Version: 1, State: KeyActive, Key: slices.Clone(data)}}}, nil
+	}
+
+	ring := &Keyring{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("keyring line %d: expected version:state:key", n)
+		}
+		version, err := strconv.Atoi(fields[0])
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("keyring line %d: version must be a positive integer", n)
+		}
+		state := KeyState(fields[1])
+		if state != KeyActive && state != KeyDecryptOnly {
+			return nil, fmt.Errorf("keyring line %d: state must be %q or %q", n, KeyActive, KeyDecryptOnly)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("keyring line %d: %v", n, err)
+		}
+		if len(key) != chacha20poly1305.KeySize {
+			return nil, fmt.Errorf("keyring line %d: key must be %d bytes", n, chacha20poly1305.KeySize)
+		}
+		if _, dup := ring.Key(version); dup {
+			return nil, fmt.Errorf("keyring line %d: duplicate version %d", n, version)
+		}
+		ring.keys = append(ring.keys, KeyVersion{Version: version, State: state, Key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	active := 0
+	for _, key := range ring.keys {
+		if key.State == KeyActive {
+			active++
+		}
+	}
+	if active != 1 {
+		return nil, fmt.Errorf("keyring must have exactly one active key, found %d", active)
+	}
+	slices.SortFunc(ring.keys, func(a, b KeyVersion) int { return a.Version - b.Version })
+	return ring, nil
+}
+
+// Marshal encodes the keyring in its file format
+func (r *Keyring) Marshal() []byte {
+	var b bytes.Buffer
+	b.WriteString("# Signee claim encryption keyring: version:state:base64key\n")
+	for _, key := range r.keys {
+		fmt.Fprintf(&b, "%d:%s:%s\n", key.Version, key.State, base64.StdEncoding.EncodeToString(key.Key))
+	}
+	return b.Bytes()
+}
+
+// Save writes the keyring to path. The file is replaced in one step so a
+// running server never reads half of it.
+func (r *Keyring) Save(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*")
+	if err != nil {
+		return fmt.Errorf("failed to save encryption keyring: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(r.Marshal()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save encryption keyring: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save encryption keyring: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save encryption keyring: %v", err)
+	}
+	return nil
+}
+
+// Versions lists every key, oldest first
+func (r *Keyring) Versions() []KeyVersion {
+	return slices.Clone(r.keys)
+}
+
+// Active returns the key new data is sealed with
+func (r *Keyring) Active() KeyVersion {
+	for _, key := range r.keys {
+		if key.State == KeyActive {
+			return key
+		}
+	}
+	panic("jwt: keyring has no active key")
+}
+
+// Key returns key version, if the keyring still holds it
+func (r *Keyring) Key(version int) ([]byte, bool) {
+	for _, key := range r.keys {
+		if key.Version == version {
+			return key.Key, true
+		}
+	}
+	return nil, false
+}
+
+// Add generates the next version as decrypt-only. Once every instance has
+// loaded it, Promote can make it active without any instance meeting a
+// ciphertext it can't open.
+func (r *Keyring) Add() (KeyVersion, error) {
+	key, err := newEncryptionKey()
+	if err != nil {
+		return KeyVersion{}, err
+	}
+	added := KeyVersion{Version: r.keys[len(r.keys)-1].Version + 1, State: KeyDecryptOnly, Key: key}
+	r.keys = append(r.keys, added)
+	return added, nil
+}
+
+// Promote makes version the active key; the previously active key becomes decrypt-only
+func (r *Keyring) Promote(version int) error {
+	if _, ok := r.Key(version); !ok {
+		return fmt.Errorf("no key version %d", version)
+	}
+	for i := range r.keys {
+		if r.keys[i].Version == version {
+			r.keys[i].State = KeyActive
+		} else {
+			r.keys[i].State = KeyDecryptOnly
+		}
+	}
+	return nil
+}
+
+// Retire removes a decrypt-only version. Anything still sealed with it can no longer be opened.
+func (r *Keyring) Retire(version int) error {
+	i := slices.IndexFunc(r.keys, func(key KeyVersion) bool { return key.Version == version })
+	if i < 0 {
+		return fmt.Errorf("no key version %d", version)
+	}
+	if r.keys[i].State == KeyActive {
+		return fmt.Errorf("key version %d is active; promote another version first", version)
+	}
+	r.keys = slices.Delete(r.keys, i, i+1)
+	return nil
+}
+
+func newEncryptionKey() ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %v", err)
+	}
+	return key, nil
+}
+
+// Resealer re-encrypts data stored under an older keyring version with the active key
+type Resealer func(ctx context.Context) error
+
+// WatchKeyring reloads the keyring file every interval until ctx is done, so
+// keys added or promoted with signee-keyring take effect without a restart.
+// Whenever the active version changes, signing keys in the KeyStore and
+// anything the resealers cover are re-encrypted with it, after which older
+// versions can be retired.
+func (j *JWTManager) WatchKeyring(ctx context.Context, every time.Duration, reseal ...Resealer) {
+	resealed := 0
+	check := func() {
+		if err := j.reloadKeyring(); err != nil {
+			log.Printf("reloadKeyring failed: %v", err)
+		}
+		active := j.ring().Active().Version
+		if active == resealed {
+			return
+		}
+		if err := j.resealSigningKeys(ctx); err != nil {
+			log.Printf("resealSigningKeys failed: %v", err)
+			return
+		}
+		for _, r := range reseal {
+			if err := r(ctx); err != nil {
+				log.Printf("reseal failed: %v", err)
+				return
+			}
+		}
+		resealed = active
+	}
+
+	check()
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// reloadKeyring swaps in the keyring file's contents if they changed
+func (j *JWTManager) reloadKeyring() error {
+	ring, err := LoadKeyring(j.keyringPath)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(ring.Marshal(), j.ring().Marshal()) {
+		return nil
+	}
+	j.keyring.Store(ring)
+	log.Printf("Loaded encryption keyring, active version %d", ring.Active().Version)
+	return nil
+}
+
+// resealSigningKeys re-encrypts stored signing keys sealed under an older version
+func (j *JWTManager) resealSigningKeys(ctx context.Context) error {
+	if j.store == nil {
+		return nil
+	}
+	stored, err := j.store.ListKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list signing keys: %v", err)
+	}
+	for _, s := range stored {
+		if !j.NeedsReseal(s.SealedKey) {
+			continue
+		}
+		privateKey, err := j.unsealKey(s.SealedKey)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %v", s.ID, err)
+		}
+		sealed, err := j.sealKey(privateKey)
+		if err != nil {
+			return err
+		}
+		if err := j.store.ResealKey(ctx, s.ID, s.SealedKey, sealed); err != nil {
+			return fmt.Errorf("failed to reseal signing key %s: %v", s.ID, err)
+		}
+		log.Printf("Resealed signing key %s", s.ID)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+	for name, data := range map[string]string{
+		"no active":       "1:decrypt-only:" + key,
+		"two active":      "1:active:" + key + "\n2:active:" + key,
+		"duplicate":       "1:active:" + key + "\n1:decrypt-only:" + key,
+		"bad version":     "0:active:" + key,
+		"bad state":       "1:retired:" + key,
+		"short key":       "1:active:" + base64.StdEncoding.EncodeToString(make([]byte, 16)),
+		"not base64":      "1:active:%%%",
+		"missing field":   "1:" + key,
+		"empty":           "",
+		"only a comment":  "# nothing here\n",
+		"raw key too big": string(make([]byte, 33)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseKeyring([]byte(data)); err == nil {
+				t.Fatalf("ParseKeyring(%q) accepted", data)
+			}
+		})
+	}
+
+	// A bare 32-byte file is the key from before versioning
+	raw := make([]byte, 32)
+	rand.Read(raw)
+	ring, err := ParseKeyring(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := ring.Active(); active.Version != 1 || !bytes.Equal(active.Key, raw) {
+		t.Fatalf("legacy keyring = version %d, want the raw key as version 1", active.Version)
+	}
+
+	// Out-of-order versions, comments and blank lines parse and sort
+	ring, err = ParseKeyring([]byte("# rotated\n\n3:decrypt-only:" + key + "\n 2:active:" + key + " \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ring.Versions(); len(v) != 2 || v[0].Version != 2 || v[1].Version != 3 || ring.Active().Version != 2 {
+		t.Fatalf("ParseKeyring() = %+v, want versions 2 (active) and 3", v)
+	}
+}
+
+// TestKeyringRotation walks a rotation through the keyring file the way an
+// operator would, checking that nothing sealed before it stops opening until
+// the old version is retired
+func TestKeyringRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keyring.json")
+	j, err := NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+
+	secret, err := j.EncryptSecret([]byte("totp seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := j.GenerateTokens("alice", "alice@example.com", "viewer", "family", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate applies step to the keyring on disk and has the manager reload it
+	rotate := func(step func(ring *Keyring) error) {
+		t.Helper()
+		ring, err := LoadKeyring(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := step(ring); err != nil {
+			t.Fatal(err)
+		}
+		if err := ring.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := j.reloadKeyring(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var added KeyVersion
+	rotate(func(ring *Keyring) (err error) {
+		added, err = ring.Add()
+		return err
+	})
+	if added.Version != 2 || j.ring().Active().Version != 1 {
+		t.Fatalf("Add() = version %d, active %d; want 2 added and 1 still active", added.Version, j.ring().Active().Version)
+	}
+	rotate(func(ring *Keyring) error { return ring.Promote(2) })
+
+	// Data sealed under version 1 still opens, and new data uses version 2
+	if got, err := j.DecryptSecret(secret); err != nil || string(got) != "totp seed" {
+		t.Fatalf("DecryptSecret(v1) after promote = %q, %v", got, err)
+	}
+	if claims, err := j.ValidateAccessToken(tokens.AccessToken, r); err != nil || claims.DecryptedUserID != "alice" || claims.DecryptedRole != "viewer" {
+		t.Fatalf("ValidateAccessToken(v1) after promote = %+v, %v", claims, err)
+	}
+	if _, err := j.ValidateRefreshToken(tokens.RefreshToken, r); err != nil {
+		t.Fatalf("ValidateRefreshToken(v1) after promote = %v", err)
+	}
+	if !j.NeedsReseal(secret) {
+		t.Fatal("NeedsReseal(v1) = false after promoting v2")
+	}
+	resealed, err := j.EncryptSecret([]byte("totp seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resealed, versionPrefix(2)) || j.NeedsReseal(resealed) {
+		t.Fatalf("EncryptSecret() = %q, want it sealed with v2", resealed)
+	}
+
+	// The active version can't be retired, on disk or in memory
+	ring, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ring.Retire(2); err == nil {
+		t.Fatal("Retire(active) succeeded")
+	}
+	if err := ring.Retire(7); err == nil {
+		t.Fatal("Retire(unknown) succeeded")
+	}
+	if err := ring.Promote(7); err == nil {
+		t.Fatal("Promote(unknown) succeeded")
+	}
+
+	// Retiring version 1 strands whatever wasn't resealed, and only that
+	rotate(func(ring *Keyring) error { return ring.Retire(1) })
+	if _, err := j.DecryptSecret(secret); err == nil {
+		t.Fatal("DecryptSecret(v1) after retiring v1 succeeded")
+	}
+	if _, err := j.ValidateAccessToken(tokens.AccessToken, r); err == nil {
+		t.Fatal("ValidateAccessToken(v1) after retiring v1 succeeded")
+	}
+	if got, err := j.DecryptSecret(resealed); err != nil || string(got) != "totp seed" {
+		t.Fatalf("DecryptSecret(v2) after retiring v1 = %q, %v", got, err)
+	}
+}
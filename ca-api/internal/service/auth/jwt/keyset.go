@@ -0,0 +1,300 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SigningKey is one version of the token signing key
+type SigningKey struct {
+	ID          string // RFC 7638 thumbprint of the public key, stamped into tokens as kid
+	PrivateKey  *ecdsa.PrivateKey
+	CreatedAt   time.Time
+	ActivatedAt time.Time // zero while the key is published ahead of use
+}
+
+// StoredKey is a signing key as a KeyStore keeps it, with the private key
+// sealed under the claim encryption key
+type StoredKey struct {
+	ID          string
+	SealedKey   string
+	CreatedAt   time.Time
+	ActivatedAt time.Time
+}
+
+// KeyStore keeps signing keys where every API instance can see them
+type KeyStore interface {
+	// ListKeys returns every key that hasn't been retired
+	ListKeys(ctx context.Context) ([]StoredKey, error)
+	// AddKey stores a key, pending unless ActivatedAt is set. It reports false
+	// when another instance already added a pending key.
+	AddKey(ctx context.Context, key StoredKey) (bool, error)
+	ActivateKey(ctx context.Context, kid string) error
+	RetireKey(ctx context.Context, kid string) error
+	// ResealKey replaces a key's sealed form, unless it changed since it was listed
+	ResealKey(ctx context.Context, kid, oldSealed, newSealed string) error
+}
+
+// KeyRotation schedules signing key replacement
+type KeyRotation struct {
+	Interval time.Duration // how long each key signs; zero turns scheduled rotation off
+	Lead     time.Duration // how long a new key is published before it signs
+	Check    time.Duration // how often to rotate when due and pick up keys other instances added
+}
+
+// DefaultKeyRotation replaces the signing key monthly. The lead gives every
+// instance, and anyone caching the JWKS, a day to learn a key before tokens
+// signed with it show up.
+var DefaultKeyRotation = KeyRotation{
+	Interval: 30 * 24 * time.Hour,
+	Lead:     24 * time.Hour,
+	Check:    10 * time.Minute,
+}
+
+// keySet is the signing keys in use, oldest first
+type keySet struct {
+	mu   sync.RWMutex
+	keys []SigningKey
+}
+
+func (ks *keySet) set(keys []SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+}
+
+func (ks *keySet) all() []SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return slices.Clone(ks.keys)
+}
+
+// signing returns the most recently activated key
+func (ks *keySet) signing() (SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	var newest SigningKey
+	for _, key := range ks.keys {
+		if !key.ActivatedAt.IsZero() && key.ActivatedAt.After(newest.ActivatedAt) {
+			newest = key
+		}
+	}
+	return newest, newest.PrivateKey != nil
+}
+
+// verification returns the public key for kid; pending keys count, since
+// another instance may have activated one this instance hasn't reloaded yet
+func (ks *keySet) verification(kid string) (*ecdsa.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, key := range ks.keys {
+		if key.ID == kid {
+			return &key.PrivateKey.PublicKey, true
+		}
+	}
+	return nil, false
+}
+
+func newSigningKey() (SigningKey, error) {
+	privateKey, err := generateECDSAKey()
+	if err != nil {
+		return SigningKey{}, err
+	}
+	kid, err := thumbprint(&privateKey.PublicKey)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{ID: kid, PrivateKey: privateKey}, nil
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of a P-256 public key
+func thumbprint(pub *ecdsa.PublicKey) (string, error) {
+	x, y, err := publicKeyCoordinates(pub)
+	if err != nil {
+		return "", err
+	}
+	// Members in lexicographic order, no whitespace, as the RFC requires
+	canonical := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, x, y)
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// publicKeyCoordinates returns the base64url-encoded, fixed-width x and y of pub
+func publicKeyCoordinates(pub *ecdsa.PublicKey) (x, y string, err error) {
+	ecdhKey, err := pub.ECDH()
+	if err != nil {
+		return "", "", fmt.Errorf("invalid ECDSA public key: %v", err)
+	}
+	// Uncompressed point: 0x04 || X || Y
+	point := ecdhKey.Bytes()
+	size := (len(point) - 1) / 2
+	return base64.RawURLEncoding.EncodeToString(point[1 : 1+size]),
+		base64.RawURLEncoding.EncodeToString(point[1+size:]), nil
+}
+
+// UseKeyStore moves signing keys into store so every instance signs and
+// verifies with the same versioned keys. The first time, the key loaded at
+// startup is stored as the active key so tokens it already signed stay valid.
+func (j *JWTManager) UseKeyStore(ctx context.Context, store KeyStore, rotation KeyRotation) error {
+	if rotation.Interval > 0 && (rotation.Lead <= rotation.Check || rotation.Lead <= jwksMaxAge) {
+		return fmt.Errorf("signing key lead time (%s) must be longer than the check interval (%s) and JWKS cache lifetime (%s)",
+			rotation.Lead, rotation.Check, jwksMaxAge)
+	}
+	if rotation.Interval > 0 && rotation.Interval <= rotation.Lead {
+		return fmt.Errorf("signing key rotation interval (%s) must be longer than its lead time (%s)", rotation.Interval, rotation.Lead)
+	}
+
+	stored, err := store.ListKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list signing keys: %v", err)
+	}
+	if !slices.ContainsFunc(stored, func(key StoredKey) bool { return !key.ActivatedAt.IsZero() }) {
+		initial, ok := j.keys.signing()
+		if !ok {
+			return fmt.Errorf("no signing key to start from")
+		}
+		sealed, err := j.sealKey(initial.PrivateKey)
+		if err != nil {
+			return err
+		}
+		// Another instance starting at the same time may store the same key; that's fine
+		_, err = store.AddKey(ctx, StoredKey{ID: initial.ID, SealedKey: sealed, ActivatedAt: time.Now()})
+		if err != nil {
+			return fmt.Errorf("failed to store initial signing key: %v", err)
+		}
+	}
+
+	j.store = store
+	j.rotation = rotation
+	return j.reloadKeys(ctx)
+}
+
+// RunKeyRotation rotates the signing key on schedule and picks up keys other
+// instances added, until ctx is done. It does nothing without a KeyStore.
+func (j *JWTManager) RunKeyRotation(ctx context.Context) {
+	if j.store == nil {
+		return
+	}
+	ticker := time.NewTicker(j.rotation.Check)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.RotateKeys(ctx); err != nil {
+				log.Printf("RotateKeys failed: %v", err)
+			}
+		}
+	}
+}
+
+// RotateKeys moves each key one step along its lifecycle when it is due:
+// a new key is published Lead before the active one has signed for Interval,
+// takes over once it has been published for Lead, and the key it replaced is
+// retired once every token that key signed has expired.
+func (j *JWTManager) RotateKeys(ctx context.Context) error {
+	if err := j.reloadKeys(ctx); err != nil {
+		return err
+	}
+	now := time.Now()
+	keys := j.keys.all()
+
+	if j.rotation.Interval > 0 {
+		active, _ := j.keys.signing()
+		pendingIdx := slices.IndexFunc(keys, func(key SigningKey) bool { return key.ActivatedAt.IsZero() })
+		switch {
+		case pendingIdx >= 0 && now.Sub(keys[pendingIdx].CreatedAt) >= j.rotation.Lead:
+			if err := j.store.ActivateKey(ctx, keys[pendingIdx].ID); err != nil {
+				return fmt.Errorf("failed to activate signing key: %v", err)
+			}
+			log.Printf("Activated signing key %s", keys[pendingIdx].ID)
+		case pendingIdx < 0 && now.Sub(active.ActivatedAt) >= j.rotation.Interval-j.rotation.Lead:
+			key, err := newSigningKey()
+			if err != nil {
+				return err
+			}
+			sealed, err := j.sealKey(key.PrivateKey)
+			if err != nil {
+				return err
+			}
+			added, err := j.store.AddKey(ctx, StoredKey{ID: key.ID, SealedKey: sealed})
+			if err != nil {
+				return fmt.Errorf("failed to store signing key: %v", err)
+			}
+			if added {
+				log.Printf("Published signing key %s", key.ID)
+			}
+		}
+	}
+
+	// Refresh tokens live longest, so a replaced key is kept that long
+	activated := slices.DeleteFunc(keys, func(key SigningKey) bool { return key.ActivatedAt.IsZero() })
+	slices.SortFunc(activated, func(a, b SigningKey) int { return a.ActivatedAt.Compare(b.ActivatedAt) })
+	for i := 0; i+1 < len(activated); i++ {
+		if now.Sub(activated[i+1].ActivatedAt) < j.refreshExpiration {
+			continue
+		}
+		if err := j.store.RetireKey(ctx, activated[i].ID); err != nil {
+			return fmt.Errorf("failed to retire signing key: %v", err)
+		}
+		log.Printf("Retired signing key %s", activated[i].ID)
+	}
+
+	return j.reloadKeys(ctx)
+}
+
+// reloadKeys replaces the key set with what the store holds
+func (j *JWTManager) reloadKeys(ctx context.Context) error {
+	stored, err := j.store.ListKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list signing keys: %v", err)
+	}
+
+	keys := make([]SigningKey, 0, len(stored))
+	for _, s := range stored {
+		privateKey, err := j.unsealKey(s.SealedKey)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %v", s.ID, err)
+		}
+		// The kid is derived from the key, so a mismatch means the row was tampered with
+		if kid, err := thumbprint(&privateKey.PublicKey); err != nil || kid != s.ID {
+			return fmt.Errorf("signing key %s does not match its kid", s.ID)
+		}
+		keys = append(keys, SigningKey{
+			ID:          s.ID,
+			PrivateKey:  privateKey,
+			CreatedAt:   s.CreatedAt,
+			ActivatedAt: s.ActivatedAt,
+		})
+	}
+	if !slices.ContainsFunc(keys, func(key SigningKey) bool { return !key.ActivatedAt.IsZero() }) {
+		return fmt.Errorf("no active signing key")
+	}
+
+	j.keys.set(keys)
+	return nil
+}
+
+func (j *JWTManager) sealKey(key *ecdsa.PrivateKey) (string, error) {
+	data, err := encodeECDSAKey(key)
+	if err != nil {
+		return "", err
+	}
+	return encryptData(data, j.ring())
+}
+
+func (j *JWTManager) unsealKey(sealed string) (*ecdsa.PrivateKey, error) {
+	data, err := decryptData(sealed, j.ring())
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal: %v", err)
+	}
+	return decodeECDSAKey(data)
+}
@@ -0,0 +1,246 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memKeyStore is a KeyStore in memory; retired keys are dropped
+type memKeyStore struct {
+	mu   sync.Mutex
+	keys []StoredKey
+}
+
+func (s *memKeyStore) ListKeys(context.Context) ([]StoredKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.keys), nil
+}
+
+func (s *memKeyStore) AddKey(_ context.Context, key StoredKey) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key.ActivatedAt.IsZero() && slices.ContainsFunc(s.keys, func(k StoredKey) bool { return k.ActivatedAt.IsZero() }) {
+		return false, nil
+	}
+	key.CreatedAt = time.Now()
+	s.keys = append(s.keys, key)
+	return true, nil
+}
+
+func (s *memKeyStore) ActivateKey(_ context.Context, kid string) error {
+	s.update(kid, func(k *StoredKey) { k.ActivatedAt = time.Now() })
+	return nil
+}
+
+func (s *memKeyStore) RetireKey(_ context.Context, kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = slices.DeleteFunc(s.keys, func(k StoredKey) bool { return k.ID == kid })
+	return nil
+}
+
+func (s *memKeyStore) ResealKey(_ context.Context, kid, oldSealed, newSealed string) error {
+	s.update(kid, func(k *StoredKey) {
+		if k.SealedKey == oldSealed {
+			k.SealedKey = newSealed
+		}
+	})
+	return nil
+}
+
+func (s *memKeyStore) update(kid string, f func(k *StoredKey)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.keys {
+		if s.keys[i].ID == kid {
+			f(&s.keys[i])
+		}
+	}
+}
+
+// backdate moves every timestamp of key kid d into the past
+func (s *memKeyStore) backdate(kid string, d time.Duration) {
+	s.update(kid, func(k *StoredKey) {
+		k.CreatedAt = k.CreatedAt.Add(-d)
+		if !k.ActivatedAt.IsZero() {
+			k.ActivatedAt = k.ActivatedAt.Add(-d)
+		}
+	})
+}
+
+// publishedKids lists the kids GetJWKS serves
+func publishedKids(t *testing.T, j *JWTManager) []string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	j.GetJWKS(c)
+
+	var set auth.JWKS
+	if err := json.Unmarshal(w.Body.Bytes(), &set); w.Code != http.StatusOK || err != nil {
+		t.Fatalf("GetJWKS = %d: %s", w.Code, w.Body)
+	}
+	var kids []string
+	for _, key := range set.Keys {
+		kids = append(kids, key.Kid)
+	}
+	slices.Sort(kids)
+	return kids
+}
+
+// tokenKid is the kid in a token's header
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &auth.SecureClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// TestSigningKeyRotation takes the signing key through a full rotation and
+// checks that tokens verify exactly while their kid is published
+func TestSigningKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	store := &memKeyStore{}
+	if err := j.UseKeyStore(ctx, store, DefaultKeyRotation); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	issue := func() *auth.IssuedTokens {
+		t.Helper()
+		tokens, err := j.GenerateTokens("alice", "alice@example.com", "viewer", "family", r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens
+	}
+
+	old := issue()
+	oldKid := tokenKid(t, old.AccessToken)
+	if kids := publishedKids(t, j); !slices.Equal(kids, []string{oldKid}) {
+		t.Fatalf("JWKS = %v, want only %s", kids, oldKid)
+	}
+
+	// Due for rotation: the next key is published but doesn't sign yet
+	store.backdate(oldKid, DefaultKeyRotation.Interval)
+	if err := j.RotateKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	kids := publishedKids(t, j)
+	if len(kids) != 2 {
+		t.Fatalf("JWKS after publishing = %v, want the next key alongside %s", kids, oldKid)
+	}
+	newKid := kids[0]
+	if newKid == oldKid {
+		newKid = kids[1]
+	}
+	if kid := tokenKid(t, issue().AccessToken); kid != oldKid {
+		t.Fatalf("signed with %s while the next key was pending, want %s", kid, oldKid)
+	}
+
+	// After the lead the new key signs, and the replaced one still verifies
+	store.backdate(newKid, DefaultKeyRotation.Lead)
+	if err := j.RotateKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	current := issue()
+	if kid := tokenKid(t, current.AccessToken); kid != newKid {
+		t.Fatalf("signed with %s after activation, want %s", kid, newKid)
+	}
+	if kids := publishedKids(t, j); !slices.Contains(kids, oldKid) {
+		t.Fatalf("JWKS after activation = %v, want %s still published", kids, oldKid)
+	}
+	if _, err := j.ValidateAccessToken(old.AccessToken, r); err != nil {
+		t.Fatalf("ValidateAccessToken(replaced key) = %v", err)
+	}
+	if _, err := j.ValidateRefreshToken(old.RefreshToken, r); err != nil {
+		t.Fatalf("ValidateRefreshToken(replaced key) = %v", err)
+	}
+
+	// Once refresh tokens it signed have expired, the replaced key is retired
+	store.backdate(newKid, j.RefreshExpiration())
+	if err := j.RotateKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if kids := publishedKids(t, j); !slices.Equal(kids, []string{newKid}) {
+		t.Fatalf("JWKS after retirement = %v, want only %s", kids, newKid)
+	}
+	if _, err := j.ValidateRefreshToken(old.RefreshToken, r); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Fatalf("ValidateRefreshToken(retired key) = %v, want an unknown signing key", err)
+	}
+	if _, err := j.ValidateAccessToken(current.AccessToken, r); err != nil {
+		t.Fatalf("ValidateAccessToken(active key) = %v", err)
+	}
+}
+
+func TestUnknownKidRejected(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	tokens, err := j.GenerateTokens("alice", "alice@example.com", "viewer", "family", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := j.ValidateAccessToken(tokens.AccessToken, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := newSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := tokenKid(t, tokens.AccessToken)
+
+	// resign signs the valid token's claims with key under kid
+	resign := func(kid string, key any) string {
+		t.Helper()
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	signing, _ := j.keys.signing()
+	if _, err := j.ValidateAccessToken(resign(known, signing.PrivateKey), r); err != nil {
+		t.Fatalf("ValidateAccessToken(re-signed with the real key) = %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"unknown kid":          resign(foreign.ID, foreign.PrivateKey),
+		"made-up kid":          resign("not-a-thumbprint", foreign.PrivateKey),
+		"known kid, other key": resign(known, foreign.PrivateKey),
+		"no kid, unknown key":  resign("", foreign.PrivateKey),
+		"bad signature":        tokens.AccessToken[:strings.LastIndex(tokens.AccessToken, ".")] + ".c2ln",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := j.ValidateAccessToken(token, r); err == nil {
+				t.Fatal("ValidateAccessToken() accepted the token")
+			}
+		})
+	}
+}
@@ -16,10 +16,9 @@ func loadOrGenerateECDSAKey(filename string) (*ecdsa.PrivateKey, error) {
 		return loadECDSAKey(filename)
 	}
 
-	// Generate new ECDSA key (P-256 curve for ES256)
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	privateKey, err := generateECDSAKey()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate ECDSA key: %v", err)
+		return nil, err
 	}
 
 	// Save the key
@@ -30,17 +29,22 @@ func loadOrGenerateECDSAKey(filename string) (*ecdsa.PrivateKey, error) {
 	return privateKey, nil
 }
 
+// generateECDSAKey generates a P-256 key for ES256
+func generateECDSAKey() (*ecdsa.PrivateKey, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ECDSA key: %v", err)
+	}
+	return privateKey, nil
+}
+
 // saveECDSAKey saves ECDSA private key to file with 0600 permissions
 func saveECDSAKey(filename string, key *ecdsa.PrivateKey) error {
-	keyBytes, err := x509.MarshalECPrivateKey(key)
+	data, err := encodeECDSAKey(key)
 	if err != nil {
-		return fmt.Errorf("failed to marshal ECDSA key: %v", err)
-	}
-	pemBlock := &pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: keyBytes,
+		return err
 	}
-	return os.WriteFile(filename, pem.EncodeToMemory(pemBlock), 0600)
+	return os.WriteFile(filename, data, 0600)
 }
 
 // loadECDSAKey loads ECDSA private key from file
@@ -49,9 +53,31 @@ func loadECDSAKey(filename string) (*ecdsa.PrivateKey, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read ECDSA key file: %v", err)
 	}
+	key, err := decodeECDSAKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v in %s", err, filename)
+	}
+	return key, nil
+}
+
+// encodeECDSAKey PEM-encodes an ECDSA private key
+func encodeECDSAKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ECDSA key: %v", err)
+	}
+	pemBlock := &pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: keyBytes,
+	}
+	return pem.EncodeToMemory(pemBlock), nil
+}
+
+// decodeECDSAKey parses a PEM-encoded ECDSA private key
+func decodeECDSAKey(data []byte) (*ecdsa.PrivateKey, error) {
 	pemBlock, _ := pem.Decode(data)
 	if pemBlock == nil || pemBlock.Type != "EC PRIVATE KEY" {
-		return nil, fmt.Errorf("invalid PEM block in %s", filename)
+		return nil, fmt.Errorf("invalid PEM block")
 	}
 	key, err := x509.ParseECPrivateKey(pemBlock.Bytes)
 	if err != nil {
@@ -0,0 +1,86 @@
+package jwt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationChecker reports whether every token in a refresh token family has been revoked
+type RevocationChecker interface {
+	IsFamilyRevoked(ctx context.Context, familyID string) (bool, error)
+	Invalidate(familyID string)
+}
+
+// SetRevocationChecker makes ValidateAccessToken reject tokens from revoked families
+func (j *JWTManager) SetRevocationChecker(rc RevocationChecker) {
+	j.revocations = rc
+}
+
+// Revocations returns the checker so revocations can invalidate cached answers
+func (j *JWTManager) Revocations() RevocationChecker {
+	return j.revocations
+}
+
+type revocationEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+// RevocationCache memoizes family lookups for ttl so validating an access token
+// doesn't cost a database round trip on every request. Revocations made on this
+// instance take effect immediately; other instances pick them up within ttl.
+type RevocationCache struct {
+	lookup func(ctx context.Context, familyID string) (bool, error)
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]revocationEntry
+}
+
+func NewRevocationCache(lookup func(ctx context.Context, familyID string) (bool, error), ttl time.Duration) *RevocationCache {
+	return &RevocationCache{
+		lookup:  lookup,
+		ttl:     ttl,
+		entries: make(map[string]revocationEntry),
+	}
+}
+
+func (rc *RevocationCache) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	now := time.Now()
+
+	rc.mu.Lock()
+	entry, ok := rc.entries[familyID]
+	rc.mu.Unlock()
+	if ok && now.Sub(entry.checkedAt) < rc.ttl {
+		return entry.revoked, nil
+	}
+
+	revoked, err := rc.lookup(ctx, familyID)
+	if err != nil {
+		return false, err
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.entries) > 10000 {
+		rc.pruneLocked(now)
+	}
+	rc.entries[familyID] = revocationEntry{revoked: revoked, checkedAt: now}
+	return revoked, nil
+}
+
+// Invalidate forgets the cached answer for a family, typically right after revoking it
+func (rc *RevocationCache) Invalidate(familyID string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	delete(rc.entries, familyID)
+}
+
+func (rc *RevocationCache) pruneLocked(now time.Time) {
+	for id, entry := range rc.entries {
+		if now.Sub(entry.checkedAt) >= rc.ttl {
+			delete(rc.entries, id)
+		}
+	}
+}
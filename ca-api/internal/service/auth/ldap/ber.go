@@ -0,0 +1,187 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER tags used by LDAPv3 (RFC 4511). Only definite-length encodings are
+// produced or accepted, which is all LDAP allows.
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	classApplication = 0x40
+	classContext     = 0x80
+	constructed      = 0x20
+
+	// Caps any one message; directory entries are far smaller
+	maxPacket = 4 << 20
+)
+
+// packet is a decoded BER element
+type packet struct {
+	tag      byte
+	value    []byte    // contents of primitive elements
+	children []*packet // contents of constructed elements
+}
+
+func (p *packet) constructed() bool {
+	return p.tag&constructed != 0
+}
+
+func (p *packet) str() string {
+	return string(p.value)
+}
+
+func (p *packet) int() (int64, error) {
+	if len(p.value) == 0 || len(p.value) > 8 {
+		return 0, errors.New("ber: invalid integer")
+	}
+	v := int64(int8(p.value[0]))
+	for _, b := range p.value[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+// encode helpers build the wire form directly
+
+func ber(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	case n <= 0xffff:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+func berSeq(tag byte, items ...[]byte) []byte {
+	var content []byte
+	for _, item := range items {
+		content = append(content, item...)
+	}
+	return ber(tag, content)
+}
+
+func berInt(tag byte, v int64) []byte {
+	// Minimal two's complement: stop once the remaining value fits the byte just added
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if v >= -128 && v < 128 {
+			return ber(tag, b)
+		}
+		v >>= 8
+	}
+}
+
+func berString(tag byte, s string) []byte {
+	return ber(tag, []byte(s))
+}
+
+func berBool(v bool) []byte {
+	if v {
+		return ber(tagBoolean, []byte{0xff})
+	}
+	return ber(tagBoolean, []byte{0x00})
+}
+
+// readPacket reads one complete element from the stream
+func readPacket(r *bufio.Reader) (*packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if tag&0x1f == 0x1f {
+		return nil, errors.New("ber: multi-byte tags are not supported")
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		n := int(first & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, errors.New("ber: indefinite or oversized length")
+		}
+		length = 0
+		for range n {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxPacket {
+		return nil, fmt.Errorf("ber: element of %d bytes is too large", length)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parsePacket(tag, content, 0)
+}
+
+func parsePacket(tag byte, content []byte, depth int) (*packet, error) {
+	p := &packet{tag: tag}
+	if tag&constructed == 0 {
+		p.value = content
+		return p, nil
+	}
+	if depth > 32 {
+		return nil, errors.New("ber: nesting too deep")
+	}
+
+	for len(content) > 0 {
+		if len(content) < 2 {
+			return nil, errors.New("ber: truncated element")
+		}
+		childTag, first := content[0], content[1]
+		content = content[2:]
+		if childTag&0x1f == 0x1f {
+			return nil, errors.New("ber: multi-byte tags are not supported")
+		}
+
+		length := int(first)
+		if first&0x80 != 0 {
+			n := int(first & 0x7f)
+			if n == 0 || n > 4 || len(content) < n {
+				return nil, errors.New("ber: invalid length")
+			}
+			length = 0
+			for _, b := range content[:n] {
+				length = length<<8 | int(b)
+			}
+			content = content[n:]
+		}
+		if length < 0 || length > len(content) {
+			return nil, errors.New("ber: truncated element")
+		}
+
+		child, err := parsePacket(childTag, content[:length], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+		content = content[length:]
+	}
+	return p, nil
+}
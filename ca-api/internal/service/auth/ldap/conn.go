@@ -0,0 +1,277 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol operation tags (RFC 4511 section 4.2 onwards)
+const (
+	opBindRequest       = classApplication | constructed | 0
+	opBindResponse      = classApplication | constructed | 1
+	opUnbindRequest     = classApplication | 2
+	opSearchRequest     = classApplication | constructed | 3
+	opSearchEntry       = classApplication | constructed | 4
+	opSearchDone        = classApplication | constructed | 5
+	opSearchReference   = classApplication | constructed | 19
+	opExtendedRequest   = classApplication | constructed | 23
+	opExtendedResponse  = classApplication | constructed | 24
+	authSimple          = classContext | 0
+	extendedRequestName = classContext | 0
+
+	oidStartTLS = "1.3.6.1.4.1.1466.20037"
+
+	scopeBase    = 0
+	scopeSubtree = 2
+
+	resultSuccess            = 0
+	resultInvalidCredentials = 49
+)
+
+// Error is a non-success LDAPResult
+type Error struct {
+	Code    int64
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// entry is one SearchResultEntry; attribute names are lower-cased
+type entry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+func (e *entry) first(name string) string {
+	if values := e.attrs[strings.ToLower(name)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// conn is a single LDAPv3 session. Requests are issued one at a time.
+type conn struct {
+	netConn net.Conn
+	r       *bufio.Reader
+	msgID   int64
+}
+
+// dial connects over TLS, either directly (ldaps) or by upgrading with StartTLS.
+// The deadline covers the whole session.
+func dial(ctx context.Context, rawURL string, startTLS bool, tlsConfig *tls.Config, timeout time.Duration) (*conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	var netConn net.Conn
+	switch u.Scheme {
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		cfg := tlsConfig.Clone()
+		cfg.ServerName = u.Hostname()
+		d := tls.Dialer{NetDialer: &net.Dialer{Timeout: timeout}, Config: cfg}
+		netConn, err = d.DialContext(ctx, "tcp", host)
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		d := net.Dialer{Timeout: timeout}
+		netConn, err = d.DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	netConn.SetDeadline(deadline)
+
+	c := &conn{netConn: netConn, r: bufio.NewReader(netConn)}
+	if u.Scheme == "ldap" && startTLS {
+		if err := c.startTLS(u.Hostname(), tlsConfig); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *conn) startTLS(serverName string, tlsConfig *tls.Config) error {
+	resp, err := c.roundTrip(berSeq(opExtendedRequest, berString(extendedRequestName, oidStartTLS)), opExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if err := checkResult(resp); err != nil {
+		return err
+	}
+
+	cfg := tlsConfig.Clone()
+	cfg.ServerName = serverName
+	tlsConn := tls.Client(c.netConn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.netConn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	return nil
+}
+
+// bind performs a simple bind. Callers must not pass an empty password for a
+// user: servers treat that as an unauthenticated bind and report success.
+func (c *conn) bind(dn, password string) error {
+	resp, err := c.roundTrip(berSeq(opBindRequest,
+		berInt(tagInteger, 3),
+		berString(tagOctetString, dn),
+		berString(authSimple, password),
+	), opBindResponse)
+	if err != nil {
+		return err
+	}
+	return checkResult(resp)
+}
+
+// search returns the entries matching filter, asking for at most sizeLimit
+func (c *conn) search(base string, scope int64, filter string, attrs []string, sizeLimit int64) ([]*entry, error) {
+	filterBER, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var attrList [][]byte
+	for _, a := range attrs {
+		attrList = append(attrList, berString(tagOctetString, a))
+	}
+
+	if err := c.send(berSeq(opSearchRequest,
+		berString(tagOctetString, base),
+		berInt(tagEnumerated, scope),
+		berInt(tagEnumerated, 0), // never dereference aliases
+		berInt(tagInteger, sizeLimit),
+		berInt(tagInteger, 0),
+		berBool(false),
+		filterBER,
+		berSeq(tagSequence, attrList...),
+	)); err != nil {
+		return nil, err
+	}
+
+	var entries []*entry
+	for {
+		op, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case opSearchEntry:
+			e, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case opSearchReference:
+			// Referrals to other servers are not followed
+		case opSearchDone:
+			if err := checkResult(op); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("ldap: unexpected operation 0x%02x during search", op.tag)
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.send(ber(opUnbindRequest, nil))
+	c.netConn.Close()
+}
+
+func (c *conn) roundTrip(op []byte, want byte) (*packet, error) {
+	if err := c.send(op); err != nil {
+		return nil, err
+	}
+	resp, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if resp.tag != want {
+		return nil, fmt.Errorf("ldap: unexpected response 0x%02x", resp.tag)
+	}
+	return resp, nil
+}
+
+func (c *conn) send(op []byte) error {
+	c.msgID++
+	_, err := c.netConn.Write(berSeq(tagSequence, berInt(tagInteger, c.msgID), op))
+	return err
+}
+
+// read returns the protocol op of the next message for the current request
+func (c *conn) read() (*packet, error) {
+	msg, err := readPacket(c.r)
+	if err != nil {
+		return nil, err
+	}
+	if msg.tag != tagSequence || len(msg.children) < 2 {
+		return nil, errors.New("ldap: malformed message")
+	}
+	id, err := msg.children[0].int()
+	if err != nil {
+		return nil, err
+	}
+	if id == 0 {
+		// Unsolicited notification, in practice the server disconnecting us
+		return nil, errors.New("ldap: server sent a notice of disconnection")
+	}
+	if id != c.msgID {
+		return nil, fmt.Errorf("ldap: response to message %d, expected %d", id, c.msgID)
+	}
+	return msg.children[1], nil
+}
+
+// checkResult turns an LDAPResult into an error unless it reports success
+func checkResult(op *packet) error {
+	if len(op.children) < 3 || op.children[0].tag != tagEnumerated {
+		return errors.New("ldap: malformed result")
+	}
+	code, err := op.children[0].int()
+	if err != nil {
+		return err
+	}
+	if code != resultSuccess {
+		return &Error{Code: code, Message: op.children[2].str()}
+	}
+	return nil
+}
+
+func parseEntry(op *packet) (*entry, error) {
+	if len(op.children) != 2 || op.children[1].tag != tagSequence {
+		return nil, errors.New("ldap: malformed search entry")
+	}
+	e := &entry{dn: op.children[0].str(), attrs: make(map[string][]string)}
+	for _, attr := range op.children[1].children {
+		if len(attr.children) != 2 || attr.children[1].tag != tagSet {
+			return nil, errors.New("ldap: malformed attribute")
+		}
+		name := strings.ToLower(attr.children[0].str())
+		for _, v := range attr.children[1].children {
+			e.attrs[name] = append(e.attrs[name], v.str())
+		}
+	}
+	return e, nil
+}
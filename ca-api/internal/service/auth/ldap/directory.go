@@ -0,0 +1,285 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/ldap"
+)
+
+var ErrInvalidCredentials = errors.New("invalid directory credentials")
+
+// LoadDirectories reads a JSON array of directory configs and fills in defaults
+func LoadDirectories(path string) ([]ldap.DirectoryConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LDAP directories: %v", err)
+	}
+
+	var configs []ldap.DirectoryConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse LDAP directories: %v", err)
+	}
+
+	owner := make(map[string]string)
+	for i := range configs {
+		cfg := &configs[i]
+		if cfg.Name == "" || cfg.URL == "" || len(cfg.Domains) == 0 {
+			return nil, fmt.Errorf("LDAP directory %d: name, url and domains are required", i)
+		}
+		if strings.HasPrefix(cfg.URL, "ldap://") && !cfg.StartTLS {
+			return nil, fmt.Errorf("LDAP directory %q: ldap:// requires start_tls; passwords are never sent in the clear", cfg.Name)
+		}
+		if cfg.UserDNTemplate == "" && cfg.BaseDN == "" {
+			return nil, fmt.Errorf("LDAP directory %q: set user_dn_template or base_dn", cfg.Name)
+		}
+		if cfg.UserDNTemplate != "" && !strings.Contains(cfg.UserDNTemplate, "=") && cfg.BaseDN == "" {
+			return nil, fmt.Errorf("LDAP directory %q: a UPN template needs base_dn to look the user up", cfg.Name)
+		}
+
+		for j, domain := range cfg.Domains {
+			domain = strings.ToLower(domain)
+			if other, ok := owner[domain]; ok {
+				return nil, fmt.Errorf("LDAP directories %q and %q both claim %s", other, cfg.Name, domain)
+			}
+			owner[domain] = cfg.Name
+			cfg.Domains[j] = domain
+		}
+
+		if cfg.Timeout == 0 {
+			cfg.Timeout = 10
+		}
+		if cfg.UserFilter == "" {
+			cfg.UserFilter = "(mail={email})"
+		}
+		if cfg.GroupsAttribute == "" {
+			cfg.GroupsAttribute = "memberOf"
+		}
+		if cfg.GroupFilter == "" {
+			cfg.GroupFilter = "(member={dn})"
+		}
+		if cfg.FirstNameAttribute == "" {
+			cfg.FirstNameAttribute = "givenName"
+		}
+		if cfg.LastNameAttribute == "" {
+			cfg.LastNameAttribute = "sn"
+		}
+
+		// DNs compare case-insensitively
+		mapping := make(map[string]string, len(cfg.RoleMapping))
+		for group, role := range cfg.RoleMapping {
+			mapping[strings.ToLower(group)] = role
+		}
+		cfg.RoleMapping = mapping
+	}
+	return configs, nil
+}
+
+// Directory authenticates users against one LDAP server
+type Directory struct {
+	cfg       ldap.DirectoryConfig
+	tlsConfig *tls.Config
+}
+
+func NewDirectory(cfg ldap.DirectoryConfig) (*Directory, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CACertFile != "" {
+		pemData, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("LDAP directory %q: %v", cfg.Name, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("LDAP directory %q: no certificates in %s", cfg.Name, cfg.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &Directory{cfg: cfg, tlsConfig: tlsConfig}, nil
+}
+
+func (d *Directory) Config() ldap.DirectoryConfig {
+	return d.cfg
+}
+
+// Authenticate verifies the password for email and reads the user's profile and groups
+func (d *Directory) Authenticate(ctx context.Context, email, password string) (*ldap.UserEntry, error) {
+	// An empty password would be an unauthenticated bind, which servers accept
+	if email == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	c, err := dial(ctx, d.cfg.URL, d.cfg.StartTLS, d.tlsConfig, time.Duration(d.cfg.Timeout)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+
+	var user *entry
+	var groups []string
+	if d.cfg.UserDNTemplate != "" {
+		user, groups, err = d.directBind(c, email, password)
+	} else {
+		user, groups, err = d.searchThenBind(c, email, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := user.dn
+	if d.cfg.IDAttribute != "" {
+		if id = user.first(d.cfg.IDAttribute); id == "" {
+			return nil, fmt.Errorf("ldap: %s has no %s", user.dn, d.cfg.IDAttribute)
+		}
+		// Binary ids such as objectGUID
+		if !utf8.ValidString(id) {
+			id = hex.EncodeToString([]byte(id))
+		}
+	}
+
+	return &ldap.UserEntry{
+		DN:        user.dn,
+		ID:        id,
+		Email:     strings.ToLower(email),
+		FirstName: user.first(d.cfg.FirstNameAttribute),
+		LastName:  user.first(d.cfg.LastNameAttribute),
+		Groups:    groups,
+	}, nil
+}
+
+// directBind binds as the user, then reads their entry with their own rights
+func (d *Directory) directBind(c *conn, email, password string) (*entry, []string, error) {
+	escape := EscapeDN
+	if !strings.Contains(d.cfg.UserDNTemplate, "=") {
+		// A UPN such as {email} is used verbatim
+		escape = func(s string) string { return s }
+	}
+	dn := d.expand(d.cfg.UserDNTemplate, email, escape)
+	if err := userBind(c, dn, password); err != nil {
+		return nil, nil, err
+	}
+
+	var user *entry
+	var err error
+	if d.cfg.BaseDN != "" {
+		user, err = d.findUser(c, email)
+	} else {
+		user, err = d.readEntry(c, dn)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups, err := d.groups(c, user)
+	return user, groups, err
+}
+
+// searchThenBind finds the user with the service account, then proves the password by binding as them
+func (d *Directory) searchThenBind(c *conn, email, password string) (*entry, []string, error) {
+	if err := c.bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+		return nil, nil, fmt.Errorf("ldap: service bind failed: %v", err)
+	}
+
+	user, err := d.findUser(c, email)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, err := d.groups(c, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := userBind(c, user.dn, password); err != nil {
+		return nil, nil, err
+	}
+	return user, groups, nil
+}
+
+func (d *Directory) findUser(c *conn, email string) (*entry, error) {
+	filter := d.expand(d.cfg.UserFilter, email, EscapeFilter)
+	entries, err := c.search(d.cfg.BaseDN, scopeSubtree, filter, d.userAttributes(), 2)
+	if err != nil {
+		var ldapErr *Error
+		if errors.As(err, &ldapErr) && ldapErr.Code == 4 { // sizeLimitExceeded
+			return nil, fmt.Errorf("ldap: %s matches more than one entry", filter)
+		}
+		return nil, err
+	}
+	switch len(entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+		return entries[0], nil
+	}
+	return nil, fmt.Errorf("ldap: %s matches more than one entry", filter)
+}
+
+func (d *Directory) readEntry(c *conn, dn string) (*entry, error) {
+	entries, err := c.search(dn, scopeBase, "(objectClass=*)", d.userAttributes(), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("ldap: cannot read %s", dn)
+	}
+	return entries[0], nil
+}
+
+// groups returns the user's group DNs, lower-cased for matching
+func (d *Directory) groups(c *conn, user *entry) ([]string, error) {
+	var groups []string
+	if d.cfg.GroupBaseDN == "" {
+		groups = user.attrs[strings.ToLower(d.cfg.GroupsAttribute)]
+	} else {
+		filter := strings.ReplaceAll(d.cfg.GroupFilter, "{dn}", EscapeFilter(user.dn))
+		// "1.1" asks for no attributes; only the DNs matter
+		entries, err := c.search(d.cfg.GroupBaseDN, scopeSubtree, filter, []string{"1.1"}, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			groups = append(groups, e.dn)
+		}
+	}
+
+	out := make([]string, len(groups))
+	for i, g := range groups {
+		out[i] = strings.ToLower(g)
+	}
+	return out, nil
+}
+
+func (d *Directory) userAttributes() []string {
+	attrs := []string{d.cfg.FirstNameAttribute, d.cfg.LastNameAttribute}
+	if d.cfg.GroupBaseDN == "" {
+		attrs = append(attrs, d.cfg.GroupsAttribute)
+	}
+	if d.cfg.IDAttribute != "" {
+		attrs = append(attrs, d.cfg.IDAttribute)
+	}
+	return attrs
+}
+
+// expand fills {email} and {username} (the part before @) into a template
+func (d *Directory) expand(template, email string, escape func(string) string) string {
+	username, _, _ := strings.Cut(email, "@")
+	return strings.NewReplacer("{email}", escape(email), "{username}", escape(username)).Replace(template)
+}
+
+// userBind maps a rejected password onto ErrInvalidCredentials
+func userBind(c *conn, dn, password string) error {
+	err := c.bind(dn, password)
+	var ldapErr *Error
+	if errors.As(err, &ldapErr) && ldapErr.Code == resultInvalidCredentials {
+		return ErrInvalidCredentials
+	}
+	return err
+}
@@ -0,0 +1,165 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/ldap"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/ldap/ldaptest"
+)
+
+const (
+	aliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+	serviceDN = "cn=signee,ou=services,dc=example,dc=com"
+	opsDN     = "cn=Ops,ou=groups,dc=example,dc=com"
+)
+
+func testEntries() []ldaptest.Entry {
+	return []ldaptest.Entry{
+		{DN: serviceDN, Password: "service-secret"},
+		{DN: aliceDN, Password: "alice-secret", Attrs: map[string][]string{
+			"mail":      {"alice@example.com"},
+			"givenName": {"Alice"},
+			"sn":        {"Example"},
+			"entryUUID": {"6f1c0c8e-1d2b-4b7a-9a51-0c7e2f3b9d10"},
+			"memberOf":  {opsDN},
+		}},
+		{DN: "uid=bob,ou=people,dc=example,dc=com", Password: "bob-secret", Attrs: map[string][]string{
+			"mail": {"bob@example.com"},
+		}},
+		{DN: opsDN, Attrs: map[string][]string{"member": {aliceDN}}},
+	}
+}
+
+func testDirectory(t *testing.T, srv *ldaptest.Server, cfg ldap.DirectoryConfig) *Directory {
+	t.Helper()
+	cfg.Name, cfg.URL, cfg.CACertFile, cfg.Timeout = "corp", srv.URL, srv.CAFile, 5
+	cfg.UserFilter, cfg.GroupsAttribute, cfg.GroupFilter = "(mail={email})", "memberOf", "(member={dn})"
+	cfg.FirstNameAttribute, cfg.LastNameAttribute = "givenName", "sn"
+	d, err := NewDirectory(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDirectBind(t *testing.T) {
+	srv := ldaptest.NewServer(t, testEntries()...)
+	d := testDirectory(t, srv, ldap.DirectoryConfig{UserDNTemplate: "uid={username},ou=people,dc=example,dc=com"})
+
+	user, err := d.Authenticate(context.Background(), "Alice@example.com", "alice-secret")
+	if err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+	want := ldap.UserEntry{
+		DN: aliceDN, ID: aliceDN, Email: "alice@example.com", FirstName: "Alice", LastName: "Example",
+		Groups: []string{"cn=ops,ou=groups,dc=example,dc=com"},
+	}
+	if user.DN != want.DN || user.ID != want.ID || user.Email != want.Email || user.FirstName != want.FirstName ||
+		user.LastName != want.LastName || !slices.Equal(user.Groups, want.Groups) {
+		t.Fatalf("Authenticate() = %+v, want %+v", user, want)
+	}
+	if binds := srv.Binds(); !slices.Equal(binds, []string{aliceDN}) {
+		t.Fatalf("binds = %q, want only the user's", binds)
+	}
+
+	for name, tc := range map[string]struct {
+		email, password string
+	}{
+		"wrong password": {"alice@example.com", "guess"},
+		"unknown user":   {"carol@example.com", "alice-secret"},
+		"empty password": {"alice@example.com", ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := d.Authenticate(context.Background(), tc.email, tc.password); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("Authenticate() = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+	if binds := srv.Binds(); len(binds) != 1 {
+		t.Fatalf("binds = %q, want no more after rejected logins", binds)
+	}
+}
+
+func TestSearchThenBind(t *testing.T) {
+	srv := ldaptest.NewServer(t, testEntries()...)
+	d := testDirectory(t, srv, ldap.DirectoryConfig{
+		BindDN:       serviceDN,
+		BindPassword: "service-secret",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		GroupBaseDN:  "ou=groups,dc=example,dc=com",
+		IDAttribute:  "entryUUID",
+	})
+
+	user, err := d.Authenticate(context.Background(), "alice@example.com", "alice-secret")
+	if err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+	if user.DN != aliceDN || user.ID != "6f1c0c8e-1d2b-4b7a-9a51-0c7e2f3b9d10" || user.FirstName != "Alice" {
+		t.Fatalf("Authenticate() = %+v, want alice by her entryUUID", user)
+	}
+	// Groups come from the group search, not memberOf
+	if want := []string{"cn=ops,ou=groups,dc=example,dc=com"}; !slices.Equal(user.Groups, want) {
+		t.Fatalf("groups = %q, want %q", user.Groups, want)
+	}
+	if binds := srv.Binds(); !slices.Equal(binds, []string{serviceDN, aliceDN}) {
+		t.Fatalf("binds = %q, want the service account then the user", binds)
+	}
+
+	for name, tc := range map[string]struct {
+		email, password string
+	}{
+		"wrong password": {"alice@example.com", "guess"},
+		"unknown email":  {"carol@example.com", "alice-secret"},
+		"empty password": {"alice@example.com", ""},
+		// Unescaped, the wildcard would match every entry with a mail
+		"filter injection": {"*", "alice-secret"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := d.Authenticate(context.Background(), tc.email, tc.password); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("Authenticate() = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+
+	t.Run("ambiguous email", func(t *testing.T) {
+		srv.Put(ldaptest.Entry{DN: "uid=alice2,ou=people,dc=example,dc=com", Password: "alice-secret", Attrs: map[string][]string{
+			"mail": {"alice@example.com"},
+		}})
+		_, err := d.Authenticate(context.Background(), "alice@example.com", "alice-secret")
+		if err == nil || errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Authenticate() = %v, want a directory error", err)
+		}
+	})
+}
+
+// TestServiceBindFailure checks that a broken service account surfaces as a
+// directory error rather than as the user's password being wrong
+func TestServiceBindFailure(t *testing.T) {
+	srv := ldaptest.NewServer(t, testEntries()...)
+	d := testDirectory(t, srv, ldap.DirectoryConfig{
+		BindDN:       serviceDN,
+		BindPassword: "rotated-away",
+		BaseDN:       "ou=people,dc=example,dc=com",
+	})
+	_, err := d.Authenticate(context.Background(), "alice@example.com", "alice-secret")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Authenticate() = %v, want a directory error", err)
+	}
+}
+
+func TestDirectoryUntrustedCertificate(t *testing.T) {
+	srv := ldaptest.NewServer(t, testEntries()...)
+	d, err := NewDirectory(ldap.DirectoryConfig{Name: "corp", URL: srv.URL, Timeout: 5, UserDNTemplate: "uid={username},ou=people,dc=example,dc=com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Authenticate(context.Background(), "alice@example.com", "alice-secret"); err == nil {
+		t.Fatal("Authenticate() trusted a certificate outside the system roots")
+	}
+	if binds := srv.Binds(); len(binds) != 0 {
+		t.Fatalf("binds = %q, want the password never sent", binds)
+	}
+}
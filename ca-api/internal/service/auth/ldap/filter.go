@@ -0,0 +1,200 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Filter choice tags (RFC 4511 section 4.5.1)
+const (
+	filterAnd        = classContext | constructed | 0
+	filterOr         = classContext | constructed | 1
+	filterNot        = classContext | constructed | 2
+	filterEquality   = classContext | constructed | 3
+	filterSubstrings = classContext | constructed | 4
+	filterGreater    = classContext | constructed | 5
+	filterLess       = classContext | constructed | 6
+	filterPresent    = classContext | 7
+	filterApprox     = classContext | constructed | 8
+
+	substringInitial = classContext | 0
+	substringAny     = classContext | 1
+	substringFinal   = classContext | 2
+)
+
+// EscapeFilter makes s safe to splice into a filter as a literal value (RFC 4515)
+func EscapeFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// EscapeDN makes s safe to use as an attribute value in a DN (RFC 4514)
+func EscapeDN(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			c == '#' && i == 0,
+			c == ' ' && (i == 0 || i == len(s)-1):
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// compileFilter turns a string filter such as (&(objectClass=person)(mail=x))
+// into its BER encoding
+func compileFilter(s string) ([]byte, error) {
+	out, rest, err := parseFilter(s, 0)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, errors.New("ldap: trailing data after filter")
+	}
+	return out, nil
+}
+
+func parseFilter(s string, depth int) ([]byte, string, error) {
+	if depth > 16 {
+		return nil, "", errors.New("ldap: filter nested too deep")
+	}
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", errors.New("ldap: filter must start with (")
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", errors.New("ldap: unterminated filter")
+	}
+
+	switch s[0] {
+	case '&', '|':
+		tag := byte(filterAnd)
+		if s[0] == '|' {
+			tag = filterOr
+		}
+		s = s[1:]
+		var items [][]byte
+		for strings.HasPrefix(s, "(") {
+			item, rest, err := parseFilter(s, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			items, s = append(items, item), rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", errors.New("ldap: unterminated filter")
+		}
+		return berSeq(tag, items...), s[1:], nil
+
+	case '!':
+		item, rest, err := parseFilter(s[1:], depth+1)
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", errors.New("ldap: unterminated filter")
+		}
+		return berSeq(filterNot, item), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", errors.New("ldap: unterminated filter")
+	}
+	item, err := parseItem(s[:end])
+	return item, s[end+1:], err
+}
+
+func parseItem(s string) ([]byte, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("ldap: invalid filter item %q", s)
+	}
+	attr, value := s[:eq], s[eq+1:]
+
+	tag := byte(filterEquality)
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = filterGreater, attr[:len(attr)-1]
+	case '<':
+		tag, attr = filterLess, attr[:len(attr)-1]
+	case '~':
+		tag, attr = filterApprox, attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, fmt.Errorf("ldap: invalid filter item %q", s)
+	}
+
+	if tag == filterEquality && value == "*" {
+		return berString(filterPresent, attr), nil
+	}
+	if tag == filterEquality && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		var subs [][]byte
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			v, err := unescapeFilter(part)
+			if err != nil {
+				return nil, err
+			}
+			switch i {
+			case 0:
+				subs = append(subs, berString(substringInitial, v))
+			case len(parts) - 1:
+				subs = append(subs, berString(substringFinal, v))
+			default:
+				subs = append(subs, berString(substringAny, v))
+			}
+		}
+		return berSeq(filterSubstrings, berString(tagOctetString, attr), berSeq(tagSequence, subs...)), nil
+	}
+
+	v, err := unescapeFilter(value)
+	if err != nil {
+		return nil, err
+	}
+	return berSeq(tag, berString(tagOctetString, attr), berString(tagOctetString, v)), nil
+}
+
+// unescapeFilter decodes \XX escapes in a filter value
+func unescapeFilter(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", errors.New("ldap: truncated escape in filter")
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", errors.New("ldap: invalid escape in filter")
+		}
+		b.Write(c)
+		i += 2
+	}
+	return b.String(), nil
+}
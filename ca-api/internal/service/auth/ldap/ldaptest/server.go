@@ -0,0 +1,387 @@
+// Package ldaptest runs an LDAPv3 directory in-process for tests. It speaks
+// LDAPS with a self-signed certificate and answers simple binds and searches
+// over a fixed set of entries; anything else is refused.
+package ldaptest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Entry is one directory object. Binds as DN succeed with Password; an entry
+// without one can't be bound to.
+type Entry struct {
+	DN       string
+	Password string
+	Attrs    map[string][]string
+}
+
+// Server is a directory at URL whose certificate is trusted by CAFile.
+// Searches need a successful bind first, as most production servers require.
+type Server struct {
+	URL    string
+	CAFile string
+
+	listener net.Listener
+	mu       sync.Mutex
+	entries  []Entry
+	binds    []string
+}
+
+// NewServer starts a directory holding entries and stops it when the test ends
+func NewServer(t *testing.T, entries ...Entry) *Server {
+	t.Helper()
+	cert, caFile := selfSigned(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		URL:      "ldaps://" + listener.Addr().String(),
+		CAFile:   caFile,
+		listener: listener,
+		entries:  entries,
+	}
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close stops accepting connections, as a directory outage would
+func (s *Server) Close() {
+	s.listener.Close()
+}
+
+// Put adds e, replacing any entry with the same DN
+func (s *Server) Put(e Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = slices.DeleteFunc(s.entries, func(old Entry) bool { return strings.EqualFold(old.DN, e.DN) })
+	s.entries = append(s.entries, e)
+}
+
+// Binds lists the DNs of every successful authenticated bind, in order
+func (s *Server) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.binds)
+}
+
+func (s *Server) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(c)
+	}
+}
+
+// BER tags and result codes (RFC 4511)
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	opBindRequest   = 0x60
+	opBindResponse  = 0x61
+	opSearchRequest = 0x63
+	opSearchEntry   = 0x64
+	opSearchDone    = 0x65
+	authSimple      = 0x80
+
+	scopeBase    = 0
+	scopeSubtree = 2
+
+	resultSuccess            = 0
+	resultProtocolError      = 2
+	resultSizeLimitExceeded  = 4
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+	resultInsufficientAccess = 50
+
+	maxMessage = 1 << 20
+)
+
+// session answers one client until it unbinds or sends something unexpected
+func (s *Server) session(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	bound := false
+	for {
+		msg, err := readElement(r)
+		if err != nil || msg.tag != tagSequence || len(msg.children) < 2 {
+			return
+		}
+		id, op := msg.children[0].value, msg.children[1]
+		reply := func(ops ...[]byte) {
+			for _, o := range ops {
+				c.Write(seq(tagSequence, encode(tagInteger, id), o))
+			}
+		}
+
+		switch op.tag {
+		case opBindRequest:
+			code := s.bind(op)
+			bound = code == resultSuccess
+			reply(result(opBindResponse, code))
+		case opSearchRequest:
+			if !bound {
+				reply(result(opSearchDone, resultInsufficientAccess))
+				continue
+			}
+			reply(s.search(op)...)
+		default:
+			// Unbind, or an operation this directory doesn't offer such as StartTLS
+			return
+		}
+	}
+}
+
+// bind checks a simple bind. An empty password is an unauthenticated bind,
+// which succeeds without proving anything (RFC 4513 section 5.1.2).
+func (s *Server) bind(op *element) byte {
+	if len(op.children) != 3 || op.children[2].tag != authSimple {
+		return resultProtocolError
+	}
+	dn, password := string(op.children[1].value), string(op.children[2].value)
+	if password == "" {
+		return resultSuccess
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if strings.EqualFold(e.DN, dn) && e.Password != "" && e.Password == password {
+			s.binds = append(s.binds, e.DN)
+			return resultSuccess
+		}
+	}
+	return resultInvalidCredentials
+}
+
+// search returns the matching entries followed by the SearchResultDone
+func (s *Server) search(op *element) [][]byte {
+	if len(op.children) != 8 {
+		return [][]byte{result(opSearchDone, resultProtocolError)}
+	}
+	base, scope := string(op.children[0].value), op.children[1].int()
+	sizeLimit, filter := op.children[3].int(), op.children[6]
+	var want []string
+	for _, a := range op.children[7].children {
+		want = append(want, string(a.value))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if scope == scopeBase && !slices.ContainsFunc(s.entries, func(e Entry) bool { return strings.EqualFold(e.DN, base) }) {
+		return [][]byte{result(opSearchDone, resultNoSuchObject)}
+	}
+
+	var out [][]byte
+	for _, e := range s.entries {
+		inScope := strings.EqualFold(e.DN, base)
+		if scope == scopeSubtree {
+			inScope = inScope || strings.HasSuffix(strings.ToLower(e.DN), ","+strings.ToLower(base))
+		}
+		if !inScope || !matches(filter, e) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(out)) == sizeLimit {
+			return append(out, result(opSearchDone, resultSizeLimitExceeded))
+		}
+		out = append(out, searchEntry(e, want))
+	}
+	return append(out, result(opSearchDone, resultSuccess))
+}
+
+// matches evaluates the filter choices the client produces. Values compare
+// case-insensitively, as mail, uid and DN-valued attributes do.
+func matches(f *element, e Entry) bool {
+	switch f.tag {
+	case 0xa0: // and
+		for _, c := range f.children {
+			if !matches(c, e) {
+				return false
+			}
+		}
+		return true
+	case 0xa1: // or
+		return slices.ContainsFunc(f.children, func(c *element) bool { return matches(c, e) })
+	case 0xa2: // not
+		return len(f.children) == 1 && !matches(f.children[0], e)
+	case 0xa3: // equalityMatch
+		if len(f.children) != 2 {
+			return false
+		}
+		values := attr(e, string(f.children[0].value))
+		return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, string(f.children[1].value)) })
+	case 0x87: // present
+		return strings.EqualFold(string(f.value), "objectClass") || len(attr(e, string(f.value))) > 0
+	}
+	return false
+}
+
+func attr(e Entry, name string) []string {
+	for k, v := range e.Attrs {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// searchEntry encodes e with the requested attributes: all of them when none
+// are named, and none for "1.1"
+func searchEntry(e Entry, want []string) []byte {
+	var attrs [][]byte
+	for name, values := range e.Attrs {
+		if slices.Contains(want, "1.1") || len(want) > 0 && !slices.ContainsFunc(want, func(w string) bool { return strings.EqualFold(w, name) }) {
+			continue
+		}
+		var vals [][]byte
+		for _, v := range values {
+			vals = append(vals, encode(tagOctetString, []byte(v)))
+		}
+		attrs = append(attrs, seq(tagSequence, encode(tagOctetString, []byte(name)), seq(tagSet, vals...)))
+	}
+	return seq(opSearchEntry, encode(tagOctetString, []byte(e.DN)), seq(tagSequence, attrs...))
+}
+
+func result(tag, code byte) []byte {
+	return seq(tag, encode(tagEnumerated, []byte{code}), encode(tagOctetString, nil), encode(tagOctetString, nil))
+}
+
+// element is a decoded BER element; LDAP only uses definite lengths
+type element struct {
+	tag      byte
+	value    []byte
+	children []*element
+}
+
+func (e *element) int() int64 {
+	var v int64
+	for i, b := range e.value {
+		if i == 0 {
+			v = int64(int8(b))
+			continue
+		}
+		v = v<<8 | int64(b)
+	}
+	return v
+}
+
+func readElement(r *bufio.Reader) (*element, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	n := int(length)
+	if length&0x80 != 0 {
+		n = 0
+		for range length & 0x7f {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	if n > maxMessage {
+		return nil, errors.New("ldaptest: message too large")
+	}
+	content := make([]byte, n)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parse(tag, content)
+}
+
+func parse(tag byte, content []byte) (*element, error) {
+	e := &element{tag: tag, value: content}
+	if tag&0x20 == 0 {
+		return e, nil
+	}
+	r := bufio.NewReader(bytes.NewReader(content))
+	for {
+		child, err := readElement(r)
+		if err == io.EOF {
+			return e, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		e.children = append(e.children, child)
+	}
+}
+
+func encode(tag byte, content []byte) []byte {
+	n := len(content)
+	switch {
+	case n < 0x80:
+		return append([]byte{tag, byte(n)}, content...)
+	case n <= 0xffff:
+		return append([]byte{tag, 0x82, byte(n >> 8), byte(n)}, content...)
+	}
+	return append([]byte{tag, 0x84, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, content...)
+}
+
+func seq(tag byte, items ...[]byte) []byte {
+	var content []byte
+	for _, item := range items {
+		content = append(content, item...)
+	}
+	return encode(tag, content)
+}
+
+// selfSigned makes a certificate for 127.0.0.1 and writes it where a
+// directory config's ca_cert_file can point
+func selfSigned(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ldap-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
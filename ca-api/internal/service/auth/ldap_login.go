@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/ldap"
+	"github.com/gin-gonic/gin"
+)
+
+// directoryFor returns the directory that owns the email's domain, or nil for local accounts
+func (s *AuthService) directoryFor(email string) *ldap.Directory {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return nil
+	}
+	return s.Directories[strings.ToLower(domain)]
+}
+
+// directoryLogin authenticates against the directory and provisions or re-syncs
+// the user. The attempt has already been charged to the throttles.
+func (s *AuthService) directoryLogin(c *gin.Context, dir *ldap.Directory, req auth.LoginRequest, charged []db.LoginThrottle) {
+	account, ip := loginThrottles(c, req.Email)
+
+	entry, err := dir.Authenticate(c, req.Email, req.Password)
+	if errors.Is(err, ldap.ErrInvalidCredentials) {
+		log.Printf("Directory rejected credentials for email: %s", req.Email)
+		s.loginFailed(c, req.Email, charged)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_CREDENTIALS",
+				"message": "Invalid email or password.",
+				"status":  http.StatusUnauthorized,
+			},
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Directory %s authentication failed: %v", dir.Config().Name, err)
+		s.refundAttempt(c, account, ip)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": gin.H{
+				"code":    "DIRECTORY_UNAVAILABLE",
+				"message": "The directory service is unavailable. Please try again later.",
+				"status":  http.StatusServiceUnavailable,
+			},
+		})
+		return
+	}
+
+	s.clearLoginFailures(c, req.Email)
+	s.refundAttempt(c, ip)
+
+	cfg := dir.Config()
+	user, err := s.provisionExternalUser(c, auth.ExternalIdentity{
+		Source:    "ldap:" + cfg.Name,
+		Subject:   entry.ID,
+		Email:     entry.Email,
+		FirstName: entry.FirstName,
+		LastName:  entry.LastName,
+		Roles:     mapGroups(entry.Groups, cfg.RoleMapping, cfg.DefaultRole),
+		// Logins for the directory's domains go nowhere else, so it owns their accounts
+		Authoritative: true,
+	})
+	if err != nil {
+		log.Printf("provisionExternalUser failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	s.completeLogin(c, user)
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	domainldap "github.com/dhruvpatel-10/signee/ca-api/internal/domain/ldap"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/ldap"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/ldap/ldaptest"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ldapAliceDN = "uid=alice,ou=people,dc=example,dc=com"
+	ldapOpsDN   = "cn=Ops,ou=groups,dc=example,dc=com"
+)
+
+// ldapTest wires an AuthService to an in-process directory and a fake database
+type ldapTest struct {
+	t      *testing.T
+	db     *fakeDB
+	srv    *ldaptest.Server
+	router *gin.Engine
+}
+
+func newLDAPTest(t *testing.T) *ldapTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	fake, conn, queries := newFakeDB(t, "operator", "viewer", "admin")
+
+	dir := t.TempDir()
+	jwtManager, err := jwt.NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := ldaptest.NewServer(t, ldapAlice(ldapOpsDN))
+	directory, err := ldap.NewDirectory(domainldap.DirectoryConfig{
+		Name:               "corp",
+		Domains:            []string{"example.com"},
+		URL:                srv.URL,
+		CACertFile:         srv.CAFile,
+		Timeout:            5,
+		UserDNTemplate:     "uid={username},ou=people,dc=example,dc=com",
+		GroupsAttribute:    "memberOf",
+		FirstNameAttribute: "givenName",
+		LastNameAttribute:  "sn",
+		RoleMapping:        map[string]string{strings.ToLower(ldapOpsDN): "operator"},
+		DefaultRole:        "viewer",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &AuthService{
+		Conn:        conn,
+		DB:          queries,
+		JWT:         jwtManager,
+		Directories: map[string]*ldap.Directory{"example.com": directory},
+		HashLimit:   NewHashLimiter(1),
+	}
+	router := gin.New()
+	router.POST("/login", s.Login)
+	return &ldapTest{t: t, db: fake, srv: srv, router: router}
+}
+
+// ldapAlice is alice's directory entry as a member of groups
+func ldapAlice(groups ...string) ldaptest.Entry {
+	return ldaptest.Entry{DN: ldapAliceDN, Password: "alice-secret", Attrs: map[string][]string{
+		"mail":      {"alice@example.com"},
+		"givenName": {"Alice"},
+		"sn":        {"Example"},
+		"memberOf":  groups,
+	}}
+}
+
+func (l *ldapTest) login(email, password string) *httptest.ResponseRecorder {
+	body, err := json.Marshal(auth.LoginRequest{Email: email, Password: password})
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	l.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestDirectoryLoginSyncsRoles(t *testing.T) {
+	l := newLDAPTest(t)
+
+	w := l.login("alice@example.com", "alice-secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login = %d: %s", w.Code, w.Body)
+	}
+	var resp auth.AuthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Tokens == nil || resp.Tokens.AccessToken == "" || resp.User == nil || resp.User.Email != "alice@example.com" {
+		t.Fatalf("response = %s, want tokens for alice", w.Body)
+	}
+
+	user := l.db.user("alice@example.com")
+	if user.Status != auth.UserStatusActive || user.FirstName != "Alice" || user.LastName != "Example" {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+	if len(l.db.identities) != 1 || l.db.identities[0].Provider != "ldap:corp" || l.db.identities[0].Subject != ldapAliceDN {
+		t.Fatalf("identities = %+v, want alice's DN under ldap:corp", l.db.identities)
+	}
+	if roles := l.db.rolesOf(user.ID, "ldap:corp"); !slices.Equal(roles, []string{"operator"}) {
+		t.Fatalf("roles = %v, want [operator]", roles)
+	}
+	if !slices.Equal(l.db.events, []string{string(audit.UserProvisioned)}) {
+		t.Fatalf("audit events = %v", l.db.events)
+	}
+
+	// Roles granted by another source are not the directory's to revoke
+	admin := l.db.roles[slices.IndexFunc(l.db.roles, func(r db.Role) bool { return r.Name == "admin" })]
+	l.db.grants = append(l.db.grants, fakeGrant{userID: user.ID, roleID: admin.ID, source: "local"})
+
+	// Leaving the group in the directory takes the role away at the next login
+	l.srv.Put(ldapAlice("cn=Contractors,ou=groups,dc=example,dc=com"))
+	if w := l.login("alice@example.com", "alice-secret"); w.Code != http.StatusOK {
+		t.Fatalf("second Login = %d: %s", w.Code, w.Body)
+	}
+	if len(l.db.users) != 1 {
+		t.Fatalf("%d users after two logins, want 1", len(l.db.users))
+	}
+	if roles := l.db.rolesOf(user.ID, "ldap:corp"); !slices.Equal(roles, []string{"viewer"}) {
+		t.Fatalf("roles after leaving the group = %v, want the default [viewer]", roles)
+	}
+	if roles := l.db.rolesOf(user.ID, "local"); !slices.Equal(roles, []string{"admin"}) {
+		t.Fatalf("local roles = %v, want [admin] untouched", roles)
+	}
+}
+
+func TestDirectoryLoginRejected(t *testing.T) {
+	account := accountThrottleKey("alice@example.com")
+
+	t.Run("wrong password", func(t *testing.T) {
+		l := newLDAPTest(t)
+		w := l.login("alice@example.com", "guess")
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_CREDENTIALS") {
+			t.Fatalf("Login = %d: %s, want 401 INVALID_CREDENTIALS", w.Code, w.Body)
+		}
+		if len(l.db.users) != 0 {
+			t.Fatalf("users = %+v, want none provisioned", l.db.users)
+		}
+		if failures := l.db.throttles[account].Failures; failures != 1 {
+			t.Fatalf("account failures = %d, want the attempt charged", failures)
+		}
+	})
+
+	t.Run("directory unavailable", func(t *testing.T) {
+		l := newLDAPTest(t)
+		l.srv.Close()
+		w := l.login("alice@example.com", "alice-secret")
+		if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "DIRECTORY_UNAVAILABLE") {
+			t.Fatalf("Login = %d: %s, want 503 DIRECTORY_UNAVAILABLE", w.Code, w.Body)
+		}
+		if failures := l.db.throttles[account].Failures; failures != 0 {
+			t.Fatalf("account failures = %d, want the attempt refunded", failures)
+		}
+	})
+}
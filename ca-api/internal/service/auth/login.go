@@ -1,12 +1,17 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/config"
 	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // Login function
@@ -23,24 +28,39 @@ func (s *AuthService) Login(c *gin.Context) {
 		return
 	}
 
-	// Get user by email
+	// The attempt is charged before any password is checked, the same way for
+	// known and unknown emails
+	account, ip := loginThrottles(c, req.Email)
+	charged, wait, err := s.reserveAttempt(c, account, ip)
+	switch {
+	case err != nil:
+		log.Printf("reserveAttempt failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	case wait > 0:
+		tooManyLoginAttempts(c, wait)
+		return
+	}
+
+	// Users in a directory-managed domain authenticate against the directory only;
+	// everyone else falls back to the local password
+	if dir := s.directoryFor(req.Email); dir != nil {
+		s.directoryLogin(c, dir, req, charged)
+		return
+	}
+
 	// Get user by email
 	user, err := s.DB.GetUserByEmail(c, req.Email)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// User not found
-			log.Printf("User not found for email: %s", req.Email)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": gin.H{
-					"code":    "INVALID_CREDENTIALS",
-					"message": "Invalid email or password.",
-					"status":  http.StatusUnauthorized,
-				},
-			})
-			return
-		}
+	if err != nil && err != sql.ErrNoRows {
 		// Only fatal for unexpected DB errors
 		log.Printf("GetUserByEmail failed: %v", err)
+		s.refundAttempt(c, account, ip)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"code":    "INTERNAL_SERVER_ERROR",
@@ -51,10 +71,24 @@ func (s *AuthService) Login(c *gin.Context) {
 		return
 	}
 
+	// Unknown emails are checked against a dummy hash so they take as long as real ones
+	passwordHash := user.PasswordHash
+	if err == sql.ErrNoRows {
+		log.Printf("User not found for email: %s", req.Email)
+		if passwordHash, err = dummyPasswordHash(); err != nil {
+			log.Printf("dummyPasswordHash failed: %v", err)
+		}
+	}
+
 	// Verify password
-	switch isValid, err := verifyPassword(req.Password, user.PasswordHash); {
+	switch isValid, err := s.verifyPassword(c, req.Password, passwordHash); {
+	case errors.Is(err, ErrHashBusy):
+		s.refundAttempt(c, account, ip)
+		hashingBusy(c)
+		return
 	case err != nil:
 		log.Printf("verifyPassword failed: %v", err)
+		s.refundAttempt(c, account, ip)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"code":    "INTERNAL_SERVER_ERROR",
@@ -63,8 +97,9 @@ func (s *AuthService) Login(c *gin.Context) {
 			},
 		})
 		return
-	case !isValid:
+	case !isValid || user.ID == uuid.Nil:
 		log.Printf("Password does not match for email: %s", req.Email)
+		s.loginFailed(c, req.Email, charged)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": gin.H{
 				"code":    "INVALID_CREDENTIALS",
@@ -75,21 +110,119 @@ func (s *AuthService) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token or session (implement this based on your auth strategy)
-	// token, err := generateJWTToken(user.ID) // You'll need to implement this
-	// if err != nil {
-	// 	c.JSON(http.StatusInternalServerError, gin.H{
-	// 		"error": gin.H{
-	// 			"code":    "INTERNAL_SERVER_ERROR",
-	// 			"message": "Something went wrong. Please try again later.",
-	// 			"status":  http.StatusInternalServerError,
-	// 		},
-	// 	})
-	// 	return
-	// }
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "Welcome Back",
-		"username": user.FirstName + " " + user.LastName,
+	s.clearLoginFailures(c, req.Email)
+	s.refundAttempt(c, ip)
+	s.upgradePasswordHash(c, user, req.Password)
+
+	s.completeLogin(c, user)
+}
+
+// accountUnavailable answers for a user who may not sign in and reports
+// whether it did: pending users still have to verify their email, and
+// suspended or disabled ones are shut out
+func accountUnavailable(c *gin.Context, user db.User) bool {
+	switch user.Status {
+	case auth.UserStatusActive:
+		return false
+	case auth.UserStatusPending:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"code":    "EMAIL_NOT_VERIFIED",
+				"message": "Verify your email address before logging in.",
+				"status":  http.StatusForbidden,
+			},
+		})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"code":    "ACCOUNT_DISABLED",
+				"message": "This account has been disabled.",
+				"status":  http.StatusForbidden,
+			},
+		})
+	}
+	return true
+}
+
+// completeLogin finishes a first-factor login: with MFA on, the first factor only
+// earns a challenge redeemable at /auth/mfa/verify; otherwise tokens are issued
+func (s *AuthService) completeLogin(c *gin.Context, user db.User) {
+	if accountUnavailable(c, user) {
+		return
+	}
+
+	methods, err := s.mfaMethods(c, user)
+	if err != nil {
+		log.Printf("mfaMethods failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if len(methods) > 0 {
+		challenge, err := s.createMFAChallenge(c, user.ID)
+		if err != nil {
+			log.Printf("createMFAChallenge failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"code":    "INTERNAL_SERVER_ERROR",
+					"message": "Something went wrong. Please try again later.",
+					"status":  http.StatusInternalServerError,
+				},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, auth.AuthResponse{
+			RequiresMFA:  true,
+			MFAChallenge: challenge,
+			MFAMethods:   methods,
+		})
+		return
+	}
+
+	// Issue access and refresh tokens in a new token family
+	tokens, err := s.startTokenFamily(c, user)
+	if err != nil {
+		log.Printf("startTokenFamily failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	config.SetTokenCookies(c.Writer, tokens.RefreshToken, config.DefaultCookieConfig())
+
+	c.JSON(http.StatusOK, auth.AuthResponse{
+		User:   userInfo(user),
+		Tokens: s.tokenPair(tokens),
 	})
 }
+
+// upgradePasswordHash rehashes a just-verified password when its hash predates the
+// current argon2id parameters or pepper. Failures are logged; the login goes ahead.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, user db.User, password string) {
+	if !s.needsRehash(user.PasswordHash) {
+		return
+	}
+
+	hash, err := s.hashPassword(ctx, password)
+	if err == nil {
+		err = s.DB.RehashUserPassword(ctx, db.RehashUserPasswordParams{
+			NewHash: hash,
+			ID:      user.ID,
+			OldHash: user.PasswordHash,
+		})
+	}
+	if err != nil {
+		log.Printf("RehashUserPassword failed: %v", err)
+	}
+}
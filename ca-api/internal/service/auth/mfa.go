@@ -0,0 +1,490 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/config"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/notify"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+)
+
+var (
+	errInvalidMFAChallenge = errors.New("invalid mfa challenge")
+	errInvalidMFACode      = errors.New("invalid mfa code")
+)
+
+// EnableMFA starts TOTP enrollment; MFA only takes effect once ConfirmMFA sees a valid code
+func (s *AuthService) EnableMFA(c *gin.Context) {
+	principal := middleware.CurrentPrincipal(c)
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		log.Printf("generateTOTPSecret failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	sealed, err := s.JWT.EncryptSecret([]byte(secret))
+	if err != nil {
+		log.Printf("EncryptSecret failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	// Re-enrolling before confirmation replaces the pending secret
+	updated, err := s.DB.SetPendingMFASecret(c, db.SetPendingMFASecretParams{
+		ID:        principal.UserID,
+		MfaSecret: sql.NullString{String: sealed, Valid: true},
+	})
+	if err != nil {
+		log.Printf("SetPendingMFASecret failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if updated == 0 {
+		mfaAlreadyEnabled(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, auth.MFAEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: otpauthURI(principal.Email, secret),
+	})
+}
+
+// ConfirmMFA turns MFA on after the user proves their authenticator produces valid codes
+func (s *AuthService) ConfirmMFA(c *gin.Context) {
+	var req auth.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	user, err := s.DB.GetUserByID(c, principal.UserID)
+	if err != nil {
+		log.Printf("GetUserByID failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if user.MfaEnabled.Bool {
+		mfaAlreadyEnabled(c)
+		return
+	}
+	if !user.MfaSecret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "MFA_NOT_ENROLLED",
+				"message": "Start MFA enrollment before confirming it.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	// Hashed up front so the transaction below isn't held open during argon2
+	codes, hashes, err := s.generateRecoveryCodes(c, user.ID)
+	if err == nil {
+		err = s.enableMFA(c, user, req.Code, hashes)
+	}
+	if errors.Is(err, errInvalidMFACode) {
+		invalidMFACode(c)
+		return
+	}
+	if errors.Is(err, ErrHashBusy) {
+		hashingBusy(c)
+		return
+	}
+	if err != nil {
+		log.Printf("ConfirmMFA failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Multi-factor authentication is now enabled.",
+		"recovery_codes": codes,
+	})
+}
+
+// enableMFA checks the first code and turns MFA on together with the initial recovery codes
+func (s *AuthService) enableMFA(ctx context.Context, user db.User, code string, recoveryHashes []string) error {
+	tx, err := s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	if err := s.checkTOTP(ctx, q, user, code); err != nil {
+		return err
+	}
+	if _, err := q.EnableMFA(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := storeRecoveryCodes(ctx, q, user.ID, recoveryHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyMFA completes a login that Login answered with an MFA challenge
+func (s *AuthService) VerifyMFA(c *gin.Context) {
+	var req auth.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	provided := 0
+	for _, set := range []bool{req.Code != "", req.RecoveryCode != "", req.Passkey != nil} {
+		if set {
+			provided++
+		}
+	}
+	if provided != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Provide exactly one of an authentication code, a recovery code or a passkey.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	var retry retryAfterError
+	user, err := s.redeemMFAChallenge(c, req)
+	switch {
+	case errors.Is(err, errInvalidMFAChallenge):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_MFA_CHALLENGE",
+				"message": "The MFA challenge is invalid or has expired. Please log in again.",
+				"status":  http.StatusUnauthorized,
+			},
+		})
+		return
+	case errors.Is(err, errInvalidMFACode):
+		invalidMFACode(c)
+		return
+	case errors.As(err, &retry):
+		tooManyLoginAttempts(c, retry.wait)
+		return
+	case errors.Is(err, ErrHashBusy):
+		hashingBusy(c)
+		return
+	case err != nil:
+		log.Printf("redeemMFAChallenge failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	// The account may have been suspended since the first factor
+	if accountUnavailable(c, user) {
+		return
+	}
+
+	tokens, err := s.startTokenFamily(c, user)
+	if err != nil {
+		log.Printf("startTokenFamily failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	if req.RecoveryCode != "" {
+		s.notifyUser(c, user, notify.Message{
+			Subject: "A recovery code was used to sign in",
+			Body:    "One of your MFA recovery codes was just used to sign in to your account. If this wasn't you, change your password and regenerate your recovery codes.",
+		})
+	}
+
+	config.SetTokenCookies(c.Writer, tokens.RefreshToken, config.DefaultCookieConfig())
+
+	c.JSON(http.StatusOK, auth.AuthResponse{
+		User:   userInfo(user),
+		Tokens: s.tokenPair(tokens),
+	})
+}
+
+// mfaMethods lists the second factors the user has set up; empty means MFA is off
+func (s *AuthService) mfaMethods(ctx context.Context, user db.User) ([]string, error) {
+	var methods []string
+	if user.MfaEnabled.Bool {
+		methods = append(methods, "totp", "recovery_code")
+	}
+
+	passkeys, err := s.DB.CountWebAuthnCredentialsByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if passkeys > 0 {
+		methods = append(methods, "passkey")
+	}
+	return methods, nil
+}
+
+// createMFAChallenge records a single-use token standing in for a verified password
+func (s *AuthService) createMFAChallenge(ctx context.Context, userID uuid.UUID) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := s.DB.DeleteExpiredMFAChallenges(ctx); err != nil {
+		log.Printf("DeleteExpiredMFAChallenges failed: %v", err)
+	}
+
+	err := s.DB.CreateMFAChallenge(ctx, db.CreateMFAChallengeParams{
+		TokenHash: mfaChallengeHash(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// redeemMFAChallenge consumes the challenge if code is valid. Failed attempts are
+// committed so a challenge can't be brute-forced past mfaChallengeMaxAttempts,
+// and count against the user so new challenges can't get around mfaThrottle.
+func (s *AuthService) redeemMFAChallenge(c *gin.Context, req auth.MFAVerifyRequest) (db.User, error) {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return db.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	hash := mfaChallengeHash(req.MFAChallenge)
+	challenge, err := q.GetMFAChallengeForUpdate(c, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.User{}, errInvalidMFAChallenge
+	}
+	if err != nil {
+		return db.User{}, err
+	}
+	if challenge.UsedAt.Valid || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= mfaChallengeMaxAttempts {
+		return db.User{}, errInvalidMFAChallenge
+	}
+
+	user, err := q.GetUserByID(c, challenge.UserID)
+	if err != nil {
+		return db.User{}, err
+	}
+
+	// Charged before the code is checked, and kept even if this transaction
+	// rolls back, so parallel guesses and fresh challenges don't reset it
+	counter := throttled{mfaThrottleKey(user.ID), mfaThrottle}
+	charged, wait, err := s.reserveAttempt(c, counter)
+	if err != nil {
+		return db.User{}, err
+	}
+	if wait > 0 {
+		return db.User{}, retryAfterError{wait: wait}
+	}
+
+	switch {
+	case req.Passkey != nil:
+		err = s.checkPasskey(c, q, user, hash, *req.Passkey)
+		if errors.Is(err, errPasskeyVerification) {
+			err = errInvalidMFACode
+		}
+	case req.RecoveryCode != "":
+		err = s.checkRecoveryCode(c, q, user, req.RecoveryCode)
+	default:
+		err = s.checkTOTP(c, q, user, req.Code)
+	}
+	if errors.Is(err, errInvalidMFACode) {
+		if charged[0].Failures == mfaThrottle.lockAt {
+			s.mfaLocked(c, user)
+		}
+		if err := q.RecordMFAChallengeAttempt(c, hash); err != nil {
+			return db.User{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return db.User{}, err
+		}
+		return db.User{}, errInvalidMFACode
+	}
+	if err != nil {
+		s.refundAttempt(c, counter)
+		return db.User{}, err
+	}
+
+	if err := q.MarkMFAChallengeUsed(c, hash); err != nil {
+		return db.User{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return db.User{}, err
+	}
+	if err := s.DB.ClearLoginThrottle(c, counter.key); err != nil {
+		log.Printf("ClearLoginThrottle failed: %v", err)
+	}
+	return user, nil
+}
+
+// checkTOTP validates code against the user's secret and burns its time step
+func (s *AuthService) checkTOTP(ctx context.Context, q *db.Queries, user db.User, code string) error {
+	if !user.MfaSecret.Valid {
+		return errInvalidMFACode
+	}
+	secret, err := s.JWT.DecryptSecret(user.MfaSecret.String)
+	if err != nil {
+		return err
+	}
+
+	step, ok := verifyTOTP(string(secret), code, time.Now())
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	// Only a step newer than the last accepted one counts, so a code can't be replayed
+	consumed, err := q.ConsumeTOTPStep(ctx, db.ConsumeTOTPStepParams{
+		Step: sql.NullInt64{Int64: step, Valid: true},
+		ID:   user.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if consumed == 0 {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+func mfaChallengeHash(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+func mfaAlreadyEnabled(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error": gin.H{
+			"code":    "MFA_ALREADY_ENABLED",
+			"message": "Multi-factor authentication is already enabled.",
+			"status":  http.StatusConflict,
+		},
+	})
+}
+
+func invalidMFACode(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_MFA_CODE",
+			"message": "Invalid authentication code.",
+			"status":  http.StatusUnauthorized,
+		},
+	})
+}
+
+// ResealMFASecrets re-encrypts stored TOTP secrets with the active encryption key
+func ResealMFASecrets(q *db.Queries, j *jwt.JWTManager) jwt.Resealer {
+	return func(ctx context.Context) error {
+		rows, err := q.ListMFASecrets(ctx)
+		if err != nil {
+			return err
+		}
+		resealed := 0
+		for _, row := range rows {
+			if !j.NeedsReseal(row.MfaSecret.String) {
+				continue
+			}
+			secret, err := j.DecryptSecret(row.MfaSecret.String)
+			if err != nil {
+				log.Printf("mfa secret for user %s can't be opened: %v", row.ID, err)
+				continue
+			}
+			sealed, err := j.EncryptSecret(secret)
+			if err != nil {
+				return err
+			}
+			n, err := q.ResealMFASecret(ctx, db.ResealMFASecretParams{
+				NewSecret: sql.NullString{String: sealed, Valid: true},
+				ID:        row.ID,
+				OldSecret: row.MfaSecret,
+			})
+			if err != nil {
+				return err
+			}
+			resealed += int(n)
+		}
+		if resealed > 0 {
+			log.Printf("Resealed %d MFA secrets", resealed)
+		}
+		return nil
+	}
+}
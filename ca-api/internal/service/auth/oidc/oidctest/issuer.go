@@ -0,0 +1,213 @@
+// Package oidctest runs an OpenID Connect provider in-process for tests: a
+// discovery document, an authorization endpoint that approves every login,
+// a token endpoint that enforces PKCE, and a JWKS that can be rotated.
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Issuer is a mock provider. Subject, Email and Groups describe the user who
+// logs in; Modify, when set, edits each ID token's claims before signing, so
+// tests can mint tokens with a bad issuer, audience, nonce or lifetime.
+type Issuer struct {
+	*httptest.Server
+	ClientID    string
+	RedirectURL string
+	Subject     string
+	Email       string
+	Groups      []string
+	Modify      func(claims jwt.MapClaims)
+
+	t     *testing.T
+	mu    sync.Mutex
+	key   *ecdsa.PrivateKey
+	kid   string
+	codes map[string]grant
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	challenge string
+	nonce     string
+}
+
+// NewIssuer starts a provider that serves clientID, redirecting back to redirectURL
+func NewIssuer(t *testing.T, clientID, redirectURL string) *Issuer {
+	t.Helper()
+	iss := &Issuer{
+		ClientID:    clientID,
+		RedirectURL: redirectURL,
+		Subject:     "user-1",
+		Email:       "alice@example.com",
+		t:           t,
+		codes:       make(map[string]grant),
+	}
+	iss.Rotate()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("GET /authorize", iss.authorize)
+	mux.HandleFunc("POST /token", iss.token)
+	mux.HandleFunc("GET /jwks", iss.jwks)
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// Rotate replaces the signing key with a new one under a new kid
+func (iss *Issuer) Rotate() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.key, iss.kid = key, randomString()
+}
+
+// Login follows authURL as a browser would and returns the URL the provider
+// redirects back to, carrying the code and state
+func (iss *Issuer) Login(authURL string) *url.URL {
+	iss.t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		iss.t.Fatalf("authorization endpoint returned %d", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	return callback
+}
+
+// IDToken signs claims with the current key
+func (iss *Issuer) IDToken(claims jwt.MapClaims) string {
+	iss.mu.Lock()
+	key, kid := iss.key, iss.kid
+	iss.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	return signed
+}
+
+func (iss *Issuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]string{
+		"issuer":                 iss.URL,
+		"authorization_endpoint": iss.URL + "/authorize",
+		"token_endpoint":         iss.URL + "/token",
+		"jwks_uri":               iss.URL + "/jwks",
+	})
+}
+
+func (iss *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != iss.ClientID || q.Get("redirect_uri") != iss.RedirectURL ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("state") == "" || q.Get("nonce") == "" ||
+		!strings.Contains(" "+q.Get("scope")+" ", " openid ") {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	iss.mu.Lock()
+	iss.codes[code] = grant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	iss.mu.Unlock()
+
+	back := url.Values{"code": {code}, "state": {q.Get("state")}}
+	http.Redirect(w, r, iss.RedirectURL+"?"+back.Encode(), http.StatusFound)
+}
+
+// token redeems a code once, and only with the verifier whose S256 hash was
+// sent to the authorization endpoint (RFC 7636 section 4.6)
+func (iss *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("client_id") != iss.ClientID ||
+		r.PostFormValue("redirect_uri") != iss.RedirectURL {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	iss.mu.Lock()
+	g, ok := iss.codes[r.PostFormValue("code")]
+	delete(iss.codes, r.PostFormValue("code"))
+	iss.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            iss.URL,
+		"aud":            iss.ClientID,
+		"sub":            iss.Subject,
+		"email":          iss.Email,
+		"email_verified": true,
+		"name":           "Alice Example",
+		"groups":         iss.Groups,
+		"nonce":          g.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+	if iss.Modify != nil {
+		iss.Modify(claims)
+	}
+	writeJSON(w, map[string]string{"access_token": randomString(), "token_type": "Bearer", "id_token": iss.IDToken(claims)})
+}
+
+func (iss *Issuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	iss.mu.Lock()
+	key, kid := iss.key, iss.kid
+	iss.mu.Unlock()
+
+	point, err := key.PublicKey.Bytes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"keys": []map[string]string{{
+		"kty": "EC",
+		"crv": "P-256",
+		"kid": kid,
+		"use": "sig",
+		"x":   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		"y":   base64.RawURLEncoding.EncodeToString(point[33:]),
+	}}})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
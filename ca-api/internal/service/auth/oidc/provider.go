@@ -0,0 +1,341 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	discoveryTTL = time.Hour
+	// An unknown kid triggers a JWKS refetch, but no more often than this
+	jwksMinRefresh = time.Minute
+	clockLeeway    = time.Minute
+	maxResponse    = 1 << 20
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// LoadProviders reads a JSON array of provider configs
+func LoadProviders(path string) ([]oidc.ProviderConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OIDC providers: %v", err)
+	}
+
+	var configs []oidc.ProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC providers: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range configs {
+		cfg := &configs[i]
+		if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			return nil, fmt.Errorf("OIDC provider %d: name, issuer, client_id and redirect_url are required", i)
+		}
+		if seen[cfg.Name] {
+			return nil, fmt.Errorf("OIDC provider %q is configured twice", cfg.Name)
+		}
+		seen[cfg.Name] = true
+		if len(cfg.AllowedDomains) == 0 {
+			return nil, fmt.Errorf("OIDC provider %q: allowed_domains is required", cfg.Name)
+		}
+		for j, domain := range cfg.AllowedDomains {
+			cfg.AllowedDomains[j] = strings.ToLower(domain)
+		}
+
+		if cfg.EmailClaim == "" {
+			cfg.EmailClaim = "email"
+		}
+		if cfg.GroupsClaim == "" {
+			cfg.GroupsClaim = "groups"
+		}
+		if !slices.Contains(cfg.Scopes, "openid") {
+			cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+		}
+	}
+	return configs, nil
+}
+
+// Provider is an OIDC relying party for one issuer. Metadata and signing keys
+// are fetched lazily and cached.
+type Provider struct {
+	cfg    oidc.ProviderConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidc.Discovery
+	discoveredAt  time.Time
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func NewProvider(cfg oidc.ProviderConfig, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) Config() oidc.ProviderConfig {
+	return p.cfg
+}
+
+// AuthCodeURL is where to send the browser to start a login
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	disc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(disc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return disc.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*oidc.UserClaims, error) {
+	disc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, disc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange failed: %v", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+	return p.verifyIDToken(ctx, token.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, raw, nonce string) (*oidc.UserClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockLeeway),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	// Multiple audiences are only acceptable when we are the authorized party
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, fmt.Errorf("%w: azp mismatch", ErrInvalidIDToken)
+		}
+	}
+	// The email may end up naming a Signee account, so a provider that doesn't
+	// say it checked the address isn't believed
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return nil, fmt.Errorf("%w: email not verified", ErrInvalidIDToken)
+	}
+
+	subject, _ := claims.GetSubject()
+	email, _ := claims[p.cfg.EmailClaim].(string)
+	if subject == "" || email == "" {
+		return nil, fmt.Errorf("%w: missing sub or %s claim", ErrInvalidIDToken, p.cfg.EmailClaim)
+	}
+
+	user := &oidc.UserClaims{
+		Subject: subject,
+		Email:   strings.ToLower(email),
+		Groups:  stringList(claims[p.cfg.GroupsClaim]),
+	}
+	user.GivenName, _ = claims["given_name"].(string)
+	user.FamilyName, _ = claims["family_name"].(string)
+	if user.GivenName == "" {
+		name, _ := claims["name"].(string)
+		user.GivenName, user.FamilyName, _ = strings.Cut(name, " ")
+	}
+	return user, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*oidc.Discovery, error) {
+	p.mu.Lock()
+	if p.discovery != nil && time.Since(p.discoveredAt) < discoveryTTL {
+		disc := p.discovery
+		p.mu.Unlock()
+		return disc, nil
+	}
+	p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var disc oidc.Discovery
+	if err := p.doJSON(req, &disc); err != nil {
+		return nil, fmt.Errorf("discovery failed: %v", err)
+	}
+	if disc.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", disc.Issuer, p.cfg.Issuer)
+	}
+	if disc.AuthorizationEndpoint == "" || disc.TokenEndpoint == "" || disc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document is missing endpoints")
+	}
+
+	p.mu.Lock()
+	p.discovery, p.discoveredAt = &disc, time.Now()
+	p.mu.Unlock()
+	return &disc, nil
+}
+
+// key returns the signing key for kid, refetching the JWKS once if it's unknown (key rotation)
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.lookupKeyLocked(kid)
+	stale := time.Since(p.keysFetchedAt) >= jwksMinRefresh
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	disc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, disc.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jwkSet
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("jwks fetch failed: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.keysFetchedAt = set.publicKeys(), time.Now()
+	if key, ok := p.lookupKeyLocked(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKeyLocked accepts an empty kid only when the set holds a single key
+func (p *Provider) lookupKeyLocked(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) doJSON(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", req.URL.Redacted(), resp.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// NewPKCE returns a code verifier and its S256 challenge (RFC 7636)
+func NewPKCE() (string, string, error) {
+	verifier, err := RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomToken returns 256 random bits, URL-safe encoded, for state, nonce and verifiers
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// stringList accepts a claim holding either a list of strings or a single string
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
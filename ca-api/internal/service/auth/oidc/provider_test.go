@@ -0,0 +1,268 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/oidc"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testRedirectURL = "https://signee.example.com/api/v1/auth/oidc/test/callback"
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Issuer) {
+	t.Helper()
+	iss := oidctest.NewIssuer(t, "signee", testRedirectURL)
+	p := NewProvider(oidc.ProviderConfig{
+		Name:        "test",
+		Issuer:      iss.URL,
+		ClientID:    "signee",
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"openid", "email"},
+		EmailClaim:  "email",
+		GroupsClaim: "groups",
+	}, iss.Client())
+	return p, iss
+}
+
+// login runs the browser half of a login and returns the code the provider sent back
+func login(t *testing.T, p *Provider, iss *oidctest.Issuer, state, nonce, challenge string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() = %v", err)
+	}
+	callback := iss.Login(authURL)
+	if got := callback.Query().Get("state"); got != state {
+		t.Fatalf("provider returned state %q, want %q", got, state)
+	}
+	return callback.Query().Get("code")
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p, iss := newTestProvider(t)
+	authURL, err := p.AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, iss.URL+"/authorize?") {
+		t.Fatalf("AuthCodeURL() = %s, want the discovered authorization endpoint", authURL)
+	}
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "signee",
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        "the-challenge",
+		"code_challenge_method": "S256",
+	} {
+		if got := u.Query().Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	p, iss := newTestProvider(t)
+	iss.Email = "Alice@Example.com"
+	iss.Groups = []string{"ops", "dev"}
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := login(t, p, iss, "state", "nonce", challenge)
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce")
+	if err != nil {
+		t.Fatalf("Exchange() = %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "alice@example.com" || claims.GivenName != "Alice" || claims.FamilyName != "Example" {
+		t.Fatalf("Exchange() = %+v", claims)
+	}
+	if strings.Join(claims.Groups, ",") != "ops,dev" {
+		t.Fatalf("groups = %v, want [ops dev]", claims.Groups)
+	}
+
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+		t.Fatal("a redeemed code was accepted again")
+	}
+}
+
+func TestLoadProvidersRequiresDomains(t *testing.T) {
+	for name, tc := range map[string]struct {
+		json string
+		want []string // allowed domains after loading; nil for an error
+	}{
+		"missing": {json: `[{"name":"corp","issuer":"https://id.example.com","client_id":"signee","redirect_url":"` + testRedirectURL + `"}]`},
+		"empty":   {json: `[{"name":"corp","issuer":"https://id.example.com","client_id":"signee","redirect_url":"` + testRedirectURL + `","allowed_domains":[]}]`},
+		"lowered": {
+			json: `[{"name":"corp","issuer":"https://id.example.com","client_id":"signee","redirect_url":"` + testRedirectURL + `","allowed_domains":["Example.COM"]}]`,
+			want: []string{"example.com"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "providers.json")
+			if err := os.WriteFile(path, []byte(tc.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			configs, err := LoadProviders(path)
+			if tc.want == nil {
+				if err == nil {
+					t.Fatalf("LoadProviders() = %+v, want an error", configs)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(configs[0].AllowedDomains, tc.want) {
+				t.Fatalf("LoadProviders() = %+v, %v, want allowed domains %q", configs, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestExchangePKCE(t *testing.T) {
+	p, iss := newTestProvider(t)
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A code intercepted on its way back is useless without the verifier
+	code := login(t, p, iss, "state", "nonce", challenge)
+	if _, err := p.Exchange(context.Background(), code, otherVerifier, "nonce"); err == nil {
+		t.Fatal("code redeemed with the wrong PKCE verifier")
+	}
+}
+
+func TestExchangeRejectsIDToken(t *testing.T) {
+	for name, tc := range map[string]struct {
+		modify func(claims jwt.MapClaims)
+		nonce  string // passed to Exchange; the login always uses "nonce"
+	}{
+		"nonce from another login": {nonce: "other-nonce"},
+		"missing nonce":            {modify: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		"other issuer":             {modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		"other audience":           {modify: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		"shared audience, no azp":  {modify: func(c jwt.MapClaims) { c["aud"] = []string{"signee", "someone-else"} }},
+		"shared audience, other azp": {modify: func(c jwt.MapClaims) {
+			c["aud"], c["azp"] = []string{"signee", "someone-else"}, "someone-else"
+		}},
+		"expired":            {modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * clockLeeway).Unix() }},
+		"no expiry":          {modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		"issued in future":   {modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(2 * clockLeeway).Unix() }},
+		"email not verified": {modify: func(c jwt.MapClaims) { c["email_verified"] = false }},
+		// Silence is not a verified email, nor is a claim of the wrong type
+		"email_verified missing":   {modify: func(c jwt.MapClaims) { delete(c, "email_verified") }},
+		"email_verified as string": {modify: func(c jwt.MapClaims) { c["email_verified"] = "true" }},
+		"no email":                 {modify: func(c jwt.MapClaims) { delete(c, "email") }},
+		"no subject":               {modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, iss := newTestProvider(t)
+			iss.Modify = tc.modify
+			nonce := tc.nonce
+			if nonce == "" {
+				nonce = "nonce"
+			}
+
+			verifier, challenge, err := NewPKCE()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := login(t, p, iss, "state", "nonce", challenge)
+			if _, err := p.Exchange(context.Background(), code, verifier, nonce); !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("Exchange() = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+
+	t.Run("shared audience, our azp", func(t *testing.T) {
+		p, iss := newTestProvider(t)
+		iss.Modify = func(c jwt.MapClaims) { c["aud"], c["azp"] = []string{"signee", "someone-else"}, "signee" }
+		verifier, challenge, _ := NewPKCE()
+		code := login(t, p, iss, "state", "nonce", challenge)
+		if _, err := p.Exchange(context.Background(), code, verifier, "nonce"); err != nil {
+			t.Fatalf("Exchange() = %v", err)
+		}
+	})
+}
+
+func TestVerifyIDTokenAlgorithms(t *testing.T) {
+	p, iss := newTestProvider(t)
+	claims := jwt.MapClaims{
+		"iss": iss.URL, "aud": "signee", "sub": "user-1", "email": "alice@example.com", "email_verified": true, "nonce": "nonce",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+	}
+	if _, err := p.verifyIDToken(context.Background(), iss.IDToken(claims), "nonce"); err != nil {
+		t.Fatalf("verifyIDToken() = %v", err)
+	}
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HMAC with a public value as the secret is the classic key confusion attack
+	hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(iss.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, raw := range map[string]string{"none": unsigned, "HS256": hmac} {
+		if _, err := p.verifyIDToken(context.Background(), raw, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("verifyIDToken(%s) = %v, want ErrInvalidIDToken", name, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	p, iss := newTestProvider(t)
+	exchange := func() error {
+		verifier, challenge, err := NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := login(t, p, iss, "state", "nonce", challenge)
+		_, err = p.Exchange(context.Background(), code, verifier, "nonce")
+		return err
+	}
+	if err := exchange(); err != nil {
+		t.Fatalf("Exchange() = %v", err)
+	}
+
+	// Unknown kids refetch the JWKS, but not more than once a minute
+	iss.Rotate()
+	if err := exchange(); err == nil {
+		t.Fatal("token from a new key accepted without refetching the JWKS")
+	}
+	p.mu.Lock()
+	p.keysFetchedAt = time.Now().Add(-jwksMinRefresh)
+	p.mu.Unlock()
+	if err := exchange(); err != nil {
+		t.Fatalf("Exchange() after rotation = %v", err)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	p, iss := newTestProvider(t)
+	// Same discovery URL, but the document names a different issuer than configured
+	p.cfg.Issuer = iss.URL + "/"
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatal("discovery document for another issuer was accepted")
+	}
+}
@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/oidc"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+	// Binds the login to the browser that started it, so a stolen callback URL can't be replayed elsewhere
+	oidcStateCookie = "__Host-oidc-state"
+)
+
+// BeginOIDCLogin redirects the browser to the provider's authorization endpoint
+func (s *AuthService) BeginOIDCLogin(c *gin.Context) {
+	provider, ok := s.OIDC[c.Param("provider")]
+	if !ok {
+		ssoProviderNotFound(c)
+		return
+	}
+
+	authURL, state, err := s.newOIDCLogin(c, provider, uuid.NullUUID{})
+	if err != nil {
+		log.Printf("newOIDCLogin failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	setOIDCStateCookie(c, state)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// LinkOIDCIdentity starts linking a provider to the caller's own account. The
+// frontend sends the browser to the returned URL; FinishOIDCLogin completes it.
+// This is the only way an identity gets attached to an existing account.
+func (s *AuthService) LinkOIDCIdentity(c *gin.Context) {
+	provider, ok := s.OIDC[c.Param("provider")]
+	if !ok {
+		ssoProviderNotFound(c)
+		return
+	}
+
+	userID := middleware.CurrentPrincipal(c).UserID
+	authURL, state, err := s.newOIDCLogin(c, provider, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("newOIDCLogin failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	setOIDCStateCookie(c, state)
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// setOIDCStateCookie binds a login to the browser that started it. Lax, not
+// Strict: the cookie must survive the cross-site redirect back from the provider.
+func setOIDCStateCookie(c *gin.Context, state string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(oidcStateTTL / time.Second),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// FinishOIDCLogin handles the provider's redirect back, provisioning the user on
+// first login, and sends the browser on to the frontend signed in
+func (s *AuthService) FinishOIDCLogin(c *gin.Context) {
+	name := c.Param("provider")
+	provider, ok := s.OIDC[name]
+	if !ok {
+		ssoProviderNotFound(c)
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		log.Printf("OIDC provider %s returned error: %s", name, errCode)
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+
+	state, code := c.Query("state"), c.Query("code")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if state == "" || code == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+
+	login, err := consumeOIDCState(c, s.DB, name, state)
+	if errors.Is(err, errInvalidOIDCState) {
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+	if err != nil {
+		log.Printf("consumeOIDCState failed: %v", err)
+		s.ssoRedirectError(c, "INTERNAL_SERVER_ERROR")
+		return
+	}
+
+	claims, err := provider.Exchange(c, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("OIDC exchange with %s failed: %v", name, err)
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+
+	cfg := provider.Config()
+	if !s.emailAllowed(claims.Email, cfg.AllowedDomains) {
+		log.Printf("OIDC provider %s vouched for %s outside its domains", name, claims.Email)
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+	ext := auth.ExternalIdentity{
+		Source:    "oidc:" + name,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+		Roles:     mapGroups(claims.Groups, cfg.RoleMapping, cfg.DefaultRole),
+	}
+	if login.LinkUserID.Valid {
+		s.finishSSOLink(c, login.LinkUserID.UUID, ext)
+		return
+	}
+
+	user, err := s.provisionExternalUser(c, ext)
+	if errors.Is(err, errAccountExists) {
+		// Signing in as whoever holds the email would hand their account to the provider
+		s.ssoRedirectError(c, "ACCOUNT_EXISTS")
+		return
+	}
+	if err != nil {
+		log.Printf("provisionExternalUser failed: %v", err)
+		s.ssoRedirectError(c, "INTERNAL_SERVER_ERROR")
+		return
+	}
+
+	// Local MFA still applies on top of the provider's authentication
+	s.completeSSOLogin(c, user)
+}
+
+var errInvalidOIDCState = errors.New("invalid or expired OIDC state")
+
+// newOIDCLogin stores the state, nonce and PKCE verifier for one login attempt.
+// A valid linkUserID makes it link the identity to that user instead.
+func (s *AuthService) newOIDCLogin(c *gin.Context, provider *oidc.Provider, linkUserID uuid.NullUUID) (string, string, error) {
+	state, err := oidc.RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(c, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Opportunistic cleanup of abandoned logins
+	if err := s.DB.DeleteExpiredOIDCLoginStates(c); err != nil {
+		log.Printf("DeleteExpiredOIDCLoginStates failed: %v", err)
+	}
+
+	stateHash := sha256.Sum256([]byte(state))
+	err = s.DB.CreateOIDCLoginState(c, db.CreateOIDCLoginStateParams{
+		StateHash:    stateHash[:],
+		Provider:     provider.Config().Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+		LinkUserID:   linkUserID,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// consumeOIDCState redeems a state exactly once, for the provider it was issued for
+func consumeOIDCState(c *gin.Context, q *db.Queries, provider, state string) (db.OidcLoginState, error) {
+	stateHash := sha256.Sum256([]byte(state))
+	login, err := q.ConsumeOIDCLoginState(c, stateHash[:])
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.OidcLoginState{}, errInvalidOIDCState
+	}
+	if err != nil {
+		return db.OidcLoginState{}, err
+	}
+	if login.Provider != provider || time.Now().After(login.ExpiresAt) {
+		return db.OidcLoginState{}, errInvalidOIDCState
+	}
+	return login, nil
+}
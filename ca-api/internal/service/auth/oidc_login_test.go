@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/config"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	domainldap "github.com/dhruvpatel-10/signee/ca-api/internal/domain/ldap"
+	domainoidc "github.com/dhruvpatel-10/signee/ca-api/internal/domain/oidc"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/ldap"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/oidc"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/oidc/oidctest"
+	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	oidcRedirectURL = "https://signee.example.com/api/v1/auth/oidc/corp/callback"
+	testAppURL      = "https://app.example.com"
+)
+
+// oidcTest wires an AuthService to a mock issuer and a fake database
+type oidcTest struct {
+	t      *testing.T
+	db     *fakeDB
+	s      *AuthService
+	iss    *oidctest.Issuer
+	router *gin.Engine
+
+	principal *auth.Principal // who is signed in when linking
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	fake, conn, queries := newFakeDB(t, "operator", "viewer", "admin")
+
+	dir := t.TempDir()
+	jwtManager, err := jwt.NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iss := oidctest.NewIssuer(t, "signee", oidcRedirectURL)
+	providers := make(map[string]*oidc.Provider)
+	for _, name := range []string{"corp", "partner"} {
+		providers[name] = oidc.NewProvider(domainoidc.ProviderConfig{
+			Name:        name,
+			Issuer:      iss.URL,
+			ClientID:    "signee",
+			RedirectURL: oidcRedirectURL,
+			Scopes:      []string{"openid", "email"},
+			EmailClaim:  "email",
+			GroupsClaim: "groups",
+			RoleMapping: map[string]string{"ops": "operator"},
+			DefaultRole: "viewer",
+
+			AllowedDomains: []string{"example.com", "partner.example.org"},
+		}, iss.Client())
+	}
+
+	s := &AuthService{Conn: conn, DB: queries, JWT: jwtManager, OIDC: providers, HashLimit: NewHashLimiter(1), AppURL: testAppURL}
+	o := &oidcTest{t: t, db: fake, s: s, iss: iss}
+	o.router = gin.New()
+	o.router.GET("/oidc/:provider/login", s.BeginOIDCLogin)
+	o.router.GET("/oidc/:provider/callback", s.FinishOIDCLogin)
+	o.router.POST("/oidc/:provider/link", func(c *gin.Context) { c.Set(middleware.PrincipalKey, o.principal) }, s.LinkOIDCIdentity)
+	return o
+}
+
+func (o *oidcTest) serve(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, req)
+	return w
+}
+
+// begin starts a login and returns the provider's redirect back and the state cookie
+func (o *oidcTest) begin(provider string) (*url.URL, *http.Cookie) {
+	o.t.Helper()
+	w := o.serve("/oidc/"+provider+"/login", nil)
+	if w.Code != http.StatusFound {
+		o.t.Fatalf("BeginOIDCLogin = %d: %s", w.Code, w.Body)
+	}
+	var state *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			state = c
+		}
+	}
+	if state == nil || !state.HttpOnly || !state.Secure {
+		o.t.Fatalf("state cookie = %+v, want a Secure, HttpOnly cookie", state)
+	}
+	return o.iss.Login(w.Header().Get("Location")), state
+}
+
+func (o *oidcTest) finish(provider string, callback *url.URL, cookie *http.Cookie) *httptest.ResponseRecorder {
+	return o.serve("/oidc/"+provider+"/callback?"+callback.RawQuery, cookie)
+}
+
+// signedIn checks that a callback sent the browser to the frontend with a
+// refresh token cookie and nothing else for the page to leak
+func signedIn(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	if w.Code != http.StatusFound || w.Header().Get("Location") != testAppURL+"/" {
+		t.Fatalf("callback = %d to %q: %s, want a redirect to the frontend", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	refresh := config.DefaultCookieConfig().TokenName
+	if !slices.ContainsFunc(w.Result().Cookies(), func(c *http.Cookie) bool { return c.Name == refresh && c.Value != "" }) {
+		t.Fatalf("cookies = %v, want a %s", w.Result().Cookies(), refresh)
+	}
+	if strings.Contains(w.Body.String(), "token") {
+		t.Fatalf("body = %s, want no tokens in the page", w.Body)
+	}
+}
+
+// ssoFailed checks that a callback sent the browser back to the login page with code
+func ssoFailed(t *testing.T, w *httptest.ResponseRecorder, code string) {
+	t.Helper()
+	if want := testAppURL + "/login?error=" + code; w.Code != http.StatusFound || w.Header().Get("Location") != want {
+		t.Fatalf("callback = %d to %q: %s, want a redirect to %s", w.Code, w.Header().Get("Location"), w.Body, want)
+	}
+	if slices.ContainsFunc(w.Result().Cookies(), func(c *http.Cookie) bool { return c.Name == config.DefaultCookieConfig().TokenName }) {
+		t.Fatal("failed login set a refresh token cookie")
+	}
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	o := newOIDCTest(t)
+	o.iss.Groups = []string{"ops", "unmapped"}
+
+	callback, cookie := o.begin("corp")
+	signedIn(t, o.finish("corp", callback, cookie))
+
+	user := o.db.user("alice@example.com")
+	if user.Status != auth.UserStatusActive || user.FirstName != "Alice" || user.LastName != "Example" {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+	if ok, _ := (&AuthService{HashLimit: NewHashLimiter(1)}).verifyPassword(t.Context(), "", user.PasswordHash); ok {
+		t.Fatal("provisioned user has a usable password")
+	}
+	if roles := o.db.rolesOf(user.ID, "oidc:corp"); !slices.Equal(roles, []string{"operator"}) {
+		t.Fatalf("roles = %v, want [operator]", roles)
+	}
+	if !slices.Equal(o.db.events, []string{string(audit.UserProvisioned)}) {
+		t.Fatalf("audit events = %v", o.db.events)
+	}
+
+	// The next login finds the same user through its identity and re-syncs roles
+	o.iss.Groups = nil
+	o.iss.Email = "alice.new@example.com"
+	callback, cookie = o.begin("corp")
+	signedIn(t, o.finish("corp", callback, cookie))
+	if len(o.db.users) != 1 {
+		t.Fatalf("%d users after two logins, want 1", len(o.db.users))
+	}
+	if roles := o.db.rolesOf(user.ID, "oidc:corp"); !slices.Equal(roles, []string{"viewer"}) {
+		t.Fatalf("roles after groups changed = %v, want the default [viewer]", roles)
+	}
+}
+
+// TestOIDCLoginMFA checks that a second factor is still asked for, with the
+// challenge handed over in the fragment instead of a token cookie
+func TestOIDCLoginMFA(t *testing.T) {
+	o := newOIDCTest(t)
+	callback, cookie := o.begin("corp")
+	signedIn(t, o.finish("corp", callback, cookie))
+	o.db.users[0].MfaEnabled = sql.NullBool{Bool: true, Valid: true}
+
+	callback, cookie = o.begin("corp")
+	w := o.finish("corp", callback, cookie)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusFound || err != nil || location.Path != "/login/mfa" || location.RawQuery != "" {
+		t.Fatalf("FinishOIDCLogin = %d to %q, want a redirect to /login/mfa", w.Code, w.Header().Get("Location"))
+	}
+	fragment, err := url.ParseQuery(location.Fragment)
+	if err != nil || fragment.Get("challenge") == "" || fragment.Get("methods") != "totp,recovery_code" {
+		t.Fatalf("fragment = %q, want a challenge and the user's methods", location.Fragment)
+	}
+	if len(o.db.challenges) != 1 || o.db.challenges[0].UserID != o.db.users[0].ID {
+		t.Fatalf("challenges = %+v, want one for the user", o.db.challenges)
+	}
+	if len(w.Result().Cookies()) != 1 {
+		t.Fatalf("cookies = %v, want only the state cookie cleared", w.Result().Cookies())
+	}
+}
+
+// link starts linking provider to the signed-in user's account and returns
+// the provider's redirect back and the state cookie
+func (o *oidcTest) link(provider string, userID uuid.UUID) (*url.URL, *http.Cookie) {
+	o.t.Helper()
+	o.principal = &auth.Principal{UserID: userID}
+	req := httptest.NewRequest(http.MethodPost, "/oidc/"+provider+"/link", nil)
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, req)
+
+	var resp struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusOK || err != nil || resp.AuthorizationURL == "" {
+		o.t.Fatalf("LinkOIDCIdentity = %d: %s, want an authorization URL", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+		o.t.Fatalf("cookies = %v, want the state cookie", cookies)
+	}
+	return o.iss.Login(resp.AuthorizationURL), cookies[0]
+}
+
+// TestOIDCLoginDoesNotTakeOverAccounts checks that a provider vouching for an
+// email can't sign in to an account it was never linked to
+func TestOIDCLoginDoesNotTakeOverAccounts(t *testing.T) {
+	for name, tc := range map[string]struct {
+		setup func(o *oidcTest)
+		code  string
+	}{
+		"existing admin": {
+			setup: func(o *oidcTest) {
+				id := o.db.addUser(db.User{Email: "alice@example.com", FirstName: "Alice", Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+				o.db.grants = append(o.db.grants, fakeGrant{userID: id, roleID: o.db.roles[2].ID, source: "local"})
+			},
+			code: "ACCOUNT_EXISTS",
+		},
+		"service account": {
+			setup: func(o *oidcTest) {
+				o.db.addUser(db.User{Email: "alice@example.com", FirstName: "deploy", Status: auth.UserStatusActive, Kind: auth.UserKindService})
+			},
+			code: "ACCOUNT_EXISTS",
+		},
+		"email_verified missing": {
+			setup: func(o *oidcTest) { o.iss.Modify = func(c gojwt.MapClaims) { delete(c, "email_verified") } },
+			code:  "SSO_LOGIN_FAILED",
+		},
+		"domain not allowed": {
+			setup: func(o *oidcTest) { o.iss.Email = "alice@elsewhere.example.net" },
+			code:  "SSO_LOGIN_FAILED",
+		},
+		"domain owned by a directory": {
+			setup: func(o *oidcTest) {
+				dir, err := ldap.NewDirectory(domainldap.DirectoryConfig{Name: "corp", Domains: []string{"example.com"}})
+				if err != nil {
+					o.t.Fatal(err)
+				}
+				o.s.Directories = map[string]*ldap.Directory{"example.com": dir}
+			},
+			code: "SSO_LOGIN_FAILED",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			o := newOIDCTest(t)
+			tc.setup(o)
+			before := len(o.db.users)
+
+			callback, cookie := o.begin("corp")
+			ssoFailed(t, o.finish("corp", callback, cookie), tc.code)
+			if len(o.db.identities) != 0 || len(o.db.users) != before {
+				t.Fatalf("identities = %+v, users = %d, want nothing linked or provisioned", o.db.identities, len(o.db.users))
+			}
+			for _, u := range o.db.users {
+				if roles := o.db.rolesOf(u.ID, "oidc:corp"); len(roles) != 0 {
+					t.Fatalf("roles = %v granted to %s", roles, u.Email)
+				}
+			}
+		})
+	}
+}
+
+// TestOIDCLinkFromSession links a provider to an account by its signed-in
+// owner, after which logging in through the provider reaches that account
+func TestOIDCLinkFromSession(t *testing.T) {
+	o := newOIDCTest(t)
+	alice := o.db.addUser(db.User{Email: "alice@example.com", FirstName: "Alice", Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+
+	callback, cookie := o.link("corp", alice)
+	w := o.finish("corp", callback, cookie)
+	if want := testAppURL + "/account/identities?linked=oidc%3Acorp"; w.Code != http.StatusFound || w.Header().Get("Location") != want {
+		t.Fatalf("FinishOIDCLogin = %d to %q, want a redirect to %s", w.Code, w.Header().Get("Location"), want)
+	}
+	if len(o.db.identities) != 1 || o.db.identities[0].UserID != alice || o.db.identities[0].Subject != "user-1" {
+		t.Fatalf("identities = %+v, want user-1 linked to alice", o.db.identities)
+	}
+	if !slices.Equal(o.db.events, []string{string(audit.IdentityLinked)}) {
+		t.Fatalf("audit events = %v", o.db.events)
+	}
+
+	callback, cookie = o.begin("corp")
+	signedIn(t, o.finish("corp", callback, cookie))
+	if len(o.db.users) != 1 || !slices.Equal(o.db.rolesOf(alice, "oidc:corp"), []string{"viewer"}) {
+		t.Fatalf("users = %d, roles = %v, want alice signed in with the provider's roles", len(o.db.users), o.db.rolesOf(alice, "oidc:corp"))
+	}
+
+	t.Run("identity linked elsewhere", func(t *testing.T) {
+		bob := o.db.addUser(db.User{Email: "bob@example.com", FirstName: "Bob", Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+		callback, cookie := o.link("corp", bob)
+		w := o.finish("corp", callback, cookie)
+		if want := testAppURL + "/account/identities?error=IDENTITY_IN_USE"; w.Header().Get("Location") != want {
+			t.Fatalf("FinishOIDCLogin = %d to %q, want a redirect to %s", w.Code, w.Header().Get("Location"), want)
+		}
+		if len(o.db.identities) != 1 || o.db.identities[0].UserID != alice {
+			t.Fatalf("identities = %+v, want user-1 still alice's", o.db.identities)
+		}
+	})
+
+	t.Run("service account", func(t *testing.T) {
+		svc := o.db.addUser(db.User{Email: "deploy@example.com", FirstName: "deploy", Status: auth.UserStatusActive, Kind: auth.UserKindService})
+		o.iss.Subject = "user-2"
+		callback, cookie := o.link("corp", svc)
+		w := o.finish("corp", callback, cookie)
+		if want := testAppURL + "/account/identities?error=LINK_NOT_ALLOWED"; w.Header().Get("Location") != want {
+			t.Fatalf("FinishOIDCLogin = %d to %q, want a redirect to %s", w.Code, w.Header().Get("Location"), want)
+		}
+		if len(o.db.identities) != 1 {
+			t.Fatalf("identities = %+v, want nothing linked to the service account", o.db.identities)
+		}
+	})
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	for name, tc := range map[string]func(o *oidcTest) *httptest.ResponseRecorder{
+		"no state cookie": func(o *oidcTest) *httptest.ResponseRecorder {
+			callback, _ := o.begin("corp")
+			return o.finish("corp", callback, nil)
+		},
+		"another browser's state": func(o *oidcTest) *httptest.ResponseRecorder {
+			callback, _ := o.begin("corp")
+			_, other := o.begin("corp")
+			return o.finish("corp", callback, other)
+		},
+		"state for another provider": func(o *oidcTest) *httptest.ResponseRecorder {
+			callback, cookie := o.begin("corp")
+			return o.finish("partner", callback, cookie)
+		},
+		"replayed callback": func(o *oidcTest) *httptest.ResponseRecorder {
+			callback, cookie := o.begin("corp")
+			signedIn(o.t, o.finish("corp", callback, cookie))
+			return o.finish("corp", callback, cookie)
+		},
+		"provider error": func(o *oidcTest) *httptest.ResponseRecorder {
+			_, cookie := o.begin("corp")
+			return o.serve("/oidc/corp/callback?error=access_denied&state="+url.QueryEscape(cookie.Value), cookie)
+		},
+		"nonce from another login": func(o *oidcTest) *httptest.ResponseRecorder {
+			o.iss.Modify = func(claims gojwt.MapClaims) { claims["nonce"] = "stolen" }
+			callback, cookie := o.begin("corp")
+			return o.finish("corp", callback, cookie)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			o := newOIDCTest(t)
+			ssoFailed(t, tc(o), "SSO_LOGIN_FAILED")
+			if name != "replayed callback" && len(o.db.users) != 0 {
+				t.Fatal("user provisioned by a rejected login")
+			}
+		})
+	}
+}
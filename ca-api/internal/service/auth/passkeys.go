@@ -0,0 +1,631 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/config"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/webauthn"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	webauthnrp "github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/webauthn"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Ceremonies a stored WebAuthn challenge may be answered by
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+	ceremonyMFA          = "mfa"
+)
+
+const (
+	passkeyCeremonyTTL = 5 * time.Minute
+	defaultPasskeyName = "Passkey"
+)
+
+var errPasskeyVerification = errors.New("passkey verification failed")
+
+// BeginPasskeyRegistration returns creation options for a new passkey on the caller's account
+func (s *AuthService) BeginPasskeyRegistration(c *gin.Context) {
+	principal := middleware.CurrentPrincipal(c)
+	user, err := s.DB.GetUserByID(c, principal.UserID)
+	if err != nil {
+		log.Printf("GetUserByID failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	existing, err := s.DB.ListWebAuthnCredentialsByUser(c, user.ID)
+	if err != nil {
+		log.Printf("ListWebAuthnCredentialsByUser failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	challenge, err := s.newPasskeyChallenge(c, ceremonyRegistration, uuid.NullUUID{UUID: user.ID, Valid: true}, nil)
+	if err != nil {
+		log.Printf("newPasskeyChallenge failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	params := make([]webauthn.CredentialParameter, 0, len(webauthnrp.SupportedAlgorithms))
+	for _, alg := range webauthnrp.SupportedAlgorithms {
+		params = append(params, webauthn.CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": webauthn.CreationOptions{
+		Challenge: webauthnrp.Encode(challenge),
+		RP:        webauthn.RPEntity{ID: s.WebAuthn.ID, Name: s.WebAuthn.Name},
+		User: webauthn.UserEntity{
+			ID:          webauthnrp.Encode(user.ID[:]),
+			Name:        user.Email,
+			DisplayName: user.FirstName + " " + user.LastName,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            int(passkeyCeremonyTTL.Milliseconds()),
+		ExcludeCredentials: credentialDescriptors(existing),
+		AuthenticatorSelection: webauthn.AuthenticatorSelection{
+			ResidentKey:      "preferred", // discoverable credentials enable passwordless login
+			UserVerification: "preferred",
+		},
+		Attestation: "direct",
+	}})
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response and stores the credential
+func (s *AuthService) FinishPasskeyRegistration(c *gin.Context) {
+	var req webauthn.RegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	cred, err := s.verifyPasskeyRegistration(c, principal.UserID, req.Credential)
+	if errors.Is(err, errPasskeyVerification) {
+		passkeyVerificationFailed(c)
+		return
+	}
+	if err != nil {
+		log.Printf("verifyPasskeyRegistration failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	_, err = s.DB.GetWebAuthnCredentialByCredentialID(c, cred.ID)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": gin.H{
+				"code":    "PASSKEY_ALREADY_REGISTERED",
+				"message": "This passkey is already registered.",
+				"status":  http.StatusConflict,
+			},
+		})
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("GetWebAuthnCredentialByCredentialID failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	stored, err := s.storePasskey(c, principal.UserID, name, cred)
+	if err != nil {
+		log.Printf("storePasskey failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, credentialInfo(stored))
+}
+
+// ListPasskeys lists the caller's registered passkeys
+func (s *AuthService) ListPasskeys(c *gin.Context) {
+	creds, err := s.DB.ListWebAuthnCredentialsByUser(c, middleware.CurrentPrincipal(c).UserID)
+	if err != nil {
+		log.Printf("ListWebAuthnCredentialsByUser failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	passkeys := make([]webauthn.CredentialInfo, 0, len(creds))
+	for _, cred := range creds {
+		passkeys = append(passkeys, credentialInfo(cred))
+	}
+	c.JSON(http.StatusOK, gin.H{"passkeys": passkeys})
+}
+
+// DeletePasskey removes one of the caller's passkeys
+func (s *AuthService) DeletePasskey(c *gin.Context) {
+	principal := middleware.CurrentPrincipal(c)
+	credentialID, err := uuid.Parse(c.Param("credentialID"))
+	if err != nil {
+		passkeyNotFound(c)
+		return
+	}
+
+	deleted, err := s.deletePasskey(c, principal.UserID, credentialID)
+	if err != nil {
+		log.Printf("deletePasskey failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if !deleted {
+		passkeyNotFound(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// BeginPasskeyLogin returns request options for passwordless login with a discoverable credential
+func (s *AuthService) BeginPasskeyLogin(c *gin.Context) {
+	challenge, err := s.newPasskeyChallenge(c, ceremonyLogin, uuid.NullUUID{}, nil)
+	if err != nil {
+		log.Printf("newPasskeyChallenge failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": webauthn.RequestOptions{
+		Challenge: webauthnrp.Encode(challenge),
+		Timeout:   int(passkeyCeremonyTTL.Milliseconds()),
+		RPID:      s.WebAuthn.ID,
+		// The passkey stands in for both password and second factor, so it must verify the user
+		UserVerification: "required",
+	}})
+}
+
+// FinishPasskeyLogin signs the user in from a passkey assertion alone
+func (s *AuthService) FinishPasskeyLogin(c *gin.Context) {
+	var req webauthn.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	user, err := s.verifyPasskeyLogin(c, req.Credential)
+	if errors.Is(err, errPasskeyVerification) {
+		passkeyVerificationFailed(c)
+		return
+	}
+	if err != nil {
+		log.Printf("verifyPasskeyLogin failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if accountUnavailable(c, user) {
+		return
+	}
+
+	tokens, err := s.startTokenFamily(c, user)
+	if err != nil {
+		log.Printf("startTokenFamily failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	config.SetTokenCookies(c.Writer, tokens.RefreshToken, config.DefaultCookieConfig())
+
+	c.JSON(http.StatusOK, auth.AuthResponse{
+		User:   userInfo(user),
+		Tokens: s.tokenPair(tokens),
+	})
+}
+
+// BeginPasskeyMFA returns request options for answering a login MFA challenge with a passkey
+func (s *AuthService) BeginPasskeyMFA(c *gin.Context) {
+	var req webauthn.MFAOptionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	hash := mfaChallengeHash(req.MFAChallenge)
+	challenge, err := s.DB.GetMFAChallenge(c, hash)
+	if err == nil && (challenge.UsedAt.Valid || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= mfaChallengeMaxAttempts) {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_MFA_CHALLENGE",
+				"message": "The MFA challenge is invalid or has expired. Please log in again.",
+				"status":  http.StatusUnauthorized,
+			},
+		})
+		return
+	}
+
+	var creds []db.WebauthnCredential
+	if err == nil {
+		creds, err = s.DB.ListWebAuthnCredentialsByUser(c, challenge.UserID)
+	}
+	var passkeyChallenge []byte
+	if err == nil && len(creds) > 0 {
+		passkeyChallenge, err = s.newPasskeyChallenge(c, ceremonyMFA, uuid.NullUUID{UUID: challenge.UserID, Valid: true}, hash)
+	}
+	if err != nil {
+		log.Printf("BeginPasskeyMFA failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if len(creds) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "NO_PASSKEYS",
+				"message": "No passkeys are registered for this account.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": webauthn.RequestOptions{
+		Challenge:        webauthnrp.Encode(passkeyChallenge),
+		Timeout:          int(passkeyCeremonyTTL.Milliseconds()),
+		RPID:             s.WebAuthn.ID,
+		AllowCredentials: credentialDescriptors(creds),
+		UserVerification: "preferred",
+	}})
+}
+
+func (s *AuthService) newPasskeyChallenge(ctx context.Context, ceremony string, userID uuid.NullUUID, mfaTokenHash []byte) ([]byte, error) {
+	challenge, err := webauthnrp.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.DeleteExpiredWebAuthnChallenges(ctx); err != nil {
+		log.Printf("DeleteExpiredWebAuthnChallenges failed: %v", err)
+	}
+
+	err = s.DB.CreateWebAuthnChallenge(ctx, db.CreateWebAuthnChallengeParams{
+		Challenge:    challenge,
+		Ceremony:     ceremony,
+		UserID:       userID,
+		MfaTokenHash: mfaTokenHash,
+		ExpiresAt:    time.Now().Add(passkeyCeremonyTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumePasskeyChallenge burns the challenge a response answers, so each ceremony runs once
+func consumePasskeyChallenge(ctx context.Context, q *db.Queries, clientDataJSON, ceremony string) (db.WebauthnChallenge, error) {
+	challenge, err := webauthnrp.Challenge(clientDataJSON)
+	if err != nil {
+		return db.WebauthnChallenge{}, errPasskeyVerification
+	}
+
+	stored, err := q.ConsumeWebAuthnChallenge(ctx, challenge)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.WebauthnChallenge{}, errPasskeyVerification
+	}
+	if err != nil {
+		return db.WebauthnChallenge{}, err
+	}
+	if stored.Ceremony != ceremony {
+		return db.WebauthnChallenge{}, errPasskeyVerification
+	}
+	return stored, nil
+}
+
+func (s *AuthService) verifyPasskeyRegistration(ctx context.Context, userID uuid.UUID, resp webauthn.CreationResponse) (*webauthnrp.Credential, error) {
+	challenge, err := consumePasskeyChallenge(ctx, s.DB, resp.Response.ClientDataJSON, ceremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserID.UUID != userID {
+		return nil, errPasskeyVerification
+	}
+
+	cred, err := s.WebAuthn.VerifyRegistration(resp, challenge.Challenge, false)
+	if err != nil {
+		log.Printf("VerifyRegistration failed: %v", err)
+		return nil, errPasskeyVerification
+	}
+	return cred, nil
+}
+
+func (s *AuthService) verifyPasskeyLogin(ctx context.Context, resp webauthn.AssertionCredential) (db.User, error) {
+	challenge, err := consumePasskeyChallenge(ctx, s.DB, resp.Response.ClientDataJSON, ceremonyLogin)
+	if err != nil {
+		return db.User{}, err
+	}
+
+	cred, err := s.verifyAssertion(ctx, s.DB, resp, challenge.Challenge, true)
+	if err != nil {
+		return db.User{}, err
+	}
+
+	// Discoverable credentials name their owner; it must be who we registered them to
+	userHandle, err := webauthnrp.Decode(resp.Response.UserHandle)
+	if err != nil || !bytes.Equal(userHandle, cred.UserID[:]) {
+		return db.User{}, errPasskeyVerification
+	}
+	return s.DB.GetUserByID(ctx, cred.UserID)
+}
+
+// checkPasskey answers an MFA challenge with a passkey bound to that same login
+func (s *AuthService) checkPasskey(ctx context.Context, q *db.Queries, user db.User, mfaTokenHash []byte, resp webauthn.AssertionCredential) error {
+	challenge, err := consumePasskeyChallenge(ctx, q, resp.Response.ClientDataJSON, ceremonyMFA)
+	if err != nil {
+		return err
+	}
+	if challenge.UserID.UUID != user.ID || !bytes.Equal(challenge.MfaTokenHash, mfaTokenHash) {
+		return errPasskeyVerification
+	}
+
+	cred, err := s.verifyAssertion(ctx, q, resp, challenge.Challenge, false)
+	if err != nil {
+		return err
+	}
+	if cred.UserID != user.ID {
+		return errPasskeyVerification
+	}
+	return nil
+}
+
+// verifyAssertion checks the assertion against the stored credential and advances its counter
+func (s *AuthService) verifyAssertion(ctx context.Context, q *db.Queries, resp webauthn.AssertionCredential, challenge []byte, requireUV bool) (db.WebauthnCredential, error) {
+	credentialID, err := webauthnrp.Decode(resp.RawID)
+	if err != nil {
+		return db.WebauthnCredential{}, errPasskeyVerification
+	}
+	cred, err := q.GetWebAuthnCredentialByCredentialID(ctx, credentialID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.WebauthnCredential{}, errPasskeyVerification
+	}
+	if err != nil {
+		return db.WebauthnCredential{}, err
+	}
+
+	assertion, err := s.WebAuthn.VerifyAssertion(resp, challenge, cred.PublicKey, uint32(cred.SignCount), requireUV)
+	if err != nil {
+		log.Printf("VerifyAssertion failed for credential %s: %v", cred.ID, err)
+		return db.WebauthnCredential{}, errPasskeyVerification
+	}
+
+	// Conditional on the stored count, so two racing assertions can't both pass
+	updated, err := q.UpdateWebAuthnSignCount(ctx, db.UpdateWebAuthnSignCountParams{
+		SignCount: int64(assertion.SignCount),
+		ID:        cred.ID,
+	})
+	if err != nil {
+		return db.WebauthnCredential{}, err
+	}
+	if updated == 0 {
+		return db.WebauthnCredential{}, errPasskeyVerification
+	}
+	return cred, nil
+}
+
+func (s *AuthService) storePasskey(c *gin.Context, userID uuid.UUID, name string, cred *webauthnrp.Credential) (db.WebauthnCredential, error) {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return db.WebauthnCredential{}, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	stored, err := q.CreateWebAuthnCredential(c, db.CreateWebAuthnCredentialParams{
+		UserID:            userID,
+		Name:              name,
+		CredentialID:      cred.ID,
+		PublicKey:         cred.PublicKey,
+		SignCount:         int64(cred.SignCount),
+		Aaguid:            cred.AAGUID,
+		AttestationFormat: cred.AttestationFormat,
+		AttestationType:   cred.AttestationType,
+		BackupEligible:    cred.BackupEligible,
+	})
+	if err != nil {
+		return db.WebauthnCredential{}, err
+	}
+
+	err = auditlog.Record(c, q, audit.Event{
+		Type:      audit.PasskeyRegistered,
+		ActorID:   userID,
+		SubjectID: userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: userAgent(c),
+		Metadata: map[string]any{
+			"credential_id":      stored.ID,
+			"attestation_format": cred.AttestationFormat,
+			"attestation_type":   cred.AttestationType,
+		},
+	})
+	if err != nil {
+		return db.WebauthnCredential{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.WebauthnCredential{}, err
+	}
+	return stored, nil
+}
+
+func (s *AuthService) deletePasskey(c *gin.Context, userID, credentialID uuid.UUID) (bool, error) {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	deleted, err := q.DeleteWebAuthnCredential(c, db.DeleteWebAuthnCredentialParams{
+		ID:     credentialID,
+		UserID: userID,
+	})
+	if err != nil || deleted == 0 {
+		return false, err
+	}
+
+	err = auditlog.Record(c, q, audit.Event{
+		Type:      audit.PasskeyRemoved,
+		ActorID:   userID,
+		SubjectID: userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: userAgent(c),
+		Metadata:  map[string]any{"credential_id": credentialID},
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func credentialDescriptors(creds []db.WebauthnCredential) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type: "public-key",
+			ID:   webauthnrp.Encode(cred.CredentialID),
+		})
+	}
+	return descriptors
+}
+
+func credentialInfo(cred db.WebauthnCredential) webauthn.CredentialInfo {
+	info := webauthn.CredentialInfo{
+		ID:                cred.ID.String(),
+		Name:              cred.Name,
+		AttestationFormat: cred.AttestationFormat,
+		BackupEligible:    cred.BackupEligible,
+		CreatedAt:         cred.CreatedAt,
+	}
+	if aaguid, err := uuid.FromBytes(cred.Aaguid); err == nil {
+		info.AAGUID = aaguid.String()
+	}
+	if cred.LastUsedAt.Valid {
+		info.LastUsedAt = &cred.LastUsedAt.Time
+	}
+	return info
+}
+
+func passkeyVerificationFailed(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error": gin.H{
+			"code":    "PASSKEY_VERIFICATION_FAILED",
+			"message": "Passkey verification failed.",
+			"status":  http.StatusUnauthorized,
+		},
+	})
+}
+
+func passkeyNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"code":    "PASSKEY_NOT_FOUND",
+			"message": "Passkey not found.",
+			"status":  http.StatusNotFound,
+		},
+	})
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/notify"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/password"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// ChangePassword replaces the caller's password and signs out every session
+func (s *AuthService) ChangePassword(c *gin.Context) {
+	var req auth.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	user, err := s.DB.GetUserByID(c, principal.UserID)
+	if err != nil {
+		log.Printf("GetUserByID failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	if !s.reauthenticate(c, user, req.CurrentPassword) {
+		return
+	}
+
+	if !s.checkNewPassword(c, "new_password", req.NewPassword, user) {
+		return
+	}
+
+	hashedPassword, err := s.hashPassword(c, req.NewPassword)
+	if err == nil {
+		err = s.DB.UpdateUserPassword(c, db.UpdateUserPasswordParams{ID: user.ID, PasswordHash: hashedPassword})
+	}
+	if errors.Is(err, ErrHashBusy) {
+		hashingBusy(c)
+		return
+	}
+	if err != nil {
+		log.Printf("UpdateUserPassword failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	s.recordAudit(c, audit.Event{
+		Type:      audit.PasswordChanged,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	s.notifyUser(c, user, notify.Message{
+		Subject: "Your Signee password was changed",
+		Body:    "The password on your account was just changed and all sessions were signed out. If this wasn't you, reset your password and contact an administrator.",
+	})
+
+	// Anyone holding a session opened with the old password loses it
+	if !s.revokeAllSessions(c, user.ID, "password_changed") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// reauthenticate checks a signed-in user's password before a sensitive change,
+// writing the error response when it fails. Guesses count against the account
+// like sign-in attempts, so a stolen session can't brute-force the password.
+func (s *AuthService) reauthenticate(c *gin.Context, user db.User, pw string) bool {
+	account := throttled{accountThrottleKey(user.Email), accountThrottle}
+	charged, wait, err := s.reserveAttempt(c, account)
+	switch {
+	case err != nil:
+		log.Printf("reserveAttempt failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return false
+	case wait > 0:
+		tooManyLoginAttempts(c, wait)
+		return false
+	}
+
+	switch isValid, err := s.verifyPassword(c, pw, user.PasswordHash); {
+	case errors.Is(err, ErrHashBusy):
+		s.refundAttempt(c, account)
+		hashingBusy(c)
+		return false
+	case err != nil:
+		log.Printf("verifyPassword failed: %v", err)
+		s.refundAttempt(c, account)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return false
+	case !isValid:
+		if charged[0].Failures == accountThrottle.lockAt {
+			s.accountLocked(c, user.Email)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_CREDENTIALS",
+				"message": "Invalid password.",
+				"status":  http.StatusUnauthorized,
+			},
+		})
+		return false
+	}
+
+	s.clearLoginFailures(c, user.Email)
+	return true
+}
+
+// checkNewPassword applies the password policy, writing a 400 listing every
+// violation when the password is refused
+func (s *AuthService) checkNewPassword(c *gin.Context, field, pw string, user db.User) bool {
+	violations, err := s.Passwords.Check(field, pw, password.UserInfo{
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	})
+	if err != nil {
+		log.Printf("password policy check failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return false
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":       "WEAK_PASSWORD",
+				"message":    "The password does not meet the password policy.",
+				"status":     http.StatusBadRequest,
+				"violations": violations,
+			},
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Corpus is a local copy of a breached-password list in the k-anonymity range
+// layout, so lookups never leave the machine and only touch one small file
+type Corpus struct {
+	dir    string
+	common map[string]bool // the built-in list, in place of dir
+}
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// DefaultCorpus is a short built-in list of the passwords seen most often in
+// breaches, for when no full corpus is configured. It stops the worst choices,
+// nowhere near all that a real corpus would. Matching ignores case, since the
+// capitalised variants are just as common.
+func DefaultCorpus() *Corpus {
+	common := make(map[string]bool)
+	for _, line := range strings.Split(commonPasswords, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			common[line] = true
+		}
+	}
+	return &Corpus{common: common}
+}
+
+// OpenCorpus checks that dir exists; range files are read per lookup
+func OpenCorpus(dir string) (*Corpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("breached password corpus: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password corpus: %s is not a directory", dir)
+	}
+	return &Corpus{dir: dir}, nil
+}
+
+// Contains reports whether the password appears in the corpus, by its SHA-1
+// for a range-file corpus
+func (c *Corpus) Contains(pw string) (bool, error) {
+	if c.common != nil {
+		return c.common[strings.ToLower(pw)], nil
+	}
+
+	sum := sha1.Sum([]byte(pw))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Trimmed corpora leave out prefixes with no entries
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,72 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testCorpus writes range files holding the SHA-1 of "Tr0ub4dor&3", with
+// the counts and casing real range files come in
+func testCorpus(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"87457": "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n2e7a5ae6a49466a6ac578b98adba78c6aa6:3645\r\n",
+		// "password" is 5BAA6 1E4C9...; this file holds its neighbours only
+		"5BAA6": "003D68EB55068C33ACE09247EE4C639306B:3\n1E4C9B93F3F0682250B6CF8331B7EE68FD9:2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCorpusContains(t *testing.T) {
+	corpus, err := OpenCorpus(testCorpus(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pw, want := range map[string]bool{
+		"Tr0ub4dor&3": true,
+		"tr0ub4dor&3": false, // range files are keyed by the exact password
+		"password":    false, // its prefix file exists but lacks its suffix
+		// SHA-1 ABF7A..., whose prefix file the trimmed corpus leaves out
+		"correct horse battery staple": false,
+	} {
+		got, err := corpus.Contains(pw)
+		if err != nil || got != want {
+			t.Errorf("Contains(%q) = %v, %v, want %v", pw, got, err, want)
+		}
+	}
+}
+
+func TestOpenCorpus(t *testing.T) {
+	dir := testCorpus(t)
+	if _, err := OpenCorpus(filepath.Join(dir, "missing")); err == nil {
+		t.Error("OpenCorpus() accepted a missing directory")
+	}
+	if _, err := OpenCorpus(filepath.Join(dir, "87457")); err == nil {
+		t.Error("OpenCorpus() accepted a file")
+	}
+}
+
+func TestDefaultCorpus(t *testing.T) {
+	corpus := DefaultCorpus()
+	if len(corpus.common) < 100 {
+		t.Fatalf("built-in list has %d passwords", len(corpus.common))
+	}
+	for pw, want := range map[string]bool{
+		"password1":   true,
+		"PassWord1":   true,
+		"P@ssw0rd":    true,
+		"":            false,
+		"Tr0ub4dor&3": false,
+	} {
+		if got, err := corpus.Contains(pw); err != nil || got != want {
+			t.Errorf("Contains(%q) = %v, %v, want %v", pw, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package password
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/password"
+)
+
+// LoadPolicy reads a JSON policy config
+func LoadPolicy(path string) (password.PolicyConfig, error) {
+	var cfg password.PolicyConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read password policy: %v", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse password policy: %v", err)
+	}
+	return cfg, nil
+}
+
+// Policy checks new passwords against the configured rules
+type Policy struct {
+	cfg      password.PolicyConfig
+	breached *Corpus
+}
+
+// NewPolicy fills in defaults and opens the breached-password corpus, falling
+// back to the built-in list of common passwords when none is configured
+func NewPolicy(cfg password.PolicyConfig) (*Policy, error) {
+	if cfg.MinLength == 0 {
+		cfg.MinLength = 8
+	}
+	if cfg.MaxLength == 0 {
+		cfg.MaxLength = 128
+	}
+	if cfg.MinEntropyBits == 0 {
+		cfg.MinEntropyBits = 35
+	}
+	if cfg.MinLength > cfg.MaxLength {
+		return nil, fmt.Errorf("password policy: min_length %d exceeds max_length %d", cfg.MinLength, cfg.MaxLength)
+	}
+
+	p := &Policy{cfg: cfg, breached: DefaultCorpus()}
+	if cfg.BreachedPasswordsDir != "" {
+		corpus, err := OpenCorpus(cfg.BreachedPasswordsDir)
+		if err != nil {
+			return nil, err
+		}
+		p.breached = corpus
+	}
+	return p, nil
+}
+
+// Check returns every rule the password breaks, reported against field.
+// The error is only for a corpus that cannot be read.
+func (p *Policy) Check(field, pw string, user password.UserInfo) ([]password.Violation, error) {
+	var violations []password.Violation
+	add := func(code, format string, args ...any) {
+		violations = append(violations, password.Violation{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(pw)
+	switch {
+	case length < p.cfg.MinLength:
+		add("TOO_SHORT", "Password must be at least %d characters.", p.cfg.MinLength)
+	case length > p.cfg.MaxLength:
+		// Nothing else is worth checking on an oversized password
+		add("TOO_LONG", "Password must be at most %d characters.", p.cfg.MaxLength)
+		return violations, nil
+	}
+
+	if EstimateEntropy(pw) < p.cfg.MinEntropyBits {
+		add("TOO_PREDICTABLE", "Password is too easy to guess. Use a longer password or a mix of unrelated words.")
+	}
+
+	if !p.cfg.AllowPersonalInfo {
+		if part := personalInfoIn(pw, user); part != "" {
+			add("CONTAINS_PERSONAL_INFO", "Password must not contain your %s.", part)
+		}
+	}
+
+	found, err := p.breached.Contains(pw)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		add("BREACHED", "This password has appeared in a data breach. Choose a different one.")
+	}
+
+	return violations, nil
+}
+
+// EstimateEntropy is a rough guessing-entropy estimate in bits: the character
+// pool the password draws from, with repeats and runs like "aaa" or "123" counting
+// for almost nothing
+func EstimateEntropy(pw string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range pw {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf && (unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' '):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+
+	var bits float64
+	var prev, prevDelta rune
+	for i, r := range []rune(pw) {
+		delta := r - prev
+		if i > 0 && (delta == 0 || (delta == prevDelta && (delta == 1 || delta == -1))) {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev, prevDelta = r, delta
+	}
+	return bits
+}
+
+// personalInfoIn names the piece of the user's identity the password contains, if any
+func personalInfoIn(pw string, user password.UserInfo) string {
+	pw = strings.ToLower(pw)
+	contains := func(s string) bool {
+		s = strings.ToLower(strings.TrimSpace(s))
+		// Very short names and fragments match too many passwords by accident
+		return utf8.RuneCountInString(s) >= 3 && strings.Contains(pw, s)
+	}
+
+	if contains(user.FirstName) || contains(user.LastName) {
+		return "name"
+	}
+	local, _, _ := strings.Cut(user.Email, "@")
+	if contains(local) {
+		return "email address"
+	}
+	for _, part := range strings.FieldsFunc(local, func(r rune) bool { return strings.ContainsRune("._-+", r) }) {
+		if contains(part) {
+			return "email address"
+		}
+	}
+	return ""
+}
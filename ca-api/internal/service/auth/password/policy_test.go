@@ -0,0 +1,120 @@
+package password
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/password"
+)
+
+func TestEstimateEntropy(t *testing.T) {
+	lower, all := math.Log2(26), math.Log2(26+26+10+33)
+	for pw, want := range map[string]float64{
+		"":     0,
+		"a":    lower,
+		"aaaa": lower + 3,      // repeats add a bit each
+		"abcd": 2*lower + 2,    // so do ascending runs, once started
+		"dcba": 2*lower + 2,    // and descending ones
+		"abab": 4 * lower,      // alternating is no run
+		"aB3$": 4 * all,        // every class widens the pool
+		"é":    math.Log2(100), // non-ASCII counts as its own class
+	} {
+		if got := EstimateEntropy(pw); math.Abs(got-want) > 1e-9 {
+			t.Errorf("EstimateEntropy(%q) = %.2f, want %.2f", pw, got, want)
+		}
+	}
+}
+
+func TestPersonalInfoIn(t *testing.T) {
+	user := password.UserInfo{Email: "j.smith-work@example.com", FirstName: "Alice", LastName: "Li"}
+	for pw, want := range map[string]string{
+		"xALICEq7#vz":      "name",
+		"q7#j.smith-work!": "email address",
+		"q7#SMITH-vz9k":    "email address", // a part of the local part
+		"q7#workvz9k":      "email address",
+		"Lion-Q7#vz9k":     "", // "Li" is too short to count
+		"j-q7#vz9k":        "", // so is "j"
+		"example.com-q7#":  "", // the domain is nobody's own
+	} {
+		if got := personalInfoIn(pw, user); got != want {
+			t.Errorf("personalInfoIn(%q) = %q, want %q", pw, got, want)
+		}
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	user := password.UserInfo{Email: "alice.smith@example.com", FirstName: "Alice", LastName: "Smith"}
+	for name, tc := range map[string]struct {
+		cfg    password.PolicyConfig
+		corpus bool // check against testCorpus rather than the built-in list
+		pw     string
+		want   []string // violation codes, in order
+	}{
+		"acceptable":         {pw: "Tr0ub4dor&3-horse"},
+		"too short":          {pw: "Ab3$x", want: []string{"TOO_SHORT", "TOO_PREDICTABLE"}},
+		"too long":           {pw: strings.Repeat("aB3$", 33), want: []string{"TOO_LONG"}},
+		"predictable":        {pw: "abcdefghijkl", want: []string{"TOO_PREDICTABLE"}},
+		"repeated":           {pw: "zzzzzzzzzzzzzzzz", want: []string{"TOO_PREDICTABLE"}},
+		"first name":         {pw: "q7#vz-ALICE-k2", want: []string{"CONTAINS_PERSONAL_INFO"}},
+		"email":              {pw: "q7#vz-smith-k2", want: []string{"CONTAINS_PERSONAL_INFO"}},
+		"personal info ok":   {cfg: password.PolicyConfig{AllowPersonalInfo: true}, pw: "q7#vz-ALICE-k2"},
+		"common password":    {pw: "Password123", want: []string{"BREACHED"}},
+		"in breach corpus":   {corpus: true, pw: "Tr0ub4dor&3", want: []string{"BREACHED"}},
+		"not in the corpus":  {corpus: true, pw: "Tr0ub4dor&4"},
+		"corpus replaces it": {corpus: true, pw: "Password123"},
+		"custom lengths":     {cfg: password.PolicyConfig{MinLength: 20, MaxLength: 24}, pw: "Tr0ub4dor&3-horse", want: []string{"TOO_SHORT"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if tc.corpus {
+				tc.cfg.BreachedPasswordsDir = testCorpus(t)
+			}
+			p, err := NewPolicy(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			violations, err := p.Check("new_password", tc.pw, user)
+			if err != nil {
+				t.Fatalf("Check() = %v", err)
+			}
+
+			var codes []string
+			for _, v := range violations {
+				codes = append(codes, v.Code)
+				if v.Field != "new_password" || v.Message == "" {
+					t.Errorf("violation %+v, want it reported against new_password with a message", v)
+				}
+			}
+			if !slices.Equal(codes, tc.want) {
+				t.Fatalf("Check(%q) = %v, want %v", tc.pw, codes, tc.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckNamesPersonalInfo(t *testing.T) {
+	p, err := NewPolicy(password.PolicyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := password.UserInfo{Email: "alice.smith@example.com", FirstName: "Alice", LastName: "Smith"}
+	for pw, want := range map[string]string{
+		"q7#vz-ALICE-k2":       "Password must not contain your name.",
+		"q7#vz-alice.smith-k2": "Password must not contain your name.",
+	} {
+		violations, err := p.Check("password", pw, user)
+		if err != nil || len(violations) != 1 || violations[0].Message != want {
+			t.Errorf("Check(%q) = %+v, %v, want %q", pw, violations, err, want)
+		}
+	}
+}
+
+func TestNewPolicyRejectsBadLengths(t *testing.T) {
+	if _, err := NewPolicy(password.PolicyConfig{MinLength: 20, MaxLength: 10}); err == nil {
+		t.Fatal("NewPolicy() accepted min_length above max_length")
+	}
+	if _, err := NewPolicy(password.PolicyConfig{BreachedPasswordsDir: t.TempDir() + "/missing"}); err == nil {
+		t.Fatal("NewPolicy() accepted a missing corpus directory")
+	}
+}
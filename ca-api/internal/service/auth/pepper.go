@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const minPepperLen = 32
+
+// PepperRing holds every pepper still referenced by stored hashes. New hashes
+// use the highest version; older ones stay so existing hashes keep verifying
+// until users log in and are rehashed.
+type PepperRing struct {
+	current int
+	keys    map[int][]byte
+}
+
+// LoadPeppers reads a keyring file with one "version:base64key" per line;
+// blank lines and # comments are ignored
+func LoadPeppers(path string) (*PepperRing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peppers: %v", err)
+	}
+
+	ring := &PepperRing{keys: make(map[int][]byte)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		version, encoded, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("peppers line %d: expected version:key", n)
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(version))
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("peppers line %d: version must be a positive integer", n)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("peppers line %d: %v", n, err)
+		}
+		if len(key) < minPepperLen {
+			return nil, fmt.Errorf("peppers line %d: key must be at least %d bytes", n, minPepperLen)
+		}
+		if _, dup := ring.keys[id]; dup {
+			return nil, fmt.Errorf("peppers line %d: duplicate version %d", n, id)
+		}
+
+		ring.keys[id] = key
+		ring.current = max(ring.current, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ring.keys) == 0 {
+		return nil, fmt.Errorf("no peppers in %s", path)
+	}
+	return ring, nil
+}
+
+// CurrentID is the version new hashes use, or 0 without a keyring
+func (r *PepperRing) CurrentID() int {
+	if r == nil {
+		return 0
+	}
+	return r.current
+}
+
+// Key returns pepper version id
+func (r *PepperRing) Key(id int) ([]byte, bool) {
+	if r == nil {
+		return nil, false
+	}
+	key, ok := r.keys[id]
+	return key, ok
+}
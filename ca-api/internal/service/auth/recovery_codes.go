@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/notify"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 10 // ~49 bits each, shown as two groups of five
+	// No 0/o, 1/l/i: the codes get written down and typed back in
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	// Marks a peppered HMAC, as opposed to an argon2id PHC string
+	recoveryCodeMACPrefix = "$hmac-sha256$"
+)
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after they re-enter their password
+func (s *AuthService) RegenerateRecoveryCodes(c *gin.Context) {
+	var req auth.ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	user, err := s.DB.GetUserByID(c, principal.UserID)
+	if err != nil {
+		log.Printf("GetUserByID failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	if !s.reauthenticate(c, user, req.Password) {
+		return
+	}
+
+	if !user.MfaEnabled.Bool {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "MFA_NOT_ENABLED",
+				"message": "Multi-factor authentication is not enabled.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	codes, hashes, err := s.generateRecoveryCodes(c, user.ID)
+	if err == nil {
+		err = s.replaceRecoveryCodes(c, user.ID, hashes)
+	}
+	if errors.Is(err, ErrHashBusy) {
+		hashingBusy(c)
+		return
+	}
+	if err != nil {
+		log.Printf("RegenerateRecoveryCodes failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	s.notifyUser(c, user, notify.Message{
+		Subject: "Your recovery codes were regenerated",
+		Body:    "New MFA recovery codes were generated for your account and the old ones no longer work. If this wasn't you, change your password and contact an administrator.",
+	})
+	c.JSON(http.StatusOK, auth.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// replaceRecoveryCodes swaps the user's codes for a new set and records it
+func (s *AuthService) replaceRecoveryCodes(c *gin.Context, userID uuid.UUID, hashes []string) error {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	if err := storeRecoveryCodes(c, q, userID, hashes); err != nil {
+		return err
+	}
+	err = auditlog.Record(c, q, audit.Event{
+		Type:      audit.MFARecoveryCodesRegenerated,
+		ActorID:   userID,
+		SubjectID: userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: userAgent(c),
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// storeRecoveryCodes replaces whatever codes the user had with hashes
+func storeRecoveryCodes(ctx context.Context, q *db.Queries, userID uuid.UUID, hashes []string) error {
+	if err := q.DeleteMFARecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		err := q.CreateMFARecoveryCode(ctx, db.CreateMFARecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hash,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRecoveryCode burns the matching unused code. The codes are matched
+// without locking them, since argon2id-hashed ones are slow to try in turn;
+// the burn itself only succeeds while the code is still unused.
+func (s *AuthService) checkRecoveryCode(c *gin.Context, q *db.Queries, user db.User, code string) error {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLen {
+		return errInvalidMFACode
+	}
+
+	unused, err := q.ListUnusedMFARecoveryCodes(c, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, stored := range unused {
+		ok, err := s.recoveryCodeMatches(c, user.ID, code, stored.CodeHash)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		burned, err := q.MarkMFARecoveryCodeUsed(c, stored.ID)
+		if err != nil {
+			return err
+		}
+		if burned == 0 {
+			// Redeemed by a concurrent request in the meantime
+			return errInvalidMFACode
+		}
+		return auditlog.Record(c, q, audit.Event{
+			Type:      audit.MFARecoveryCodeUsed,
+			ActorID:   user.ID,
+			SubjectID: user.ID,
+			IPAddress: c.ClientIP(),
+			UserAgent: userAgent(c),
+			Metadata:  map[string]any{"remaining": len(unused) - 1},
+		})
+	}
+	return errInvalidMFACode
+}
+
+// generateRecoveryCodes returns the codes to show the user once and their hashes to store
+func (s *AuthService) generateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		raw := make([]byte, recoveryCodeLen)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %v", err)
+		}
+		for i, b := range raw {
+			// 256 is not a multiple of the alphabet size; the bias this leaves is negligible
+			raw[i] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+		}
+		code := string(raw)
+
+		hash, err := s.hashRecoveryCode(ctx, userID, code)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code[:recoveryCodeLen/2]+"-"+code[recoveryCodeLen/2:])
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode keys code to the user with the current pepper. Codes are
+// random, so unlike passwords they don't need argon2id to stand up to a
+// stolen database, and an HMAC is cheap to compare against every unused one.
+// Without peppers there is no secret to key it with, so argon2id it is.
+func (s *AuthService) hashRecoveryCode(ctx context.Context, userID uuid.UUID, code string) (string, error) {
+	keyID := s.Peppers.CurrentID()
+	if keyID == 0 {
+		return s.hashPassword(ctx, code)
+	}
+	mac, err := s.recoveryCodeMAC(userID, code, keyID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%skeyid=%d$%s", recoveryCodeMACPrefix, keyID, base64.RawStdEncoding.EncodeToString(mac)), nil
+}
+
+// recoveryCodeMatches checks code against a stored hash of either kind
+func (s *AuthService) recoveryCodeMatches(ctx context.Context, userID uuid.UUID, code, stored string) (bool, error) {
+	encoded, ok := strings.CutPrefix(stored, recoveryCodeMACPrefix)
+	if !ok {
+		return s.verifyPassword(ctx, code, stored)
+	}
+
+	params, encoded, ok := strings.Cut(encoded, "$")
+	keyID, err := strconv.Atoi(strings.TrimPrefix(params, "keyid="))
+	if !ok || err != nil {
+		return false, fmt.Errorf("invalid recovery code hash")
+	}
+	want, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false, err
+	}
+	mac, err := s.recoveryCodeMAC(userID, code, keyID)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(mac, want), nil
+}
+
+// recoveryCodeMAC is HMAC-SHA256 under pepper keyID, kept apart from
+// pepperPassword's by a label so a code can never stand in for a password
+func (s *AuthService) recoveryCodeMAC(userID uuid.UUID, code string, keyID int) ([]byte, error) {
+	key, ok := s.Peppers.Key(keyID)
+	if !ok {
+		return nil, fmt.Errorf("unknown pepper key id %d", keyID)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("signee mfa recovery code\x00"))
+	mac.Write(userID[:])
+	mac.Write([]byte(code))
+	return mac.Sum(nil), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const mfaTestPassword = "correct horse battery staple"
+
+// mfaTest wires an AuthService to a fake database holding alice, who has MFA on
+type mfaTest struct {
+	t      *testing.T
+	db     *fakeDB
+	s      *AuthService
+	router *gin.Engine
+	alice  uuid.UUID
+}
+
+func newMFATest(t *testing.T, peppers *PepperRing) *mfaTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	fake, conn, queries := newFakeDB(t)
+
+	dir := t.TempDir()
+	jwtManager, err := jwt.NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &AuthService{Conn: conn, DB: queries, JWT: jwtManager, HashLimit: NewHashLimiter(1), Peppers: peppers}
+	hash, err := s.hashPassword(context.Background(), mfaTestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := fake.addUser(db.User{
+		Email: "alice@example.com", FirstName: "Alice", PasswordHash: hash, Status: auth.UserStatusActive, Kind: auth.UserKindHuman,
+		MfaEnabled: sql.NullBool{Bool: true, Valid: true},
+	})
+
+	m := &mfaTest{t: t, db: fake, s: s, alice: alice}
+	signedIn := func(c *gin.Context) { c.Set(middleware.PrincipalKey, &auth.Principal{UserID: alice}) }
+	m.router = gin.New()
+	m.router.POST("/mfa/verify", s.VerifyMFA)
+	m.router.POST("/recovery-codes", signedIn, s.RegenerateRecoveryCodes)
+	m.router.POST("/password", signedIn, s.ChangePassword)
+	return m
+}
+
+func (m *mfaTest) post(path string, body any) *httptest.ResponseRecorder {
+	m.t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(b)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	m.router.ServeHTTP(w, req)
+	return w
+}
+
+// challenge starts a second step for alice as a correct password would
+func (m *mfaTest) challenge() string {
+	m.t.Helper()
+	token, err := m.s.createMFAChallenge(context.Background(), m.alice)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return token
+}
+
+// verify redeems req's challenge, or a fresh one, with its second factor
+func (m *mfaTest) verify(req auth.MFAVerifyRequest) *httptest.ResponseRecorder {
+	m.t.Helper()
+	if req.MFAChallenge == "" {
+		req.MFAChallenge = m.challenge()
+	}
+	return m.post("/mfa/verify", req)
+}
+
+// recoveryCodes regenerates alice's codes and returns them as shown to her
+func (m *mfaTest) recoveryCodes() []string {
+	m.t.Helper()
+	w := m.post("/recovery-codes", auth.ReauthRequest{Password: mfaTestPassword})
+	var resp auth.RecoveryCodesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusOK || err != nil || len(resp.RecoveryCodes) != recoveryCodeCount {
+		m.t.Fatalf("RegenerateRecoveryCodes = %d: %s, want %d codes", w.Code, w.Body, recoveryCodeCount)
+	}
+	return resp.RecoveryCodes
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		peppers *PepperRing
+		prefix  string
+	}{
+		"peppered":   {testPeppers(1), recoveryCodeMACPrefix},
+		"unpeppered": {nil, "$argon2id$"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := newMFATest(t, tc.peppers)
+			codes := m.recoveryCodes()
+			for _, r := range m.db.recovery {
+				if !strings.HasPrefix(r.CodeHash, tc.prefix) {
+					t.Fatalf("stored hash %q, want a %s hash", r.CodeHash, tc.prefix)
+				}
+			}
+
+			if w := m.verify(auth.MFAVerifyRequest{RecoveryCode: codes[0]}); w.Code != http.StatusOK {
+				t.Fatalf("VerifyMFA = %d: %s", w.Code, w.Body)
+			}
+			w := m.verify(auth.MFAVerifyRequest{RecoveryCode: codes[0]})
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_MFA_CODE") {
+				t.Fatalf("VerifyMFA with a used code = %d: %s, want 401 INVALID_MFA_CODE", w.Code, w.Body)
+			}
+			used := 0
+			for _, e := range m.db.events {
+				if e == string(audit.MFARecoveryCodeUsed) {
+					used++
+				}
+			}
+			if used != 1 {
+				t.Fatalf("audit events = %v, want one code used", m.db.events)
+			}
+
+			// Regenerating retires every code that was left
+			m.recoveryCodes()
+			if w := m.verify(auth.MFAVerifyRequest{RecoveryCode: codes[1]}); w.Code != http.StatusUnauthorized {
+				t.Fatalf("VerifyMFA with a replaced code = %d: %s, want 401", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+// TestRecoveryCodeNormalized types each code back in a way people write them down
+func TestRecoveryCodeNormalized(t *testing.T) {
+	m := newMFATest(t, testPeppers(1))
+	codes := m.recoveryCodes()
+
+	for name, tc := range map[string]struct {
+		typed func(code string) string
+		want  int
+	}{
+		"as shown":    {func(code string) string { return code }, http.StatusOK},
+		"upper case":  {strings.ToUpper, http.StatusOK},
+		"no dash":     {func(code string) string { return strings.ReplaceAll(code, "-", "") }, http.StatusOK},
+		"spaced":      {func(code string) string { return " " + strings.ReplaceAll(code, "-", " ") + " " }, http.StatusOK},
+		"truncated":   {func(code string) string { return code[:len(code)-1] }, http.StatusUnauthorized},
+		"other digit": {func(code string) string { return code[:len(code)-1] + "0" }, http.StatusUnauthorized},
+	} {
+		t.Run(name, func(t *testing.T) {
+			code := codes[0]
+			codes = codes[1:]
+			// Failures count against alice; only the code is under test here
+			delete(m.db.throttles, mfaThrottleKey(m.alice))
+
+			if w := m.verify(auth.MFAVerifyRequest{RecoveryCode: tc.typed(code)}); w.Code != tc.want {
+				t.Fatalf("VerifyMFA(%q) = %d: %s, want %d", tc.typed(code), w.Code, w.Body, tc.want)
+			}
+		})
+	}
+}
+
+// TestReauthenticationThrottled checks that re-entering the password for a
+// sensitive change counts against the account like a sign-in does
+func TestReauthenticationThrottled(t *testing.T) {
+	account := accountThrottleKey("alice@example.com")
+
+	for name, tc := range map[string]struct {
+		path         string
+		wrong, right any
+	}{
+		"regenerate recovery codes": {
+			"/recovery-codes",
+			auth.ReauthRequest{Password: "guess"},
+			auth.ReauthRequest{Password: mfaTestPassword},
+		},
+		"change password": {
+			"/password",
+			auth.ChangePasswordRequest{CurrentPassword: "guess", NewPassword: "a much longer replacement passphrase"},
+			auth.ChangePasswordRequest{CurrentPassword: mfaTestPassword, NewPassword: "a much longer replacement passphrase"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := newMFATest(t, nil)
+
+			w := m.post(tc.path, tc.wrong)
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_CREDENTIALS") {
+				t.Fatalf("%s = %d: %s, want 401 INVALID_CREDENTIALS", tc.path, w.Code, w.Body)
+			}
+			if failures := m.db.throttles[account].Failures; failures != 1 {
+				t.Fatalf("account failures = %d, want the guess charged", failures)
+			}
+
+			// Once the account is locked even the right password waits
+			m.db.throttles[account] = db.LoginThrottle{Key: account, Failures: accountThrottle.lockAt, LastFailureAt: time.Now()}
+			w = m.post(tc.path, tc.right)
+			if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+				t.Fatalf("%s while locked = %d: %s, want 429 with Retry-After", tc.path, w.Code, w.Body)
+			}
+		})
+	}
+
+	t.Run("success clears failures", func(t *testing.T) {
+		m := newMFATest(t, nil)
+		m.db.throttles[account] = db.LoginThrottle{Key: account, Failures: accountThrottle.free, LastFailureAt: time.Now()}
+		m.recoveryCodes()
+		if _, ok := m.db.throttles[account]; ok {
+			t.Fatalf("throttle = %+v, want it cleared by the right password", m.db.throttles[account])
+		}
+	})
+}
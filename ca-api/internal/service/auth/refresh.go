@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/config"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// Refresh exchanges a refresh token for a new pair. Refresh tokens are single use:
+// presenting one that was already exchanged revokes every token in its family.
+func (s *AuthService) Refresh(c *gin.Context) {
+	cookieConfig := config.DefaultCookieConfig()
+
+	// Browsers send the cookie; API clients may post the token instead
+	tokenString, _ := c.Cookie(cookieConfig.TokenName)
+	if tokenString == "" {
+		var req auth.RefreshRequest
+		if err := c.ShouldBindJSON(&req); err == nil {
+			tokenString = req.RefreshToken
+		}
+	}
+	if tokenString == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	claims, err := s.JWT.ValidateRefreshToken(tokenString, c.Request)
+	if err != nil {
+		log.Printf("ValidateRefreshToken failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_TOKEN",
+				"message": "Invalid or expired refresh token.",
+				"status":  http.StatusUnauthorized,
+			},
+		})
+		return
+	}
+
+	user, tokens, err := s.rotateRefreshToken(c, claims)
+	switch {
+	case errors.Is(err, errRefreshTokenReused):
+		log.Printf("Refresh token reuse detected for user %s; family %s revoked", claims.DecryptedUserID, claims.FamilyID)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"code":    "REFRESH_TOKEN_REUSED",
+				"message": "This session has been revoked. Please log in again.",
+				"status":  http.StatusUnauthorized,
+			},
+		})
+		return
+	case errors.Is(err, errInvalidRefreshToken):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_TOKEN",
+				"message": "Invalid or expired refresh token.",
+				"status":  http.StatusUnauthorized,
+			},
+		})
+		return
+	case err != nil:
+		log.Printf("rotateRefreshToken failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	config.SetTokenCookies(c.Writer, tokens.RefreshToken, cookieConfig)
+
+	c.JSON(http.StatusOK, auth.AuthResponse{
+		User:   userInfo(user),
+		Tokens: s.tokenPair(tokens),
+	})
+}
+
+// rotateRefreshToken consumes the presented refresh token and issues the next pair in its family.
+// The row lock makes concurrent refreshes with the same token look like reuse to all but one.
+func (s *AuthService) rotateRefreshToken(c *gin.Context, claims *auth.SecureClaims) (db.User, *auth.IssuedTokens, error) {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return db.User{}, nil, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	stored, err := q.GetRefreshTokenForUpdate(c, claims.ID)
+	if err == sql.ErrNoRows {
+		return db.User{}, nil, errInvalidRefreshToken
+	}
+	if err != nil {
+		return db.User{}, nil, err
+	}
+
+	if stored.RevokedAt.Valid || stored.UserID.String() != claims.DecryptedUserID {
+		return db.User{}, nil, errInvalidRefreshToken
+	}
+
+	// Only one exchange gets to mark the token used; a replay, or a refresh
+	// racing another with the same token, is treated as reuse
+	reused := stored.UsedAt.Valid
+	if !reused {
+		marked, err := q.MarkRefreshTokenUsed(c, stored.Jti)
+		if err != nil {
+			return db.User{}, nil, err
+		}
+		reused = marked == 0
+	}
+	if reused {
+		// Someone is replaying a consumed token: kill the whole family
+		if err := revokeFamily(c, q, stored.FamilyID, revokedReuseDetected); err != nil {
+			return db.User{}, nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return db.User{}, nil, err
+		}
+		s.invalidateFamily(stored.FamilyID)
+		return db.User{}, nil, errRefreshTokenReused
+	}
+
+	err = q.TouchSession(c, db.TouchSessionParams{
+		FamilyID:  stored.FamilyID,
+		UserAgent: userAgent(c),
+		IpAddress: c.ClientIP(),
+	})
+	if err != nil {
+		return db.User{}, nil, err
+	}
+
+	user, err := q.GetUserByID(c, stored.UserID)
+	if err == sql.ErrNoRows {
+		return db.User{}, nil, errInvalidRefreshToken
+	}
+	if err != nil {
+		return db.User{}, nil, err
+	}
+	if user.Status != auth.UserStatusActive {
+		return db.User{}, nil, errInvalidRefreshToken
+	}
+
+	tokens, err := s.issueTokens(c, q, user, stored.FamilyID)
+	if err != nil {
+		return db.User{}, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.User{}, nil, err
+	}
+	return user, tokens, nil
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// tokenTest wires an AuthService to a fake database holding alice, who can
+// be signed in without going through a login flow
+type tokenTest struct {
+	t      *testing.T
+	db     *fakeDB
+	s      *AuthService
+	router *gin.Engine
+	alice  db.User
+}
+
+func newTokenTest(t *testing.T) *tokenTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	fake, conn, queries := newFakeDB(t, "viewer")
+
+	dir := t.TempDir()
+	jwtManager, err := jwt.NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cached answers outlive the test, so only invalidateFamily makes a revocation visible
+	jwtManager.SetRevocationChecker(jwt.NewRevocationCache(FamilyRevocationLookup(queries), time.Hour))
+
+	s := &AuthService{Conn: conn, DB: queries, JWT: jwtManager, HashLimit: NewHashLimiter(1)}
+	id := fake.addUser(db.User{Email: "alice@example.com", FirstName: "Alice", Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+	fake.grants = append(fake.grants, fakeGrant{userID: id, roleID: fake.roles[0].ID, source: "local"})
+
+	tt := &tokenTest{t: t, db: fake, s: s, alice: fake.user("alice@example.com")}
+	tt.router = gin.New()
+	tt.router.POST("/refresh", s.Refresh)
+	return tt
+}
+
+// signIn starts a token family for alice as a completed login would
+func (tt *tokenTest) signIn() *auth.IssuedTokens {
+	tt.t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	tokens, err := tt.s.startTokenFamily(c, tt.alice)
+	if err != nil {
+		tt.t.Fatalf("startTokenFamily() = %v", err)
+	}
+	return tokens
+}
+
+func (tt *tokenTest) post(path string, body any) *httptest.ResponseRecorder {
+	tt.t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		tt.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(b)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	tt.router.ServeHTTP(w, req)
+	return w
+}
+
+func (tt *tokenTest) refresh(token string) *httptest.ResponseRecorder {
+	return tt.post("/refresh", auth.RefreshRequest{RefreshToken: token})
+}
+
+// refreshed is the refresh token in a successful response
+func refreshed(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp auth.AuthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusOK || err != nil || resp.Tokens == nil || resp.Tokens.RefreshToken == "" {
+		t.Fatalf("Refresh = %d: %s, want a new pair", w.Code, w.Body)
+	}
+	return resp.Tokens.RefreshToken
+}
+
+// familyOf is the family a refresh token was issued in
+func (tt *tokenTest) familyOf(token string) *db.RefreshTokenFamily {
+	tt.t.Helper()
+	claims, err := tt.s.JWT.ValidateRefreshToken(token, httptest.NewRequest(http.MethodPost, "/refresh", nil))
+	if err != nil {
+		tt.t.Fatal(err)
+	}
+	return tt.db.family(uuid.MustParse(claims.FamilyID))
+}
+
+func TestRefreshRotates(t *testing.T) {
+	tt := newTokenTest(t)
+	first := tt.signIn().RefreshToken
+
+	second := refreshed(t, tt.refresh(first))
+	third := refreshed(t, tt.refresh(second))
+	if second == first || third == second {
+		t.Fatal("Refresh returned the token it was given")
+	}
+	if family := tt.familyOf(third); family.ID != tt.familyOf(first).ID || family.RevokedAt.Valid {
+		t.Fatalf("family = %+v, want the login's family still live", family)
+	}
+	if len(tt.db.families) != 1 || len(tt.db.refresh) != 3 {
+		t.Fatalf("%d families and %d tokens, want 1 and 3", len(tt.db.families), len(tt.db.refresh))
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	tt := newTokenTest(t)
+	first := tt.signIn().RefreshToken
+	second := refreshed(t, tt.refresh(first))
+
+	w := tt.refresh(first)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "REFRESH_TOKEN_REUSED") {
+		t.Fatalf("Refresh with a used token = %d: %s, want 401 REFRESH_TOKEN_REUSED", w.Code, w.Body)
+	}
+	family := tt.familyOf(first)
+	if !family.RevokedAt.Valid || family.RevokedReason.String != revokedReuseDetected {
+		t.Fatalf("family = %+v, want it revoked for reuse", family)
+	}
+
+	// The legitimate holder's newer token dies with the family
+	w = tt.refresh(second)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_TOKEN") {
+		t.Fatalf("Refresh after revocation = %d: %s, want 401 INVALID_TOKEN", w.Code, w.Body)
+	}
+
+	// Other logins are not affected
+	refreshed(t, tt.refresh(tt.signIn().RefreshToken))
+}
+
+// TestRefreshConcurrent races two exchanges of the same token: one must win
+// and the other must look like reuse, never two live successors. Both read
+// the token before either marks it used, the interleaving the row lock is
+// there to prevent.
+func TestRefreshConcurrent(t *testing.T) {
+	tt := newTokenTest(t)
+	token := tt.signIn().RefreshToken
+
+	var read, wg sync.WaitGroup
+	read.Add(2)
+	tt.db.after = func(name string) {
+		if name == "GetRefreshTokenForUpdate" {
+			read.Done()
+			read.Wait()
+		}
+	}
+
+	var results [2]*httptest.ResponseRecorder
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = tt.refresh(token)
+		}()
+	}
+	wg.Wait()
+
+	ok, reused := 0, 0
+	for _, w := range results {
+		switch {
+		case w.Code == http.StatusOK:
+			ok++
+		case w.Code == http.StatusUnauthorized && strings.Contains(w.Body.String(), "REFRESH_TOKEN_REUSED"):
+			reused++
+		}
+	}
+	if ok != 1 || reused != 1 {
+		t.Fatalf("concurrent Refresh = %d: %s and %d: %s, want one success and one reuse",
+			results[0].Code, results[0].Body, results[1].Code, results[1].Body)
+	}
+	if family := tt.familyOf(token); !family.RevokedAt.Valid {
+		t.Fatalf("family = %+v, want it revoked", family)
+	}
+}
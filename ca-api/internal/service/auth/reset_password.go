@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/mail"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/notify"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestPasswordReset emails a reset link. The response is the same whether
+// or not the address has an account.
+func (s *AuthService) RequestPasswordReset(c *gin.Context) {
+	var req auth.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	user, err := s.DB.GetUserByEmail(c, req.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("GetUserByEmail failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	// Directory users' passwords live in the directory, and service accounts have none
+	if err == nil && s.directoryFor(user.Email) == nil && user.Kind == auth.UserKindHuman {
+		s.sendPasswordResetEmail(user)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If that address has an account, a password reset email is on its way.",
+	})
+}
+
+// ResetPassword sets a new password with the token from a reset email
+func (s *AuthService) ResetPassword(c *gin.Context) {
+	var req auth.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	user, err := s.readEmailToken(c, req.Token, tokenResetPassword)
+	if errors.Is(err, errInvalidEmailToken) {
+		invalidEmailToken(c)
+		return
+	}
+	if err != nil {
+		log.Printf("readEmailToken failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	if !s.checkNewPassword(c, "new_password", req.NewPassword, user) {
+		return
+	}
+
+	hashedPassword, err := s.hashPassword(c, req.NewPassword)
+	if err == nil {
+		err = s.resetPassword(c, user, hashedPassword)
+	}
+	if errors.Is(err, ErrHashBusy) {
+		hashingBusy(c)
+		return
+	}
+	if err != nil {
+		log.Printf("ResetPassword failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	s.clearLoginFailures(c, user.Email)
+	s.notifyUser(c, user, notify.Message{
+		Subject: "Your Signee password was reset",
+		Body:    "The password on your account was just reset using a link sent to this address, and all sessions were signed out. If this wasn't you, contact an administrator.",
+	})
+
+	if !s.revokeAllSessions(c, user.ID, "password_reset") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// resetPassword stores the new hash and, since the reset link proved the user
+// owns their email, activates a pending account
+func (s *AuthService) resetPassword(c *gin.Context, user db.User, hashedPassword string) error {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	if err := q.UpdateUserPassword(c, db.UpdateUserPasswordParams{ID: user.ID, PasswordHash: hashedPassword}); err != nil {
+		return err
+	}
+	if _, err := q.ActivateUser(c, user.ID); err != nil {
+		return err
+	}
+	if err := auditlog.Record(c, q, audit.Event{
+		Type:      audit.PasswordReset,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *AuthService) sendPasswordResetEmail(user db.User) {
+	token, err := s.signEmailToken(tokenResetPassword, user, resetPasswordTokenTTL)
+	if err != nil {
+		log.Printf("signEmailToken failed: %v", err)
+		return
+	}
+	s.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Signee password",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Someone asked to reset the password for your Signee account. To choose a new one, open:\n\n" +
+			s.AppURL + "/reset-password?token=" + url.QueryEscape(token) + "\n\n" +
+			"The link expires in an hour and works once. If you didn't ask for this, you can ignore this email.\n",
+	})
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Role granted to users who sign themselves up
+const signupRole = "developer"
+
+// SyncSystemRoles writes auth.DefaultRoles into the roles table so they can be
+// granted like any other role. Code stays the source of truth for system roles.
+func SyncSystemRoles(ctx context.Context, q *db.Queries) error {
+	for name, perms := range auth.DefaultRoles {
+		raw, err := json.Marshal(perms)
+		if err != nil {
+			return err
+		}
+		_, err = q.UpsertSystemRole(ctx, db.UpsertSystemRoleParams{
+			Name:        name,
+			Permissions: raw,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to sync role %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// LoadPrincipal resolves access token claims into the caller's current roles and permissions.
+// Roles are read on every request so grants and revocations apply without a new token.
+func LoadPrincipal(q *db.Queries) middleware.PrincipalLoader {
+	return func(ctx context.Context, claims *auth.SecureClaims) (*auth.Principal, error) {
+		userID, err := uuid.Parse(claims.DecryptedUserID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id in token: %v", err)
+		}
+
+		user, err := q.GetUserByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		// Suspending or disabling a user cuts off the tokens they already hold
+		if user.Status != auth.UserStatusActive {
+			return nil, sql.ErrNoRows
+		}
+
+		roles, err := q.ListUserRoles(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		principal := &auth.Principal{
+			UserID:      user.ID,
+			Email:       user.Email,
+			FamilyID:    claims.FamilyID,
+			Roles:       make([]string, 0, len(roles)),
+			Permissions: make(map[auth.Permission]bool),
+		}
+		for _, role := range roles {
+			principal.Roles = append(principal.Roles, role.Name)
+			for _, perm := range rolePermissions(role) {
+				principal.Permissions[perm] = true
+			}
+		}
+		return principal, nil
+	}
+}
+
+// rolePermissions prefers the compiled-in definition for system roles so a
+// stale row can't outlive a deploy that narrowed them
+func rolePermissions(role db.Role) []auth.Permission {
+	if role.IsSystem {
+		if perms, ok := auth.DefaultRoles[role.Name]; ok {
+			return perms
+		}
+	}
+
+	var perms []auth.Permission
+	if err := json.Unmarshal(role.Permissions, &perms); err != nil {
+		return nil
+	}
+	return perms
+}
+
+// grantRole gives userID the named role; grantedBy is empty for self-service grants
+func grantRole(ctx context.Context, q *db.Queries, userID uuid.UUID, name string, grantedBy uuid.NullUUID) error {
+	role, err := q.GetRoleByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to find role %s: %v", name, err)
+	}
+	return q.GrantUserRole(ctx, db.GrantUserRoleParams{
+		UserID:    userID,
+		RoleID:    role.ID,
+		GrantedBy: grantedBy,
+	})
+}
+
+// knownRoles responds 400 and returns false if any of names isn't a role
+func (s *AuthService) knownRoles(c *gin.Context, names []string) bool {
+	for _, name := range names {
+		_, err := s.DB.GetRoleByName(c, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "UNKNOWN_ROLE",
+					"message": "Unknown role: " + name,
+					"status":  http.StatusBadRequest,
+				},
+			})
+			return false
+		}
+		if err != nil {
+			log.Printf("GetRoleByName failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"code":    "INTERNAL_SERVER_ERROR",
+					"message": "Something went wrong. Please try again later.",
+					"status":  http.StatusInternalServerError,
+				},
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// roleClaim summarizes the user's roles for the token; authorization never relies on it
+func roleClaim(ctx context.Context, q *db.Queries, userID uuid.UUID) (string, error) {
+	roles, err := q.ListUserRoles(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return strings.Join(names, ","), nil
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+)
+
+// TestLoadPrincipalStatus checks that tokens stop working as soon as their
+// user is no longer active, not when they expire
+func TestLoadPrincipalStatus(t *testing.T) {
+	for status, wantErr := range map[string]error{
+		auth.UserStatusActive:    nil,
+		auth.UserStatusPending:   sql.ErrNoRows,
+		auth.UserStatusSuspended: sql.ErrNoRows,
+		auth.UserStatusDisabled:  sql.ErrNoRows,
+	} {
+		t.Run(status, func(t *testing.T) {
+			fake, _, queries := newFakeDB(t, "viewer")
+			id := fake.addUser(db.User{Email: "alice@example.com", Status: status, Kind: auth.UserKindHuman})
+			fake.grants = append(fake.grants, fakeGrant{userID: id, roleID: fake.roles[0].ID, source: "local"})
+
+			principal, err := LoadPrincipal(queries)(context.Background(), &auth.SecureClaims{DecryptedUserID: id.String()})
+			if !errors.Is(err, wantErr) {
+				t.Fatalf("LoadPrincipal() = %v, want %v", err, wantErr)
+			}
+			if err == nil && (principal.UserID != id || !slices.Equal(principal.Roles, []string{"viewer"})) {
+				t.Fatalf("LoadPrincipal() = %+v, want alice as a viewer", principal)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sort"
+	"strings"
+)
+
+// canonicalize serializes the subtree at e using Exclusive XML Canonicalization
+// without comments (https://www.w3.org/TR/xml-exc-c14n/). skip, if set, is left
+// out of the output, which is how the enveloped-signature transform is applied.
+// inclusive lists the InclusiveNamespaces PrefixList, with "#default" for the
+// default namespace.
+func canonicalize(e, skip *element, inclusive []string) []byte {
+	var buf bytes.Buffer
+	c := c14n{skip: skip, inclusive: make(map[string]bool)}
+	for _, p := range inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		c.inclusive[p] = true
+	}
+	c.element(&buf, e, map[string]string{})
+	return buf.Bytes()
+}
+
+type c14n struct {
+	skip      *element
+	inclusive map[string]bool
+}
+
+// element writes e; rendered holds the namespace declarations already in
+// effect from output ancestors
+func (c *c14n) element(buf *bytes.Buffer, e *element, rendered map[string]string) {
+	// Namespaces are output where they're visibly used, plus those in the
+	// inclusive list that are in scope
+	used := map[string]bool{e.prefix: true}
+	for _, a := range e.attrs {
+		if a.Name.Space != "" && a.Name.Space != "xml" {
+			used[a.Name.Space] = true
+		}
+	}
+	for p := range c.inclusive {
+		if _, ok := e.lookupNS(p); ok {
+			used[p] = true
+		}
+	}
+
+	var decls []string
+	scope := rendered
+	for p := range used {
+		uri, _ := e.lookupNS(p)
+		prev, ok := rendered[p]
+		if ok && prev == uri || !ok && p == "" && uri == "" {
+			continue
+		}
+		if len(decls) == 0 {
+			scope = make(map[string]string, len(rendered)+len(used))
+			for k, v := range rendered {
+				scope[k] = v
+			}
+		}
+		scope[p] = uri
+		decls = append(decls, p)
+	}
+	sort.Strings(decls)
+
+	attrs := make([]xml.Attr, len(e.attrs))
+	copy(attrs, e.attrs)
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ui, uj := attrURI(e, attrs[i]), attrURI(e, attrs[j])
+		if ui != uj {
+			return ui < uj
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+
+	buf.WriteByte('<')
+	buf.WriteString(qname(e.prefix, e.local))
+	for _, p := range decls {
+		if p == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + p + `="`)
+		}
+		escapeAttr(buf, scope[p])
+		buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		buf.WriteString(" " + qname(a.Name.Space, a.Name.Local) + `="`)
+		escapeAttr(buf, a.Value)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, child := range e.children {
+		switch t := child.(type) {
+		case *element:
+			if t != c.skip {
+				c.element(buf, t, scope)
+			}
+		case xml.CharData:
+			escapeText(buf, string(t))
+		case xml.ProcInst:
+			buf.WriteString("<?" + t.Target)
+			if len(t.Inst) > 0 {
+				buf.WriteByte(' ')
+				buf.Write(t.Inst)
+			}
+			buf.WriteString("?>")
+		}
+	}
+
+	buf.WriteString("</" + qname(e.prefix, e.local) + ">")
+}
+
+func attrURI(e *element, a xml.Attr) string {
+	if a.Name.Space == "" {
+		return ""
+	}
+	uri, _ := e.lookupNS(a.Name.Space)
+	return uri
+}
+
+func qname(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(buf *bytes.Buffer, s string) {
+	textEscaper.WriteString(buf, s)
+}
+
+func escapeAttr(buf *bytes.Buffer, s string) {
+	attrEscaper.WriteString(buf, s)
+}
@@ -0,0 +1,172 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	nsDSig    = "http://www.w3.org/2000/09/xmldsig#"
+	nsExcC14N = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+	algEnveloped   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algSHA256      = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512      = "http://www.w3.org/2001/04/xmlenc#sha512"
+	algRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algECDSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+)
+
+var errNotSigned = errors.New("element is not signed")
+
+// verifyEnveloped checks the enveloped signature that is a direct child of el
+// and covers el itself. Only the narrow profile SAML IdPs use is accepted: one
+// reference, exclusive canonicalization and SHA-2. SHA-1 is refused.
+func verifyEnveloped(el *element, pub crypto.PublicKey) error {
+	sigs := el.childElements(nsDSig, "Signature")
+	if len(sigs) == 0 {
+		return errNotSigned
+	}
+	if len(sigs) > 1 {
+		return errors.New("multiple signatures")
+	}
+	sig := sigs[0]
+
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("missing SignedInfo")
+	}
+	c14nMethod := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != nsExcC14N {
+		return errors.New("unsupported canonicalization method")
+	}
+	sigMethod := signedInfo.child(nsDSig, "SignatureMethod")
+	if sigMethod == nil {
+		return errors.New("missing SignatureMethod")
+	}
+
+	refs := signedInfo.childElements(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return errors.New("expected exactly one reference")
+	}
+	ref := refs[0]
+	if id := el.attr("ID"); id == "" || ref.attr("URI") != "#"+id {
+		return errors.New("reference does not point at the signed element")
+	}
+
+	// The only transforms that make sense here: drop the signature, then canonicalize
+	var enveloped, canonical bool
+	var prefixes []string
+	if transforms := ref.child(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.childElements(nsDSig, "Transform") {
+			switch t.attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case nsExcC14N:
+				canonical = true
+				prefixes = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("unsupported transform %q", t.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped || !canonical {
+		return errors.New("reference must use enveloped-signature and exclusive c14n transforms")
+	}
+
+	digestMethod := ref.child(nsDSig, "DigestMethod")
+	digestValue := ref.child(nsDSig, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return errors.New("missing digest")
+	}
+	var digestHash crypto.Hash
+	switch digestMethod.attr("Algorithm") {
+	case algSHA256:
+		digestHash = crypto.SHA256
+	case algSHA512:
+		digestHash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported digest method %q", digestMethod.attr("Algorithm"))
+	}
+	want, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("invalid digest value: %v", err)
+	}
+	h := digestHash.New()
+	h.Write(canonicalize(el, sig, prefixes))
+	if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+		return errors.New("digest mismatch")
+	}
+
+	sigValue := sig.child(nsDSig, "SignatureValue")
+	if sigValue == nil {
+		return errors.New("missing SignatureValue")
+	}
+	sigBytes, err := decodeBase64(sigValue.text())
+	if err != nil {
+		return fmt.Errorf("invalid signature value: %v", err)
+	}
+	return verifySignedInfo(sigMethod.attr("Algorithm"), pub, canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod)), sigBytes)
+}
+
+func verifySignedInfo(alg string, pub crypto.PublicKey, data, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case algRSASHA256, algECDSASHA256:
+		hash = crypto.SHA256
+	case algRSASHA512:
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature method %q", alg)
+	}
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if alg == algECDSASHA256 {
+			return errors.New("key does not match signature method")
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, sig); err != nil {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != algECDSASHA256 {
+			return errors.New("key does not match signature method")
+		}
+		// XML DSig encodes ECDSA signatures as r || s, not ASN.1
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("signature verification failed")
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+	return errors.New("unsupported key type")
+}
+
+// inclusivePrefixes reads the InclusiveNamespaces PrefixList of a transform
+// or canonicalization method
+func inclusivePrefixes(method *element) []string {
+	if ns := method.child(nsExcC14N, "InclusiveNamespaces"); ns != nil {
+		return strings.Fields(ns.attr("PrefixList"))
+	}
+	return nil
+}
+
+// decodeBase64 tolerates the line breaks IdPs wrap base64 content with
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
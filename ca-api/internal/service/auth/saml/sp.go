@@ -0,0 +1,384 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/saml"
+)
+
+const (
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+
+	bindingPOST       = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	methodBearer      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	NameIDFormatEmail = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	nameIDPersisted   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+
+	clockSkew = time.Minute
+)
+
+var ErrInvalidResponse = errors.New("invalid SAML response")
+
+// LoadProviders reads a JSON array of provider configs
+func LoadProviders(path string) ([]saml.ProviderConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SAML providers: %v", err)
+	}
+
+	var configs []saml.ProviderConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse SAML providers: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range configs {
+		cfg := &configs[i]
+		if cfg.Name == "" || cfg.EntityID == "" || cfg.ACSURL == "" || cfg.IdPEntityID == "" || cfg.IdPSSOURL == "" || cfg.IdPCertificate == "" {
+			return nil, fmt.Errorf("SAML provider %d: name, entity_id, acs_url, idp_entity_id, idp_sso_url and idp_certificate are required", i)
+		}
+		if seen[cfg.Name] {
+			return nil, fmt.Errorf("SAML provider %q is configured twice", cfg.Name)
+		}
+		seen[cfg.Name] = true
+		if len(cfg.AllowedDomains) == 0 {
+			return nil, fmt.Errorf("SAML provider %q: allowed_domains is required", cfg.Name)
+		}
+		for j, domain := range cfg.AllowedDomains {
+			cfg.AllowedDomains[j] = strings.ToLower(domain)
+		}
+	}
+	return configs, nil
+}
+
+// ServiceProvider is Signee's side of one IdP relationship
+type ServiceProvider struct {
+	cfg     saml.ProviderConfig
+	idpCert *x509.Certificate
+}
+
+func NewServiceProvider(cfg saml.ProviderConfig) (*ServiceProvider, error) {
+	block, _ := pem.Decode([]byte(cfg.IdPCertificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("SAML provider %q: idp_certificate is not a PEM certificate", cfg.Name)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("SAML provider %q: %v", cfg.Name, err)
+	}
+	return &ServiceProvider{cfg: cfg, idpCert: cert}, nil
+}
+
+func (sp *ServiceProvider) Config() saml.ProviderConfig {
+	return sp.cfg
+}
+
+type spMetadata struct {
+	XMLName    xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID   string   `xml:"entityID,attr"`
+	Descriptor struct {
+		AuthnRequestsSigned        bool     `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned       bool     `xml:"WantAssertionsSigned,attr"`
+		ProtocolSupportEnumeration string   `xml:"protocolSupportEnumeration,attr"`
+		NameIDFormats              []string `xml:"NameIDFormat"`
+		ACS                        struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+			Index    int    `xml:"index,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+// Metadata is the SP metadata document to register with the IdP
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	md := spMetadata{EntityID: sp.cfg.EntityID}
+	md.Descriptor.WantAssertionsSigned = true
+	md.Descriptor.ProtocolSupportEnumeration = nsProtocol
+	md.Descriptor.NameIDFormats = []string{nameIDPersisted, NameIDFormatEmail}
+	md.Descriptor.ACS.Binding = bindingPOST
+	md.Descriptor.ACS.Location = sp.cfg.ACSURL
+
+	out, err := xml.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	Issuer                      struct {
+		XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+		Value   string   `xml:",chardata"`
+	}
+	NameIDPolicy struct {
+		AllowCreate bool `xml:"AllowCreate,attr"`
+	} `xml:"NameIDPolicy"`
+}
+
+// AuthnRequestURL builds the HTTP-Redirect binding URL for an AuthnRequest
+func (sp *ServiceProvider) AuthnRequestURL(requestID, relayState string, now time.Time) (string, error) {
+	req := authnRequest{
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                now.UTC().Format(time.RFC3339),
+		Destination:                 sp.cfg.IdPSSOURL,
+		AssertionConsumerServiceURL: sp.cfg.ACSURL,
+		ProtocolBinding:             bindingPOST,
+	}
+	req.Issuer.Value = sp.cfg.EntityID
+	req.NameIDPolicy.AllowCreate = true
+
+	out, err := xml.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(out); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	params.Set("RelayState", relayState)
+
+	sep := "?"
+	if strings.Contains(sp.cfg.IdPSSOURL, "?") {
+		sep = "&"
+	}
+	return sp.cfg.IdPSSOURL + sep + params.Encode(), nil
+}
+
+// ParseResponse validates a base64 SAMLResponse from the HTTP-POST binding that
+// answers requestID. Everything returned is read from signed elements only, so
+// unsigned content smuggled in beside them (signature wrapping) is never seen.
+func (sp *ServiceProvider) ParseResponse(encoded, requestID string, now time.Time) (*saml.Assertion, error) {
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	assertion, err := sp.parseResponse(data, requestID, now)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return assertion, nil
+}
+
+func (sp *ServiceProvider) parseResponse(data []byte, requestID string, now time.Time) (*saml.Assertion, error) {
+	resp, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.is(nsProtocol, "Response") {
+		return nil, errors.New("not a Response")
+	}
+
+	// Signature references resolve by ID, so IDs must be unambiguous
+	ids := make(map[string]bool)
+	var dup bool
+	resp.walk(func(el *element) {
+		if id := el.attr("ID"); id != "" {
+			dup = dup || ids[id]
+			ids[id] = true
+		}
+	})
+	if dup {
+		return nil, errors.New("duplicate ID attributes")
+	}
+
+	if dest := resp.attr("Destination"); dest != "" && dest != sp.cfg.ACSURL {
+		return nil, fmt.Errorf("destination %q is not our ACS", dest)
+	}
+	if resp.attr("InResponseTo") != requestID {
+		return nil, errors.New("response does not answer our request")
+	}
+	if issuer := resp.child(nsAssertion, "Issuer"); issuer != nil && issuer.text() != sp.cfg.IdPEntityID {
+		return nil, fmt.Errorf("unexpected issuer %q", issuer.text())
+	}
+	status := resp.child(nsProtocol, "Status")
+	if status == nil {
+		return nil, errors.New("missing status")
+	}
+	if code := status.child(nsProtocol, "StatusCode"); code == nil || code.attr("Value") != statusSuccess {
+		return nil, errors.New("IdP reported failure")
+	}
+
+	if len(resp.childElements(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertion := resp.child(nsAssertion, "Assertion")
+	if assertion == nil {
+		return nil, errors.New("expected exactly one assertion")
+	}
+
+	// A signature on the response covers the assertion inside it; either will do,
+	// but any signature that is present must verify
+	responseSigned, err := sp.checkSignature(resp)
+	if err != nil {
+		return nil, fmt.Errorf("response signature: %v", err)
+	}
+	assertionSigned, err := sp.checkSignature(assertion)
+	if err != nil {
+		return nil, fmt.Errorf("assertion signature: %v", err)
+	}
+	if !responseSigned && !assertionSigned {
+		return nil, errors.New("assertion is not signed")
+	}
+
+	return sp.readAssertion(assertion, requestID, now)
+}
+
+func (sp *ServiceProvider) checkSignature(el *element) (bool, error) {
+	err := verifyEnveloped(el, sp.idpCert.PublicKey)
+	if errors.Is(err, errNotSigned) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (sp *ServiceProvider) readAssertion(a *element, requestID string, now time.Time) (*saml.Assertion, error) {
+	issuer := a.child(nsAssertion, "Issuer")
+	if issuer == nil || issuer.text() != sp.cfg.IdPEntityID {
+		return nil, errors.New("assertion issuer mismatch")
+	}
+
+	subject := a.child(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, errors.New("missing subject")
+	}
+	nameID := subject.child(nsAssertion, "NameID")
+	if nameID == nil || nameID.text() == "" {
+		return nil, errors.New("missing NameID")
+	}
+	if !sp.bearerConfirmed(subject, requestID, now) {
+		return nil, errors.New("no valid bearer subject confirmation")
+	}
+
+	conditions := a.child(nsAssertion, "Conditions")
+	if conditions == nil {
+		return nil, errors.New("missing conditions")
+	}
+	if err := checkWindow(conditions, now); err != nil {
+		return nil, err
+	}
+	restrictions := conditions.childElements(nsAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return nil, errors.New("missing audience restriction")
+	}
+	// Every restriction must be satisfied
+	for _, r := range restrictions {
+		ok := false
+		for _, aud := range r.childElements(nsAssertion, "Audience") {
+			ok = ok || aud.text() == sp.cfg.EntityID
+		}
+		if !ok {
+			return nil, errors.New("we are not in the audience")
+		}
+	}
+
+	out := &saml.Assertion{
+		NameID:       nameID.text(),
+		NameIDFormat: nameID.attr("Format"),
+		Attributes:   make(map[string][]string),
+	}
+	for _, stmt := range a.childElements(nsAssertion, "AttributeStatement") {
+		for _, attr := range stmt.childElements(nsAssertion, "Attribute") {
+			name := attr.attr("Name")
+			for _, v := range attr.childElements(nsAssertion, "AttributeValue") {
+				out.Attributes[name] = append(out.Attributes[name], v.text())
+			}
+		}
+	}
+	return out, nil
+}
+
+// bearerConfirmed looks for a bearer confirmation addressed to our ACS, for our request, still in date
+func (sp *ServiceProvider) bearerConfirmed(subject *element, requestID string, now time.Time) bool {
+	for _, sc := range subject.childElements(nsAssertion, "SubjectConfirmation") {
+		if sc.attr("Method") != methodBearer {
+			continue
+		}
+		data := sc.child(nsAssertion, "SubjectConfirmationData")
+		if data == nil || data.attr("Recipient") != sp.cfg.ACSURL || data.attr("InResponseTo") != requestID {
+			continue
+		}
+		if data.attr("NotOnOrAfter") == "" {
+			continue
+		}
+		if checkWindow(data, now) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWindow enforces NotBefore / NotOnOrAfter with some allowance for clock skew
+func checkWindow(el *element, now time.Time) error {
+	if v := el.attr("NotBefore"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return fmt.Errorf("invalid NotBefore: %v", err)
+		}
+		if now.Add(clockSkew).Before(t) {
+			return errors.New("assertion not yet valid")
+		}
+	}
+	if v := el.attr("NotOnOrAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return fmt.Errorf("invalid NotOnOrAfter: %v", err)
+		}
+		if !now.Add(-clockSkew).Before(t) {
+			return errors.New("assertion expired")
+		}
+	}
+	return nil
+}
+
+// NewRequestID returns a random AuthnRequest ID; IDs must not start with a digit
+func NewRequestID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate request id: %v", err)
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// NewRelayState returns an opaque RelayState, well under the 80 byte limit
+func NewRelayState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate relay state: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,363 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/saml"
+)
+
+const (
+	testEntityID    = "https://signee.example.com/api/v1/auth/saml/corp/metadata"
+	testACSURL      = "https://signee.example.com/api/v1/auth/saml/corp/acs"
+	testIdPEntityID = "https://idp.example.com/metadata"
+	testRequestID   = "_request1"
+)
+
+// testIdP is a locally generated IdP signing key and its certificate
+type testIdP struct {
+	key     *rsa.PrivateKey
+	certPEM string
+}
+
+var (
+	idpOnce  sync.Once
+	idps     [2]testIdP
+	idpError error
+)
+
+// newTestIdPs returns two IdPs with distinct keys, generated once per run
+func newTestIdPs(t *testing.T) (testIdP, testIdP) {
+	t.Helper()
+	idpOnce.Do(func() {
+		for i := range idps {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				idpError = err
+				return
+			}
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(int64(i + 1)),
+				Subject:      pkix.Name{CommonName: "idp.example.com"},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+			}
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+			if err != nil {
+				idpError = err
+				return
+			}
+			idps[i] = testIdP{key: key, certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+		}
+	})
+	if idpError != nil {
+		t.Fatal(idpError)
+	}
+	return idps[0], idps[1]
+}
+
+func newTestSP(t *testing.T, idp testIdP) *ServiceProvider {
+	t.Helper()
+	sp, err := NewServiceProvider(saml.ProviderConfig{
+		Name:           "corp",
+		EntityID:       testEntityID,
+		ACSURL:         testACSURL,
+		IdPEntityID:    testIdPEntityID,
+		IdPSSOURL:      "https://idp.example.com/sso",
+		IdPCertificate: idp.certPEM,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp
+}
+
+// response holds the values a test IdP puts into a Response. Signature is
+// filled in by sign.
+type response struct {
+	ID, AssertionID string
+	InResponseTo    string
+	Destination     string
+	Issuer          string
+	NameID          string
+	Recipient       string
+	Audience        string
+	NotBefore       string
+	NotOnOrAfter    string
+	Signature       string
+}
+
+func newResponse(now time.Time) response {
+	return response{
+		ID:           "_response1",
+		AssertionID:  "_assertion1",
+		InResponseTo: testRequestID,
+		Destination:  testACSURL,
+		Issuer:       testIdPEntityID,
+		NameID:       "alice@example.com",
+		Recipient:    testACSURL,
+		Audience:     testEntityID,
+		NotBefore:    now.Add(-time.Minute).UTC().Format(time.RFC3339),
+		NotOnOrAfter: now.Add(5 * time.Minute).UTC().Format(time.RFC3339),
+	}
+}
+
+var responseTemplate = template.Must(template.New("response").Parse(
+	`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion"` +
+		` ID="{{.ID}}" Version="2.0" IssueInstant="{{.NotBefore}}" Destination="{{.Destination}}" InResponseTo="{{.InResponseTo}}">` +
+		`<saml:Issuer>{{.Issuer}}</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>` +
+		`<saml:Assertion ID="{{.AssertionID}}" Version="2.0" IssueInstant="{{.NotBefore}}">` +
+		`<saml:Issuer>{{.Issuer}}</saml:Issuer>{{.Signature}}` +
+		`<saml:Subject>` +
+		`<saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">{{.NameID}}</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+		`<saml:SubjectConfirmationData InResponseTo="{{.InResponseTo}}" NotOnOrAfter="{{.NotOnOrAfter}}" Recipient="{{.Recipient}}"/>` +
+		`</saml:SubjectConfirmation>` +
+		`</saml:Subject>` +
+		`<saml:Conditions NotBefore="{{.NotBefore}}" NotOnOrAfter="{{.NotOnOrAfter}}">` +
+		`<saml:AudienceRestriction><saml:Audience>{{.Audience}}</saml:Audience></saml:AudienceRestriction>` +
+		`</saml:Conditions>` +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="groups"><saml:AttributeValue>ops</saml:AttributeValue><saml:AttributeValue>dev</saml:AttributeValue></saml:Attribute>` +
+		`</saml:AttributeStatement>` +
+		`</saml:Assertion>` +
+		`</samlp:Response>`))
+
+var signatureTemplate = template.Must(template.New("signature").Parse(
+	`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:SignedInfo>` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#{{.URI}}">` +
+		`<ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`</ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="{{.DigestMethod}}"/>` +
+		`<ds:DigestValue>{{.Digest}}</ds:DigestValue>` +
+		`</ds:Reference>` +
+		`</ds:SignedInfo>` +
+		`<ds:SignatureValue>{{.Value}}</ds:SignatureValue>` +
+		`</ds:Signature>`))
+
+type signature struct {
+	URI, DigestMethod, Digest, Value string
+}
+
+func render(t *testing.T, tmpl *template.Template, v any) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// sign renders r with an enveloped signature over its assertion, made the
+// way an IdP does: digest the canonical assertion without the signature,
+// then sign the canonical SignedInfo
+func (idp testIdP) sign(t *testing.T, r response) string {
+	t.Helper()
+	sig := signature{URI: r.AssertionID, DigestMethod: algSHA256}
+	assertion := func() (*element, *element) {
+		r.Signature = render(t, signatureTemplate, sig)
+		resp, err := parseXML([]byte(render(t, responseTemplate, r)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := resp.child(nsAssertion, "Assertion")
+		return a, a.child(nsDSig, "Signature")
+	}
+
+	a, s := assertion()
+	digest := sha256.Sum256(canonicalize(a, s, nil))
+	sig.Digest = base64.StdEncoding.EncodeToString(digest[:])
+
+	_, s = assertion()
+	signed := sha256.Sum256(canonicalize(s.child(nsDSig, "SignedInfo"), nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, signed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.Value = base64.StdEncoding.EncodeToString(value)
+
+	r.Signature = render(t, signatureTemplate, sig)
+	return render(t, responseTemplate, r)
+}
+
+func parse(sp *ServiceProvider, xml string, now time.Time) (*saml.Assertion, error) {
+	return sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(xml)), testRequestID, now)
+}
+
+func TestParseResponse(t *testing.T) {
+	idp, _ := newTestIdPs(t)
+	sp := newTestSP(t, idp)
+	now := time.Now()
+
+	got, err := parse(sp, idp.sign(t, newResponse(now)), now)
+	if err != nil {
+		t.Fatalf("ParseResponse() = %v", err)
+	}
+	if got.NameID != "alice@example.com" || got.NameIDFormat != NameIDFormatEmail {
+		t.Fatalf("NameID = %q (%s)", got.NameID, got.NameIDFormat)
+	}
+	if groups := got.Attributes["groups"]; strings.Join(groups, ",") != "ops,dev" {
+		t.Fatalf("groups = %v, want [ops dev]", groups)
+	}
+}
+
+func TestParseResponseTampered(t *testing.T) {
+	idp, other := newTestIdPs(t)
+	sp := newTestSP(t, idp)
+	now := time.Now()
+	signed := idp.sign(t, newResponse(now))
+
+	for name, xml := range map[string]string{
+		// Editing signed content breaks the digest
+		"content": strings.Replace(signed, ">alice@example.com<", ">mallory@example.com<", 1),
+		// Recomputing the digest breaks the signature over SignedInfo
+		"digest": func() string {
+			r := newResponse(now)
+			r.NameID = "mallory@example.com"
+			forged := idp.sign(t, r)
+			// Mallory's content and a matching digest, under the signature value made for Alice's
+			value := func(xml string) (int, int) {
+				return strings.Index(xml, "<ds:SignatureValue>"), strings.Index(xml, "</ds:Signature>")
+			}
+			fs, fe := value(forged)
+			ss, se := value(signed)
+			return forged[:fs] + signed[ss:se] + forged[fe:]
+		}(),
+		"signed by another key": other.sign(t, newResponse(now)),
+		"unsigned":              render(t, responseTemplate, newResponse(now)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parse(sp, xml, now); !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("ParseResponse() = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+func TestParseResponseSHA1Refused(t *testing.T) {
+	idp, _ := newTestIdPs(t)
+	sp := newTestSP(t, idp)
+	now := time.Now()
+	xml := strings.Replace(idp.sign(t, newResponse(now)), algSHA256, "http://www.w3.org/2000/09/xmldsig#sha1", 1)
+	if _, err := parse(sp, xml, now); err == nil || !strings.Contains(err.Error(), "unsupported digest method") {
+		t.Fatalf("ParseResponse() = %v, want an unsupported digest error", err)
+	}
+}
+
+// TestParseResponseSignatureWrapping moves a genuinely signed assertion out of
+// the way and puts an unsigned one where the SP reads it (XSW attacks)
+func TestParseResponseSignatureWrapping(t *testing.T) {
+	idp, _ := newTestIdPs(t)
+	sp := newTestSP(t, idp)
+	now := time.Now()
+
+	signed := idp.sign(t, newResponse(now))
+	start := strings.Index(signed, "<saml:Assertion ")
+	end := strings.Index(signed, "</samlp:Response>")
+	genuine := signed[start:end]
+
+	evil := newResponse(now)
+	evil.NameID = "mallory@example.com"
+	evil.AssertionID = "_evil"
+	unsignedEvil := render(t, responseTemplate, evil)
+	evilAssertion := unsignedEvil[strings.Index(unsignedEvil, "<saml:Assertion "):strings.Index(unsignedEvil, "</samlp:Response>")]
+
+	// The evil assertion carrying the genuine signature, whose reference names the genuine ID
+	sigStart, sigEnd := strings.Index(genuine, "<ds:Signature"), strings.Index(genuine, "</ds:Signature>")+len("</ds:Signature>")
+	evilWithSig := strings.Replace(evilAssertion, "</saml:Issuer>", "</saml:Issuer>"+genuine[sigStart:sigEnd], 1)
+
+	for name, xml := range map[string]string{
+		"evil assertion beside the genuine one": signed[:start] + evilAssertion + genuine + signed[end:],
+		"genuine assertion hidden in Extensions": signed[:start] +
+			`<samlp:Extensions>` + genuine + `</samlp:Extensions>` + evilAssertion + signed[end:],
+		"genuine assertion nested in the evil one": signed[:start] +
+			strings.Replace(evilAssertion, "</saml:Assertion>", genuine+"</saml:Assertion>", 1) + signed[end:],
+		"evil assertion reusing the genuine ID": signed[:start] +
+			`<samlp:Extensions>` + genuine + `</samlp:Extensions>` +
+			strings.Replace(evilAssertion, `ID="_evil"`, `ID="_assertion1"`, 1) + signed[end:],
+		"evil assertion with the genuine signature": signed[:start] + evilWithSig + signed[end:],
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := parse(sp, xml, now)
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("ParseResponse() = %+v, %v; want ErrInvalidResponse", got, err)
+			}
+		})
+	}
+}
+
+func TestParseResponseConditions(t *testing.T) {
+	idp, _ := newTestIdPs(t)
+	sp := newTestSP(t, idp)
+	now := time.Now()
+
+	for name, tc := range map[string]struct {
+		change func(r *response)
+		at     time.Time
+	}{
+		"expired":           {at: now.Add(10 * time.Minute)},
+		"not yet valid":     {at: now.Add(-5 * time.Minute)},
+		"wrong audience":    {change: func(r *response) { r.Audience = "https://other-sp.example.com" }},
+		"wrong recipient":   {change: func(r *response) { r.Recipient = "https://other-sp.example.com/acs" }},
+		"wrong issuer":      {change: func(r *response) { r.Issuer = "https://evil-idp.example.com" }},
+		"other request":     {change: func(r *response) { r.InResponseTo = "_request2" }},
+		"wrong destination": {change: func(r *response) { r.Destination = "https://other-sp.example.com/acs" }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := newResponse(now)
+			if tc.change != nil {
+				tc.change(&r)
+			}
+			at := now
+			if !tc.at.IsZero() {
+				at = tc.at
+			}
+			if _, err := parse(sp, idp.sign(t, r), at); !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("ParseResponse() = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+
+	// Clocks a little apart are tolerated
+	if _, err := parse(sp, idp.sign(t, newResponse(now)), now.Add(5*time.Minute+clockSkew/2)); err != nil {
+		t.Fatalf("ParseResponse() within clock skew = %v", err)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	doc, err := parseXML([]byte(`<root xmlns="urn:a" xmlns:b="urn:b" xmlns:unused="urn:u"><b:child z="1" a="2" b:x="3">text &amp; more</b:child></root>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		el   *element
+		want string
+	}{
+		{doc, `<root xmlns="urn:a"><b:child xmlns:b="urn:b" a="2" z="1" b:x="3">text &amp; more</b:child></root>`},
+		{doc.child("urn:b", "child"), `<b:child xmlns:b="urn:b" a="2" z="1" b:x="3">text &amp; more</b:child>`},
+	} {
+		if got := string(canonicalize(tc.el, nil, nil)); got != tc.want {
+			t.Errorf("canonicalize() =\n%s\nwant\n%s", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	nsXML       = "http://www.w3.org/XML/1998/namespace"
+	maxXMLDepth = 64
+)
+
+// element is a parsed XML element that keeps prefixes and namespace
+// declarations as written, which canonicalization needs and encoding/xml's
+// Unmarshal throws away
+type element struct {
+	parent   *element
+	prefix   string
+	local    string
+	nsDecls  map[string]string // prefix ("" for default) -> URI declared on this element
+	attrs    []xml.Attr        // Name.Space holds the prefix, not the URI
+	children []any             // *element, xml.CharData or xml.ProcInst
+}
+
+// parseXML builds an element tree. DTDs are refused outright, which rules out
+// entity expansion tricks.
+func parseXML(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var root, cur *element
+	depth := 0
+
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root != nil && cur == nil {
+				return nil, errors.New("xml: multiple root elements")
+			}
+			if depth++; depth > maxXMLDepth {
+				return nil, errors.New("xml: nesting too deep")
+			}
+			el := &element{parent: cur, prefix: t.Name.Space, local: t.Name.Local, nsDecls: map[string]string{}}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					el.nsDecls[""] = a.Value
+				case a.Name.Space == "xmlns":
+					el.nsDecls[a.Name.Local] = a.Value
+				default:
+					el.attrs = append(el.attrs, a)
+				}
+			}
+			if cur == nil {
+				root = el
+			} else {
+				cur.children = append(cur.children, el)
+			}
+			cur = el
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.prefix || t.Name.Local != cur.local {
+				return nil, errors.New("xml: mismatched end element")
+			}
+			cur, depth = cur.parent, depth-1
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, t.Copy())
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("xml: text outside root element")
+			}
+		case xml.ProcInst:
+			if cur != nil {
+				cur.children = append(cur.children, t.Copy())
+			}
+		case xml.Directive:
+			return nil, errors.New("xml: DTDs are not allowed")
+		}
+	}
+
+	if root == nil || cur != nil {
+		return nil, errors.New("xml: incomplete document")
+	}
+	if err := root.checkPrefixes(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// lookupNS resolves prefix in scope at e
+func (e *element) lookupNS(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for el := e; el != nil; el = el.parent {
+		if uri, ok := el.nsDecls[prefix]; ok {
+			return uri, true
+		}
+	}
+	return "", prefix == ""
+}
+
+func (e *element) namespace() string {
+	uri, _ := e.lookupNS(e.prefix)
+	return uri
+}
+
+// checkPrefixes rejects undeclared prefixes so namespace lookups never guess
+func (e *element) checkPrefixes() error {
+	if _, ok := e.lookupNS(e.prefix); !ok {
+		return fmt.Errorf("xml: undeclared prefix %q", e.prefix)
+	}
+	for _, a := range e.attrs {
+		if a.Name.Space == "" {
+			continue
+		}
+		if _, ok := e.lookupNS(a.Name.Space); !ok {
+			return fmt.Errorf("xml: undeclared prefix %q", a.Name.Space)
+		}
+	}
+	for _, child := range e.children {
+		if el, ok := child.(*element); ok {
+			if err := el.checkPrefixes(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *element) is(ns, local string) bool {
+	return e.local == local && e.namespace() == ns
+}
+
+// attr returns an unqualified attribute
+func (e *element) attr(name string) string {
+	for _, a := range e.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (e *element) childElements(ns, local string) []*element {
+	var out []*element
+	for _, child := range e.children {
+		if el, ok := child.(*element); ok && el.is(ns, local) {
+			out = append(out, el)
+		}
+	}
+	return out
+}
+
+// child returns the only child named ns:local, or nil if there is none or several
+func (e *element) child(ns, local string) *element {
+	if els := e.childElements(ns, local); len(els) == 1 {
+		return els[0]
+	}
+	return nil
+}
+
+func (e *element) text() string {
+	var b strings.Builder
+	for _, child := range e.children {
+		if cd, ok := child.(xml.CharData); ok {
+			b.Write(cd)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// walk visits e and all its descendants in document order
+func (e *element) walk(fn func(*element)) {
+	fn(e)
+	for _, child := range e.children {
+		if el, ok := child.(*element); ok {
+			el.walk(fn)
+		}
+	}
+}
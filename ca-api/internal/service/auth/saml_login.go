@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	samltypes "github.com/dhruvpatel-10/signee/ca-api/internal/domain/saml"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/saml"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	samlRequestTTL = 10 * time.Minute
+	// The IdP posts back cross-site, so this cookie has to be SameSite=None
+	samlRelayCookie = "__Host-saml-relay"
+	maxSAMLResponse = 1 << 20
+)
+
+// SAMLMetadata serves the SP metadata to register with the IdP
+func (s *AuthService) SAMLMetadata(c *gin.Context) {
+	sp, ok := s.SAML[c.Param("provider")]
+	if !ok {
+		ssoProviderNotFound(c)
+		return
+	}
+
+	metadata, err := sp.Metadata()
+	if err != nil {
+		log.Printf("SAML metadata failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// BeginSAMLLogin redirects the browser to the IdP with an AuthnRequest
+func (s *AuthService) BeginSAMLLogin(c *gin.Context) {
+	sp, ok := s.SAML[c.Param("provider")]
+	if !ok {
+		ssoProviderNotFound(c)
+		return
+	}
+
+	authURL, relayState, err := s.newSAMLRequest(c, sp, uuid.NullUUID{})
+	if err != nil {
+		log.Printf("newSAMLRequest failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	setSAMLRelayCookie(c, relayState)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// LinkSAMLIdentity starts linking an IdP to the caller's own account. The
+// frontend sends the browser to the returned URL; FinishSAMLLogin completes it.
+// This is the only way an identity gets attached to an existing account.
+func (s *AuthService) LinkSAMLIdentity(c *gin.Context) {
+	sp, ok := s.SAML[c.Param("provider")]
+	if !ok {
+		ssoProviderNotFound(c)
+		return
+	}
+
+	userID := middleware.CurrentPrincipal(c).UserID
+	authURL, relayState, err := s.newSAMLRequest(c, sp, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		log.Printf("newSAMLRequest failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	setSAMLRelayCookie(c, relayState)
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+func setSAMLRelayCookie(c *gin.Context, relayState string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     samlRelayCookie,
+		Value:    relayState,
+		Path:     "/",
+		MaxAge:   int(samlRequestTTL / time.Second),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+// FinishSAMLLogin is the assertion consumer service for the HTTP-POST binding.
+// Like FinishOIDCLogin it ends on the frontend rather than with JSON.
+func (s *AuthService) FinishSAMLLogin(c *gin.Context) {
+	name := c.Param("provider")
+	sp, ok := s.SAML[name]
+	if !ok {
+		ssoProviderNotFound(c)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSAMLResponse)
+	encoded, relayState := c.PostForm("SAMLResponse"), c.PostForm("RelayState")
+	cookie, _ := c.Cookie(samlRelayCookie)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     samlRelayCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	// IdP-initiated logins carry no request of ours and are not accepted
+	if encoded == "" || relayState == "" || subtle.ConstantTimeCompare([]byte(relayState), []byte(cookie)) != 1 {
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+
+	request, err := consumeSAMLRequest(c, s.DB, name, relayState)
+	if errors.Is(err, errInvalidSAMLRequest) {
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+	if err != nil {
+		log.Printf("consumeSAMLRequest failed: %v", err)
+		s.ssoRedirectError(c, "INTERNAL_SERVER_ERROR")
+		return
+	}
+
+	assertion, err := sp.ParseResponse(encoded, request.RequestID, time.Now())
+	if err != nil {
+		log.Printf("SAML response from %s rejected: %v", name, err)
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+	s.completeSAMLLogin(c, sp.Config(), assertion, request.LinkUserID)
+}
+
+// completeSAMLLogin signs in, provisions or links the user a verified
+// assertion names. A valid linkUserID links the identity to that user.
+func (s *AuthService) completeSAMLLogin(c *gin.Context, cfg samltypes.ProviderConfig, assertion *samltypes.Assertion, linkUserID uuid.NullUUID) {
+	ext, err := samlIdentity(cfg, assertion)
+	if err != nil {
+		log.Printf("SAML assertion from %s unusable: %v", cfg.Name, err)
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+	if !s.emailAllowed(ext.Email, cfg.AllowedDomains) {
+		log.Printf("SAML provider %s vouched for %s outside its domains", cfg.Name, ext.Email)
+		s.ssoRedirectError(c, "SSO_LOGIN_FAILED")
+		return
+	}
+	if linkUserID.Valid {
+		s.finishSSOLink(c, linkUserID.UUID, ext)
+		return
+	}
+
+	user, err := s.provisionExternalUser(c, ext)
+	if errors.Is(err, errAccountExists) {
+		// Signing in as whoever holds the email would hand their account to the IdP
+		s.ssoRedirectError(c, "ACCOUNT_EXISTS")
+		return
+	}
+	if err != nil {
+		log.Printf("provisionExternalUser failed: %v", err)
+		s.ssoRedirectError(c, "INTERNAL_SERVER_ERROR")
+		return
+	}
+
+	// Local MFA still applies on top of the IdP's authentication
+	s.completeSSOLogin(c, user)
+}
+
+var errInvalidSAMLRequest = errors.New("invalid or expired SAML request")
+
+// newSAMLRequest records an AuthnRequest so its response can be matched and
+// redeemed once. A valid linkUserID makes it link the identity to that user.
+func (s *AuthService) newSAMLRequest(c *gin.Context, sp *saml.ServiceProvider, linkUserID uuid.NullUUID) (string, string, error) {
+	requestID, err := saml.NewRequestID()
+	if err != nil {
+		return "", "", err
+	}
+	relayState, err := saml.NewRelayState()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := sp.AuthnRequestURL(requestID, relayState, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+
+	// Opportunistic cleanup of abandoned logins
+	if err := s.DB.DeleteExpiredSAMLRequests(c); err != nil {
+		log.Printf("DeleteExpiredSAMLRequests failed: %v", err)
+	}
+
+	relayHash := sha256.Sum256([]byte(relayState))
+	err = s.DB.CreateSAMLRequest(c, db.CreateSAMLRequestParams{
+		RelayStateHash: relayHash[:],
+		RequestID:      requestID,
+		Provider:       sp.Config().Name,
+		ExpiresAt:      time.Now().Add(samlRequestTTL),
+		LinkUserID:     linkUserID,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, relayState, nil
+}
+
+// consumeSAMLRequest redeems a request exactly once, which also stops assertions being replayed
+func consumeSAMLRequest(c *gin.Context, q *db.Queries, provider, relayState string) (db.SamlRequest, error) {
+	relayHash := sha256.Sum256([]byte(relayState))
+	request, err := q.ConsumeSAMLRequest(c, relayHash[:])
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.SamlRequest{}, errInvalidSAMLRequest
+	}
+	if err != nil {
+		return db.SamlRequest{}, err
+	}
+	if request.Provider != provider || time.Now().After(request.ExpiresAt) {
+		return db.SamlRequest{}, errInvalidSAMLRequest
+	}
+	return request, nil
+}
+
+// samlIdentity maps a verified assertion onto an external identity using the provider's attribute names
+func samlIdentity(cfg samltypes.ProviderConfig, a *samltypes.Assertion) (auth.ExternalIdentity, error) {
+	first := func(name string) string {
+		if values := a.Attributes[name]; name != "" && len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	email := first(cfg.EmailAttribute)
+	if cfg.EmailAttribute == "" && a.NameIDFormat == saml.NameIDFormatEmail {
+		email = a.NameID
+	}
+	if email == "" {
+		return auth.ExternalIdentity{}, errors.New("assertion carries no email")
+	}
+
+	var groups []string
+	if cfg.GroupsAttribute != "" {
+		groups = a.Attributes[cfg.GroupsAttribute]
+	}
+
+	return auth.ExternalIdentity{
+		Source:    "saml:" + cfg.Name,
+		Subject:   a.NameID,
+		Email:     strings.ToLower(email),
+		FirstName: first(cfg.FirstNameAttribute),
+		LastName:  first(cfg.LastNameAttribute),
+		Roles:     mapGroups(groups, cfg.RoleMapping, cfg.DefaultRole),
+	}, nil
+}
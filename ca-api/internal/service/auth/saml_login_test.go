@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	samltypes "github.com/dhruvpatel-10/signee/ca-api/internal/domain/saml"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/saml"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// samlTest wires an AuthService to one IdP and a fake database. Assertions
+// are handed to completeSAMLLogin as ParseResponse would return them once
+// verified; the signature checks themselves are the saml package's tests.
+type samlTest struct {
+	t      *testing.T
+	db     *fakeDB
+	cfg    samltypes.ProviderConfig
+	router *gin.Engine
+
+	assertion *samltypes.Assertion // what the next POST /acs asserts
+	link      uuid.NullUUID        // the user the next POST /acs links to
+	principal *auth.Principal      // who is signed in when linking
+}
+
+func newSAMLTest(t *testing.T) *samlTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	fake, conn, queries := newFakeDB(t, "operator", "viewer", "admin")
+
+	dir := t.TempDir()
+	jwtManager, err := jwt.NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := samltypes.ProviderConfig{
+		Name:            "corp",
+		EntityID:        "https://signee.example.com/api/v1/auth/saml/corp/metadata",
+		ACSURL:          "https://signee.example.com/api/v1/auth/saml/corp/acs",
+		IdPEntityID:     "https://idp.example.com/metadata",
+		IdPSSOURL:       "https://idp.example.com/sso",
+		IdPCertificate:  idpCertificate(t),
+		GroupsAttribute: "groups",
+		RoleMapping:     map[string]string{"ops": "operator"},
+		DefaultRole:     "viewer",
+		AllowedDomains:  []string{"example.com"},
+	}
+	sp, err := saml.NewServiceProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &AuthService{
+		Conn: conn, DB: queries, JWT: jwtManager, HashLimit: NewHashLimiter(1), AppURL: testAppURL,
+		SAML: map[string]*saml.ServiceProvider{"corp": sp},
+	}
+	st := &samlTest{t: t, db: fake, cfg: cfg, assertion: samlAssertion("alice@example.com", "ops")}
+	st.router = gin.New()
+	st.router.POST("/acs", func(c *gin.Context) { s.completeSAMLLogin(c, st.cfg, st.assertion, st.link) })
+	st.router.POST("/saml/:provider/acs", s.FinishSAMLLogin)
+	st.router.POST("/saml/:provider/link", func(c *gin.Context) { c.Set(middleware.PrincipalKey, st.principal) }, s.LinkSAMLIdentity)
+	return st
+}
+
+// idpCertificate is a throwaway certificate for an IdP whose signatures are never checked here
+func idpCertificate(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// samlAssertion names email by an emailAddress NameID, in groups
+func samlAssertion(email string, groups ...string) *samltypes.Assertion {
+	return &samltypes.Assertion{
+		NameID:       email,
+		NameIDFormat: saml.NameIDFormatEmail,
+		Attributes:   map[string][]string{"groups": groups},
+	}
+}
+
+func (st *samlTest) acs() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	st.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/acs", nil))
+	return w
+}
+
+func TestSAMLLoginProvisionsUser(t *testing.T) {
+	st := newSAMLTest(t)
+	signedIn(t, st.acs())
+
+	user := st.db.user("alice@example.com")
+	if len(st.db.identities) != 1 || st.db.identities[0].Provider != "saml:corp" || st.db.identities[0].UserID != user.ID {
+		t.Fatalf("identities = %+v, want alice's NameID under saml:corp", st.db.identities)
+	}
+	if roles := st.db.rolesOf(user.ID, "saml:corp"); !slices.Equal(roles, []string{"operator"}) {
+		t.Fatalf("roles = %v, want [operator]", roles)
+	}
+
+	st.assertion = samlAssertion("alice@elsewhere.example.net")
+	ssoFailed(t, st.acs(), "SSO_LOGIN_FAILED")
+	if len(st.db.users) != 1 {
+		t.Fatalf("%d users, want none provisioned outside the allowed domains", len(st.db.users))
+	}
+}
+
+// TestSAMLLoginDoesNotTakeOverAdmin asserts an existing local admin's email,
+// which must not sign in as that admin or touch their account
+func TestSAMLLoginDoesNotTakeOverAdmin(t *testing.T) {
+	st := newSAMLTest(t)
+	admin := st.db.addUser(db.User{Email: "alice@example.com", FirstName: "Alice", Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+	st.db.grants = append(st.db.grants, fakeGrant{userID: admin, roleID: st.db.roles[2].ID, source: "local"})
+
+	ssoFailed(t, st.acs(), "ACCOUNT_EXISTS")
+	if len(st.db.identities) != 0 || len(st.db.users) != 1 {
+		t.Fatalf("identities = %+v, users = %d, want nothing linked or provisioned", st.db.identities, len(st.db.users))
+	}
+	if roles := st.db.rolesOf(admin, "saml:corp"); len(roles) != 0 {
+		t.Fatalf("IdP roles = %v granted to the admin", roles)
+	}
+	if roles := st.db.rolesOf(admin, "local"); !slices.Equal(roles, []string{"admin"}) {
+		t.Fatalf("local roles = %v, want [admin] untouched", roles)
+	}
+	if len(st.db.events) != 0 {
+		t.Fatalf("audit events = %v, want none", st.db.events)
+	}
+}
+
+// TestSAMLLinkFromSession links the IdP to an account by its signed-in owner
+func TestSAMLLinkFromSession(t *testing.T) {
+	st := newSAMLTest(t)
+	alice := st.db.addUser(db.User{Email: "alice@example.com", FirstName: "Alice", Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+
+	st.principal = &auth.Principal{UserID: alice}
+	w := httptest.NewRecorder()
+	st.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/saml/corp/link", nil))
+	var resp struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusOK || err != nil ||
+		!strings.HasPrefix(resp.AuthorizationURL, st.cfg.IdPSSOURL+"?") {
+		t.Fatalf("LinkSAMLIdentity = %d: %s, want the IdP's URL", w.Code, w.Body)
+	}
+	if len(st.db.samlReqs) != 1 || st.db.samlReqs[0].LinkUserID != (uuid.NullUUID{UUID: alice, Valid: true}) {
+		t.Fatalf("requests = %+v, want one linking to alice", st.db.samlReqs)
+	}
+
+	st.link = st.db.samlReqs[0].LinkUserID
+	w = st.acs()
+	if want := testAppURL + "/account/identities?linked=saml%3Acorp"; w.Code != http.StatusFound || w.Header().Get("Location") != want {
+		t.Fatalf("completeSAMLLogin = %d to %q, want a redirect to %s", w.Code, w.Header().Get("Location"), want)
+	}
+	if len(st.db.identities) != 1 || st.db.identities[0].UserID != alice {
+		t.Fatalf("identities = %+v, want the NameID linked to alice", st.db.identities)
+	}
+	if !slices.Equal(st.db.events, []string{string(audit.IdentityLinked)}) {
+		t.Fatalf("audit events = %v", st.db.events)
+	}
+
+	st.link = uuid.NullUUID{}
+	signedIn(t, st.acs())
+	if len(st.db.users) != 1 {
+		t.Fatalf("%d users, want alice signed in through the link", len(st.db.users))
+	}
+}
+
+func TestFinishSAMLLoginWithoutRequest(t *testing.T) {
+	st := newSAMLTest(t)
+	form := url.Values{"SAMLResponse": {"PHNhbWxwOlJlc3BvbnNlLz4="}, "RelayState": {"forged"}}
+	req := httptest.NewRequest(http.MethodPost, "/saml/corp/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: samlRelayCookie, Value: "forged"})
+	w := httptest.NewRecorder()
+	st.router.ServeHTTP(w, req)
+	ssoFailed(t, w, "SSO_LOGIN_FAILED")
+}
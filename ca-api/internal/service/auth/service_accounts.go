@@ -0,0 +1,541 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAPIKeyTTL     = 90 * 24 * time.Hour
+	defaultAPIKeyOverlap = 24 * time.Hour
+)
+
+// Service accounts get an address under a reserved TLD, so it is unique per
+// name and nothing is ever delivered to it
+const serviceAccountEmailDomain = "@service-accounts.invalid"
+
+// CreateServiceAccount creates a user for automation that can only authenticate with API keys (admin)
+func (s *AuthService) CreateServiceAccount(c *gin.Context) {
+	var req auth.CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+	name := strings.ToLower(req.Name)
+	if !isServiceAccountName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Service account names may only contain letters, digits, dots, hyphens and underscores.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+	if !s.knownRoles(c, req.Roles) {
+		return
+	}
+
+	_, err := s.DB.GetUserByEmail(c, name+serviceAccountEmailDomain)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": gin.H{
+				"code":    "SERVICE_ACCOUNT_EXISTS",
+				"message": "A service account with this name already exists.",
+				"status":  http.StatusConflict,
+			},
+		})
+		return
+	}
+	var account db.User
+	if errors.Is(err, sql.ErrNoRows) {
+		account, err = s.createServiceAccount(c, name, req.Roles)
+	}
+	if err != nil {
+		log.Printf("CreateServiceAccount failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, serviceAccountInfo(account))
+}
+
+func (s *AuthService) createServiceAccount(c *gin.Context, name string, roles []string) (db.User, error) {
+	passwordHash, err := unusablePasswordHash(s.Peppers.CurrentID())
+	if err != nil {
+		return db.User{}, err
+	}
+
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return db.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	principal := middleware.CurrentPrincipal(c)
+	createdBy := uuid.NullUUID{UUID: principal.UserID, Valid: true}
+	account, err := q.CreateServiceAccount(c, db.CreateServiceAccountParams{
+		FirstName:    name,
+		LastName:     "",
+		Email:        name + serviceAccountEmailDomain,
+		PasswordHash: passwordHash,
+		CreatedBy:    createdBy,
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+	for _, role := range roles {
+		if err := grantRole(c, q, account.ID, role, createdBy); err != nil {
+			return db.User{}, err
+		}
+	}
+
+	err = auditlog.Record(c, q, audit.Event{
+		Type:      audit.ServiceAccountCreated,
+		ActorID:   principal.UserID,
+		SubjectID: account.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"name": name, "roles": roles},
+	})
+	if err != nil {
+		return db.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.User{}, err
+	}
+	return account, nil
+}
+
+// ListServiceAccounts lists every service account (admin)
+func (s *AuthService) ListServiceAccounts(c *gin.Context) {
+	accounts, err := s.DB.ListServiceAccounts(c)
+	if err != nil {
+		log.Printf("ListServiceAccounts failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	infos := make([]auth.ServiceAccountInfo, 0, len(accounts))
+	for _, account := range accounts {
+		infos = append(infos, serviceAccountInfo(account))
+	}
+	c.JSON(http.StatusOK, gin.H{"service_accounts": infos})
+}
+
+// CreateAPIKey issues a key for a service account. The secret is in this
+// response only. (admin)
+func (s *AuthService) CreateAPIKey(c *gin.Context) {
+	account, ok := s.serviceAccountParam(c)
+	if !ok {
+		return
+	}
+
+	var req auth.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+	if !s.grantablePermissions(c, account, req.Permissions) {
+		return
+	}
+
+	ttl := defaultAPIKeyTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	apiKey, key, err := s.createAPIKey(c, s.DB, db.CreateAPIKeyParams{
+		UserID:    account.ID,
+		Name:      req.Name,
+		CreatedBy: uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		ExpiresAt: time.Now().Add(ttl),
+	}, req.Permissions)
+	if err != nil {
+		log.Printf("CreateAPIKey failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	s.recordAudit(c, audit.Event{
+		Type:      audit.APIKeyCreated,
+		ActorID:   principal.UserID,
+		SubjectID: account.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"api_key_id": apiKey.ID, "prefix": apiKey.Prefix, "permissions": req.Permissions},
+	})
+	c.JSON(http.StatusCreated, auth.APIKeyResponse{APIKeyInfo: apiKeyInfo(apiKey), Key: key})
+}
+
+// ListAPIKeys lists a service account's keys, including expired and revoked ones (admin)
+func (s *AuthService) ListAPIKeys(c *gin.Context) {
+	account, ok := s.serviceAccountParam(c)
+	if !ok {
+		return
+	}
+
+	apiKeys, err := s.DB.ListAPIKeys(c, account.ID)
+	if err != nil {
+		log.Printf("ListAPIKeys failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	infos := make([]auth.APIKeyInfo, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		infos = append(infos, apiKeyInfo(apiKey))
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": infos})
+}
+
+// RotateAPIKey issues a replacement with the same name and permissions. The
+// old key keeps working until the overlap ends so pipelines can switch over
+// without downtime. (admin)
+func (s *AuthService) RotateAPIKey(c *gin.Context) {
+	account, ok := s.serviceAccountParam(c)
+	if !ok {
+		return
+	}
+	keyID, err := uuid.Parse(c.Param("keyID"))
+	if err != nil {
+		apiKeyNotFound(c)
+		return
+	}
+
+	var req auth.RotateAPIKeyRequest
+	// The body is optional; every field has a default
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": "Invalid input provided.",
+					"status":  http.StatusBadRequest,
+				},
+			})
+			return
+		}
+	}
+	overlap := defaultAPIKeyOverlap
+	if req.OverlapHours > 0 {
+		overlap = time.Duration(req.OverlapHours) * time.Hour
+	}
+	ttl := defaultAPIKeyTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	apiKey, key, err := s.rotateAPIKey(c, account, keyID, overlap, ttl)
+	if errors.Is(err, sql.ErrNoRows) {
+		apiKeyNotFound(c)
+		return
+	}
+	if err != nil {
+		log.Printf("RotateAPIKey failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, auth.APIKeyResponse{APIKeyInfo: apiKeyInfo(apiKey), Key: key})
+}
+
+func (s *AuthService) rotateAPIKey(c *gin.Context, account db.User, keyID uuid.UUID, overlap, ttl time.Duration) (db.ApiKey, string, error) {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	old, err := q.GetActiveAPIKey(c, db.GetActiveAPIKeyParams{ID: keyID, UserID: account.ID})
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	apiKey, key, err := s.createAPIKey(c, q, db.CreateAPIKeyParams{
+		UserID:      account.ID,
+		Name:        old.Name,
+		RotatedFrom: uuid.NullUUID{UUID: old.ID, Valid: true},
+		CreatedBy:   uuid.NullUUID{UUID: principal.UserID, Valid: true},
+		ExpiresAt:   time.Now().Add(ttl),
+	}, apiKeyPermissions(old))
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+	if err := q.ShortenAPIKey(c, db.ShortenAPIKeyParams{ID: old.ID, ExpiresAt: time.Now().Add(overlap)}); err != nil {
+		return db.ApiKey{}, "", err
+	}
+
+	err = auditlog.Record(c, q, audit.Event{
+		Type:      audit.APIKeyRotated,
+		ActorID:   principal.UserID,
+		SubjectID: account.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata: map[string]any{
+			"api_key_id":     apiKey.ID,
+			"prefix":         apiKey.Prefix,
+			"rotated_from":   old.ID,
+			"overlap_period": overlap.String(),
+		},
+	})
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.ApiKey{}, "", err
+	}
+	return apiKey, key, nil
+}
+
+// RevokeAPIKey stops a key working immediately (admin)
+func (s *AuthService) RevokeAPIKey(c *gin.Context) {
+	account, ok := s.serviceAccountParam(c)
+	if !ok {
+		return
+	}
+	keyID, err := uuid.Parse(c.Param("keyID"))
+	if err != nil {
+		apiKeyNotFound(c)
+		return
+	}
+
+	revoked, err := s.DB.RevokeAPIKey(c, db.RevokeAPIKeyParams{ID: keyID, UserID: account.ID})
+	if err != nil {
+		log.Printf("RevokeAPIKey failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if revoked == 0 {
+		apiKeyNotFound(c)
+		return
+	}
+
+	s.recordAudit(c, audit.Event{
+		Type:      audit.APIKeyRevoked,
+		ActorID:   middleware.CurrentPrincipal(c).UserID,
+		SubjectID: account.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"api_key_id": keyID},
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// createAPIKey generates a key and stores its hash with perms, returning the key itself
+func (s *AuthService) createAPIKey(c *gin.Context, q *db.Queries, params db.CreateAPIKeyParams, perms []auth.Permission) (db.ApiKey, string, error) {
+	key, prefix, secretHash, err := newAPIKey()
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+	params.Prefix = prefix
+	params.SecretHash = secretHash
+	if params.Permissions, err = json.Marshal(perms); err != nil {
+		return db.ApiKey{}, "", err
+	}
+
+	apiKey, err := q.CreateAPIKey(c, params)
+	if err != nil {
+		return db.ApiKey{}, "", err
+	}
+	return apiKey, key, nil
+}
+
+// grantablePermissions responds 400 and returns false unless every permission
+// exists and is granted to account by one of its roles
+func (s *AuthService) grantablePermissions(c *gin.Context, account db.User, perms []auth.Permission) bool {
+	granted, err := userPermissions(c, s.DB, account)
+	if err != nil {
+		log.Printf("ListUserRoles failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return false
+	}
+
+	for _, perm := range perms {
+		if !slices.Contains(auth.AllPermissions, perm) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "UNKNOWN_PERMISSION",
+					"message": "Unknown permission: " + string(perm),
+					"status":  http.StatusBadRequest,
+				},
+			})
+			return false
+		}
+		if !granted[perm] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"code":    "PERMISSION_NOT_GRANTED",
+					"message": "The service account's roles don't grant " + string(perm) + ".",
+					"status":  http.StatusBadRequest,
+				},
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// serviceAccountParam loads the service account named by the :id route parameter
+func (s *AuthService) serviceAccountParam(c *gin.Context) (db.User, bool) {
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		serviceAccountNotFound(c)
+		return db.User{}, false
+	}
+
+	account, err := s.DB.GetUserByID(c, accountID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && account.Kind != auth.UserKindService) {
+		serviceAccountNotFound(c)
+		return db.User{}, false
+	}
+	if err != nil {
+		log.Printf("GetUserByID failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return db.User{}, false
+	}
+	return account, true
+}
+
+func isServiceAccountName(name string) bool {
+	for _, r := range name {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func serviceAccountInfo(account db.User) auth.ServiceAccountInfo {
+	info := auth.ServiceAccountInfo{
+		ID:        account.ID.String(),
+		Name:      account.FirstName,
+		Status:    account.Status,
+		CreatedAt: account.CreatedAt,
+	}
+	if account.CreatedBy.Valid {
+		info.CreatedBy = account.CreatedBy.UUID.String()
+	}
+	return info
+}
+
+func apiKeyInfo(apiKey db.ApiKey) auth.APIKeyInfo {
+	info := auth.APIKeyInfo{
+		ID:          apiKey.ID.String(),
+		Name:        apiKey.Name,
+		Prefix:      auth.APIKeyPrefix + apiKey.Prefix,
+		Permissions: apiKeyPermissions(apiKey),
+		CreatedAt:   apiKey.CreatedAt,
+		ExpiresAt:   apiKey.ExpiresAt,
+	}
+	if apiKey.RotatedFrom.Valid {
+		info.RotatedFrom = apiKey.RotatedFrom.UUID.String()
+	}
+	if apiKey.LastUsedAt.Valid {
+		info.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	if apiKey.RevokedAt.Valid {
+		info.RevokedAt = &apiKey.RevokedAt.Time
+	}
+	return info
+}
+
+func serviceAccountNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"code":    "SERVICE_ACCOUNT_NOT_FOUND",
+			"message": "Service account not found.",
+			"status":  http.StatusNotFound,
+		},
+	})
+}
+
+func apiKeyNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"code":    "API_KEY_NOT_FOUND",
+			"message": "API key not found.",
+			"status":  http.StatusNotFound,
+		},
+	})
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/config"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ListMySessions lists the caller's active sessions
+func (s *AuthService) ListMySessions(c *gin.Context) {
+	principal := middleware.CurrentPrincipal(c)
+	s.listSessions(c, principal.UserID, principal.FamilyID)
+}
+
+// RevokeMySession logs one of the caller's sessions out
+func (s *AuthService) RevokeMySession(c *gin.Context) {
+	s.revokeSession(c, middleware.CurrentPrincipal(c).UserID, revokedByUser)
+}
+
+// RevokeAllMySessions logs the caller out everywhere, including this session
+func (s *AuthService) RevokeAllMySessions(c *gin.Context) {
+	if !s.revokeAllSessions(c, middleware.CurrentPrincipal(c).UserID, revokedByUser) {
+		return
+	}
+	config.ClearTokenCookies(c.Writer, config.DefaultCookieConfig())
+	c.Status(http.StatusNoContent)
+}
+
+// Logout revokes the session the access token belongs to
+func (s *AuthService) Logout(c *gin.Context) {
+	principal := middleware.CurrentPrincipal(c)
+	familyID, err := uuid.Parse(principal.FamilyID)
+	if err != nil {
+		invalidSession(c)
+		return
+	}
+
+	_, err = s.DB.RevokeUserSession(c, db.RevokeUserSessionParams{
+		ID:            familyID,
+		UserID:        principal.UserID,
+		RevokedReason: sql.NullString{String: revokedLogout, Valid: true},
+	})
+	if err != nil {
+		log.Printf("RevokeUserSession failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	s.invalidateFamily(familyID)
+
+	config.ClearTokenCookies(c.Writer, config.DefaultCookieConfig())
+	c.Status(http.StatusNoContent)
+}
+
+// ListUserSessions lists another user's active sessions (admin)
+func (s *AuthService) ListUserSessions(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	s.listSessions(c, userID, "")
+}
+
+// RevokeUserSession logs one of another user's sessions out (admin)
+func (s *AuthService) RevokeUserSession(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	s.revokeSession(c, userID, revokedByAdmin)
+}
+
+// RevokeAllUserSessions logs another user out everywhere (admin)
+func (s *AuthService) RevokeAllUserSessions(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	if s.revokeAllSessions(c, userID, revokedByAdmin) {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (s *AuthService) listSessions(c *gin.Context, userID uuid.UUID, currentFamilyID string) {
+	rows, err := s.DB.ListActiveSessionsByUser(c, db.ListActiveSessionsByUserParams{
+		UserID: userID,
+		// Sessions idle longer than a refresh token lives can't be resumed
+		SeenAfter: time.Now().Add(-s.JWT.RefreshExpiration()),
+	})
+	if err != nil {
+		log.Printf("ListActiveSessionsByUser failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	sessions := make([]auth.SessionInfo, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, auth.SessionInfo{
+			ID:         row.FamilyID.String(),
+			UserAgent:  row.UserAgent,
+			IPAddress:  row.IpAddress,
+			CreatedAt:  row.CreatedAt,
+			LastSeenAt: row.LastSeenAt,
+			Current:    row.FamilyID.String() == currentFamilyID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (s *AuthService) revokeSession(c *gin.Context, userID uuid.UUID, reason string) {
+	sessionID, err := uuid.Parse(c.Param("sessionID"))
+	if err != nil {
+		sessionNotFound(c)
+		return
+	}
+
+	revoked, err := s.DB.RevokeUserSession(c, db.RevokeUserSessionParams{
+		ID:            sessionID,
+		UserID:        userID,
+		RevokedReason: sql.NullString{String: reason, Valid: true},
+	})
+	if err != nil {
+		log.Printf("RevokeUserSession failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if revoked == 0 {
+		sessionNotFound(c)
+		return
+	}
+
+	s.invalidateFamily(sessionID)
+	c.Status(http.StatusNoContent)
+}
+
+func (s *AuthService) revokeAllSessions(c *gin.Context, userID uuid.UUID, reason string) bool {
+	familyIDs, err := s.DB.RevokeAllUserSessions(c, db.RevokeAllUserSessionsParams{
+		UserID:        userID,
+		RevokedReason: sql.NullString{String: reason, Valid: true},
+	})
+	if err != nil {
+		log.Printf("RevokeAllUserSessions failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return false
+	}
+
+	for _, id := range familyIDs {
+		s.invalidateFamily(id)
+	}
+	return true
+}
+
+func userIDParam(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "USER_NOT_FOUND",
+				"message": "User not found.",
+				"status":  http.StatusNotFound,
+			},
+		})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func sessionNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"code":    "SESSION_NOT_FOUND",
+			"message": "Session not found.",
+			"status":  http.StatusNotFound,
+		},
+	})
+}
+
+func invalidSession(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error": gin.H{
+			"code":    "UNAUTHORIZED",
+			"message": "Authentication required.",
+			"status":  http.StatusUnauthorized,
+		},
+	})
+}
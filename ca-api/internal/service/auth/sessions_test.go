@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/google/uuid"
+)
+
+// newSessionTest is a tokenTest with the session routes behind AuthRequired,
+// so revoked access tokens are refused the way they are in production
+func newSessionTest(t *testing.T) *tokenTest {
+	t.Helper()
+	tt := newTokenTest(t)
+	account := tt.router.Group("/", middleware.AuthRequired(tt.s.JWT, LoadPrincipal(tt.s.DB), LoadAPIKeyPrincipal(tt.s.DB)), middleware.SessionRequired())
+	account.POST("/logout", tt.s.Logout)
+	account.GET("/sessions", tt.s.ListMySessions)
+	account.DELETE("/sessions", tt.s.RevokeAllMySessions)
+	account.DELETE("/sessions/:sessionID", tt.s.RevokeMySession)
+	return tt
+}
+
+// call sends an empty request to path with tokens' access token
+func (tt *tokenTest) call(method, path string, tokens *auth.IssuedTokens) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	w := httptest.NewRecorder()
+	tt.router.ServeHTTP(w, req)
+	return w
+}
+
+// sessionIDs lists the session IDs tokens' owner sees as active
+func (tt *tokenTest) sessionIDs(tokens *auth.IssuedTokens) []string {
+	tt.t.Helper()
+	w := tt.call(http.MethodGet, "/sessions", tokens)
+	var resp struct{ Sessions []auth.SessionInfo }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); w.Code != http.StatusOK || err != nil {
+		tt.t.Fatalf("ListMySessions = %d: %s", w.Code, w.Body)
+	}
+	var ids []string
+	for _, s := range resp.Sessions {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+// checkSignedOut fails the test unless both of tokens are refused
+func (tt *tokenTest) checkSignedOut(name string, tokens *auth.IssuedTokens) {
+	tt.t.Helper()
+	if w := tt.call(http.MethodGet, "/sessions", tokens); w.Code != http.StatusUnauthorized {
+		tt.t.Fatalf("%s access token = %d: %s, want 401", name, w.Code, w.Body)
+	}
+	if w := tt.refresh(tokens.RefreshToken); w.Code != http.StatusUnauthorized {
+		tt.t.Fatalf("%s refresh token = %d: %s, want 401", name, w.Code, w.Body)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	tt := newSessionTest(t)
+	laptop, phone := tt.signIn(), tt.signIn()
+	if ids := tt.sessionIDs(laptop); len(ids) != 2 {
+		t.Fatalf("sessions = %v, want both", ids)
+	}
+
+	if w := tt.call(http.MethodPost, "/logout", laptop); w.Code != http.StatusNoContent {
+		t.Fatalf("Logout = %d: %s", w.Code, w.Body)
+	}
+	if family := tt.familyOf(laptop.RefreshToken); family.RevokedReason.String != revokedLogout {
+		t.Fatalf("family = %+v, want it revoked by the logout", family)
+	}
+	tt.checkSignedOut("logged out", laptop)
+
+	// The other session carries on
+	if ids := tt.sessionIDs(phone); len(ids) != 1 || ids[0] != tt.familyOf(phone.RefreshToken).ID.String() {
+		t.Fatalf("sessions = %v, want only the phone's", ids)
+	}
+	refreshed(t, tt.refresh(phone.RefreshToken))
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	tt := newSessionTest(t)
+	sessions := []*auth.IssuedTokens{tt.signIn(), tt.signIn(), tt.signIn()}
+	// A fresh access token from a refresh dies with its family too
+	rotated := tt.refresh(sessions[2].RefreshToken)
+	var resp auth.AuthResponse
+	if err := json.Unmarshal(rotated.Body.Bytes(), &resp); rotated.Code != http.StatusOK || err != nil {
+		t.Fatalf("Refresh = %d: %s", rotated.Code, rotated.Body)
+	}
+	sessions[2] = &auth.IssuedTokens{AccessToken: resp.Tokens.AccessToken, RefreshToken: resp.Tokens.RefreshToken}
+
+	if w := tt.call(http.MethodDelete, "/sessions", sessions[0]); w.Code != http.StatusNoContent {
+		t.Fatalf("RevokeAllMySessions = %d: %s", w.Code, w.Body)
+	}
+	for i, tokens := range sessions {
+		tt.checkSignedOut(fmt.Sprintf("session %d", i), tokens)
+	}
+
+	// Signing in again starts over
+	if ids := tt.sessionIDs(tt.signIn()); len(ids) != 1 {
+		t.Fatalf("sessions after signing in again = %v, want just the new one", ids)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	tt := newSessionTest(t)
+	laptop, lost := tt.signIn(), tt.signIn()
+	lostID := tt.familyOf(lost.RefreshToken).ID.String()
+
+	// Another user's session can't be revoked through this route
+	bob := tt.db.addUser(db.User{Email: "bob@example.com", Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+	bobs := db.RefreshTokenFamily{ID: uuid.New(), UserID: bob, CreatedAt: time.Now()}
+	tt.db.families = append(tt.db.families, bobs)
+	if w := tt.call(http.MethodDelete, "/sessions/"+bobs.ID.String(), laptop); w.Code != http.StatusNotFound {
+		t.Fatalf("RevokeMySession(bob's) = %d: %s, want 404", w.Code, w.Body)
+	}
+	if tt.db.family(bobs.ID).RevokedAt.Valid {
+		t.Fatal("bob's session was revoked")
+	}
+
+	if w := tt.call(http.MethodDelete, "/sessions/"+lostID, laptop); w.Code != http.StatusNoContent {
+		t.Fatalf("RevokeMySession = %d: %s", w.Code, w.Body)
+	}
+	tt.checkSignedOut("revoked", lost)
+	if w := tt.call(http.MethodDelete, "/sessions/"+lostID, laptop); w.Code != http.StatusNotFound {
+		t.Fatalf("RevokeMySession again = %d: %s, want 404", w.Code, w.Body)
+	}
+	if ids := tt.sessionIDs(laptop); len(ids) != 1 || ids[0] == lostID {
+		t.Fatalf("sessions = %v, want only the laptop's", ids)
+	}
+}
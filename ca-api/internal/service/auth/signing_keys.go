@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+)
+
+// SigningKeyStore keeps the JWT manager's signing keys in the database
+func SigningKeyStore(q *db.Queries) jwt.KeyStore {
+	return signingKeyStore{q: q}
+}
+
+type signingKeyStore struct {
+	q *db.Queries
+}
+
+func (s signingKeyStore) ListKeys(ctx context.Context) ([]jwt.StoredKey, error) {
+	rows, err := s.q.ListJWTSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]jwt.StoredKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, jwt.StoredKey{
+			ID:          row.Kid,
+			SealedKey:   row.PrivateKey,
+			CreatedAt:   row.CreatedAt,
+			ActivatedAt: row.ActivatedAt.Time, // zero while pending
+		})
+	}
+	return keys, nil
+}
+
+func (s signingKeyStore) AddKey(ctx context.Context, key jwt.StoredKey) (bool, error) {
+	added, err := s.q.CreateJWTSigningKey(ctx, db.CreateJWTSigningKeyParams{
+		Kid:         key.ID,
+		PrivateKey:  key.SealedKey,
+		ActivatedAt: sql.NullTime{Time: key.ActivatedAt, Valid: !key.ActivatedAt.IsZero()},
+	})
+	return added > 0, err
+}
+
+func (s signingKeyStore) ActivateKey(ctx context.Context, kid string) error {
+	return s.q.ActivateJWTSigningKey(ctx, kid)
+}
+
+func (s signingKeyStore) RetireKey(ctx context.Context, kid string) error {
+	return s.q.RetireJWTSigningKey(ctx, kid)
+}
+
+func (s signingKeyStore) ResealKey(ctx context.Context, kid, oldSealed, newSealed string) error {
+	return s.q.ResealJWTSigningKey(ctx, db.ResealJWTSigningKeyParams{
+		NewKey: newSealed,
+		Kid:    kid,
+		OldKey: oldSealed,
+	})
+}
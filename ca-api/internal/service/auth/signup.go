@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 
@@ -13,6 +15,17 @@ import (
 
 // Your existing signup function (looks good!)
 func (s *AuthService) Signup(c *gin.Context) {
+	if !s.OpenSignup {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"code":    "SIGNUP_DISABLED",
+				"message": "Signup is by invitation only.",
+				"status":  http.StatusForbidden,
+			},
+		})
+		return
+	}
+
 	var req auth.SignupRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -25,6 +38,14 @@ func (s *AuthService) Signup(c *gin.Context) {
 		return
 	}
 
+	if !s.checkNewPassword(c, "password", req.Password, db.User{
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+	}) {
+		return
+	}
+
 	emailUsr, err := s.DB.GetUserByEmail(c, req.Email)
 	if err != nil && err != sql.ErrNoRows {
 		// Only fatal for unexpected DB errors
@@ -51,7 +72,11 @@ func (s *AuthService) Signup(c *gin.Context) {
 		return
 	}
 
-	hashedPassword, err := hashPassword(req.Password)
+	hashedPassword, err := s.hashPassword(c, req.Password)
+	if errors.Is(err, ErrHashBusy) {
+		hashingBusy(c)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
@@ -63,7 +88,7 @@ func (s *AuthService) Signup(c *gin.Context) {
 		return
 	}
 
-	user, err := s.DB.CreateUser(c, db.CreateUserParams{
+	user, err := s.createUser(c, db.CreateUserParams{
 		FirstName:    req.FirstName,
 		LastName:     req.LastName,
 		Email:        req.Email,
@@ -71,7 +96,8 @@ func (s *AuthService) Signup(c *gin.Context) {
 		MfaSecret:    sql.NullString{},
 		MfaEnabled:   sql.NullBool{},
 		CreatedBy:    uuid.NullUUID{},
-	})
+		Status:       auth.UserStatusPending,
+	}, signupRole)
 
 	if err != nil {
 		log.Printf("CreateUser failed: %v", err)
@@ -85,8 +111,33 @@ func (s *AuthService) Signup(c *gin.Context) {
 		return
 	}
 
+	s.sendVerificationEmail(user)
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message":  "Congratulations! You've successfully registered",
+		"message":  "Congratulations! You've successfully registered. Check your email to verify your address before logging in.",
 		"username": user.FirstName + " " + user.LastName,
 	})
 }
+
+// createUser inserts the user and grants their initial role atomically
+func (s *AuthService) createUser(ctx context.Context, params db.CreateUserParams, role string) (db.User, error) {
+	tx, err := s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return db.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	user, err := q.CreateUser(ctx, params)
+	if err != nil {
+		return db.User{}, err
+	}
+	if err := grantRole(ctx, q, user.ID, role, params.CreatedBy); err != nil {
+		return db.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.User{}, err
+	}
+	return user, nil
+}
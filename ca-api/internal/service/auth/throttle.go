@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/notify"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// throttlePolicy: the first free failures cost nothing, then each one doubles
+// the wait, and at lockAt the key is locked out for lockFor
+type throttlePolicy struct {
+	free    int32
+	lockAt  int32
+	lockFor time.Duration
+}
+
+var (
+	// Keyed by email whether or not the account exists, so lockouts reveal nothing
+	accountThrottle = throttlePolicy{free: 3, lockAt: 10, lockFor: 30 * time.Minute}
+	// Looser, since offices and NATs share addresses
+	ipThrottle = throttlePolicy{free: 20, lockAt: 100, lockFor: time.Hour}
+	// Second-factor codes per user, across every challenge a known password can mint
+	mfaThrottle = throttlePolicy{free: 5, lockAt: 10, lockFor: 30 * time.Minute}
+)
+
+const (
+	throttleBaseDelay = time.Second
+	throttleMaxDelay  = 15 * time.Minute
+	// A streak of failures is forgotten after this long without another
+	throttleWindow = 24 * time.Hour
+)
+
+func (p throttlePolicy) blockedUntil(t db.LoginThrottle) time.Time {
+	switch {
+	case t.Failures >= p.lockAt:
+		return t.LastFailureAt.Add(p.lockFor)
+	case t.Failures <= p.free:
+		return time.Time{}
+	}
+	delay := throttleMaxDelay
+	if n := t.Failures - p.free - 1; n < 30 {
+		delay = min(throttleBaseDelay<<n, throttleMaxDelay)
+	}
+	return t.LastFailureAt.Add(delay)
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+func mfaThrottleKey(userID uuid.UUID) string {
+	return "mfa:" + userID.String()
+}
+
+// retryAfterError reports that a throttled caller must wait before trying again
+type retryAfterError struct {
+	wait time.Duration
+}
+
+func (e retryAfterError) Error() string {
+	return fmt.Sprintf("throttled for %s", e.wait)
+}
+
+// throttled is a counter an attempt is charged to
+type throttled struct {
+	key    string
+	policy throttlePolicy
+}
+
+// loginThrottles are the counters a sign-in attempt for email is charged to
+func loginThrottles(c *gin.Context, email string) (account, ip throttled) {
+	return throttled{accountThrottleKey(email), accountThrottle}, throttled{ipThrottleKey(c.ClientIP()), ipThrottle}
+}
+
+// reserveAttempt charges an attempt to every counter as a failure before the
+// credential is checked, so a burst of parallel requests can't all get in
+// under the limit. When a counter is still blocked nothing is charged and the
+// wait is returned instead. Callers refund the attempt if it succeeds.
+func (s *AuthService) reserveAttempt(ctx context.Context, counters ...throttled) ([]db.LoginThrottle, time.Duration, error) {
+	tx, err := s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	// Counters are always locked in the same order, so concurrent attempts can't deadlock
+	q := s.DB.WithTx(tx)
+	var wait time.Duration
+	for _, t := range counters {
+		if err := q.EnsureLoginThrottle(ctx, t.key); err != nil {
+			return nil, 0, err
+		}
+		row, err := q.GetLoginThrottleForUpdate(ctx, t.key)
+		if err != nil {
+			return nil, 0, err
+		}
+		wait = max(wait, time.Until(t.policy.blockedUntil(row)))
+	}
+	if wait > 0 {
+		return nil, wait, nil
+	}
+
+	resetBefore := time.Now().Add(-throttleWindow)
+	charged := make([]db.LoginThrottle, len(counters))
+	for i, t := range counters {
+		charged[i], err = q.RecordLoginFailure(ctx, db.RecordLoginFailureParams{Key: t.key, ResetBefore: resetBefore})
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return charged, 0, tx.Commit()
+}
+
+// refundAttempt takes back a reserved attempt that didn't turn out to be a failure
+func (s *AuthService) refundAttempt(ctx context.Context, counters ...throttled) {
+	for _, t := range counters {
+		if err := s.DB.RefundLoginAttempt(ctx, t.key); err != nil {
+			log.Printf("RefundLoginAttempt failed: %v", err)
+		}
+	}
+}
+
+// loginFailed reacts to a failed sign-in whose attempt reserveAttempt charged
+// to the account and IP counters, in that order
+func (s *AuthService) loginFailed(c *gin.Context, email string, charged []db.LoginThrottle) {
+	if charged[0].Failures == accountThrottle.lockAt {
+		s.accountLocked(c, email)
+	}
+	if ip := charged[1]; ip.Failures == ipThrottle.lockAt {
+		log.Printf("Login attempts from %s locked out after %d failures", c.ClientIP(), ip.Failures)
+		s.recordAudit(c, audit.Event{
+			Type:      audit.LoginLocked,
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Metadata:  map[string]any{"scope": "ip", "until": time.Now().Add(ipThrottle.lockFor)},
+		})
+	}
+
+	// Opportunistic cleanup of forgotten streaks
+	if err := s.DB.DeleteStaleLoginThrottles(c, time.Now().Add(-throttleWindow)); err != nil {
+		log.Printf("DeleteStaleLoginThrottles failed: %v", err)
+	}
+}
+
+// mfaLocked audits a second-factor lockout and tells the user, whose password is known to someone
+func (s *AuthService) mfaLocked(c *gin.Context, user db.User) {
+	log.Printf("MFA for user %s locked out after %d failures", user.ID, mfaThrottle.lockAt)
+	s.notifyUser(c, user, notify.Message{
+		Subject: "Your Signee account was temporarily locked",
+		Body:    "Someone signed in with your password but entered too many wrong verification codes, so sign-in is paused for a while. Change your password if this wasn't you.",
+	})
+	s.recordAudit(c, audit.Event{
+		Type:      audit.LoginLocked,
+		SubjectID: user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"scope": "mfa", "until": time.Now().Add(mfaThrottle.lockFor)},
+	})
+}
+
+// accountLocked audits a lockout and, if the account exists, tells its owner
+func (s *AuthService) accountLocked(c *gin.Context, email string) {
+	event := audit.Event{
+		Type:      audit.LoginLocked,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"scope": "account", "email": email, "until": time.Now().Add(accountThrottle.lockFor)},
+	}
+
+	user, err := s.DB.GetUserByEmail(c, email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("GetUserByEmail failed: %v", err)
+	}
+	if err == nil {
+		event.SubjectID = user.ID
+		s.notifyUser(c, user, notify.Message{
+			Subject: "Your Signee account was temporarily locked",
+			Body:    "There were too many failed sign-in attempts on your account, so sign-in is paused for a while. If this wasn't you, consider changing your password.",
+		})
+	}
+	s.recordAudit(c, event)
+}
+
+// clearLoginFailures forgets the account's failures after a correct password.
+// The IP counter only gets its reserved attempt back, so one valid account
+// can't launder guesses at others.
+func (s *AuthService) clearLoginFailures(c *gin.Context, email string) {
+	if err := s.DB.ClearLoginThrottle(c, accountThrottleKey(email)); err != nil {
+		log.Printf("ClearLoginThrottle failed: %v", err)
+	}
+}
+
+// UnlockUser clears a user's failed login attempts (admin)
+func (s *AuthService) UnlockUser(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := s.DB.GetUserByID(c, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"code":    "USER_NOT_FOUND",
+				"message": "User not found.",
+				"status":  http.StatusNotFound,
+			},
+		})
+		return
+	}
+	if err == nil {
+		err = s.DB.ClearLoginThrottle(c, accountThrottleKey(user.Email))
+	}
+	if err != nil {
+		log.Printf("UnlockUser failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+
+	s.recordAudit(c, audit.Event{
+		Type:      audit.LoginUnlocked,
+		ActorID:   middleware.CurrentPrincipal(c).UserID,
+		SubjectID: user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// recordAudit writes an event outside any transaction; failures are logged only
+func (s *AuthService) recordAudit(ctx context.Context, event audit.Event) {
+	if err := auditlog.Record(ctx, s.DB, event); err != nil {
+		log.Printf("audit %s failed: %v", event.Type, err)
+	}
+}
+
+// dummyPasswordHash gives unknown emails the same argon2 cost as real ones.
+// It skips the pepper, which costs one HMAC and doesn't show next to argon2.
+var dummyPasswordHash = sync.OnceValues(func() (string, error) {
+	return unusablePasswordHash(0)
+})
+
+func tooManyLoginAttempts(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": gin.H{
+			"code":    "TOO_MANY_ATTEMPTS",
+			"message": "Too many failed sign-in attempts. Please try again later.",
+			"status":  http.StatusTooManyRequests,
+		},
+	})
+}
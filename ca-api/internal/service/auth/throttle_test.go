@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+func TestThrottlePolicyBlockedUntil(t *testing.T) {
+	last := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, tc := range map[string]struct {
+		policy   throttlePolicy
+		failures int32
+		want     time.Duration // after last; 0 is not blocked
+	}{
+		"none":              {accountThrottle, 0, 0},
+		"free":              {accountThrottle, 3, 0},
+		"first delay":       {accountThrottle, 4, time.Second},
+		"doubling":          {accountThrottle, 6, 4 * time.Second},
+		"last before lock":  {accountThrottle, 9, 32 * time.Second},
+		"locked":            {accountThrottle, 10, 30 * time.Minute},
+		"past lock":         {accountThrottle, 12, 30 * time.Minute},
+		"ip free":           {ipThrottle, 20, 0},
+		"ip delay capped":   {ipThrottle, 99, throttleMaxDelay},
+		"ip locked":         {ipThrottle, 100, time.Hour},
+		"mfa first delay":   {mfaThrottle, 6, time.Second},
+		"mfa locked":        {mfaThrottle, 10, 30 * time.Minute},
+		"shift overflow":    {throttlePolicy{free: 0, lockAt: 100, lockFor: time.Hour}, 90, throttleMaxDelay},
+		"lock below delays": {throttlePolicy{free: 5, lockAt: 3, lockFor: time.Minute}, 3, time.Minute},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := tc.policy.blockedUntil(db.LoginThrottle{Failures: tc.failures, LastFailureAt: last})
+			want := time.Time{}
+			if tc.want > 0 {
+				want = last.Add(tc.want)
+			}
+			if !got.Equal(want) {
+				t.Fatalf("blockedUntil(%d failures) = %v, want %v", tc.failures, got, want)
+			}
+		})
+	}
+}
+
+// throttleTest signs in with passwords from one address against a fake database holding alice
+type throttleTest struct {
+	t      *testing.T
+	db     *fakeDB
+	router *gin.Engine
+}
+
+const (
+	throttleTestPassword = "correct horse battery staple"
+	throttleTestIP       = "192.0.2.1"
+)
+
+func newThrottleTest(t *testing.T) *throttleTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	fake, conn, queries := newFakeDB(t)
+
+	dir := t.TempDir()
+	jwtManager, err := jwt.NewJWTManager("signee", filepath.Join(dir, "jwt.pem"), filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &AuthService{Conn: conn, DB: queries, JWT: jwtManager, HashLimit: NewHashLimiter(1)}
+	hash, err := s.hashPassword(context.Background(), throttleTestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.addUser(db.User{Email: "alice@example.com", FirstName: "Alice", PasswordHash: hash, Status: auth.UserStatusActive, Kind: auth.UserKindHuman})
+
+	router := gin.New()
+	router.POST("/login", s.Login)
+	return &throttleTest{t: t, db: fake, router: router}
+}
+
+func (tt *throttleTest) login(email, password string) *httptest.ResponseRecorder {
+	tt.t.Helper()
+	body, err := json.Marshal(auth.LoginRequest{Email: email, Password: password})
+	if err != nil {
+		tt.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = throttleTestIP + ":40000"
+	w := httptest.NewRecorder()
+	tt.router.ServeHTTP(w, req)
+	return w
+}
+
+// wait moves every counter's failures d into the past, as if the caller had waited
+func (tt *throttleTest) wait(d time.Duration) {
+	for key, t := range tt.db.throttles {
+		t.LastFailureAt = t.LastFailureAt.Add(-d)
+		if t.PreviousFailureAt.Valid {
+			t.PreviousFailureAt.Time = t.PreviousFailureAt.Time.Add(-d)
+		}
+		tt.db.throttles[key] = t
+	}
+}
+
+func TestLoginLocksAccount(t *testing.T) {
+	tt := newThrottleTest(t)
+	account := accountThrottleKey("alice@example.com")
+
+	for n := int32(1); n <= accountThrottle.lockAt; n++ {
+		if w := tt.login("alice@example.com", "guess"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d = %d: %s, want 401", n, w.Code, w.Body)
+		}
+		if failures := tt.db.throttles[account].Failures; failures != n {
+			t.Fatalf("after attempt %d account failures = %d", n, failures)
+		}
+		if locked := slices.Contains(tt.db.events, string(audit.LoginLocked)); locked != (n == accountThrottle.lockAt) {
+			t.Fatalf("after attempt %d audit events = %v", n, tt.db.events)
+		}
+		tt.wait(throttleMaxDelay)
+	}
+
+	// The lock outlasts the longest delay and holds even for the right password
+	w := tt.login("alice@example.com", throttleTestPassword)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Login while locked = %d: %s, want 429 with Retry-After", w.Code, w.Body)
+	}
+	if failures := tt.db.throttles[account].Failures; failures != accountThrottle.lockAt {
+		t.Fatalf("account failures = %d, want a blocked attempt not charged", failures)
+	}
+
+	tt.wait(accountThrottle.lockFor)
+	if w := tt.login("alice@example.com", throttleTestPassword); w.Code != http.StatusOK {
+		t.Fatalf("Login after the lock = %d: %s", w.Code, w.Body)
+	}
+	if _, ok := tt.db.throttles[account]; ok {
+		t.Fatalf("account throttle = %+v, want it cleared by the right password", tt.db.throttles[account])
+	}
+}
+
+// TestLoginRefundsSuccess checks that a successful sign-in gives the address
+// back the attempt charged in advance, including the time it stamped
+func TestLoginRefundsSuccess(t *testing.T) {
+	tt := newThrottleTest(t)
+	ip := ipThrottleKey(throttleTestIP)
+
+	for range 4 {
+		tt.login("bob@example.com", "guess")
+		tt.wait(throttleMaxDelay)
+	}
+	before := tt.db.throttles[ip]
+
+	if w := tt.login("alice@example.com", throttleTestPassword); w.Code != http.StatusOK {
+		t.Fatalf("Login = %d: %s", w.Code, w.Body)
+	}
+	after := tt.db.throttles[ip]
+	if after.Failures != before.Failures || !after.LastFailureAt.Equal(before.LastFailureAt) {
+		t.Fatalf("ip throttle = %d failures at %v, want %d at %v restored",
+			after.Failures, after.LastFailureAt, before.Failures, before.LastFailureAt)
+	}
+	if _, ok := tt.db.throttles[accountThrottleKey("bob@example.com")]; !ok {
+		t.Fatal("another account's failures were cleared")
+	}
+}
+
+// TestLoginLocksAddress checks that guesses spread across accounts still add
+// up against the address they come from
+func TestLoginLocksAddress(t *testing.T) {
+	tt := newThrottleTest(t)
+	ip := ipThrottleKey(throttleTestIP)
+	tt.db.throttles[ip] = db.LoginThrottle{Key: ip, Failures: ipThrottle.lockAt - 1, LastFailureAt: time.Now().Add(-time.Hour)}
+
+	if w := tt.login("carol@example.com", "guess"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Login = %d: %s, want 401", w.Code, w.Body)
+	}
+	if failures := tt.db.throttles[ip].Failures; failures != ipThrottle.lockAt {
+		t.Fatalf("ip failures = %d, want %d", failures, ipThrottle.lockAt)
+	}
+	if !slices.Contains(tt.db.events, string(audit.LoginLocked)) {
+		t.Fatalf("audit events = %v, want the lockout recorded", tt.db.events)
+	}
+
+	// A different, untouched account is still refused from that address
+	w := tt.login("alice@example.com", throttleTestPassword)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Login from a locked address = %d: %s, want 429", w.Code, w.Body)
+	}
+	if failures := tt.db.throttles[accountThrottleKey("alice@example.com")].Failures; failures != 0 {
+		t.Fatalf("alice's failures = %d, want none charged", failures)
+	}
+}
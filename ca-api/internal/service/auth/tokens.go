@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Reasons recorded when a refresh token family is revoked
+const (
+	revokedReuseDetected = "reuse_detected"
+	revokedLogout        = "logout"
+	revokedByUser        = "revoked_by_user"
+	revokedByAdmin       = "revoked_by_admin"
+)
+
+// Longest User-Agent kept on a session
+const maxUserAgentLen = 512
+
+// startTokenFamily opens a new refresh token family for a fresh login and issues its first pair
+func (s *AuthService) startTokenFamily(c *gin.Context, user db.User) (*auth.IssuedTokens, error) {
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := s.DB.WithTx(tx)
+	family, err := q.CreateRefreshTokenFamily(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.CreateSession(c, db.CreateSessionParams{
+		FamilyID:  family.ID,
+		UserID:    user.ID,
+		UserAgent: userAgent(c),
+		IpAddress: c.ClientIP(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.issueTokens(c, q, user, family.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// issueTokens signs a new pair and records the refresh token so it can only be used once
+func (s *AuthService) issueTokens(c *gin.Context, q *db.Queries, user db.User, familyID uuid.UUID) (*auth.IssuedTokens, error) {
+	role, err := roleClaim(c, q, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.JWT.GenerateTokens(user.ID.String(), user.Email, role, familyID.String(), c.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.CreateRefreshToken(c, db.CreateRefreshTokenParams{
+		Jti:       tokens.RefreshJTI,
+		FamilyID:  familyID,
+		ExpiresAt: tokens.RefreshExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// revokeFamily ends every token descended from the same login.
+// Call invalidateFamily once the revocation is committed.
+func revokeFamily(ctx context.Context, q *db.Queries, familyID uuid.UUID, reason string) error {
+	return q.RevokeRefreshTokenFamily(ctx, db.RevokeRefreshTokenFamilyParams{
+		ID:            familyID,
+		RevokedReason: sql.NullString{String: reason, Valid: true},
+	})
+}
+
+// invalidateFamily drops any cached "not revoked" answer so access tokens die now
+func (s *AuthService) invalidateFamily(familyID uuid.UUID) {
+	if rc := s.JWT.Revocations(); rc != nil {
+		rc.Invalidate(familyID.String())
+	}
+}
+
+// FamilyRevocationLookup answers revocation checks for the JWT manager from the database
+func FamilyRevocationLookup(q *db.Queries) func(ctx context.Context, familyID string) (bool, error) {
+	return func(ctx context.Context, familyID string) (bool, error) {
+		id, err := uuid.Parse(familyID)
+		if err != nil {
+			return true, nil
+		}
+		revoked, err := q.IsRefreshTokenFamilyRevoked(ctx, id)
+		if err == sql.ErrNoRows {
+			return true, nil
+		}
+		return revoked, err
+	}
+}
+
+func userAgent(c *gin.Context) string {
+	ua := c.Request.UserAgent()
+	if len(ua) > maxUserAgentLen {
+		ua = ua[:maxUserAgentLen]
+	}
+	return ua
+}
+
+// tokenPair wraps freshly issued tokens for the response body
+func (s *AuthService) tokenPair(tokens *auth.IssuedTokens) *auth.TokenPair {
+	expiresIn := s.JWT.AccessExpiration()
+	return &auth.TokenPair{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		TokenType:    tokens.TokenType,
+		ExpiresIn:    int(expiresIn.Seconds()),
+		ExpiresAt:    time.Now().Add(expiresIn),
+	}
+}
+
+func userInfo(user db.User) *auth.UserInfo {
+	return &auth.UserInfo{
+		ID:        user.ID.String(),
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+)
+
+// The SHA-1 test vectors from RFC 6238 appendix B, cut to our six digits
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		if got := totpCode(key, unix/totpPeriod); got != want {
+			t.Errorf("totpCode(T=%d) = %s, want %s", unix, got, want)
+		}
+		step, ok := verifyTOTP(secret, want, time.Unix(unix, 0))
+		if !ok || step != unix/totpPeriod {
+			t.Errorf("verifyTOTP(T=%d) = %d, %v; want step %d", unix, step, ok, unix/totpPeriod)
+		}
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	for name, tc := range map[string]struct {
+		code string
+		want bool
+	}{
+		"previous step":  {totpCode(key, current-1), true},
+		"next step":      {totpCode(key, current+1), true},
+		"two steps back": {totpCode(key, current-2), false},
+		"two steps on":   {totpCode(key, current+2), false},
+		"too short":      {totpCode(key, current)[1:], false},
+		"too long":       {totpCode(key, current) + "0", false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := verifyTOTP(secret, tc.code, now); ok != tc.want {
+				t.Fatalf("verifyTOTP(%q) = %v, want %v", tc.code, ok, tc.want)
+			}
+		})
+	}
+}
+
+// enrollTOTP gives alice a TOTP secret and returns its key
+func (m *mfaTest) enrollTOTP() []byte {
+	m.t.Helper()
+	key := []byte("12345678901234567890")
+	sealed, err := m.s.JWT.EncryptSecret([]byte(totpEncoding.EncodeToString(key)))
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	for i := range m.db.users {
+		if m.db.users[i].ID == m.alice {
+			m.db.users[i].MfaSecret = sql.NullString{String: sealed, Valid: true}
+		}
+	}
+	return key
+}
+
+// wrongTOTP is a code that doesn't match any step verifyTOTP accepts now
+func wrongTOTP(key []byte) string {
+	current := time.Now().Unix() / totpPeriod
+	valid := []string{totpCode(key, current-1), totpCode(key, current), totpCode(key, current+1)}
+	for n := 0; ; n++ {
+		if guess := fmt.Sprintf("%0*d", totpDigits, n); !slices.Contains(valid, guess) {
+			return guess
+		}
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	m := newMFATest(t, nil)
+	key := m.enrollTOTP()
+
+	code := totpCode(key, time.Now().Unix()/totpPeriod)
+	if w := m.verify(auth.MFAVerifyRequest{Code: code}); w.Code != http.StatusOK {
+		t.Fatalf("VerifyMFA = %d: %s", w.Code, w.Body)
+	}
+	// A fresh challenge doesn't make the same step usable again
+	w := m.verify(auth.MFAVerifyRequest{Code: code})
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_MFA_CODE") {
+		t.Fatalf("VerifyMFA replayed = %d: %s, want 401 INVALID_MFA_CODE", w.Code, w.Body)
+	}
+}
+
+// TestMFAChallengeAttemptCap checks that a challenge dies after
+// mfaChallengeMaxAttempts wrong codes, even if the next one is right
+func TestMFAChallengeAttemptCap(t *testing.T) {
+	m := newMFATest(t, nil)
+	key := m.enrollTOTP()
+	challenge := m.challenge()
+
+	for n := range mfaChallengeMaxAttempts {
+		w := m.verify(auth.MFAVerifyRequest{MFAChallenge: challenge, Code: wrongTOTP(key)})
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_MFA_CODE") {
+			t.Fatalf("attempt %d = %d: %s, want 401 INVALID_MFA_CODE", n+1, w.Code, w.Body)
+		}
+	}
+	if attempts := m.db.challenges[0].Attempts; attempts != mfaChallengeMaxAttempts {
+		t.Fatalf("challenge attempts = %d, want %d", attempts, mfaChallengeMaxAttempts)
+	}
+
+	w := m.verify(auth.MFAVerifyRequest{MFAChallenge: challenge, Code: totpCode(key, time.Now().Unix()/totpPeriod)})
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_MFA_CHALLENGE") {
+		t.Fatalf("attempt after the cap = %d: %s, want 401 INVALID_MFA_CHALLENGE", w.Code, w.Body)
+	}
+}
+
+// TestMFAThrottleLocks checks that the per-user counter outlives challenges,
+// so minting new ones with the known password doesn't buy more guesses
+func TestMFAThrottleLocks(t *testing.T) {
+	m := newMFATest(t, nil)
+	key := m.enrollTOTP()
+	counter := mfaThrottleKey(m.alice)
+	m.db.throttles[counter] = db.LoginThrottle{Key: counter, Failures: mfaThrottle.lockAt - 1, LastFailureAt: time.Now().Add(-time.Hour)}
+
+	if w := m.verify(auth.MFAVerifyRequest{Code: wrongTOTP(key)}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("VerifyMFA = %d: %s, want 401", w.Code, w.Body)
+	}
+	if !slices.Contains(m.db.events, string(audit.LoginLocked)) {
+		t.Fatalf("audit events = %v, want the lockout recorded", m.db.events)
+	}
+
+	w := m.verify(auth.MFAVerifyRequest{Code: totpCode(key, time.Now().Unix()/totpPeriod)})
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("VerifyMFA while locked = %d: %s, want 429 with Retry-After", w.Code, w.Body)
+	}
+}
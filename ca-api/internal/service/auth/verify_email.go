@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/mail"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestEmailVerification resends the verification email. The response is the
+// same whether or not the address belongs to a pending account.
+func (s *AuthService) RequestEmailVerification(c *gin.Context) {
+	var req auth.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	user, err := s.DB.GetUserByEmail(c, req.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("GetUserByEmail failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if err == nil && user.Status == auth.UserStatusPending {
+		s.sendVerificationEmail(user)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If that address belongs to an unverified account, a verification email is on its way.",
+	})
+}
+
+// VerifyEmail activates the account a verification token was sent to
+func (s *AuthService) VerifyEmail(c *gin.Context) {
+	var req auth.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid input provided.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	user, err := s.readEmailToken(c, req.Token, tokenVerifyEmail)
+	if errors.Is(err, errInvalidEmailToken) {
+		invalidEmailToken(c)
+		return
+	}
+	var activated int64
+	if err == nil {
+		activated, err = s.DB.ActivateUser(c, user.ID)
+	}
+	if err != nil {
+		log.Printf("VerifyEmail failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong. Please try again later.",
+				"status":  http.StatusInternalServerError,
+			},
+		})
+		return
+	}
+	if activated == 0 {
+		invalidEmailToken(c)
+		return
+	}
+
+	s.recordAudit(c, audit.Event{
+		Type:      audit.EmailVerified,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	c.Status(http.StatusNoContent)
+}
+
+func (s *AuthService) sendVerificationEmail(user db.User) {
+	token, err := s.signEmailToken(tokenVerifyEmail, user, verifyEmailTokenTTL)
+	if err != nil {
+		log.Printf("signEmailToken failed: %v", err)
+		return
+	}
+	s.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Signee email address",
+		Body: "Hi " + user.FirstName + ",\n\n" +
+			"Confirm this is your email address to finish setting up your Signee account:\n\n" +
+			s.AppURL + "/verify-email?token=" + url.QueryEscape(token) + "\n\n" +
+			"The link expires in 48 hours. If you didn't sign up, you can ignore this email.\n",
+	})
+}
+
+func invalidEmailToken(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_TOKEN",
+			"message": "The link is invalid or has expired. Please request a new one.",
+			"status":  http.StatusBadRequest,
+		},
+	})
+}
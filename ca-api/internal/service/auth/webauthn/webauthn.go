@@ -0,0 +1,411 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/webauthn"
+)
+
+// Authenticator data flags (WebAuthn §6.1)
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagAttestedData   = 0x40
+)
+
+// Attestation types recorded with a credential
+const (
+	AttestationNone       = "none"       // authenticator made no claim about itself
+	AttestationSelf       = "self"       // signed by the credential key itself
+	AttestationBasic      = "basic"      // signed by an attestation certificate (chain not checked)
+	AttestationUnverified = "unverified" // format we don't validate; treated like none
+)
+
+// id-fido-gen-ce-aaguid: certificate extension that must match the authenticator's AAGUID
+var oidFIDOAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+var ErrVerification = errors.New("webauthn verification failed")
+
+// RelyingParty holds the identity browsers bind credentials to
+type RelyingParty struct {
+	ID      string   // registrable domain, e.g. "signee.example.com"
+	Name    string   // shown by the browser during registration
+	Origins []string // exact origins the ceremonies may come from
+}
+
+// Credential is what registration yields and the server must store
+type Credential struct {
+	ID                []byte
+	PublicKey         []byte // COSE_Key, as produced by the authenticator
+	SignCount         uint32
+	AAGUID            []byte
+	AttestationFormat string
+	AttestationType   string
+	BackupEligible    bool
+	UserVerified      bool
+}
+
+// Assertion is the verified outcome of an authentication ceremony
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// NewChallenge returns a fresh random challenge
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %v", err)
+	}
+	return challenge, nil
+}
+
+// Encode and Decode convert binary values to and from the JSON wire form
+func Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func Decode(s string) ([]byte, error) {
+	// Some clients pad; accept both
+	return base64.RawURLEncoding.DecodeString(trimPadding(s))
+}
+
+func trimPadding(s string) string {
+	for len(s) > 0 && s[len(s)-1] == '=' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// Challenge extracts the challenge a response claims to answer so the server
+// can look up the matching ceremony. Nothing is trusted until Verify* succeeds.
+func Challenge(clientDataJSON string) ([]byte, error) {
+	raw, err := Decode(clientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrVerification)
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrVerification)
+	}
+	challenge, err := Decode(cd.Challenge)
+	if err != nil || len(challenge) == 0 {
+		return nil, fmt.Errorf("%w: malformed challenge", ErrVerification)
+	}
+	return challenge, nil
+}
+
+// VerifyRegistration runs the registration ceremony checks (WebAuthn §7.1)
+func (rp *RelyingParty) VerifyRegistration(resp webauthn.CreationResponse, challenge []byte, requireUV bool) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrVerification)
+	}
+
+	clientDataJSON, err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAtt, err := Decode(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrVerification)
+	}
+	v, n, err := decodeCBOR(rawAtt)
+	if err != nil || n != len(rawAtt) {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrVerification)
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrVerification)
+	}
+	format, _ := att["fmt"].(string)
+	attStmt, _ := att["attStmt"].(map[any]any)
+	rawAuthData, _ := att["authData"].([]byte)
+	if format == "" || attStmt == nil || rawAuthData == nil {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrVerification)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrVerification)
+	}
+
+	rawID, err := Decode(resp.RawID)
+	if err != nil || !bytes.Equal(rawID, authData.credentialID) {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+	if len(authData.credentialID) > 1023 {
+		return nil, fmt.Errorf("%w: credential id too long", ErrVerification)
+	}
+
+	credKey, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	attType, err := verifyAttestation(format, attStmt, rawAuthData, clientDataHash[:], authData, credKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:                authData.credentialID,
+		PublicKey:         authData.publicKey,
+		SignCount:         authData.signCount,
+		AAGUID:            authData.aaguid,
+		AttestationFormat: format,
+		AttestationType:   attType,
+		BackupEligible:    authData.flags&flagBackupEligible != 0,
+		UserVerified:      authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion runs the authentication ceremony checks (WebAuthn §7.2)
+// against a stored credential. Callers must persist the returned sign count.
+func (rp *RelyingParty) VerifyAssertion(resp webauthn.AssertionCredential, challenge, storedPublicKey []byte, storedSignCount uint32, requireUV bool) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrVerification)
+	}
+
+	clientDataJSON, err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := Decode(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed authenticator data", ErrVerification)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+
+	sig, err := Decode(resp.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrVerification)
+	}
+	key, err := parsePublicKey(storedPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("stored public key is invalid: %v", err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := key.verify(slices.Concat(rawAuthData, clientDataHash[:]), sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	// A counter that fails to advance means the key may have been cloned.
+	// Authenticators that don't keep counters (most synced passkeys) always send 0.
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return nil, fmt.Errorf("%w: sign counter did not increase", ErrVerification)
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// verifyClientData checks type, challenge and origin and returns the raw JSON for hashing
+func (rp *RelyingParty) verifyClientData(encoded, wantType string, challenge []byte) ([]byte, error) {
+	raw, err := Decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrVerification)
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrVerification)
+	}
+	if cd.Type != wantType {
+		return nil, fmt.Errorf("%w: unexpected ceremony type %q", ErrVerification, cd.Type)
+	}
+	got, err := Decode(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return nil, fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return nil, fmt.Errorf("%w: unexpected origin %q", ErrVerification, cd.Origin)
+	}
+	return raw, nil
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(authData *authenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rpIDHash[:]) != 1 {
+		return fmt.Errorf("%w: relying party id mismatch", ErrVerification)
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrVerification)
+	}
+	if requireUV && authData.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrVerification)
+	}
+	return nil
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrVerification)
+	}
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data too short", ErrVerification)
+	}
+	authData.aaguid = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return nil, fmt.Errorf("%w: credential id truncated", ErrVerification)
+	}
+	authData.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	// The key is followed by extensions, if any, so its length comes from CBOR itself
+	_, n, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed credential public key", ErrVerification)
+	}
+	authData.publicKey = rest[:n]
+	return authData, nil
+}
+
+// verifyAttestation checks the attestation statement (WebAuthn §8) and reports its type
+func verifyAttestation(format string, attStmt map[any]any, rawAuthData, clientDataHash []byte, authData *authenticatorData, credKey *publicKey) (string, error) {
+	signed := slices.Concat(rawAuthData, clientDataHash)
+
+	switch format {
+	case "none":
+		if len(attStmt) != 0 {
+			return "", fmt.Errorf("%w: none attestation with a statement", ErrVerification)
+		}
+		return AttestationNone, nil
+
+	case "packed":
+		alg, _ := attStmt["alg"].(int64)
+		sig, _ := attStmt["sig"].([]byte)
+		if sig == nil {
+			return "", fmt.Errorf("%w: packed attestation missing signature", ErrVerification)
+		}
+		x5c, hasCerts := attStmt["x5c"].([]any)
+		if !hasCerts {
+			if alg != credKey.alg {
+				return "", fmt.Errorf("%w: self attestation algorithm mismatch", ErrVerification)
+			}
+			if err := credKey.verify(signed, sig); err != nil {
+				return "", fmt.Errorf("%w: self attestation: %v", ErrVerification, err)
+			}
+			return AttestationSelf, nil
+		}
+
+		cert, err := leafCertificate(x5c)
+		if err != nil {
+			return "", err
+		}
+		if err := verifySignature(alg, cert.PublicKey, signed, sig); err != nil {
+			return "", fmt.Errorf("%w: packed attestation: %v", ErrVerification, err)
+		}
+		if cert.IsCA {
+			return "", fmt.Errorf("%w: attestation certificate is a CA", ErrVerification)
+		}
+		for _, ext := range cert.Extensions {
+			if !ext.Id.Equal(oidFIDOAAGUID) {
+				continue
+			}
+			var aaguid []byte
+			if _, err := asn1.Unmarshal(ext.Value, &aaguid); err != nil || !bytes.Equal(aaguid, authData.aaguid) {
+				return "", fmt.Errorf("%w: attestation certificate AAGUID mismatch", ErrVerification)
+			}
+		}
+		return AttestationBasic, nil
+
+	case "fido-u2f":
+		sig, _ := attStmt["sig"].([]byte)
+		x5c, _ := attStmt["x5c"].([]any)
+		if sig == nil || len(x5c) != 1 {
+			return "", fmt.Errorf("%w: malformed fido-u2f attestation", ErrVerification)
+		}
+		cert, err := leafCertificate(x5c)
+		if err != nil {
+			return "", err
+		}
+		ecKey, ok := credKey.key.(*ecdsa.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("%w: fido-u2f requires a P-256 credential", ErrVerification)
+		}
+		point, err := ecKey.Bytes()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrVerification, err)
+		}
+		u2fSigned := slices.Concat([]byte{0}, authData.rpIDHash, clientDataHash, authData.credentialID, point)
+		if err := verifySignature(AlgES256, cert.PublicKey, u2fSigned, sig); err != nil {
+			return "", fmt.Errorf("%w: fido-u2f attestation: %v", ErrVerification, err)
+		}
+		return AttestationBasic, nil
+	}
+
+	// tpm, android-key, apple, ...: accepted without checking the statement,
+	// which the spec permits for relying parties that don't act on attestation
+	return AttestationUnverified, nil
+}
+
+func leafCertificate(x5c []any) (*x509.Certificate, error) {
+	if len(x5c) == 0 {
+		return nil, fmt.Errorf("%w: empty certificate chain", ErrVerification)
+	}
+	der, ok := x5c[0].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed certificate chain", ErrVerification)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attestation certificate: %v", ErrVerification, err)
+	}
+	return cert, nil
+}
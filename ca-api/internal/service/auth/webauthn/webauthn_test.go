@@ -0,0 +1,325 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/webauthn"
+)
+
+var testRP = &RelyingParty{
+	ID:      "signee.example.com",
+	Name:    "Signee",
+	Origins: []string{"https://signee.example.com"},
+}
+
+// softAuthenticator is a P-256 authenticator in software, producing the same
+// structures a browser hands back from navigator.credentials
+type softAuthenticator struct {
+	t         *testing.T
+	key       *ecdsa.PrivateKey
+	attestKey *ecdsa.PrivateKey // signs the self attestation instead of key when set
+	id        []byte
+	rpID      string
+	origin    string
+	flags     byte
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{
+		t:      t,
+		key:    key,
+		id:     id,
+		rpID:   testRP.ID,
+		origin: testRP.Origins[0],
+		flags:  flagUserPresent | flagUserVerified,
+	}
+}
+
+// coseKey is the credential public key as a COSE_Key
+func (a *softAuthenticator) coseKey() []byte {
+	point, err := a.key.PublicKey.Bytes()
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return []byte(cborMap(
+		int64(coseKty), int64(coseKtyEC2),
+		int64(coseAlg), AlgES256,
+		int64(coseCrv), int64(coseCrvP256),
+		int64(coseX), point[1:33],
+		int64(coseY), point[33:],
+	))
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append(rpIDHash[:], a.flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+	data[32] |= flagAttestedData
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.id)))
+	data = append(data, a.id...)
+	return append(data, a.coseKey()...)
+}
+
+func (a *softAuthenticator) clientData(typ string, challenge []byte) []byte {
+	raw, err := json.Marshal(clientData{Type: typ, Challenge: Encode(challenge), Origin: a.origin})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return raw
+}
+
+func (a *softAuthenticator) sign(key *ecdsa.PrivateKey, authData, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(slices.Concat(authData, clientDataHash[:]))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return sig
+}
+
+// create registers the credential with packed self attestation
+func (a *softAuthenticator) create(challenge []byte) webauthn.CreationResponse {
+	authData := a.authData(true)
+	clientDataJSON := a.clientData("webauthn.create", challenge)
+	attestKey := a.key
+	if a.attestKey != nil {
+		attestKey = a.attestKey
+	}
+	attObj := cborMap(
+		"fmt", "packed",
+		"attStmt", cborMap("alg", AlgES256, "sig", a.sign(attestKey, authData, clientDataJSON)),
+		"authData", authData,
+	)
+	return webauthn.CreationResponse{
+		ID:    Encode(a.id),
+		RawID: Encode(a.id),
+		Type:  "public-key",
+		Response: webauthn.AttestationResponse{
+			ClientDataJSON:    Encode(clientDataJSON),
+			AttestationObject: Encode(attObj),
+		},
+	}
+}
+
+// get answers an authentication ceremony, advancing the counter first
+func (a *softAuthenticator) get(challenge []byte) webauthn.AssertionCredential {
+	a.signCount++
+	authData := a.authData(false)
+	clientDataJSON := a.clientData("webauthn.get", challenge)
+	return webauthn.AssertionCredential{
+		ID:    Encode(a.id),
+		RawID: Encode(a.id),
+		Type:  "public-key",
+		Response: webauthn.AssertionResponse{
+			ClientDataJSON:    Encode(clientDataJSON),
+			AuthenticatorData: Encode(authData),
+			Signature:         Encode(a.sign(a.key, authData, clientDataJSON)),
+		},
+	}
+}
+
+func newTestChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func register(t *testing.T, a *softAuthenticator) *Credential {
+	t.Helper()
+	challenge := newTestChallenge(t)
+	cred, err := testRP.VerifyRegistration(a.create(challenge), challenge, true)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() = %v", err)
+	}
+	return cred
+}
+
+func TestRegistration(t *testing.T) {
+	a := newSoftAuthenticator(t)
+	cred := register(t, a)
+	if !slices.Equal(cred.ID, a.id) || !slices.Equal(cred.PublicKey, a.coseKey()) {
+		t.Fatal("credential doesn't match the authenticator")
+	}
+	if cred.AttestationFormat != "packed" || cred.AttestationType != AttestationSelf || !cred.UserVerified {
+		t.Fatalf("credential = %+v, want packed self attestation with UV", cred)
+	}
+
+	for name, tc := range map[string]struct {
+		change    func(a *softAuthenticator)
+		requireUV bool
+		challenge []byte
+	}{
+		"other challenge": {challenge: []byte("not the issued challenge")},
+		"other origin":    {change: func(a *softAuthenticator) { a.origin = "https://evil.example.com" }},
+		"other rp id":     {change: func(a *softAuthenticator) { a.rpID = "evil.example.com" }},
+		"not present":     {change: func(a *softAuthenticator) { a.flags = flagUserVerified }},
+		"not verified":    {change: func(a *softAuthenticator) { a.flags = flagUserPresent }, requireUV: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := newSoftAuthenticator(t)
+			if tc.change != nil {
+				tc.change(a)
+			}
+			challenge := newTestChallenge(t)
+			resp := a.create(challenge)
+			if tc.challenge != nil {
+				challenge = tc.challenge
+			}
+			if _, err := testRP.VerifyRegistration(resp, challenge, tc.requireUV); !errors.Is(err, ErrVerification) {
+				t.Fatalf("VerifyRegistration() = %v, want ErrVerification", err)
+			}
+		})
+	}
+
+	t.Run("forged self attestation", func(t *testing.T) {
+		a := newSoftAuthenticator(t)
+		a.attestKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		challenge := newTestChallenge(t)
+		if _, err := testRP.VerifyRegistration(a.create(challenge), challenge, false); !errors.Is(err, ErrVerification) {
+			t.Fatalf("VerifyRegistration() = %v, want ErrVerification", err)
+		}
+	})
+}
+
+func TestAssertion(t *testing.T) {
+	a := newSoftAuthenticator(t)
+	cred := register(t, a)
+
+	challenge := newTestChallenge(t)
+	got, err := testRP.VerifyAssertion(a.get(challenge), challenge, cred.PublicKey, cred.SignCount, true)
+	if err != nil {
+		t.Fatalf("VerifyAssertion() = %v", err)
+	}
+	if got.SignCount != a.signCount || !got.UserVerified {
+		t.Fatalf("assertion = %+v, want sign count %d with UV", got, a.signCount)
+	}
+
+	t.Run("other challenge", func(t *testing.T) {
+		resp := a.get(newTestChallenge(t))
+		if _, err := testRP.VerifyAssertion(resp, challenge, cred.PublicKey, got.SignCount, false); !errors.Is(err, ErrVerification) {
+			t.Fatalf("VerifyAssertion() = %v, want ErrVerification", err)
+		}
+	})
+	t.Run("tampered authenticator data", func(t *testing.T) {
+		challenge := newTestChallenge(t)
+		resp := a.get(challenge)
+		raw, _ := Decode(resp.Response.AuthenticatorData)
+		raw[32] |= flagBackupEligible
+		resp.Response.AuthenticatorData = Encode(raw)
+		if _, err := testRP.VerifyAssertion(resp, challenge, cred.PublicKey, got.SignCount, false); !errors.Is(err, ErrVerification) {
+			t.Fatalf("VerifyAssertion() = %v, want ErrVerification", err)
+		}
+	})
+	t.Run("another key", func(t *testing.T) {
+		other := newSoftAuthenticator(t)
+		challenge := newTestChallenge(t)
+		if _, err := testRP.VerifyAssertion(other.get(challenge), challenge, cred.PublicKey, 0, false); !errors.Is(err, ErrVerification) {
+			t.Fatalf("VerifyAssertion() = %v, want ErrVerification", err)
+		}
+	})
+	t.Run("registration replayed as assertion", func(t *testing.T) {
+		challenge := newTestChallenge(t)
+		resp := a.get(challenge)
+		resp.Response.ClientDataJSON = Encode(a.clientData("webauthn.create", challenge))
+		if _, err := testRP.VerifyAssertion(resp, challenge, cred.PublicKey, 0, false); !errors.Is(err, ErrVerification) {
+			t.Fatalf("VerifyAssertion() = %v, want ErrVerification", err)
+		}
+	})
+}
+
+// TestSignCounterRegression checks that an assertion whose counter doesn't
+// move past the stored one, the sign of a cloned key, is refused
+func TestSignCounterRegression(t *testing.T) {
+	a := newSoftAuthenticator(t)
+	cred := register(t, a)
+
+	for _, tc := range []struct {
+		name         string
+		stored, sent uint32
+		wantErr      bool
+	}{
+		{"advanced", 5, 6, false},
+		{"repeated", 5, 5, true},
+		{"went back", 5, 3, true},
+		{"reset to zero", 5, 0, true},
+		{"no counter", 0, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a.signCount = tc.sent - 1 // get advances it
+			challenge := newTestChallenge(t)
+			_, err := testRP.VerifyAssertion(a.get(challenge), challenge, cred.PublicKey, tc.stored, false)
+			if tc.wantErr && !errors.Is(err, ErrVerification) {
+				t.Fatalf("VerifyAssertion() = %v, want ErrVerification", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("VerifyAssertion() = %v", err)
+			}
+		})
+	}
+}
+
+// cborRaw is already encoded CBOR, such as a nested map
+type cborRaw []byte
+
+// cborMap encodes alternating keys and values as a CBOR map. It covers only
+// the types WebAuthn uses: integers, byte and text strings, and maps.
+func cborMap(pairs ...any) cborRaw {
+	out := cborHead(5, uint64(len(pairs)/2))
+	for _, v := range pairs {
+		out = append(out, cborValue(v)...)
+	}
+	return out
+}
+
+func cborValue(v any) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case cborRaw:
+		return v
+	}
+	panic("cborValue: unsupported type")
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	}
+	return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+}
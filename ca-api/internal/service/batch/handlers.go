@@ -0,0 +1,140 @@
+package batch
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/batch"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Uploads larger than this are rejected before parsing
+const maxUploadBytes = 16 << 20
+
+// SubmitBatch accepts a JSONL or CSV body of hosts and queues a signing job.
+// The response is 202 with the job; poll GetBatch for progress and results.
+func (m *Manager) SubmitBatch(c *gin.Context) {
+	tmpl, ok := m.templates[c.Query("template")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_TEMPLATE",
+				"message": "Unknown host template.",
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes)
+
+	var items []batch.Item
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	switch mediaType {
+	case "text/csv":
+		items, err = ParseCSV(body)
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		items, err = ParseJSONL(body)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error": gin.H{
+				"code":    "UNSUPPORTED_MEDIA_TYPE",
+				"message": "Upload hosts as text/csv or application/x-ndjson.",
+				"status":  http.StatusUnsupportedMediaType,
+			},
+		})
+		return
+	}
+
+	if err != nil || len(items) == 0 {
+		message := "Invalid input provided."
+		if errors.Is(err, ErrTooManyItems) {
+			message = ErrTooManyItems.Error()
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": message,
+				"status":  http.StatusBadRequest,
+			},
+		})
+		return
+	}
+
+	job, err := m.Submit(c, tmpl, items, middleware.CurrentPrincipal(c).UserID)
+	if err != nil {
+		log.Printf("batch Submit failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	c.Header("Location", c.Request.URL.Path+"/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetBatch reports a job's progress, and every item's result once it is done.
+// Only whoever submitted the job can see it.
+func (m *Manager) GetBatch(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		jobNotFound(c)
+		return
+	}
+	row, err := m.DB.GetBatchJob(c, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && row.SubmittedBy != middleware.CurrentPrincipal(c).UserID) {
+		jobNotFound(c)
+		return
+	}
+	if err != nil {
+		log.Printf("GetBatchJob failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	job := jobInfo(row)
+	if job.Status == batch.JobDone {
+		results, err := m.DB.ListBatchItemResults(c, id)
+		if err != nil {
+			log.Printf("ListBatchItemResults failed: %v", err)
+			internalError(c)
+			return
+		}
+		job.Results = make([]batch.ItemResult, 0, len(results))
+		for _, r := range results {
+			job.Results = append(job.Results, batch.ItemResult{
+				Line:        int(r.Line),
+				Hostname:    r.Hostname,
+				Status:      batch.ItemStatus(r.Status),
+				Certificate: r.Certificate.String,
+				Error:       r.Error.String,
+			})
+		}
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func jobNotFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"code":    "JOB_NOT_FOUND",
+			"message": "No batch job with this id.",
+			"status":  http.StatusNotFound,
+		},
+	})
+}
+
+func internalError(c *gin.Context) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"code":    "INTERNAL_SERVER_ERROR",
+			"message": "Something went wrong. Please try again later.",
+			"status":  http.StatusInternalServerError,
+		},
+	})
+}
@@ -0,0 +1,308 @@
+package batch
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/batch"
+	domainca "github.com/dhruvpatel-10/signee/ca-api/internal/domain/ca"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/ca"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	jobRetention = 24 * time.Hour   // finished jobs are kept this long so clients can collect results
+	pollInterval = 10 * time.Second // idle workers look for work queued by other instances this often
+)
+
+var hostnameRE = regexp.MustCompile(`^(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Manager keeps batch jobs in the database and signs their items on one
+// worker pool shared by every job. Workers claim items with SKIP LOCKED, so
+// instances can share the queue and a restart picks up where it stopped.
+type Manager struct {
+	Conn *sql.DB
+	DB   *db.Queries
+	CA   *ca.Authority
+
+	workers   int
+	templates map[string]batch.HostTemplate
+	wake      chan struct{}
+}
+
+func NewManager(conn *sql.DB, queries *db.Queries, authority *ca.Authority, workers int, templates []batch.HostTemplate) *Manager {
+	if workers < 1 {
+		workers = 1
+	}
+	m := &Manager{
+		Conn:      conn,
+		DB:        queries,
+		CA:        authority,
+		workers:   workers,
+		templates: make(map[string]batch.HostTemplate, len(templates)),
+		wake:      make(chan struct{}, workers),
+	}
+	for _, t := range templates {
+		m.templates[t.Name] = t
+	}
+	return m
+}
+
+// itemRow is one item as handed to CreateBatchItems
+type itemRow struct {
+	Line      int    `json:"line"`
+	Hostname  string `json:"hostname"`
+	PublicKey string `json:"public_key"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Submit stores the job and returns immediately; progress is read with GetBatch.
+// Items that don't fit the template fail here and never reach a worker.
+func (m *Manager) Submit(ctx context.Context, tmpl batch.HostTemplate, items []batch.Item, submittedBy uuid.UUID) (*batch.Job, error) {
+	rows := make([]itemRow, len(items))
+	failed := 0
+	for i, item := range items {
+		rows[i] = itemRow{
+			Line:      item.Line,
+			Hostname:  item.Hostname,
+			PublicKey: item.PublicKey,
+			Status:    string(batch.ItemPending),
+		}
+		if _, err := validateItem(tmpl, item); err != nil {
+			rows[i].Status = string(batch.ItemFailed)
+			rows[i].Error = err.Error()
+			failed++
+		}
+	}
+	rawItems, err := json.Marshal(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode items: %v", err)
+	}
+
+	status, finishedAt := batch.JobQueued, sql.NullTime{}
+	if failed == len(items) {
+		status, finishedAt = batch.JobDone, sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	if err := m.DB.DeleteFinishedBatchJobs(ctx, sql.NullTime{Time: time.Now().Add(-jobRetention), Valid: true}); err != nil {
+		return nil, fmt.Errorf("failed to prune jobs: %v", err)
+	}
+
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	q := m.DB.WithTx(tx)
+
+	job, err := q.CreateBatchJob(ctx, db.CreateBatchJobParams{
+		Template:    tmpl.Name,
+		Status:      string(status),
+		Total:       int32(len(items)),
+		Failed:      int32(failed),
+		SubmittedBy: submittedBy,
+		FinishedAt:  finishedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := q.CreateBatchItems(ctx, db.CreateBatchItemsParams{JobID: job.ID, Items: rawItems}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	m.notify()
+	return jobInfo(job), nil
+}
+
+// notify wakes idle workers after new items are queued
+func (m *Manager) notify() {
+	for range m.workers {
+		select {
+		case m.wake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// Run signs queued items on the worker pool until ctx is done
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range m.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *Manager) work(ctx context.Context) {
+	for {
+		found, err := m.signNext(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("batch worker failed: %v", err)
+		}
+		if found && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// signNext finishes the oldest pending item and reports whether there was one.
+// The certificate, the item and the job counters commit together.
+func (m *Manager) signNext(ctx context.Context) (bool, error) {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	q := m.DB.WithTx(tx)
+
+	item, err := q.ClaimBatchItem(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	finished := db.FinishBatchItemParams{JobID: item.JobID, Line: item.Line, Status: string(batch.ItemFailed)}
+
+	tmpl, ok := m.templates[item.Template]
+	if !ok {
+		finished.Error = sql.NullString{String: "template " + item.Template + " is no longer configured", Valid: true}
+		return true, m.finish(ctx, tx, q, finished)
+	}
+	pub, err := validateItem(tmpl, batch.Item{Hostname: item.Hostname, PublicKey: item.PublicKey})
+	if err != nil {
+		finished.Error = sql.NullString{String: err.Error(), Valid: true}
+		return true, m.finish(ctx, tx, q, finished)
+	}
+
+	hostname := strings.ToLower(strings.TrimSpace(item.Hostname))
+	cert, err := m.CA.Issue(ctx, q, hostCertificate(pub, hostname, tmpl.Validity, time.Now()), domainca.SourceBatch, item.SubmittedBy)
+	if err != nil {
+		// The transaction is unusable now; fail the item on its own so it can't block the queue
+		log.Printf("batch job %s line %d: %v", item.JobID, item.Line, err)
+		tx.Rollback()
+		return true, m.failItem(ctx, finished)
+	}
+
+	finished.Status = string(batch.ItemSigned)
+	finished.CertificateID = uuid.NullUUID{UUID: cert.ID, Valid: true}
+	return true, m.finish(ctx, tx, q, finished)
+}
+
+// failItem records that an item could not be signed
+func (m *Manager) failItem(ctx context.Context, finished db.FinishBatchItemParams) error {
+	tx, err := m.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	finished.Error = sql.NullString{String: "failed to sign certificate", Valid: true}
+	return m.finish(ctx, tx, m.DB.WithTx(tx), finished)
+}
+
+// finish stores the item's outcome, counts it against its job and commits
+func (m *Manager) finish(ctx context.Context, tx *sql.Tx, q *db.Queries, finished db.FinishBatchItemParams) error {
+	updated, err := q.FinishBatchItem(ctx, finished)
+	if err != nil {
+		return err
+	}
+	if updated == 1 {
+		if err := q.CountBatchItem(ctx, db.CountBatchItemParams{
+			Signed: finished.Status == string(batch.ItemSigned),
+			ID:     finished.JobID,
+		}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// hostCertificate prepares an unsigned host certificate naming only hostname
+func hostCertificate(pub ssh.PublicKey, hostname string, validity time.Duration, now time.Time) *ssh.Certificate {
+	return &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.HostCert,
+		KeyId:           hostname,
+		ValidPrincipals: []string{hostname},
+		ValidAfter:      uint64(now.Add(-5 * time.Minute).Unix()), // tolerate clock skew
+		ValidBefore:     uint64(now.Add(validity).Unix()),
+	}
+}
+
+// validateItem checks an item against the host template
+func validateItem(tmpl batch.HostTemplate, item batch.Item) (ssh.PublicKey, error) {
+	if item.ParseErr != "" {
+		return nil, fmt.Errorf("%s", item.ParseErr)
+	}
+
+	hostname := strings.ToLower(strings.TrimSpace(item.Hostname))
+	if hostname == "" || len(hostname) > 253 || !hostnameRE.MatchString(hostname) {
+		return nil, fmt.Errorf("invalid hostname")
+	}
+	if !ca.HostAllowed(hostname, tmpl.AllowedDomains) {
+		return nil, fmt.Errorf("hostname not permitted by template %s", tmpl.Name)
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(item.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	if _, isCert := pub.(*ssh.Certificate); isCert {
+		return nil, fmt.Errorf("public key is already a certificate")
+	}
+	if len(tmpl.AllowedKeyTypes) > 0 && !slices.Contains(tmpl.AllowedKeyTypes, pub.Type()) {
+		return nil, fmt.Errorf("key type %s not permitted by template %s", pub.Type(), tmpl.Name)
+	}
+	if cryptoPub, ok := pub.(ssh.CryptoPublicKey); ok {
+		if rsaPub, ok := cryptoPub.CryptoPublicKey().(*rsa.PublicKey); ok && rsaPub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+	}
+	return pub, nil
+}
+
+func jobInfo(row db.BatchJob) *batch.Job {
+	job := &batch.Job{
+		ID:        row.ID.String(),
+		Template:  row.Template,
+		Status:    batch.JobStatus(row.Status),
+		Total:     int(row.Total),
+		Signed:    int(row.Signed),
+		Failed:    int(row.Failed),
+		CreatedAt: row.CreatedAt,
+	}
+	if row.FinishedAt.Valid {
+		job.FinishedAt = &row.FinishedAt.Time
+	}
+	return job
+}
@@ -0,0 +1,295 @@
+package batch
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/db/dbtest"
+	authz "github.com/dhruvpatel-10/signee/ca-api/internal/domain/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/batch"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/ca"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/translog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+var testTemplate = batch.HostTemplate{
+	Name:           "fleet",
+	AllowedDomains: []string{"fleet.example.com"},
+	Validity:       24 * time.Hour,
+}
+
+// fakeStore holds batch jobs, items and issued certificates in memory.
+// Certificates whose key id is in refuse fail to store, as a database error would.
+type fakeStore struct {
+	t      *testing.T
+	mu     sync.Mutex
+	jobs   []db.BatchJob
+	items  []fakeItem
+	certs  []db.Certificate
+	refuse map[string]bool
+}
+
+type fakeItem struct {
+	itemRow
+	jobID         uuid.UUID
+	certificateID uuid.NullUUID
+}
+
+func newTestManager(t *testing.T) (*Manager, *fakeStore) {
+	t.Helper()
+	f := &fakeStore{t: t, refuse: make(map[string]bool)}
+	conn := dbtest.Open(t, f.run)
+	queries := db.New(conn)
+
+	dir := t.TempDir()
+	tlog, err := translog.NewLog(conn, queries, filepath.Join(dir, "log.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority, err := ca.NewAuthority(tlog, filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(conn, queries, authority, 1, []batch.HostTemplate{testTemplate}), f
+}
+
+func (f *fakeStore) run(name string, args []driver.Value) ([][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	str := func(i int) string { s, _ := args[i].(string); return s }
+	id := func(i int) uuid.UUID { return uuid.MustParse(str(i)) }
+
+	switch name {
+	case "DeleteFinishedBatchJobs", "LockTransparencyLog":
+		return nil, nil
+
+	case "CreateBatchJob":
+		finished, _ := args[5].(time.Time)
+		job := db.BatchJob{
+			ID: uuid.New(), Template: str(0), Status: str(1), Total: int32(args[2].(int64)), Failed: int32(args[3].(int64)),
+			SubmittedBy: id(4), CreatedAt: time.Now(), FinishedAt: sql.NullTime{Time: finished, Valid: !finished.IsZero()},
+		}
+		f.jobs = append(f.jobs, job)
+		return [][]driver.Value{jobRow(job)}, nil
+
+	case "CreateBatchItems":
+		var rows []itemRow
+		if err := json.Unmarshal(args[1].([]byte), &rows); err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			f.items = append(f.items, fakeItem{itemRow: r, jobID: id(0)})
+		}
+		return nil, nil
+
+	case "ClaimBatchItem":
+		for _, i := range f.items {
+			if i.Status == string(batch.ItemPending) {
+				job := f.job(i.jobID)
+				return [][]driver.Value{{i.jobID.String(), int64(i.Line), i.Hostname, i.PublicKey, job.Template, job.SubmittedBy.String()}}, nil
+			}
+		}
+		return nil, nil
+
+	case "FinishBatchItem":
+		for n, i := range f.items {
+			if i.jobID == id(0) && int64(i.Line) == args[1].(int64) && i.Status == string(batch.ItemPending) {
+				f.items[n].Status, f.items[n].Error = str(2), str(3)
+				if args[4] != nil {
+					f.items[n].certificateID = uuid.NullUUID{UUID: id(4), Valid: true}
+				}
+				return [][]driver.Value{{}}, nil
+			}
+		}
+		return nil, nil
+
+	case "CountBatchItem":
+		job := f.job(id(1))
+		if args[0].(bool) {
+			job.Signed++
+		} else {
+			job.Failed++
+		}
+		job.Status = string(batch.JobRunning)
+		if job.Signed+job.Failed >= job.Total {
+			job.Status = string(batch.JobDone)
+		}
+		return nil, nil
+
+	case "GetTransparencyLogSize":
+		return [][]driver.Value{{int64(len(f.certs))}}, nil
+
+	case "AppendTransparencyLogEntry":
+		return [][]driver.Value{{args[0], str(1), args[2], time.Now()}}, nil
+
+	case "CreateCertificate":
+		if f.refuse[str(2)] {
+			return nil, errors.New("certificate store unavailable")
+		}
+		cert := db.Certificate{ID: uuid.New(), KeyID: str(2), Certificate: str(6), Source: str(7)}
+		f.certs = append(f.certs, cert)
+		return [][]driver.Value{{
+			cert.ID.String(), str(0), str(1), str(2), args[3], str(4), str(5), str(6), str(7), args[8], args[9], args[10], args[11], time.Now(),
+		}}, nil
+	}
+	return nil, dbtest.Unexpected(f.t, name)
+}
+
+func (f *fakeStore) job(id uuid.UUID) *db.BatchJob {
+	for n := range f.jobs {
+		if f.jobs[n].ID == id {
+			return &f.jobs[n]
+		}
+	}
+	f.t.Fatalf("no job %s", id)
+	return nil
+}
+
+func jobRow(j db.BatchJob) []driver.Value {
+	var finished driver.Value
+	if j.FinishedAt.Valid {
+		finished = j.FinishedAt.Time
+	}
+	return []driver.Value{j.ID.String(), j.Template, j.Status, int64(j.Total), int64(j.Signed), int64(j.Failed), j.SubmittedBy.String(), j.CreatedAt, finished}
+}
+
+func hostKey(t *testing.T) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca.MarshalKey(sshPub)
+}
+
+// drain signs items until none are pending
+func drain(t *testing.T, m *Manager) {
+	t.Helper()
+	for {
+		found, err := m.signNext(context.Background())
+		if err != nil {
+			t.Fatalf("signNext() = %v", err)
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+// TestBatchItemsFailAlone checks that bad items, whether rejected up front or
+// when signing, fail on their own while the rest of the job is signed
+func TestBatchItemsFailAlone(t *testing.T) {
+	m, f := newTestManager(t)
+	f.refuse["db2.fleet.example.com"] = true
+
+	items := []batch.Item{
+		{Line: 1, Hostname: "web1.fleet.example.com", PublicKey: hostKey(t)},
+		{Line: 2, Hostname: "web1.other.example.com", PublicKey: hostKey(t)},
+		{Line: 3, Hostname: "bad_name.fleet.example.com", PublicKey: hostKey(t)},
+		{Line: 4, Hostname: "web2.fleet.example.com", PublicKey: "ssh-ed25519 not-a-key"},
+		{Line: 5, ParseErr: "invalid JSON"},
+		{Line: 6, Hostname: "db2.fleet.example.com", PublicKey: hostKey(t)},
+		{Line: 7, Hostname: "DB1.fleet.example.com", PublicKey: hostKey(t)},
+	}
+	job, err := m.Submit(context.Background(), testTemplate, items, uuid.New())
+	if err != nil {
+		t.Fatalf("Submit() = %v", err)
+	}
+	if job.Status != batch.JobQueued || job.Total != 7 || job.Failed != 4 {
+		t.Fatalf("Submit() = %+v, want a queued job with 4 of 7 items already failed", job)
+	}
+
+	drain(t, m)
+
+	stored := f.job(uuid.MustParse(job.ID))
+	if stored.Status != string(batch.JobDone) || stored.Signed != 2 || stored.Failed != 5 {
+		t.Fatalf("job = %+v, want done with 2 signed and 5 failed", stored)
+	}
+	want := map[int]batch.ItemStatus{1: batch.ItemSigned, 6: batch.ItemFailed, 7: batch.ItemSigned}
+	for _, i := range f.items {
+		if status, ok := want[i.Line]; ok && batch.ItemStatus(i.Status) != status {
+			t.Errorf("line %d = %s (%s), want %s", i.Line, i.Status, i.Error, status)
+		}
+		if i.Status == string(batch.ItemFailed) && i.Error == "" {
+			t.Errorf("line %d failed without a reason", i.Line)
+		}
+	}
+
+	var names []string
+	for _, c := range f.certs {
+		names = append(names, c.KeyID)
+	}
+	slices.Sort(names)
+	if want := []string{"db1.fleet.example.com", "web1.fleet.example.com"}; !slices.Equal(names, want) {
+		t.Fatalf("certificates for %q, want %q", names, want)
+	}
+}
+
+// TestSubmitBatchIsAdminOnly mounts SubmitBatch behind the permission the
+// route uses. Bulk signing skips enrollment and approval, so the roles
+// self-signup hands out must not reach it.
+func TestSubmitBatchIsAdminOnly(t *testing.T) {
+	for role, perms := range authz.DefaultRoles {
+		if slices.Contains(perms, authz.CertIssueHost) && role != "admin" {
+			t.Errorf("role %s can issue host certificates directly", role)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	for name, tc := range map[string]struct {
+		role string
+		want int
+	}{
+		"developer":        {"developer", http.StatusForbidden},
+		"security officer": {"security_officer", http.StatusForbidden},
+		"admin":            {"admin", http.StatusAccepted},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, f := newTestManager(t)
+			principal := &authz.Principal{UserID: uuid.New(), Roles: []string{tc.role}, Permissions: make(map[authz.Permission]bool)}
+			for _, p := range authz.DefaultRoles[tc.role] {
+				principal.Permissions[p] = true
+			}
+
+			router := gin.New()
+			router.POST("/certificates/batch",
+				func(c *gin.Context) { c.Set(middleware.PrincipalKey, principal) },
+				middleware.RequirePermission(authz.CertIssueHost),
+				m.SubmitBatch)
+
+			body := `{"hostname":"web1.fleet.example.com","public_key":"` + hostKey(t) + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/certificates/batch?template=fleet", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/x-ndjson")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.want {
+				t.Fatalf("SubmitBatch = %d: %s, want %d", w.Code, w.Body, tc.want)
+			}
+			if queued := len(f.jobs) > 0; queued != (tc.want == http.StatusAccepted) {
+				t.Fatalf("jobs = %+v after a %d response", f.jobs, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/batch"
+)
+
+// MaxItems caps a single batch so one upload can't monopolize the signer
+const MaxItems = 10000
+
+var ErrTooManyItems = fmt.Errorf("batch exceeds %d items", MaxItems)
+
+// ParseJSONL reads one {"hostname": ..., "public_key": ...} object per line
+func ParseJSONL(r io.Reader) ([]batch.Item, error) {
+	var items []batch.Item
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var item batch.Item
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			// Keep going: a malformed line fails on its own during validation
+			item = batch.Item{ParseErr: "invalid JSON"}
+		}
+		item.Line = line
+		items = append(items, item)
+		if len(items) > MaxItems {
+			return nil, ErrTooManyItems
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch: %v", err)
+	}
+	return items, nil
+}
+
+// ParseCSV reads hostname,public_key rows; a header row is optional
+func ParseCSV(r io.Reader) ([]batch.Item, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var items []batch.Item
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read batch: %v", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		if line == 1 && len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "hostname") {
+			continue
+		}
+
+		item := batch.Item{Line: line}
+		if len(record) == 2 {
+			item.Hostname = strings.TrimSpace(record[0])
+			item.PublicKey = strings.TrimSpace(record[1])
+		} else {
+			item.ParseErr = "expected hostname,public_key"
+		}
+		items = append(items, item)
+		if len(items) > MaxItems {
+			return nil, ErrTooManyItems
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,41 @@
+package batch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/batch"
+)
+
+// LoadTemplates reads a JSON array of host templates
+func LoadTemplates(path string) ([]batch.HostTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host templates: %v", err)
+	}
+
+	var templates []batch.HostTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("failed to parse host templates: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range templates {
+		t := &templates[i]
+		if t.Name == "" || len(t.AllowedDomains) == 0 {
+			return nil, fmt.Errorf("host template %d: name and allowed_domains are required", i)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("host template %q is configured twice", t.Name)
+		}
+		seen[t.Name] = true
+
+		if t.ValidityHours < 1 || t.ValidityHours > 10*365*24 {
+			return nil, fmt.Errorf("host template %q: validity_hours must be between 1 and 87600", t.Name)
+		}
+		t.Validity = time.Duration(t.ValidityHours) * time.Hour
+	}
+	return templates, nil
+}
@@ -0,0 +1,175 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/ca"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/translog"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+// Latest validity the inventory stores: 9999-12-31T23:59:59Z. Certificates
+// valid forever (ssh.CertTimeInfinity) are never issued or accepted.
+const maxValidBefore = 253402300799
+
+// Authority signs certificates with the online CA key and keeps the inventory.
+// Every certificate it issues or records is stored and appended to the
+// transparency log in the caller's transaction, so none leaves the API unlogged.
+type Authority struct {
+	Log    *translog.Log
+	signer ssh.Signer
+}
+
+func NewAuthority(tlog *translog.Log, keyPath string) (*Authority, error) {
+	signer, err := LoadOrGenerateKey(keyPath, "signee-ca")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize CA key: %v", err)
+	}
+	return &Authority{Log: tlog, signer: signer}, nil
+}
+
+func (a *Authority) PublicKey() ssh.PublicKey {
+	return a.signer.PublicKey()
+}
+
+// Issue signs cert with the CA key and records it. q must be bound to a
+// transaction, and the certificate may only be handed out once that commits.
+func (a *Authority) Issue(ctx context.Context, q *db.Queries, cert *ssh.Certificate, source ca.Source, requestedBy uuid.UUID) (db.Certificate, error) {
+	if cert.Serial == 0 {
+		serial := make([]byte, 8)
+		if _, err := rand.Read(serial); err != nil {
+			return db.Certificate{}, fmt.Errorf("failed to generate serial: %v", err)
+		}
+		cert.Serial = binary.BigEndian.Uint64(serial)
+	}
+	if err := cert.SignCert(rand.Reader, a.signer); err != nil {
+		return db.Certificate{}, fmt.Errorf("failed to sign certificate: %v", err)
+	}
+	return Record(ctx, a.Log, q, cert, source, requestedBy)
+}
+
+// Record stores a certificate that is already signed, such as one from the
+// offline CA, and appends it to the transparency log. q must be bound to a transaction.
+func Record(ctx context.Context, tlog *translog.Log, q *db.Queries, cert *ssh.Certificate, source ca.Source, requestedBy uuid.UUID) (db.Certificate, error) {
+	if cert.SignatureKey == nil || cert.Signature == nil {
+		return db.Certificate{}, errors.New("certificate is not signed")
+	}
+	if cert.ValidBefore > maxValidBefore || cert.ValidAfter > cert.ValidBefore {
+		return db.Certificate{}, errors.New("certificate validity is not a finite window")
+	}
+
+	principals := cert.ValidPrincipals
+	if principals == nil {
+		principals = []string{}
+	}
+	rawPrincipals, err := json.Marshal(principals)
+	if err != nil {
+		return db.Certificate{}, fmt.Errorf("failed to encode principals: %v", err)
+	}
+
+	text := MarshalKey(cert)
+	leafIndex, err := tlog.AppendWith(ctx, q, text)
+	if err != nil {
+		return db.Certificate{}, fmt.Errorf("failed to append to transparency log: %v", err)
+	}
+
+	return q.CreateCertificate(ctx, db.CreateCertificateParams{
+		Serial:         strconv.FormatUint(cert.Serial, 10),
+		CertType:       certTypeName(cert.CertType),
+		KeyID:          cert.KeyId,
+		Principals:     rawPrincipals,
+		KeyFingerprint: ssh.FingerprintSHA256(cert.Key),
+		CaFingerprint:  ssh.FingerprintSHA256(cert.SignatureKey),
+		Certificate:    text,
+		Source:         string(source),
+		RequestedBy:    uuid.NullUUID{UUID: requestedBy, Valid: requestedBy != uuid.Nil},
+		LeafIndex:      leafIndex,
+		ValidAfter:     time.Unix(int64(cert.ValidAfter), 0),
+		ValidBefore:    time.Unix(int64(cert.ValidBefore), 0),
+	})
+}
+
+// MarshalKey renders a key or certificate in authorized_keys format, without a trailing newline
+func MarshalKey(pub ssh.PublicKey) string {
+	return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(pub)))
+}
+
+// Info describes a stored certificate for API responses
+func Info(row db.Certificate) ca.Certificate {
+	var principals []string
+	json.Unmarshal(row.Principals, &principals)
+
+	return ca.Certificate{
+		ID:          row.ID.String(),
+		Serial:      row.Serial,
+		CertType:    row.CertType,
+		KeyID:       row.KeyID,
+		Principals:  principals,
+		Certificate: row.Certificate,
+		Source:      ca.Source(row.Source),
+		LeafIndex:   row.LeafIndex,
+		ValidAfter:  row.ValidAfter,
+		ValidBefore: row.ValidBefore,
+	}
+}
+
+// HostAllowed reports whether hostname equals or sits under one of domains
+func HostAllowed(hostname string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if hostname == d || strings.HasSuffix(hostname, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func certTypeName(t uint32) string {
+	if t == ssh.HostCert {
+		return "host"
+	}
+	return "user"
+}
+
+// LoadOrGenerateKey loads an OpenSSH private key or generates and saves an Ed25519 one
+func LoadOrGenerateKey(filename, comment string) (ssh.Signer, error) {
+	data, err := os.ReadFile(filename)
+	if err == nil {
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key in %s: %v", filename, err)
+		}
+		return signer, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, comment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(filename, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save key: %v", err)
+	}
+	return ssh.NewSignerFromKey(key)
+}
@@ -0,0 +1,191 @@
+package enroll
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/enroll"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrChallengeExpired  = errors.New("challenge expired")
+	ErrKeyAuthMismatch   = errors.New("key authorization mismatch")
+	ErrHostKeyMismatch   = errors.New("presented host key does not match enrolled key")
+	ErrUnsupportedMethod = errors.New("unsupported challenge type")
+)
+
+// Verifier checks that a host controls the hostname it wants a certificate for.
+// Ports are configurable so challenges can be verified against local listeners.
+type Verifier struct {
+	HTTPPort int
+	SSHPort  int
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{
+		HTTPPort: 80,
+		SSHPort:  22,
+		Timeout:  10 * time.Second,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			// Never follow redirects off the host being verified
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// NewChallenge creates a pending challenge for the given host key
+func NewChallenge(req enroll.NewChallengeRequest, ttl time.Duration) (*enroll.Challenge, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	if _, isCert := pub.(*ssh.Certificate); isCert {
+		return nil, fmt.Errorf("public key is already a certificate")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge token: %v", err)
+	}
+
+	return &enroll.Challenge{
+		Type:      req.Type,
+		Hostname:  strings.ToLower(req.Hostname),
+		PublicKey: req.PublicKey,
+		Token:     base64.RawURLEncoding.EncodeToString(b),
+		Status:    enroll.ChallengePending,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// KeyAuthorization binds the challenge token to the host key being enrolled
+func KeyAuthorization(ch *enroll.Challenge) (string, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(ch.PublicKey))
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+	return ch.Token + "." + strings.TrimPrefix(ssh.FingerprintSHA256(pub), "SHA256:"), nil
+}
+
+// Verify dispatches on the challenge type
+func (v *Verifier) Verify(ctx context.Context, ch *enroll.Challenge) error {
+	if time.Now().After(ch.ExpiresAt) {
+		return ErrChallengeExpired
+	}
+
+	switch ch.Type {
+	case enroll.HTTP01:
+		return v.verifyHTTP(ctx, ch)
+	case enroll.SSHHostKey:
+		return v.verifySSH(ctx, ch)
+	default:
+		return ErrUnsupportedMethod
+	}
+}
+
+// verifyHTTP fetches the key authorization from the well-known path on the host
+func (v *Verifier) verifyHTTP(ctx context.Context, ch *enroll.Challenge) error {
+	expected, err := KeyAuthorization(ch)
+	if err != nil {
+		return err
+	}
+
+	url := "http://" + net.JoinHostPort(ch.Hostname, strconv.Itoa(v.HTTPPort)) + enroll.WellKnownPath + ch.Token
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build challenge request: %v", err)
+	}
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch challenge: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected challenge response status: %d", resp.StatusCode)
+	}
+
+	// Key authorizations are short; cap the read so a host can't stream at us
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if err != nil {
+		return fmt.Errorf("failed to read challenge response: %v", err)
+	}
+
+	got := strings.TrimSpace(string(body))
+	if subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+		return ErrKeyAuthMismatch
+	}
+	return nil
+}
+
+// verifySSH connects back to the host and checks it proves possession of the enrolled key.
+// The handshake alone is enough: the server signs the exchange hash with its host key
+// before any authentication happens, so the connection is dropped once the key is seen.
+func (v *Verifier) verifySSH(ctx context.Context, ch *enroll.Challenge) error {
+	expected, _, _, _, err := ssh.ParseAuthorizedKey([]byte(ch.PublicKey))
+	if err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+
+	dialer := &net.Dialer{Timeout: v.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ch.Hostname, strconv.Itoa(v.SSHPort)))
+	if err != nil {
+		return fmt.Errorf("failed to connect to host: %v", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(v.Timeout))
+	}
+
+	var matched bool
+	config := &ssh.ClientConfig{
+		User:              "signee-enroll",
+		HostKeyAlgorithms: hostKeyAlgorithms(expected),
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			matched = subtle.ConstantTimeCompare(key.Marshal(), expected.Marshal()) == 1
+			if !matched {
+				return ErrHostKeyMismatch
+			}
+			return nil
+		},
+	}
+
+	_, _, _, err = ssh.NewClientConn(conn, conn.RemoteAddr().String(), config)
+	if matched {
+		// Authentication failing after the host key check is expected
+		return nil
+	}
+	if errors.Is(err, ErrHostKeyMismatch) {
+		return ErrHostKeyMismatch
+	}
+	return fmt.Errorf("ssh handshake failed: %v", err)
+}
+
+// hostKeyAlgorithms pins negotiation to the enrolled key so the host can't
+// present a different key type it also happens to hold
+func hostKeyAlgorithms(key ssh.PublicKey) []string {
+	if key.Type() == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256}
+	}
+	return []string{key.Type()}
+}
@@ -0,0 +1,274 @@
+package enroll
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/enroll"
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func authorizedKey(pub ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+}
+
+func newTestChallenge(t *testing.T, typ enroll.ChallengeType, pub ssh.PublicKey) *enroll.Challenge {
+	t.Helper()
+	ch, err := NewChallenge(enroll.NewChallengeRequest{
+		Hostname:  "127.0.0.1",
+		PublicKey: authorizedKey(pub),
+		Type:      typ,
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func listenerPort(t *testing.T, addr net.Addr) int {
+	t.Helper()
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// serveSSH runs an SSH server with hostKey that lets no one log in
+func serveSSH(t *testing.T, hostKey ssh.Signer) int {
+	t.Helper()
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, errors.New("no logins")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+	return listenerPort(t, l.Addr())
+}
+
+func TestVerifyHTTP01(t *testing.T) {
+	ch := newTestChallenge(t, enroll.HTTP01, newHostKey(t).PublicKey())
+	keyAuth, err := KeyAuthorization(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr error // nil with fail set means any error
+		fail    bool
+	}{
+		{
+			name: "serves key authorization",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != enroll.WellKnownPath+ch.Token {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprintln(w, keyAuth)
+			},
+		},
+		{
+			name: "serves another key authorization",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, ch.Token+".not-the-fingerprint")
+			},
+			wantErr: ErrKeyAuthMismatch,
+			fail:    true,
+		},
+		{
+			name:    "nothing on the well-known path",
+			handler: http.NotFound,
+			fail:    true,
+		},
+		{
+			name: "redirects elsewhere",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "http://example.com/"+keyAuth, http.StatusFound)
+			},
+			fail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			v := NewVerifier()
+			v.HTTPPort = listenerPort(t, srv.Listener.Addr())
+
+			err := v.Verify(context.Background(), ch)
+			if !tt.fail {
+				if err != nil {
+					t.Fatalf("Verify() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Verify() = nil, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySSHHostKey(t *testing.T) {
+	hostKey := newHostKey(t)
+	port := serveSSH(t, hostKey)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPub, err := ssh.NewPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		enrolled ssh.PublicKey
+		wantErr  error
+		fail     bool
+	}{
+		{name: "host presents the enrolled key", enrolled: hostKey.PublicKey()},
+		{name: "host presents another key", enrolled: newHostKey(t).PublicKey(), wantErr: ErrHostKeyMismatch, fail: true},
+		// Negotiation is pinned to the enrolled key type, so a host without it can't finish the handshake
+		{name: "host lacks the enrolled key type", enrolled: ecPub, fail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier()
+			v.SSHPort = port
+			v.Timeout = 5 * time.Second
+
+			err := v.Verify(context.Background(), newTestChallenge(t, enroll.SSHHostKey, tt.enrolled))
+			if !tt.fail {
+				if err != nil {
+					t.Fatalf("Verify() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Verify() = nil, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	ch := newTestChallenge(t, enroll.SSHHostKey, newHostKey(t).PublicKey())
+	ch.ExpiresAt = time.Now().Add(-time.Second)
+
+	// Nothing listens on port 1; an expired challenge must fail before any connection
+	v := NewVerifier()
+	v.SSHPort = 1
+	if err := v.Verify(context.Background(), ch); !errors.Is(err, ErrChallengeExpired) {
+		t.Fatalf("Verify() = %v, want %v", err, ErrChallengeExpired)
+	}
+}
+
+func TestNewChallenge(t *testing.T) {
+	hostKey := newHostKey(t)
+
+	ch, err := NewChallenge(enroll.NewChallengeRequest{
+		Hostname:  "Web-1.Example.COM",
+		PublicKey: authorizedKey(hostKey.PublicKey()),
+		Type:      enroll.HTTP01,
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Hostname != "web-1.example.com" || ch.Status != enroll.ChallengePending || ch.Token == "" {
+		t.Fatalf("unexpected challenge %+v", ch)
+	}
+
+	keyAuth, err := KeyAuthorization(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ch.Token + "." + strings.TrimPrefix(ssh.FingerprintSHA256(hostKey.PublicKey()), "SHA256:")
+	if keyAuth != want {
+		t.Fatalf("KeyAuthorization() = %q, want %q", keyAuth, want)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             hostKey.PublicKey(),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"web-1.example.com"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, newHostKey(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, publicKey := range map[string]string{
+		"garbage":     "not a key",
+		"certificate": authorizedKey(cert),
+	} {
+		_, err := NewChallenge(enroll.NewChallengeRequest{
+			Hostname:  "web-1.example.com",
+			PublicKey: publicKey,
+			Type:      enroll.SSHHostKey,
+		}, time.Minute)
+		if err == nil {
+			t.Errorf("NewChallenge(%s) = nil error, want one", name)
+		}
+	}
+}
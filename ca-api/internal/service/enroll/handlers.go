@@ -0,0 +1,308 @@
+package enroll
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	domainca "github.com/dhruvpatel-10/signee/ca-api/internal/domain/ca"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/enroll"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/ca"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	challengeTTL     = time.Hour           // how long a host has to pass its challenge
+	hostCertValidity = 30 * 24 * time.Hour // hosts re-enroll before this runs out
+)
+
+var errChallengeClosed = errors.New("challenge is no longer pending")
+
+// Service enrolls hosts that prove control of their hostname, as an alternative
+// to join tokens. Hosts have no account, so only hostnames under AllowedDomains
+// are accepted; that also bounds where Signee connects back to.
+type Service struct {
+	Conn           *sql.DB
+	DB             *db.Queries
+	CA             *ca.Authority
+	Verifier       *Verifier
+	AllowedDomains []string
+}
+
+func invalidRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": message,
+			"status":  http.StatusBadRequest,
+		},
+	})
+}
+
+func internalError(c *gin.Context) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"code":    "INTERNAL_SERVER_ERROR",
+			"message": "Something went wrong. Please try again later.",
+			"status":  http.StatusInternalServerError,
+		},
+	})
+}
+
+func challengeClosed(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error": gin.H{
+			"code":    "CHALLENGE_CLOSED",
+			"message": "This challenge is no longer pending; start a new one.",
+			"status":  http.StatusConflict,
+		},
+	})
+}
+
+// CreateChallenge starts enrolling a host key for a hostname. The response
+// says what the host must serve, or expose over SSH, before it finalizes.
+func (s *Service) CreateChallenge(c *gin.Context) {
+	var req enroll.NewChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, "Invalid input provided.")
+		return
+	}
+	req.Hostname = strings.ToLower(req.Hostname)
+	if !ca.HostAllowed(req.Hostname, s.AllowedDomains) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"code":    "HOSTNAME_NOT_ALLOWED",
+				"message": "This hostname can't be enrolled.",
+				"status":  http.StatusForbidden,
+			},
+		})
+		return
+	}
+
+	ch, err := NewChallenge(req, challengeTTL)
+	if err != nil {
+		invalidRequest(c, "Invalid public key.")
+		return
+	}
+
+	row, err := s.DB.CreateEnrollmentChallenge(c, db.CreateEnrollmentChallengeParams{
+		Type:      string(ch.Type),
+		Hostname:  ch.Hostname,
+		PublicKey: ch.PublicKey,
+		Token:     ch.Token,
+		ExpiresAt: ch.ExpiresAt,
+	})
+	if err != nil {
+		log.Printf("CreateEnrollmentChallenge failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	c.Header("Location", c.Request.URL.Path+"/"+row.ID.String())
+	c.JSON(http.StatusCreated, challengeInfo(row, ""))
+}
+
+func (s *Service) GetChallenge(c *gin.Context) {
+	row, ok := s.loadChallenge(c)
+	if !ok {
+		return
+	}
+	s.respondChallenge(c, row)
+}
+
+// FinalizeChallenge verifies the challenge against the host and, once it
+// passes, issues the host certificate. Finalizing a valid challenge again
+// returns the same certificate.
+func (s *Service) FinalizeChallenge(c *gin.Context) {
+	row, ok := s.loadChallenge(c)
+	if !ok {
+		return
+	}
+	switch enroll.ChallengeStatus(row.Status) {
+	case enroll.ChallengeValid:
+		s.respondChallenge(c, row)
+		return
+	case enroll.ChallengeInvalid, enroll.ChallengeExpired:
+		challengeClosed(c)
+		return
+	}
+
+	ch := challengeInfo(row, "")
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.Verifier.Timeout)
+	defer cancel()
+	if err := s.Verifier.Verify(ctx, &ch); err != nil {
+		s.failChallenge(c, row, err)
+		return
+	}
+
+	cert, err := s.issue(c, row)
+	if errors.Is(err, errChallengeClosed) {
+		challengeClosed(c)
+		return
+	}
+	if err != nil {
+		log.Printf("enrollment issue failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	row.Status = string(enroll.ChallengeValid)
+	c.JSON(http.StatusOK, challengeInfo(row, cert.Certificate))
+}
+
+// issue signs the host certificate and completes the challenge in one
+// transaction, so a challenge yields at most one certificate
+func (s *Service) issue(ctx context.Context, row db.EnrollmentChallenge) (db.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(row.PublicKey))
+	if err != nil {
+		return db.Certificate{}, err
+	}
+
+	tx, err := s.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return db.Certificate{}, err
+	}
+	defer tx.Rollback()
+	q := s.DB.WithTx(tx)
+
+	cert, err := s.CA.Issue(ctx, q, hostCertificate(pub, row.Hostname, time.Now()), domainca.SourceEnroll, uuid.Nil)
+	if err != nil {
+		return db.Certificate{}, err
+	}
+
+	completed, err := q.CompleteEnrollmentChallenge(ctx, db.CompleteEnrollmentChallengeParams{
+		ID:            row.ID,
+		CertificateID: uuid.NullUUID{UUID: cert.ID, Valid: true},
+	})
+	if err != nil {
+		return db.Certificate{}, err
+	}
+	if completed == 0 {
+		return db.Certificate{}, errChallengeClosed
+	}
+
+	if err := tx.Commit(); err != nil {
+		return db.Certificate{}, err
+	}
+	return cert, nil
+}
+
+// failChallenge closes the challenge; a host that fails starts over with a new token
+func (s *Service) failChallenge(c *gin.Context, row db.EnrollmentChallenge, verifyErr error) {
+	log.Printf("enrollment challenge %s for %s failed: %v", row.ID, row.Hostname, verifyErr)
+
+	status, code := enroll.ChallengeInvalid, "CHALLENGE_FAILED"
+	if errors.Is(verifyErr, ErrChallengeExpired) {
+		status, code = enroll.ChallengeExpired, "CHALLENGE_EXPIRED"
+	}
+	reason := failureReason(verifyErr)
+
+	if err := s.DB.FailEnrollmentChallenge(c, db.FailEnrollmentChallengeParams{
+		ID:     row.ID,
+		Status: string(status),
+		Error:  sql.NullString{String: reason, Valid: true},
+	}); err != nil {
+		log.Printf("FailEnrollmentChallenge failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    code,
+			"message": reason,
+			"status":  http.StatusBadRequest,
+		},
+	})
+}
+
+// failureReason says why verification failed without echoing network errors
+// back to an unauthenticated caller
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrChallengeExpired):
+		return "The challenge expired before it was verified."
+	case errors.Is(err, ErrKeyAuthMismatch):
+		return "The host served the wrong key authorization."
+	case errors.Is(err, ErrHostKeyMismatch):
+		return "The host presented a different host key."
+	default:
+		return "The challenge could not be verified with the host."
+	}
+}
+
+func (s *Service) loadChallenge(c *gin.Context) (db.EnrollmentChallenge, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err == nil {
+		row, err := s.DB.GetEnrollmentChallenge(c, id)
+		if err == nil {
+			return row, true
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("GetEnrollmentChallenge failed: %v", err)
+			internalError(c)
+			return db.EnrollmentChallenge{}, false
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": gin.H{
+			"code":    "CHALLENGE_NOT_FOUND",
+			"message": "No enrollment challenge with this id.",
+			"status":  http.StatusNotFound,
+		},
+	})
+	return db.EnrollmentChallenge{}, false
+}
+
+// respondChallenge includes the certificate once the challenge is valid
+func (s *Service) respondChallenge(c *gin.Context, row db.EnrollmentChallenge) {
+	var certificate string
+	if row.CertificateID.Valid {
+		cert, err := s.DB.GetCertificate(c, row.CertificateID.UUID)
+		if err != nil {
+			log.Printf("GetCertificate failed: %v", err)
+			internalError(c)
+			return
+		}
+		certificate = cert.Certificate
+	}
+	c.JSON(http.StatusOK, challengeInfo(row, certificate))
+}
+
+func challengeInfo(row db.EnrollmentChallenge, certificate string) enroll.Challenge {
+	ch := enroll.Challenge{
+		ID:          row.ID.String(),
+		Type:        enroll.ChallengeType(row.Type),
+		Hostname:    row.Hostname,
+		PublicKey:   row.PublicKey,
+		Token:       row.Token,
+		Status:      enroll.ChallengeStatus(row.Status),
+		Error:       row.Error.String,
+		Certificate: certificate,
+		ExpiresAt:   row.ExpiresAt,
+	}
+	if ch.Type == enroll.HTTP01 && ch.Status == enroll.ChallengePending {
+		ch.KeyAuthorization, _ = KeyAuthorization(&ch)
+	}
+	return ch
+}
+
+// hostCertificate prepares an unsigned host certificate naming only the verified hostname
+func hostCertificate(pub ssh.PublicKey, hostname string, now time.Time) *ssh.Certificate {
+	return &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.HostCert,
+		KeyId:           hostname,
+		ValidPrincipals: []string{hostname},
+		ValidAfter:      uint64(now.Add(-5 * time.Minute).Unix()), // tolerate clock skew
+		ValidBefore:     uint64(now.Add(hostCertValidity).Unix()),
+	}
+}
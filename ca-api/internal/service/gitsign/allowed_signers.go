@@ -0,0 +1,79 @@
+package gitsign
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/gitsign"
+	"golang.org/x/crypto/ssh"
+)
+
+// allowed_signers timestamps, see ssh-keygen(1) ALLOWED SIGNERS
+const timeFormat = "20060102150405Z"
+
+// NewSigningCertificate prepares an unsigned user certificate for commit signing.
+// The email is the only principal so git can match it against the committer, and no
+// extensions are set since the certificate is never meant to open a session.
+func NewSigningCertificate(pub ssh.PublicKey, email string, tmpl gitsign.SigningTemplate, now time.Time) *ssh.Certificate {
+	return &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		KeyId:           fmt.Sprintf("%s:%s", tmpl.Namespace, email),
+		ValidPrincipals: []string{email},
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(tmpl.Validity).Unix()),
+	}
+}
+
+// Entries builds one cert-authority line per contributor trusting certificates from caKey
+func Entries(caKey ssh.PublicKey, namespace string, contributors []gitsign.Contributor) []gitsign.AllowedSigner {
+	if namespace == "" {
+		namespace = gitsign.DefaultNamespace
+	}
+	key := string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(caKey)))
+
+	entries := make([]gitsign.AllowedSigner, 0, len(contributors))
+	for _, c := range contributors {
+		entries = append(entries, gitsign.AllowedSigner{
+			Principals:  []string{strings.ToLower(c.Email)},
+			Namespaces:  []string{namespace},
+			ValidAfter:  c.ValidAfter,
+			ValidBefore: c.ValidBefore,
+			CAKey:       key,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Principals[0] < entries[j].Principals[0]
+	})
+	return entries
+}
+
+// Format renders an entry as an allowed_signers line
+func Format(e gitsign.AllowedSigner) string {
+	opts := []string{"cert-authority"}
+	if len(e.Namespaces) > 0 {
+		opts = append(opts, fmt.Sprintf("namespaces=%q", strings.Join(e.Namespaces, ",")))
+	}
+	if !e.ValidAfter.IsZero() {
+		opts = append(opts, fmt.Sprintf("valid-after=%q", e.ValidAfter.UTC().Format(timeFormat)))
+	}
+	if !e.ValidBefore.IsZero() {
+		opts = append(opts, fmt.Sprintf("valid-before=%q", e.ValidBefore.UTC().Format(timeFormat)))
+	}
+	return fmt.Sprintf("%s %s %s", strings.Join(e.Principals, ","), strings.Join(opts, ","), e.CAKey)
+}
+
+// Write renders a complete allowed_signers file
+func Write(w io.Writer, entries []gitsign.AllowedSigner) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintln(w, Format(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
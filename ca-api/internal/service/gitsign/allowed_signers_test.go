@@ -0,0 +1,136 @@
+package gitsign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/gitsign"
+	"golang.org/x/crypto/ssh"
+)
+
+func newKey(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, key
+}
+
+var testTemplate = gitsign.SigningTemplate{
+	Name:      gitsign.TemplateType,
+	Namespace: gitsign.DefaultNamespace,
+	Validity:  time.Hour,
+}
+
+func TestFormat(t *testing.T) {
+	ca, _ := newKey(t)
+	validAfter := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := Entries(ca.PublicKey(), "", []gitsign.Contributor{
+		{Email: "Bob@Example.com"},
+		{Email: "alice@example.com", ValidAfter: validAfter, ValidBefore: validAfter.Add(24 * time.Hour)},
+	})
+
+	var buf bytes.Buffer
+	if err := Write(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	caKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+	want := `alice@example.com cert-authority,namespaces="git",valid-after="20260102030405Z",valid-before="20260103030405Z" ` + caKey + "\n" +
+		`bob@example.com cert-authority,namespaces="git" ` + caKey + "\n"
+	if buf.String() != want {
+		t.Fatalf("Write() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+// TestVerifyWithSSHKeygen signs a commit message with an issued certificate and
+// checks the rendered file the way git does, with ssh-keygen -Y verify
+func TestVerifyWithSSHKeygen(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	ca, _ := newKey(t)
+	user, userKey := newKey(t)
+	dir := t.TempDir()
+
+	now := time.Now()
+	cert := NewSigningCertificate(user.PublicKey(), "alice@example.com", testTemplate, now)
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(userKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ed25519")
+	writeFile(t, keyPath, pem.EncodeToMemory(block), 0600)
+	writeFile(t, keyPath+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0644)
+
+	var signers bytes.Buffer
+	if err := Write(&signers, Entries(ca.PublicKey(), "", []gitsign.Contributor{
+		{Email: "alice@example.com", ValidAfter: now.Add(-time.Minute), ValidBefore: now.Add(testTemplate.Validity)},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	signersPath := filepath.Join(dir, "allowed_signers")
+	writeFile(t, signersPath, signers.Bytes(), 0644)
+
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nInitial commit\n")
+	sign := exec.Command("ssh-keygen", "-Y", "sign", "-f", keyPath+"-cert.pub", "-n", gitsign.DefaultNamespace)
+	sign.Stdin = bytes.NewReader(message)
+	signature, err := sign.Output()
+	if err != nil {
+		t.Fatalf("ssh-keygen -Y sign: %v", err)
+	}
+	sigPath := filepath.Join(dir, "commit.sig")
+	writeFile(t, sigPath, signature, 0644)
+
+	verify := func(identity, namespace string) error {
+		cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", signersPath, "-I", identity, "-n", namespace, "-s", sigPath)
+		cmd.Stdin = bytes.NewReader(message)
+		return cmd.Run()
+	}
+	if err := verify("alice@example.com", gitsign.DefaultNamespace); err != nil {
+		t.Fatalf("signature by a listed contributor did not verify: %v", err)
+	}
+	if err := verify("mallory@example.com", gitsign.DefaultNamespace); err == nil {
+		t.Fatal("signature verified for an identity the certificate doesn't name")
+	}
+	if err := verify("alice@example.com", "file"); err == nil {
+		t.Fatal("signature verified in another namespace")
+	}
+}
+
+func TestValidNamespace(t *testing.T) {
+	for ns, want := range map[string]bool{
+		"git":                   true,
+		"ci@example.com":        true,
+		"release-tags_v2":       true,
+		`git",cert-authority`:   false,
+		"git file":              false,
+		strings.Repeat("a", 65): false,
+	} {
+		if got := validNamespace(ns); got != want {
+			t.Errorf("validNamespace(%q) = %v, want %v", ns, got, want)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, perm os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(path, data, perm); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,186 @@
+package gitsign
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	domainca "github.com/dhruvpatel-10/signee/ca-api/internal/domain/ca"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/gitsign"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/ca"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+)
+
+// Service issues commit signing certificates from Template and builds the
+// allowed_signers files that verify them, so Signee is the one place that
+// decides whose signatures a repository accepts.
+type Service struct {
+	Conn     *sql.DB
+	DB       *db.Queries
+	CA       *ca.Authority
+	Template gitsign.SigningTemplate
+}
+
+func invalidRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": message,
+			"status":  http.StatusBadRequest,
+		},
+	})
+}
+
+func internalError(c *gin.Context) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"code":    "INTERNAL_SERVER_ERROR",
+			"message": "Something went wrong. Please try again later.",
+			"status":  http.StatusInternalServerError,
+		},
+	})
+}
+
+// IssueCertificate signs the caller's key for commit signing as their own email
+func (s *Service) IssueCertificate(c *gin.Context) {
+	var req gitsign.NewCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, "Invalid input provided.")
+		return
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	if err != nil {
+		invalidRequest(c, "Invalid public key.")
+		return
+	}
+	if _, isCert := pub.(*ssh.Certificate); isCert {
+		invalidRequest(c, "Public key is already a certificate.")
+		return
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	email := strings.ToLower(principal.Email)
+
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		log.Printf("BeginTx failed: %v", err)
+		internalError(c)
+		return
+	}
+	defer tx.Rollback()
+	q := s.DB.WithTx(tx)
+
+	cert, err := s.CA.Issue(c, q, NewSigningCertificate(pub, email, s.Template, time.Now()), domainca.SourceGitSign, principal.UserID)
+	if err != nil {
+		log.Printf("git signing issue failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	if err := auditlog.Record(c, q, audit.Event{
+		Type:      audit.GitSigningCertificateIssued,
+		ActorID:   principal.UserID,
+		SubjectID: principal.UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata: map[string]any{
+			"certificate_id": cert.ID,
+			"template":       s.Template.Name,
+			"serial":         cert.Serial,
+		},
+	}); err != nil {
+		log.Printf("audit record failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Commit failed: %v", err)
+		internalError(c)
+		return
+	}
+	c.JSON(http.StatusCreated, ca.Info(cert))
+}
+
+// AllowedSigners renders the allowed_signers file for a repository's
+// contributors. Each contributor who was issued a signing certificate by the
+// current CA key gets a cert-authority line, bounded by the validity of those
+// certificates; anyone else is left out, so their signatures won't verify.
+func (s *Service) AllowedSigners(c *gin.Context) {
+	var req gitsign.AllowedSignersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, "Invalid input provided.")
+		return
+	}
+	if req.Namespace == "" {
+		req.Namespace = s.Template.Namespace
+	}
+	if !validNamespace(req.Namespace) {
+		invalidRequest(c, "Invalid namespace.")
+		return
+	}
+
+	emails := make([]string, len(req.Contributors))
+	for i, email := range req.Contributors {
+		emails[i] = strings.ToLower(email)
+	}
+	rawEmails, err := json.Marshal(emails)
+	if err != nil {
+		log.Printf("marshal contributors failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	caKey := s.CA.PublicKey()
+	rows, err := s.DB.ListGitSigningWindows(c, db.ListGitSigningWindowsParams{
+		CaFingerprint: ssh.FingerprintSHA256(caKey),
+		Emails:        rawEmails,
+	})
+	if err != nil {
+		log.Printf("ListGitSigningWindows failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	contributors := make([]gitsign.Contributor, 0, len(rows))
+	for _, row := range rows {
+		contributors = append(contributors, gitsign.Contributor{
+			Email:       row.Email,
+			ValidAfter:  row.ValidAfter,
+			ValidBefore: row.ValidBefore,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, Entries(caKey, req.Namespace, contributors)); err != nil {
+		log.Printf("allowed_signers write failed: %v", err)
+		internalError(c)
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+}
+
+// validNamespace keeps namespaces to characters that need no quoting in an allowed_signers option
+func validNamespace(ns string) bool {
+	if len(ns) > 64 {
+		return false
+	}
+	for _, r := range ns {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("@._-", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
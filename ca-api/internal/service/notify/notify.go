@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"context"
+	"log"
+
+	domainmail "github.com/dhruvpatel-10/signee/ca-api/internal/domain/mail"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/notify"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/mail"
+)
+
+// Notifier delivers security notices to users
+type Notifier interface {
+	Notify(ctx context.Context, msg notify.Message) error
+}
+
+// LogNotifier writes notices to the server log; used until a delivery channel is configured
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	log.Printf("notify %s: %s", msg.To, msg.Subject)
+	return nil
+}
+
+// MailNotifier emails notices
+type MailNotifier struct {
+	Mailer mail.Mailer
+}
+
+func (n MailNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	return n.Mailer.Send(ctx, domainmail.Message{To: msg.To, Subject: msg.Subject, Body: msg.Body})
+}
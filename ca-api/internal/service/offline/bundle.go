@@ -0,0 +1,295 @@
+package offline
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/offline"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrBadSignature     = errors.New("bundle signature does not verify")
+	ErrUnexpectedSigner = errors.New("bundle signed by unexpected key")
+	ErrDigestMismatch   = errors.New("response does not answer this request bundle")
+	ErrIncomplete       = errors.New("response does not answer every request in the bundle")
+)
+
+// Seal signs the JSON encoding of v and wraps it in an envelope
+func Seal(v any, signer ssh.Signer) (*offline.Envelope, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundle: %v", err)
+	}
+
+	sig, err := signer.Sign(rand.Reader, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign bundle: %v", err)
+	}
+
+	return &offline.Envelope{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		SignKey:   string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(signer.PublicKey()))),
+		Format:    sig.Format,
+		Signature: base64.StdEncoding.EncodeToString(sig.Blob),
+	}, nil
+}
+
+// Open verifies the envelope was signed by want and decodes its payload into v.
+// It returns the raw payload so callers can bind responses to it.
+func Open(env *offline.Envelope, want ssh.PublicKey, v any) ([]byte, error) {
+	signKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(env.SignKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %v", err)
+	}
+	if !bytes.Equal(signKey.Marshal(), want.Marshal()) {
+		return nil, ErrUnexpectedSigner
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %v", err)
+	}
+	blob, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %v", err)
+	}
+
+	if err := want.Verify(payload, &ssh.Signature{Format: env.Format, Blob: blob}); err != nil {
+		return nil, ErrBadSignature
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return nil, fmt.Errorf("failed to decode bundle: %v", err)
+	}
+	return payload, nil
+}
+
+// Digest identifies a request payload so a response can't be replayed against another bundle
+func Digest(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewRequestBundle assembles approved requests for export
+func NewRequestBundle(caKey ssh.PublicKey, requests []offline.CertRequest) (*offline.RequestBundle, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate bundle id: %v", err)
+	}
+
+	return &offline.RequestBundle{
+		Version:   offline.BundleVersion,
+		ID:        hex.EncodeToString(id),
+		CreatedAt: time.Now().UTC(),
+		CAKey:     string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(caKey))),
+		Requests:  requests,
+	}, nil
+}
+
+// SignRequests issues a certificate for every request in the bundle with the offline CA key
+func SignRequests(bundle *offline.RequestBundle, payload []byte, ca ssh.Signer) (*offline.ResponseBundle, error) {
+	if bundle.Version != offline.BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+
+	wantCA, _, _, _, err := ssh.ParseAuthorizedKey([]byte(bundle.CAKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA key in bundle: %v", err)
+	}
+	if !bytes.Equal(wantCA.Marshal(), ca.PublicKey().Marshal()) {
+		return nil, fmt.Errorf("bundle was exported for a different CA key")
+	}
+
+	resp := &offline.ResponseBundle{
+		Version:        offline.BundleVersion,
+		RequestBundle:  bundle.ID,
+		RequestsDigest: Digest(payload),
+		SignedAt:       time.Now().UTC(),
+	}
+
+	for _, req := range bundle.Requests {
+		cert, err := signRequest(req, ca)
+		if err != nil {
+			return nil, fmt.Errorf("request %s: %v", req.ID, err)
+		}
+		resp.Certificates = append(resp.Certificates, offline.SignedCert{
+			RequestID:   req.ID,
+			Certificate: string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(cert))),
+		})
+	}
+
+	return resp, nil
+}
+
+func signRequest(req offline.CertRequest, ca ssh.Signer) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+
+	var certType uint32
+	switch req.CertType {
+	case "user":
+		certType = ssh.UserCert
+	case "host":
+		certType = ssh.HostCert
+	default:
+		return nil, fmt.Errorf("unknown cert type %q", req.CertType)
+	}
+
+	serial := make([]byte, 8)
+	if _, err := rand.Read(serial); err != nil {
+		return nil, fmt.Errorf("failed to generate serial: %v", err)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          binary.BigEndian.Uint64(serial),
+		CertType:        certType,
+		KeyId:           req.KeyID,
+		ValidPrincipals: req.Principals,
+		ValidAfter:      uint64(req.ValidAfter.Unix()),
+		ValidBefore:     uint64(req.ValidBefore.Unix()),
+	}
+	if certType == ssh.UserCert {
+		cert.Permissions.Extensions = map[string]string{
+			"permit-pty":              "",
+			"permit-port-forwarding":  "",
+			"permit-agent-forwarding": "",
+		}
+	}
+
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %v", err)
+	}
+	return cert, nil
+}
+
+// VerifyResponse checks every certificate in a response against the request bundle it answers.
+// It returns the certificates keyed by request ID, ready to be ingested.
+func VerifyResponse(bundle *offline.RequestBundle, payload []byte, resp *offline.ResponseBundle) (map[string]*ssh.Certificate, error) {
+	if resp.RequestBundle != bundle.ID || resp.RequestsDigest != Digest(payload) {
+		return nil, ErrDigestMismatch
+	}
+
+	caKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(bundle.CAKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA key in bundle: %v", err)
+	}
+
+	requests := make(map[string]offline.CertRequest, len(bundle.Requests))
+	for _, req := range bundle.Requests {
+		requests[req.ID] = req
+	}
+
+	certs := make(map[string]*ssh.Certificate, len(resp.Certificates))
+	for _, sc := range resp.Certificates {
+		req, ok := requests[sc.RequestID]
+		if !ok {
+			return nil, fmt.Errorf("certificate for unknown request %s", sc.RequestID)
+		}
+		if _, dup := certs[sc.RequestID]; dup {
+			return nil, fmt.Errorf("duplicate certificate for request %s", sc.RequestID)
+		}
+
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sc.Certificate))
+		if err != nil {
+			return nil, fmt.Errorf("request %s: invalid certificate: %v", sc.RequestID, err)
+		}
+		cert, ok := parsed.(*ssh.Certificate)
+		if !ok {
+			return nil, fmt.Errorf("request %s: not a certificate", sc.RequestID)
+		}
+
+		if err := checkCert(cert, req, caKey); err != nil {
+			return nil, fmt.Errorf("request %s: %v", sc.RequestID, err)
+		}
+		certs[sc.RequestID] = cert
+	}
+
+	return certs, nil
+}
+
+// VerifyImport checks a response against the exact payload exported for it.
+// Every request must be answered as approved; the certificates come back
+// keyed by request ID along with the bundle they answer.
+func VerifyImport(payload []byte, resp *offline.ResponseBundle) (*offline.RequestBundle, map[string]*ssh.Certificate, error) {
+	var bundle offline.RequestBundle
+	if err := json.Unmarshal(payload, &bundle); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode bundle: %v", err)
+	}
+
+	certs, err := VerifyResponse(&bundle, payload, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(certs) != len(bundle.Requests) {
+		return nil, nil, ErrIncomplete
+	}
+	return &bundle, certs, nil
+}
+
+// checkCert makes sure the offline CA signed exactly what was approved
+func checkCert(cert *ssh.Certificate, req offline.CertRequest, caKey ssh.PublicKey) error {
+	if !bytes.Equal(cert.SignatureKey.Marshal(), caKey.Marshal()) {
+		return fmt.Errorf("certificate signed by unexpected CA")
+	}
+
+	// Check the signature at the start of the validity window so future-dated
+	// certificates still verify; no critical options were requested, so any are rejected
+	checker := &ssh.CertChecker{
+		Clock: func() time.Time { return time.Unix(int64(cert.ValidAfter), 0) },
+	}
+	if err := checker.CheckCert(firstPrincipal(cert), cert); err != nil {
+		return err
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	if err != nil {
+		return fmt.Errorf("invalid public key: %v", err)
+	}
+	if !bytes.Equal(cert.Key.Marshal(), pub.Marshal()) {
+		return fmt.Errorf("certificate key does not match request")
+	}
+	if certTypeName(cert.CertType) != req.CertType {
+		return fmt.Errorf("certificate type does not match request")
+	}
+	if cert.KeyId != req.KeyID {
+		return fmt.Errorf("certificate key id does not match request")
+	}
+	if cert.ValidAfter != uint64(req.ValidAfter.Unix()) || cert.ValidBefore != uint64(req.ValidBefore.Unix()) {
+		return fmt.Errorf("certificate validity does not match request")
+	}
+	if !slices.Equal(cert.ValidPrincipals, req.Principals) {
+		return fmt.Errorf("certificate principals do not match request")
+	}
+	return nil
+}
+
+func firstPrincipal(cert *ssh.Certificate) string {
+	if len(cert.ValidPrincipals) == 0 {
+		return ""
+	}
+	return cert.ValidPrincipals[0]
+}
+
+func certTypeName(t uint32) string {
+	switch t {
+	case ssh.UserCert:
+		return "user"
+	case ssh.HostCert:
+		return "host"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,243 @@
+package offline
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/offline"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func authorizedKey(pub ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+}
+
+// export plays the API side: it bundles requests for caKey and seals them with the export key
+func export(t *testing.T, exportKey ssh.Signer, caKey ssh.PublicKey, requests []offline.CertRequest) *offline.Envelope {
+	t.Helper()
+	bundle, err := NewRequestBundle(caKey, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := Seal(bundle, exportKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// signOffline plays signee-offline sign: it checks the export and answers it with the CA key
+func signOffline(t *testing.T, env *offline.Envelope, exportKey ssh.PublicKey, ca ssh.Signer) *offline.Envelope {
+	t.Helper()
+	var bundle offline.RequestBundle
+	payload, err := Open(env, exportKey, &bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := SignRequests(&bundle, payload, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal(resp, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+// importResponse plays the API's import: the envelope must come from the CA
+// and answer the payload that was exported
+func importResponse(env *offline.Envelope, caKey ssh.PublicKey, exported *offline.Envelope) (map[string]*ssh.Certificate, error) {
+	var resp offline.ResponseBundle
+	if _, err := Open(env, caKey, &resp); err != nil {
+		return nil, err
+	}
+	payload, err := base64.StdEncoding.DecodeString(exported.Payload)
+	if err != nil {
+		return nil, err
+	}
+	_, certs, err := VerifyImport(payload, &resp)
+	return certs, err
+}
+
+func testRequests(t *testing.T) []offline.CertRequest {
+	t.Helper()
+	now := time.Now().UTC().Truncate(time.Second)
+	return []offline.CertRequest{
+		{
+			ID:          "req-user",
+			PublicKey:   authorizedKey(newSigner(t).PublicKey()),
+			CertType:    "user",
+			KeyID:       "alice@example.com",
+			Principals:  []string{"alice", "deploy"},
+			ValidAfter:  now,
+			ValidBefore: now.Add(8 * time.Hour),
+		},
+		{
+			ID:          "req-host",
+			PublicKey:   authorizedKey(newSigner(t).PublicKey()),
+			CertType:    "host",
+			KeyID:       "db-1.example.com",
+			Principals:  []string{"db-1.example.com"},
+			ValidAfter:  now,
+			ValidBefore: now.Add(30 * 24 * time.Hour),
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	exportKey, ca := newSigner(t), newSigner(t)
+	requests := testRequests(t)
+
+	exported := export(t, exportKey, ca.PublicKey(), requests)
+	response := signOffline(t, exported, exportKey.PublicKey(), ca)
+
+	certs, err := importResponse(response, ca.PublicKey(), exported)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if len(certs) != len(requests) {
+		t.Fatalf("got %d certificates, want %d", len(certs), len(requests))
+	}
+
+	for _, req := range requests {
+		cert := certs[req.ID]
+		if cert == nil {
+			t.Fatalf("no certificate for %s", req.ID)
+		}
+		if authorizedKey(cert.Key) != req.PublicKey || cert.KeyId != req.KeyID {
+			t.Errorf("%s: certificate is for another key", req.ID)
+		}
+
+		// The certificate must verify against the offline CA the way sshd would
+		checker := &ssh.CertChecker{
+			Clock: func() time.Time { return req.ValidAfter.Add(time.Minute) },
+			IsUserAuthority: func(auth ssh.PublicKey) bool {
+				return authorizedKey(auth) == authorizedKey(ca.PublicKey())
+			},
+			IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+				return authorizedKey(auth) == authorizedKey(ca.PublicKey())
+			},
+		}
+		if req.CertType == "user" {
+			if _, err := checker.Authenticate(connMeta(req.Principals[0]), cert); err != nil {
+				t.Errorf("%s: %v", req.ID, err)
+			}
+		} else if err := checker.CheckHostKey(req.Principals[0]+":22", nil, cert); err != nil {
+			t.Errorf("%s: %v", req.ID, err)
+		}
+	}
+}
+
+func TestImportRejectsTampering(t *testing.T) {
+	exportKey, ca := newSigner(t), newSigner(t)
+	requests := testRequests(t)
+	exported := export(t, exportKey, ca.PublicKey(), requests)
+
+	t.Run("export payload altered in transit", func(t *testing.T) {
+		tampered := *exported
+		payload, _ := base64.StdEncoding.DecodeString(tampered.Payload)
+		payload = []byte(strings.Replace(string(payload), `"deploy"`, `"root"`, 1))
+		tampered.Payload = base64.StdEncoding.EncodeToString(payload)
+
+		var bundle offline.RequestBundle
+		if _, err := Open(&tampered, exportKey.PublicKey(), &bundle); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("Open() = %v, want %v", err, ErrBadSignature)
+		}
+	})
+
+	t.Run("export signed by another key", func(t *testing.T) {
+		forged := export(t, newSigner(t), ca.PublicKey(), requests)
+		var bundle offline.RequestBundle
+		if _, err := Open(forged, exportKey.PublicKey(), &bundle); !errors.Is(err, ErrUnexpectedSigner) {
+			t.Fatalf("Open() = %v, want %v", err, ErrUnexpectedSigner)
+		}
+	})
+
+	t.Run("response signed by another CA", func(t *testing.T) {
+		rogue := newSigner(t)
+		// The rogue CA re-bundles the same requests for itself and answers them
+		rebundled := export(t, exportKey, rogue.PublicKey(), requests)
+		response := signOffline(t, rebundled, exportKey.PublicKey(), rogue)
+		if _, err := importResponse(response, ca.PublicKey(), exported); !errors.Is(err, ErrUnexpectedSigner) {
+			t.Fatalf("import = %v, want %v", err, ErrUnexpectedSigner)
+		}
+	})
+
+	t.Run("response answers another bundle", func(t *testing.T) {
+		other := export(t, exportKey, ca.PublicKey(), requests)
+		response := signOffline(t, other, exportKey.PublicKey(), ca)
+		if _, err := importResponse(response, ca.PublicKey(), exported); !errors.Is(err, ErrDigestMismatch) {
+			t.Fatalf("import = %v, want %v", err, ErrDigestMismatch)
+		}
+	})
+
+	t.Run("response leaves a request unanswered", func(t *testing.T) {
+		var resp offline.ResponseBundle
+		openResponse(t, signOffline(t, exported, exportKey.PublicKey(), ca), ca.PublicKey(), &resp)
+		resp.Certificates = resp.Certificates[:1]
+
+		exportedPayload, _ := base64.StdEncoding.DecodeString(exported.Payload)
+		if _, _, err := VerifyImport(exportedPayload, &resp); !errors.Is(err, ErrIncomplete) {
+			t.Fatalf("VerifyImport() = %v, want %v", err, ErrIncomplete)
+		}
+	})
+
+	t.Run("certificate grants more than was approved", func(t *testing.T) {
+		var resp offline.ResponseBundle
+		openResponse(t, signOffline(t, exported, exportKey.PublicKey(), ca), ca.PublicKey(), &resp)
+
+		// Re-sign the user certificate with an extra principal, as a compromised signer might
+		widened := requests[0]
+		widened.Principals = append(widened.Principals, "root")
+		cert, err := signRequest(widened, ca)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range resp.Certificates {
+			if resp.Certificates[i].RequestID == widened.ID {
+				resp.Certificates[i].Certificate = authorizedKey(cert)
+			}
+		}
+
+		exportedPayload, _ := base64.StdEncoding.DecodeString(exported.Payload)
+		if _, _, err := VerifyImport(exportedPayload, &resp); err == nil {
+			t.Fatal("VerifyImport() accepted a certificate with an unapproved principal")
+		}
+	})
+}
+
+func openResponse(t *testing.T, env *offline.Envelope, caKey ssh.PublicKey, resp *offline.ResponseBundle) {
+	t.Helper()
+	if _, err := Open(env, caKey, resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type connMeta string
+
+func (c connMeta) User() string          { return string(c) }
+func (c connMeta) SessionID() []byte     { return nil }
+func (c connMeta) ClientVersion() []byte { return nil }
+func (c connMeta) ServerVersion() []byte { return nil }
+func (c connMeta) RemoteAddr() net.Addr  { return nil }
+func (c connMeta) LocalAddr() net.Addr   { return nil }
@@ -0,0 +1,499 @@
+package offline
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/audit"
+	domainca "github.com/dhruvpatel-10/signee/ca-api/internal/domain/ca"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/offline"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/middleware"
+	auditlog "github.com/dhruvpatel-10/signee/ca-api/internal/service/audit"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/ca"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/translog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	maxBundleRequests = 1000     // requests carried by a single export
+	maxImportBytes    = 16 << 20 // response bundles larger than this are rejected
+)
+
+// Service queues certificate requests for the air-gapped CA. Approved requests
+// are exported in a bundle signed with ExportKey; the response signee-offline
+// produces is only ingested if CAKey signed it and it answers exactly the
+// exported requests.
+type Service struct {
+	Conn      *sql.DB
+	DB        *db.Queries
+	Log       *translog.Log
+	ExportKey ssh.Signer
+	CAKey     ssh.PublicKey // nil when no offline CA is configured
+}
+
+func invalidRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": message,
+			"status":  http.StatusBadRequest,
+		},
+	})
+}
+
+func invalidBundle(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_BUNDLE",
+			"message": message,
+			"status":  http.StatusBadRequest,
+		},
+	})
+}
+
+func conflict(c *gin.Context, code, message string) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error": gin.H{
+			"code":    code,
+			"message": message,
+			"status":  http.StatusConflict,
+		},
+	})
+}
+
+func internalError(c *gin.Context) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"code":    "INTERNAL_SERVER_ERROR",
+			"message": "Something went wrong. Please try again later.",
+			"status":  http.StatusInternalServerError,
+		},
+	})
+}
+
+// configured rejects the request when no offline CA key was set up
+func (s *Service) configured(c *gin.Context) bool {
+	if s.CAKey != nil {
+		return true
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": gin.H{
+			"code":    "OFFLINE_CA_NOT_CONFIGURED",
+			"message": "No offline CA is configured.",
+			"status":  http.StatusServiceUnavailable,
+		},
+	})
+	return false
+}
+
+// CreateRequest queues a certificate request for approval
+func (s *Service) CreateRequest(c *gin.Context) {
+	if !s.configured(c) {
+		return
+	}
+	var req offline.NewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, "Invalid input provided.")
+		return
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	if err != nil {
+		invalidRequest(c, "Invalid public key.")
+		return
+	}
+	if _, isCert := pub.(*ssh.Certificate); isCert {
+		invalidRequest(c, "Public key is already a certificate.")
+		return
+	}
+
+	principals, err := json.Marshal(normalizePrincipals(req.Principals))
+	if err != nil {
+		log.Printf("marshal principals failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	principal := middleware.CurrentPrincipal(c)
+	row, err := s.DB.CreateOfflineRequest(c, db.CreateOfflineRequestParams{
+		PublicKey:       ca.MarshalKey(pub),
+		CertType:        req.CertType,
+		KeyID:           principal.Email,
+		Principals:      principals,
+		ValiditySeconds: int32(req.ValidityHours * 3600),
+		RequestedBy:     principal.UserID,
+	})
+	if err != nil {
+		log.Printf("CreateOfflineRequest failed: %v", err)
+		internalError(c)
+		return
+	}
+	c.JSON(http.StatusCreated, requestInfo(row))
+}
+
+// ListRequests lists requests in one status, pending by default
+func (s *Service) ListRequests(c *gin.Context) {
+	status := c.DefaultQuery("status", offline.RequestPending)
+	rows, err := s.DB.ListOfflineRequestsByStatus(c, status)
+	if err != nil {
+		log.Printf("ListOfflineRequestsByStatus failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	requests := make([]offline.RequestInfo, 0, len(rows))
+	for _, row := range rows {
+		requests = append(requests, requestInfo(row))
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+func (s *Service) ApproveRequest(c *gin.Context) {
+	s.decideRequest(c, offline.RequestApproved, audit.CertificateRequestApproved)
+}
+
+func (s *Service) RejectRequest(c *gin.Context) {
+	s.decideRequest(c, offline.RequestRejected, audit.CertificateRequestRejected)
+}
+
+func (s *Service) decideRequest(c *gin.Context, status string, event audit.EventType) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		conflict(c, "REQUEST_NOT_PENDING", "No pending request with this id.")
+		return
+	}
+	principal := middleware.CurrentPrincipal(c)
+
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		log.Printf("BeginTx failed: %v", err)
+		internalError(c)
+		return
+	}
+	defer tx.Rollback()
+	q := s.DB.WithTx(tx)
+
+	decided, err := q.DecideOfflineRequest(c, db.DecideOfflineRequestParams{
+		ID:        id,
+		Status:    status,
+		DecidedBy: uuid.NullUUID{UUID: principal.UserID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("DecideOfflineRequest failed: %v", err)
+		internalError(c)
+		return
+	}
+	if decided == 0 {
+		conflict(c, "REQUEST_NOT_PENDING", "No pending request with this id.")
+		return
+	}
+
+	if err := auditlog.Record(c, q, audit.Event{
+		Type:      event,
+		ActorID:   principal.UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"request_id": id.String()},
+	}); err != nil {
+		log.Printf("audit %s failed: %v", event, err)
+		internalError(c)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Commit failed: %v", err)
+		internalError(c)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetExportKey returns the public key bundles are signed with, for signee-offline -export-key
+func (s *Service) GetExportKey(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"public_key": ca.MarshalKey(s.ExportKey.PublicKey())})
+}
+
+// ExportBundle moves the oldest approved requests into a new signed bundle.
+// Validity windows start now, so certificates aren't half spent by the time
+// the bundle has made it to the offline CA and back.
+func (s *Service) ExportBundle(c *gin.Context) {
+	if !s.configured(c) {
+		return
+	}
+	principal := middleware.CurrentPrincipal(c)
+
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		log.Printf("BeginTx failed: %v", err)
+		internalError(c)
+		return
+	}
+	defer tx.Rollback()
+	q := s.DB.WithTx(tx)
+
+	rows, err := q.ListApprovedOfflineRequestsForUpdate(c, maxBundleRequests)
+	if err != nil {
+		log.Printf("ListApprovedOfflineRequestsForUpdate failed: %v", err)
+		internalError(c)
+		return
+	}
+	if len(rows) == 0 {
+		conflict(c, "NOTHING_TO_EXPORT", "No approved requests are waiting for export.")
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	requests := make([]offline.CertRequest, 0, len(rows))
+	for _, row := range rows {
+		var principals []string
+		if err := json.Unmarshal(row.Principals, &principals); err != nil {
+			log.Printf("decode principals of request %s failed: %v", row.ID, err)
+			internalError(c)
+			return
+		}
+		requests = append(requests, offline.CertRequest{
+			ID:          row.ID.String(),
+			PublicKey:   row.PublicKey,
+			CertType:    row.CertType,
+			KeyID:       row.KeyID,
+			Principals:  principals,
+			ValidAfter:  now,
+			ValidBefore: now.Add(time.Duration(row.ValiditySeconds) * time.Second),
+		})
+	}
+
+	bundle, err := NewRequestBundle(s.CAKey, requests)
+	if err != nil {
+		log.Printf("NewRequestBundle failed: %v", err)
+		internalError(c)
+		return
+	}
+	env, err := Seal(bundle, s.ExportKey)
+	if err != nil {
+		log.Printf("Seal failed: %v", err)
+		internalError(c)
+		return
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		log.Printf("decode sealed payload failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	if err := q.CreateOfflineBundle(c, db.CreateOfflineBundleParams{
+		ID:         bundle.ID,
+		Payload:    payload,
+		ExportedBy: uuid.NullUUID{UUID: principal.UserID, Valid: true},
+	}); err != nil {
+		log.Printf("CreateOfflineBundle failed: %v", err)
+		internalError(c)
+		return
+	}
+	for _, row := range rows {
+		if err := q.MarkOfflineRequestExported(c, db.MarkOfflineRequestExportedParams{
+			ID:       row.ID,
+			BundleID: sql.NullString{String: bundle.ID, Valid: true},
+		}); err != nil {
+			log.Printf("MarkOfflineRequestExported failed: %v", err)
+			internalError(c)
+			return
+		}
+	}
+
+	if err := auditlog.Record(c, q, audit.Event{
+		Type:      audit.OfflineBundleExported,
+		ActorID:   principal.UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"bundle_id": bundle.ID, "requests": len(requests)},
+	}); err != nil {
+		log.Printf("audit %s failed: %v", audit.OfflineBundleExported, err)
+		internalError(c)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Commit failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="signee-bundle-`+bundle.ID+`.json"`)
+	c.JSON(http.StatusOK, env)
+}
+
+// ImportBundle ingests the offline CA's response to an exported bundle. The
+// envelope must be signed by the offline CA, answer every exported request
+// exactly as approved, and is only accepted once. Each certificate is stored
+// and appended to the transparency log in the same transaction.
+func (s *Service) ImportBundle(c *gin.Context) {
+	if !s.configured(c) {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	var env offline.Envelope
+	if err := c.ShouldBindJSON(&env); err != nil {
+		invalidRequest(c, "Invalid input provided.")
+		return
+	}
+
+	var resp offline.ResponseBundle
+	if _, err := Open(&env, s.CAKey, &resp); err != nil {
+		log.Printf("offline import rejected: %v", err)
+		invalidBundle(c, "The response is not signed by the offline CA.")
+		return
+	}
+
+	bundleRow, err := s.DB.GetOfflineBundle(c, resp.RequestBundle)
+	if errors.Is(err, sql.ErrNoRows) {
+		invalidBundle(c, "The response answers a bundle that was never exported.")
+		return
+	}
+	if err != nil {
+		log.Printf("GetOfflineBundle failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	bundle, certs, err := VerifyImport(bundleRow.Payload, &resp)
+	if err != nil {
+		log.Printf("offline import of bundle %s rejected: %v", bundleRow.ID, err)
+		invalidBundle(c, "The response does not match the exported requests.")
+		return
+	}
+
+	issued, ok := s.ingest(c, bundle, certs)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"certificates": issued})
+}
+
+// ingest records every certificate of a verified response in one transaction
+func (s *Service) ingest(c *gin.Context, bundle *offline.RequestBundle, certs map[string]*ssh.Certificate) ([]domainca.Certificate, bool) {
+	principal := middleware.CurrentPrincipal(c)
+	bundleID := sql.NullString{String: bundle.ID, Valid: true}
+
+	tx, err := s.Conn.BeginTx(c, nil)
+	if err != nil {
+		log.Printf("BeginTx failed: %v", err)
+		internalError(c)
+		return nil, false
+	}
+	defer tx.Rollback()
+	q := s.DB.WithTx(tx)
+
+	imported, err := q.MarkOfflineBundleImported(c, bundle.ID)
+	if err != nil {
+		log.Printf("MarkOfflineBundleImported failed: %v", err)
+		internalError(c)
+		return nil, false
+	}
+	if imported == 0 {
+		conflict(c, "BUNDLE_ALREADY_IMPORTED", "This bundle has already been imported.")
+		return nil, false
+	}
+
+	rows, err := q.ListExportedOfflineRequestsForUpdate(c, bundleID)
+	if err != nil {
+		log.Printf("ListExportedOfflineRequestsForUpdate failed: %v", err)
+		internalError(c)
+		return nil, false
+	}
+	if len(rows) != len(bundle.Requests) {
+		log.Printf("offline import of bundle %s: %d of %d requests still exported", bundle.ID, len(rows), len(bundle.Requests))
+		invalidBundle(c, "The response does not match the exported requests.")
+		return nil, false
+	}
+
+	issued := make([]domainca.Certificate, 0, len(rows))
+	for _, row := range rows {
+		cert, ok := certs[row.ID.String()]
+		if !ok {
+			invalidBundle(c, "The response does not match the exported requests.")
+			return nil, false
+		}
+
+		stored, err := ca.Record(c, s.Log, q, cert, domainca.SourceOffline, row.RequestedBy)
+		if err != nil {
+			log.Printf("record offline certificate for request %s failed: %v", row.ID, err)
+			internalError(c)
+			return nil, false
+		}
+		if _, err := q.IssueOfflineRequest(c, db.IssueOfflineRequestParams{
+			ID:            row.ID,
+			CertificateID: uuid.NullUUID{UUID: stored.ID, Valid: true},
+			BundleID:      bundleID,
+		}); err != nil {
+			log.Printf("IssueOfflineRequest failed: %v", err)
+			internalError(c)
+			return nil, false
+		}
+		issued = append(issued, ca.Info(stored))
+	}
+
+	if err := auditlog.Record(c, q, audit.Event{
+		Type:      audit.OfflineBundleImported,
+		ActorID:   principal.UserID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Metadata:  map[string]any{"bundle_id": bundle.ID, "certificates": len(issued)},
+	}); err != nil {
+		log.Printf("audit %s failed: %v", audit.OfflineBundleImported, err)
+		internalError(c)
+		return nil, false
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Commit failed: %v", err)
+		internalError(c)
+		return nil, false
+	}
+	return issued, true
+}
+
+func requestInfo(row db.OfflineRequest) offline.RequestInfo {
+	var principals []string
+	json.Unmarshal(row.Principals, &principals)
+
+	info := offline.RequestInfo{
+		ID:            row.ID.String(),
+		PublicKey:     row.PublicKey,
+		CertType:      row.CertType,
+		KeyID:         row.KeyID,
+		Principals:    principals,
+		ValidityHours: int(row.ValiditySeconds / 3600),
+		Status:        row.Status,
+		RequestedBy:   row.RequestedBy.String(),
+		BundleID:      row.BundleID.String,
+		CreatedAt:     row.CreatedAt,
+	}
+	if row.CertificateID.Valid {
+		info.CertificateID = row.CertificateID.UUID.String()
+	}
+	return info
+}
+
+// normalizePrincipals trims and drops duplicate principals
+func normalizePrincipals(principals []string) []string {
+	seen := make(map[string]bool, len(principals))
+	out := make([]string, 0, len(principals))
+	for _, p := range principals {
+		p = strings.TrimSpace(p)
+		if p != "" && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
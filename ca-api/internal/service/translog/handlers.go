@@ -0,0 +1,132 @@
+package translog
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/translog"
+	"github.com/gin-gonic/gin"
+)
+
+// Maximum number of entries returned by a single GetEntries call
+const maxEntriesPerPage = 1000
+
+func invalidRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"code":    "INVALID_REQUEST",
+			"message": message,
+			"status":  http.StatusBadRequest,
+		},
+	})
+}
+
+func internalError(c *gin.Context) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"code":    "INTERNAL_SERVER_ERROR",
+			"message": "Something went wrong. Please try again later.",
+			"status":  http.StatusInternalServerError,
+		},
+	})
+}
+
+// proofError maps proof construction errors to responses
+func proofError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrTreeSizeTooLarge):
+		invalidRequest(c, "Tree size exceeds the current log size.")
+	case errors.Is(err, ErrInvalidProof):
+		invalidRequest(c, "Requested proof parameters are out of range.")
+	default:
+		log.Printf("transparency log proof failed: %v", err)
+		internalError(c)
+	}
+}
+
+func (l *Log) GetSignedTreeHead(c *gin.Context) {
+	sth, err := l.SignedTreeHead(c)
+	if err != nil {
+		log.Printf("SignedTreeHead failed: %v", err)
+		internalError(c)
+		return
+	}
+	c.JSON(http.StatusOK, sth)
+}
+
+func (l *Log) GetPublicKey(c *gin.Context) {
+	der, err := x509.MarshalPKIXPublicKey(l.PublicKey())
+	if err != nil {
+		log.Printf("MarshalPKIXPublicKey failed: %v", err)
+		internalError(c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+}
+
+func (l *Log) GetInclusionProof(c *gin.Context) {
+	var req translog.InclusionProofQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		invalidRequest(c, "Invalid input provided.")
+		return
+	}
+
+	proof, err := l.InclusionProof(c, req.LeafIndex, req.TreeSize)
+	if err != nil {
+		proofError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, proof)
+}
+
+func (l *Log) GetConsistencyProof(c *gin.Context) {
+	var req translog.ConsistencyProofQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		invalidRequest(c, "Invalid input provided.")
+		return
+	}
+
+	proof, err := l.ConsistencyProof(c, req.First, req.Second)
+	if err != nil {
+		proofError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, proof)
+}
+
+func (l *Log) GetEntries(c *gin.Context) {
+	var req translog.EntriesQuery
+	if err := c.ShouldBindQuery(&req); err != nil || req.End <= req.Start {
+		invalidRequest(c, "Invalid input provided.")
+		return
+	}
+	if req.End-req.Start > maxEntriesPerPage {
+		req.End = req.Start + maxEntriesPerPage
+	}
+
+	rows, err := l.DB.ListTransparencyLogEntries(c, db.ListTransparencyLogEntriesParams{
+		StartIndex: req.Start,
+		EndIndex:   req.End,
+	})
+	if err != nil {
+		log.Printf("ListTransparencyLogEntries failed: %v", err)
+		internalError(c)
+		return
+	}
+
+	entries := make([]translog.LogEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, translog.LogEntry{
+			LeafIndex:   row.LeafIndex,
+			Certificate: row.Certificate,
+			LeafHash:    row.LeafHash,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
@@ -0,0 +1,276 @@
+package translog
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dhruvpatel-10/signee/ca-api/db"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/domain/translog"
+)
+
+var ErrTreeSizeTooLarge = errors.New("tree size exceeds log size")
+
+// syncPageSize bounds how many leaf hashes one query loads into the cached tree
+const syncPageSize = 10000
+
+// Log is an append-only RFC 6962 style log of issued certificates
+type Log struct {
+	Conn       *sql.DB
+	DB         *db.Queries
+	signingKey ed25519.PrivateKey
+
+	tree   tree
+	syncMu sync.Mutex                              // one loader at a time
+	head   atomic.Pointer[translog.SignedTreeHead] // latest head served
+}
+
+func NewLog(conn *sql.DB, queries *db.Queries, keyPath string) (*Log, error) {
+	key, err := loadOrGenerateSigningKey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize log signing key: %v", err)
+	}
+	return &Log{Conn: conn, DB: queries, signingKey: key}, nil
+}
+
+func (l *Log) PublicKey() ed25519.PublicKey {
+	return l.signingKey.Public().(ed25519.PublicKey)
+}
+
+// Append adds a certificate to the log in its own transaction and returns its leaf index
+func (l *Log) Append(ctx context.Context, certificate string) (int64, error) {
+	tx, err := l.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	index, err := l.AppendWith(ctx, l.DB.WithTx(tx), certificate)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
+// AppendWith adds a certificate to the log using transaction-bound queries, so
+// the entry commits or rolls back together with the issuance it records.
+// Appends are serialized with an advisory lock so leaf indexes stay dense.
+func (l *Log) AppendWith(ctx context.Context, q *db.Queries, certificate string) (int64, error) {
+	certificate = strings.TrimSpace(certificate)
+
+	if err := q.LockTransparencyLog(ctx); err != nil {
+		return 0, err
+	}
+
+	size, err := q.GetTransparencyLogSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	entry, err := q.AppendTransparencyLogEntry(ctx, db.AppendTransparencyLogEntryParams{
+		LeafIndex:   size,
+		Certificate: certificate,
+		LeafHash:    LeafHash([]byte(certificate)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return entry.LeafIndex, nil
+}
+
+// sync loads entries appended since the last call into the cached tree and
+// returns the log size. Entries are immutable, so each leaf is read only once
+// per process; entries appended by other instances are picked up the same way.
+func (l *Log) sync(ctx context.Context) (int64, error) {
+	size, err := l.DB.GetTransparencyLogSize(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+
+	for cached := l.tree.size(); cached < size; cached = l.tree.size() {
+		leaves, err := l.DB.ListTransparencyLogLeafHashes(ctx, db.ListTransparencyLogLeafHashesParams{
+			StartIndex: cached,
+			EndIndex:   min(size, cached+syncPageSize),
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(leaves) == 0 {
+			return 0, fmt.Errorf("transparency log has no entry at index %d", cached)
+		}
+		l.tree.append(leaves)
+	}
+	return size, nil
+}
+
+// SignedTreeHead returns the signed root of the log at its current size. A
+// size is signed once and the head is stored, so polling clients cost a size
+// lookup rather than a signature and a pass over the log.
+func (l *Log) SignedTreeHead(ctx context.Context) (*translog.SignedTreeHead, error) {
+	size, err := l.sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sth := l.head.Load(); sth != nil && sth.TreeSize == size {
+		return sth, nil
+	}
+
+	row, err := l.DB.GetTransparencyLogHead(ctx, size)
+	if errors.Is(err, sql.ErrNoRows) {
+		l.tree.mu.RLock()
+		root := l.tree.hash(0, uint64(size))
+		l.tree.mu.RUnlock()
+
+		sth := &translog.SignedTreeHead{
+			TreeSize:  size,
+			Timestamp: time.Now().UnixMilli(),
+			RootHash:  root,
+		}
+		sth.Signature = ed25519.Sign(l.signingKey, TreeHeadInput(sth))
+
+		if err := l.DB.CreateTransparencyLogHead(ctx, db.CreateTransparencyLogHeadParams{
+			TreeSize:    sth.TreeSize,
+			TimestampMs: sth.Timestamp,
+			RootHash:    sth.RootHash,
+			Signature:   sth.Signature,
+		}); err != nil {
+			return nil, err
+		}
+		// Another instance may have signed this size first; serve its head
+		row, err = l.DB.GetTransparencyLogHead(ctx, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sth := &translog.SignedTreeHead{
+		TreeSize:  row.TreeSize,
+		Timestamp: row.TimestampMs,
+		RootHash:  row.RootHash,
+		Signature: row.Signature,
+	}
+	// Keep the newest head; an older size may finish signing after a newer one
+	for {
+		cur := l.head.Load()
+		if cur != nil && cur.TreeSize >= sth.TreeSize {
+			break
+		}
+		if l.head.CompareAndSwap(cur, sth) {
+			break
+		}
+	}
+	return sth, nil
+}
+
+func (l *Log) InclusionProof(ctx context.Context, leafIndex, treeSize int64) (*translog.InclusionProof, error) {
+	if err := l.syncTo(ctx, treeSize); err != nil {
+		return nil, err
+	}
+
+	l.tree.mu.RLock()
+	defer l.tree.mu.RUnlock()
+
+	path, err := inclusionProof(&l.tree, uint64(leafIndex), uint64(treeSize))
+	if err != nil {
+		return nil, err
+	}
+	return &translog.InclusionProof{
+		LeafIndex: leafIndex,
+		TreeSize:  treeSize,
+		LeafHash:  l.tree.leaf(leafIndex),
+		AuditPath: path,
+	}, nil
+}
+
+func (l *Log) ConsistencyProof(ctx context.Context, first, second int64) (*translog.ConsistencyProof, error) {
+	if err := l.syncTo(ctx, second); err != nil {
+		return nil, err
+	}
+
+	l.tree.mu.RLock()
+	defer l.tree.mu.RUnlock()
+
+	proof, err := consistencyProof(&l.tree, uint64(first), uint64(second))
+	if err != nil {
+		return nil, err
+	}
+	return &translog.ConsistencyProof{First: first, Second: second, Proof: proof}, nil
+}
+
+// syncTo makes sure the cached tree covers treeSize leaves
+func (l *Log) syncTo(ctx context.Context, treeSize int64) error {
+	if treeSize <= l.tree.size() {
+		return nil
+	}
+	size, err := l.sync(ctx)
+	if err != nil {
+		return err
+	}
+	if treeSize > size {
+		return ErrTreeSizeTooLarge
+	}
+	return nil
+}
+
+// TreeHeadInput is the RFC 6962 TreeHeadSignature structure covered by the STH signature
+func TreeHeadInput(sth *translog.SignedTreeHead) []byte {
+	b := make([]byte, 0, 2+8+8+len(sth.RootHash))
+	b = append(b, 0, 1) // v1, tree_hash
+	b = binary.BigEndian.AppendUint64(b, uint64(sth.Timestamp))
+	b = binary.BigEndian.AppendUint64(b, uint64(sth.TreeSize))
+	return append(b, sth.RootHash...)
+}
+
+// VerifyTreeHead checks an STH signature against the log public key
+func VerifyTreeHead(pub ed25519.PublicKey, sth *translog.SignedTreeHead) bool {
+	return ed25519.Verify(pub, TreeHeadInput(sth), sth.Signature)
+}
+
+// loadOrGenerateSigningKey loads the Ed25519 log key or generates and saves a new one
+func loadOrGenerateSigningKey(filename string) (ed25519.PrivateKey, error) {
+	if data, err := os.ReadFile(filename); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "PRIVATE KEY" {
+			return nil, fmt.Errorf("invalid PEM block in %s", filename)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse log key: %v", err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("log key in %s is not Ed25519", filename)
+		}
+		return edKey, nil
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate log key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log key: %v", err)
+	}
+	if err := os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save log key: %v", err)
+	}
+	return key, nil
+}
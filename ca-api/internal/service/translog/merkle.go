@@ -0,0 +1,197 @@
+package translog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+// Merkle tree hashing as specified in RFC 6962 section 2.1
+
+var ErrInvalidProof = errors.New("invalid merkle proof")
+
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// splitPoint is the largest power of two smaller than n
+func splitPoint(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+// subtrees yields MTH(D[start:end]) for ranges of a tree. Proofs only ever
+// ask for ranges produced by splitPoint, so a memoized tree can answer most
+// of them without touching the leaves.
+type subtrees interface {
+	hash(start, end uint64) []byte
+}
+
+// leafList hashes subtrees straight from the leaf hashes
+type leafList [][]byte
+
+func (l leafList) hash(start, end uint64) []byte {
+	switch end - start {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return l[start]
+	}
+	k := splitPoint(end - start)
+	return nodeHash(l.hash(start, start+k), l.hash(start+k, end))
+}
+
+// RootHash computes MTH over the given leaf hashes
+func RootHash(leaves [][]byte) []byte {
+	return leafList(leaves).hash(0, uint64(len(leaves)))
+}
+
+// InclusionProof returns PATH(m, D[n]) for the leaf at index m
+func InclusionProof(m uint64, leaves [][]byte) ([][]byte, error) {
+	return inclusionProof(leafList(leaves), m, uint64(len(leaves)))
+}
+
+func inclusionProof(t subtrees, m, n uint64) ([][]byte, error) {
+	if m >= n {
+		return nil, ErrInvalidProof
+	}
+	return inclusionPath(t, m, 0, n), nil
+}
+
+// inclusionPath is PATH(m, D[start:end]) with m relative to start
+func inclusionPath(t subtrees, m, start, end uint64) [][]byte {
+	n := end - start
+	if n <= 1 {
+		return nil
+	}
+	k := splitPoint(n)
+	if m < k {
+		return append(inclusionPath(t, m, start, start+k), t.hash(start+k, end))
+	}
+	return append(inclusionPath(t, m-k, start+k, end), t.hash(start, start+k))
+}
+
+// ConsistencyProof returns PROOF(m, D[n]) between tree sizes m and n
+func ConsistencyProof(m uint64, leaves [][]byte) ([][]byte, error) {
+	return consistencyProof(leafList(leaves), m, uint64(len(leaves)))
+}
+
+func consistencyProof(t subtrees, m, n uint64) ([][]byte, error) {
+	if m == 0 || m > n {
+		return nil, ErrInvalidProof
+	}
+	if m == n {
+		return nil, nil
+	}
+	return subProof(t, m, 0, n, true), nil
+}
+
+// subProof is SUBPROOF(m, D[start:end], complete) with m relative to start
+func subProof(t subtrees, m, start, end uint64, complete bool) [][]byte {
+	n := end - start
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{t.hash(start, end)}
+	}
+	k := splitPoint(n)
+	if m <= k {
+		return append(subProof(t, m, start, start+k, complete), t.hash(start+k, end))
+	}
+	return append(subProof(t, m-k, start+k, end, false), t.hash(start, start+k))
+}
+
+// VerifyInclusion checks that leafHash sits at index in a tree of size treeSize with the given root
+func VerifyInclusion(index, treeSize uint64, leafHash []byte, proof [][]byte, root []byte) error {
+	if index >= treeSize {
+		return ErrInvalidProof
+	}
+
+	// RFC 9162 section 2.1.3.2
+	fn, sn := index, treeSize-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the tree with firstRoot is a prefix of the tree with secondRoot
+func VerifyConsistency(first, second uint64, firstRoot, secondRoot []byte, proof [][]byte) error {
+	if first == 0 || first > second {
+		return ErrInvalidProof
+	}
+	if first == second {
+		if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrInvalidProof
+		}
+		return nil
+	}
+
+	// RFC 9162 section 2.1.4.2
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return ErrInvalidProof
+	}
+
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrInvalidProof
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package translog
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"sync"
+)
+
+// tree keeps every complete subtree hash of the log in memory. Entries never
+// change once written, so the cache only grows: a root or proof over n leaves
+// costs O(log² n) hashes of ragged right edges instead of rehashing the log.
+// Each node takes sha256.Size bytes, about 64 bytes per log entry in total.
+type tree struct {
+	mu sync.RWMutex
+	// levels[k] holds the hashes of the aligned subtrees of 2^k leaves, back to back
+	levels [][]byte
+}
+
+// size is the number of leaves in the tree
+func (t *tree) size() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.leaves()
+}
+
+func (t *tree) leaves() int64 {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return int64(len(t.levels[0]) / sha256.Size)
+}
+
+// append adds leaf hashes to the right edge of the tree
+func (t *tree) append(leaves [][]byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, leaf := range leaves {
+		h := leaf
+		for k := 0; ; k++ {
+			if k == len(t.levels) {
+				t.levels = append(t.levels, nil)
+			}
+			t.levels[k] = append(t.levels[k], h...)
+			n := len(t.levels[k]) / sha256.Size
+			if n%2 == 1 {
+				break
+			}
+			// A left sibling is now complete; its parent is too
+			h = nodeHash(t.node(k, n-2), t.node(k, n-1))
+		}
+	}
+}
+
+func (t *tree) node(level int, i int) []byte {
+	return t.levels[level][i*sha256.Size : (i+1)*sha256.Size]
+}
+
+// hash implements subtrees. Callers hold the read lock and keep end within size.
+func (t *tree) hash(start, end uint64) []byte {
+	n := end - start
+	if n == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	}
+	if n&(n-1) == 0 && start%n == 0 {
+		k := bits.TrailingZeros64(n)
+		return t.node(k, int(start>>k))
+	}
+	k := splitPoint(n)
+	return nodeHash(t.hash(start, start+k), t.hash(start+k, end))
+}
+
+// leaf returns the hash of the leaf at index i
+func (t *tree) leaf(i int64) []byte {
+	return t.node(0, int(i))
+}
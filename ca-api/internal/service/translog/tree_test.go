@@ -0,0 +1,92 @@
+package translog
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = LeafHash(fmt.Appendf(nil, "cert-%d", i))
+	}
+	return leaves
+}
+
+// The cached tree must agree with hashing the leaves directly, whether it was
+// filled in one batch or a leaf at a time
+func TestTreeMatchesLeaves(t *testing.T) {
+	const max = 70
+	leaves := testLeaves(max)
+
+	var batched, incremental tree
+	batched.append(leaves[:max/2])
+	batched.append(leaves[max/2:])
+
+	for n := uint64(1); n <= max; n++ {
+		incremental.append(leaves[n-1 : n])
+		prefix := leafList(leaves[:n])
+
+		root := RootHash(leaves[:n])
+		if got := incremental.hash(0, n); !bytes.Equal(got, root) {
+			t.Fatalf("size %d: incremental root differs", n)
+		}
+		if got := batched.hash(0, n); !bytes.Equal(got, root) {
+			t.Fatalf("size %d: batched root differs", n)
+		}
+
+		for m := uint64(0); m < n; m++ {
+			want, _ := inclusionProof(prefix, m, n)
+			got, err := inclusionProof(&batched, m, n)
+			if err != nil || !equalPaths(got, want) {
+				t.Fatalf("inclusion(%d, %d) differs: %v", m, n, err)
+			}
+			if err := VerifyInclusion(m, n, batched.leaf(int64(m)), got, root); err != nil {
+				t.Fatalf("inclusion(%d, %d) does not verify: %v", m, n, err)
+			}
+		}
+
+		for m := uint64(1); m <= n; m++ {
+			want, _ := consistencyProof(prefix, m, n)
+			got, err := consistencyProof(&batched, m, n)
+			if err != nil || !equalPaths(got, want) {
+				t.Fatalf("consistency(%d, %d) differs: %v", m, n, err)
+			}
+			if err := VerifyConsistency(m, n, RootHash(leaves[:m]), root, got); err != nil {
+				t.Fatalf("consistency(%d, %d) does not verify: %v", m, n, err)
+			}
+		}
+	}
+
+	if batched.size() != max || incremental.size() != max {
+		t.Fatalf("size = %d, %d, want %d", batched.size(), incremental.size(), max)
+	}
+}
+
+func TestTreeRejectsBadRanges(t *testing.T) {
+	var tr tree
+	tr.append(testLeaves(5))
+
+	if _, err := inclusionProof(&tr, 5, 5); err != ErrInvalidProof {
+		t.Errorf("inclusion past the end = %v, want %v", err, ErrInvalidProof)
+	}
+	if _, err := consistencyProof(&tr, 0, 5); err != ErrInvalidProof {
+		t.Errorf("consistency from 0 = %v, want %v", err, ErrInvalidProof)
+	}
+	if _, err := consistencyProof(&tr, 6, 5); err != ErrInvalidProof {
+		t.Errorf("consistency from a larger tree = %v, want %v", err, ErrInvalidProof)
+	}
+}
+
+func equalPaths(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
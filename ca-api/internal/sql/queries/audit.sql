@@ -0,0 +1,11 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+    event_type,
+    actor_id,
+    subject_id,
+    ip_address,
+    user_agent,
+    metadata
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+);
@@ -0,0 +1,75 @@
+-- name: CreateBatchJob :one
+INSERT INTO batch_jobs (
+    template,
+    status,
+    total,
+    failed,
+    submitted_by,
+    finished_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: CreateBatchItems :exec
+-- items arrive as one JSON array so a large upload is a single round trip
+INSERT INTO batch_items (job_id, line, hostname, public_key, status, error)
+SELECT @job_id::UUID, x.line, x.hostname, x.public_key, x.status, x.error
+FROM jsonb_to_recordset(@items::JSONB)
+    AS x(line INTEGER, hostname TEXT, public_key TEXT, status TEXT, error TEXT);
+
+-- name: GetBatchJob :one
+SELECT *
+FROM batch_jobs
+WHERE id = $1;
+
+-- name: ListBatchItemResults :many
+SELECT
+    i.line,
+    i.hostname,
+    i.status,
+    i.error,
+    c.certificate
+FROM batch_items i
+LEFT JOIN certificates c ON c.id = i.certificate_id
+WHERE i.job_id = $1
+ORDER BY i.line;
+
+-- name: ClaimBatchItem :one
+-- the oldest pending item no other worker holds; the lock lasts until the signing transaction ends
+SELECT
+    i.job_id,
+    i.line,
+    i.hostname,
+    i.public_key,
+    j.template,
+    j.submitted_by
+FROM batch_items i
+JOIN batch_jobs j ON j.id = i.job_id
+WHERE i.status = 'pending'
+ORDER BY j.created_at, i.line
+LIMIT 1
+FOR UPDATE OF i SKIP LOCKED;
+
+-- name: FinishBatchItem :execrows
+-- an item is finished once; a worker that lost its claim changes nothing
+UPDATE batch_items
+SET status = $3,
+    error = $4,
+    certificate_id = $5
+WHERE job_id = $1
+  AND line = $2
+  AND status = 'pending';
+
+-- name: CountBatchItem :exec
+-- counts a finished item; the job is done once every item is counted
+UPDATE batch_jobs
+SET signed = signed + CASE WHEN @signed::BOOLEAN THEN 1 ELSE 0 END,
+    failed = failed + CASE WHEN @signed::BOOLEAN THEN 0 ELSE 1 END,
+    status = CASE WHEN signed + failed + 1 >= total THEN 'done' ELSE 'running' END,
+    finished_at = CASE WHEN signed + failed + 1 >= total THEN NOW() END
+WHERE id = @id;
+
+-- name: DeleteFinishedBatchJobs :exec
+DELETE FROM batch_jobs
+WHERE finished_at < $1;
@@ -0,0 +1,37 @@
+-- name: CreateCertificate :one
+INSERT INTO certificates (
+    serial,
+    cert_type,
+    key_id,
+    principals,
+    key_fingerprint,
+    ca_fingerprint,
+    certificate,
+    source,
+    requested_by,
+    leaf_index,
+    valid_after,
+    valid_before
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+)
+RETURNING *;
+
+-- name: GetCertificate :one
+SELECT *
+FROM certificates
+WHERE id = $1;
+
+-- name: ListGitSigningWindows :many
+-- validity of the git signing certificates a CA key issued to each of the given emails
+SELECT
+    p.email::TEXT AS email,
+    MIN(c.valid_after)::TIMESTAMPTZ AS valid_after,
+    MAX(c.valid_before)::TIMESTAMPTZ AS valid_before
+FROM certificates c
+CROSS JOIN LATERAL jsonb_array_elements_text(c.principals) AS p(email)
+WHERE c.source = 'git_signing'
+    AND c.ca_fingerprint = @ca_fingerprint
+    AND p.email IN (SELECT jsonb_array_elements_text(@emails::JSONB))
+GROUP BY p.email
+ORDER BY p.email;
@@ -0,0 +1,33 @@
+-- name: CreateEnrollmentChallenge :one
+INSERT INTO enrollment_challenges (
+    type,
+    hostname,
+    public_key,
+    token,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetEnrollmentChallenge :one
+SELECT *
+FROM enrollment_challenges
+WHERE id = $1;
+
+-- name: CompleteEnrollmentChallenge :execrows
+-- Only a pending, unexpired challenge can be completed, and only once
+UPDATE enrollment_challenges
+SET status = 'valid',
+    certificate_id = $2,
+    validated_at = NOW()
+WHERE id = $1
+  AND status = 'pending'
+  AND expires_at > NOW();
+
+-- name: FailEnrollmentChallenge :exec
+UPDATE enrollment_challenges
+SET status = $2,
+    error = $3
+WHERE id = $1
+  AND status = 'pending';
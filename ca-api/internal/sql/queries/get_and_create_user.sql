@@ -16,8 +16,34 @@ INSERT INTO users (
     password_hash,
     mfa_secret,
     mfa_enabled,
-    created_by
+    created_by,
+    status
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7
+    $1, $2, $3, $4, $5, $6, $7, $8
 )
 RETURNING *;
+
+-- name: GetUserByID :one
+SELECT *
+FROM users
+WHERE id = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: RehashUserPassword :exec
+-- Only replaces the hash it was computed from, so a concurrent password change wins
+UPDATE users
+SET password_hash = @new_hash
+WHERE id = @id
+  AND password_hash = @old_hash;
+
+-- name: ActivateUser :execrows
+UPDATE users
+SET status = 'active',
+    updated_at = NOW()
+WHERE id = $1
+  AND status = 'pending';
@@ -0,0 +1,63 @@
+-- name: GetUserIdentity :one
+SELECT *
+FROM user_identities
+WHERE provider = $1
+  AND subject = $2;
+
+-- name: CreateUserIdentity :exec
+INSERT INTO user_identities (
+    provider,
+    subject,
+    user_id,
+    email
+) VALUES (
+    $1, $2, $3, $4
+);
+
+-- name: TouchUserIdentity :exec
+UPDATE user_identities
+SET email = $3,
+    last_login_at = NOW()
+WHERE provider = $1
+  AND subject = $2;
+
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (
+    state_hash,
+    provider,
+    nonce,
+    code_verifier,
+    expires_at,
+    link_user_id
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+);
+
+-- name: ConsumeOIDCLoginState :one
+DELETE FROM oidc_login_states
+WHERE state_hash = $1
+RETURNING *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states
+WHERE expires_at < NOW();
+
+-- name: CreateSAMLRequest :exec
+INSERT INTO saml_requests (
+    relay_state_hash,
+    request_id,
+    provider,
+    expires_at,
+    link_user_id
+) VALUES (
+    $1, $2, $3, $4, $5
+);
+
+-- name: ConsumeSAMLRequest :one
+DELETE FROM saml_requests
+WHERE relay_state_hash = $1
+RETURNING *;
+
+-- name: DeleteExpiredSAMLRequests :exec
+DELETE FROM saml_requests
+WHERE expires_at < NOW();
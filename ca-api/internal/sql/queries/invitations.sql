@@ -0,0 +1,52 @@
+-- name: CreateInvitation :one
+INSERT INTO invitations (
+    token_hash,
+    email,
+    organization_id,
+    roles,
+    invited_by,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: RevokeOpenInvitationsForEmail :exec
+-- Re-inviting an address replaces whatever invitation it already had
+UPDATE invitations
+SET revoked_at = NOW()
+WHERE LOWER(email) = LOWER($1)
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL;
+
+-- name: GetOpenInvitationByTokenHash :one
+SELECT *
+FROM invitations
+WHERE token_hash = $1
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW();
+
+-- name: ListPendingInvitations :many
+SELECT *
+FROM invitations
+WHERE accepted_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+ORDER BY created_at DESC;
+
+-- name: RevokeInvitation :execrows
+UPDATE invitations
+SET revoked_at = NOW()
+WHERE id = $1
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL;
+
+-- name: AcceptInvitation :one
+UPDATE invitations
+SET accepted_at = NOW()
+WHERE token_hash = $1
+  AND accepted_at IS NULL
+  AND revoked_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,34 @@
+-- name: ListJWTSigningKeys :many
+SELECT *
+FROM jwt_signing_keys
+WHERE retired_at IS NULL
+ORDER BY created_at;
+
+-- name: CreateJWTSigningKey :execrows
+-- A second pending key is silently dropped, so concurrent rotations agree on one
+INSERT INTO jwt_signing_keys (
+    kid,
+    private_key,
+    activated_at
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT DO NOTHING;
+
+-- name: ActivateJWTSigningKey :exec
+UPDATE jwt_signing_keys
+SET activated_at = NOW()
+WHERE kid = $1
+  AND activated_at IS NULL;
+
+-- name: RetireJWTSigningKey :exec
+UPDATE jwt_signing_keys
+SET retired_at = NOW()
+WHERE kid = $1
+  AND retired_at IS NULL;
+
+-- name: ResealJWTSigningKey :exec
+UPDATE jwt_signing_keys
+SET private_key = @new_key
+WHERE kid = @kid
+  AND private_key = @old_key;
@@ -0,0 +1,91 @@
+-- name: SetPendingMFASecret :execrows
+UPDATE users
+SET mfa_secret = $2,
+    mfa_last_step = NULL
+WHERE id = $1
+  AND mfa_enabled IS NOT TRUE;
+
+-- name: EnableMFA :execrows
+UPDATE users
+SET mfa_enabled = TRUE
+WHERE id = $1
+  AND mfa_secret IS NOT NULL
+  AND mfa_enabled IS NOT TRUE;
+
+-- name: ConsumeTOTPStep :execrows
+UPDATE users
+SET mfa_last_step = @step
+WHERE id = @id
+  AND (mfa_last_step IS NULL OR mfa_last_step < @step);
+
+-- name: CreateMFAChallenge :exec
+INSERT INTO mfa_challenges (
+    token_hash,
+    user_id,
+    expires_at
+) VALUES (
+    $1, $2, $3
+);
+
+-- name: GetMFAChallengeForUpdate :one
+SELECT *
+FROM mfa_challenges
+WHERE token_hash = $1
+FOR UPDATE;
+
+-- name: RecordMFAChallengeAttempt :exec
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1;
+
+-- name: MarkMFAChallengeUsed :exec
+UPDATE mfa_challenges
+SET used_at = NOW()
+WHERE token_hash = $1;
+
+-- name: DeleteExpiredMFAChallenges :exec
+DELETE FROM mfa_challenges
+WHERE expires_at < NOW();
+
+-- name: CreateMFARecoveryCode :exec
+INSERT INTO mfa_recovery_codes (
+    user_id,
+    code_hash
+) VALUES (
+    $1, $2
+);
+
+-- name: DeleteMFARecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
+
+-- name: ListUnusedMFARecoveryCodes :many
+SELECT *
+FROM mfa_recovery_codes
+WHERE user_id = $1
+  AND used_at IS NULL
+ORDER BY created_at;
+
+-- name: MarkMFARecoveryCodeUsed :execrows
+-- Only burns a code that is still unused, so two redemptions can't both win
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE id = $1
+  AND used_at IS NULL;
+
+-- name: GetMFAChallenge :one
+SELECT *
+FROM mfa_challenges
+WHERE token_hash = $1;
+
+-- name: ListMFASecrets :many
+SELECT id, mfa_secret
+FROM users
+WHERE mfa_secret IS NOT NULL;
+
+-- name: ResealMFASecret :execrows
+-- Only replaces the secret it was given, so a concurrent MFA setup wins
+UPDATE users
+SET mfa_secret = @new_secret
+WHERE id = @id
+  AND mfa_secret = @old_secret;
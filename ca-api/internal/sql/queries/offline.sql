@@ -0,0 +1,78 @@
+-- name: CreateOfflineRequest :one
+INSERT INTO offline_requests (
+    public_key,
+    cert_type,
+    key_id,
+    principals,
+    validity_seconds,
+    requested_by
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: ListOfflineRequestsByStatus :many
+SELECT *
+FROM offline_requests
+WHERE status = $1
+ORDER BY created_at DESC
+LIMIT 1000;
+
+-- name: DecideOfflineRequest :execrows
+-- Approve or reject; only pending requests can be decided
+UPDATE offline_requests
+SET status = $2,
+    decided_by = $3
+WHERE id = $1
+  AND status = 'pending';
+
+-- name: ListApprovedOfflineRequestsForUpdate :many
+-- Locks what the next export will carry, oldest first
+SELECT *
+FROM offline_requests
+WHERE status = 'approved'
+ORDER BY created_at
+LIMIT @max_requests
+FOR UPDATE;
+
+-- name: MarkOfflineRequestExported :exec
+UPDATE offline_requests
+SET status = 'exported',
+    bundle_id = $2
+WHERE id = $1;
+
+-- name: ListExportedOfflineRequestsForUpdate :many
+SELECT *
+FROM offline_requests
+WHERE bundle_id = $1
+  AND status = 'exported'
+FOR UPDATE;
+
+-- name: IssueOfflineRequest :execrows
+UPDATE offline_requests
+SET status = 'issued',
+    certificate_id = $2
+WHERE id = $1
+  AND status = 'exported'
+  AND bundle_id = $3;
+
+-- name: CreateOfflineBundle :exec
+INSERT INTO offline_bundles (
+    id,
+    payload,
+    exported_by
+) VALUES (
+    $1, $2, $3
+);
+
+-- name: GetOfflineBundle :one
+SELECT *
+FROM offline_bundles
+WHERE id = $1;
+
+-- name: MarkOfflineBundleImported :execrows
+-- A response is ingested once; replaying it changes nothing
+UPDATE offline_bundles
+SET imported_at = NOW()
+WHERE id = $1
+  AND imported_at IS NULL;
@@ -0,0 +1,36 @@
+-- name: CreateRefreshTokenFamily :one
+INSERT INTO refresh_token_families (
+    user_id
+) VALUES (
+    $1
+)
+RETURNING *;
+
+-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (
+    jti,
+    family_id,
+    expires_at
+) VALUES (
+    $1, $2, $3
+);
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT rt.jti, rt.family_id, rt.issued_at, rt.expires_at, rt.used_at, f.user_id, f.revoked_at
+FROM refresh_tokens rt
+JOIN refresh_token_families f ON f.id = rt.family_id
+WHERE rt.jti = $1
+FOR UPDATE OF rt;
+
+-- name: MarkRefreshTokenUsed :execrows
+-- Only marks a token that is still unused, so two exchanges can't both win
+UPDATE refresh_tokens
+SET used_at = NOW()
+WHERE jti = $1
+  AND used_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_token_families
+SET revoked_at = NOW(),
+    revoked_reason = $2
+WHERE id = $1 AND revoked_at IS NULL;
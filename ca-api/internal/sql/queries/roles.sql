@@ -0,0 +1,55 @@
+-- name: UpsertSystemRole :one
+INSERT INTO roles (
+    name,
+    permissions,
+    is_system
+) VALUES (
+    $1, $2, TRUE
+)
+ON CONFLICT (name) DO UPDATE
+SET permissions = EXCLUDED.permissions,
+    is_system = TRUE
+RETURNING *;
+
+-- name: GetRoleByName :one
+SELECT *
+FROM roles
+WHERE name = $1;
+
+-- name: ListUserRoles :many
+SELECT r.*
+FROM roles r
+JOIN user_roles ur ON ur.role_id = r.id
+WHERE ur.user_id = $1
+  AND (ur.expires_at IS NULL OR ur.expires_at > NOW())
+ORDER BY r.name;
+
+-- name: GrantUserRole :exec
+INSERT INTO user_roles (
+    user_id,
+    role_id,
+    granted_by,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4
+)
+ON CONFLICT (user_id, role_id) DO UPDATE
+SET granted_by = EXCLUDED.granted_by,
+    granted_at = NOW(),
+    expires_at = EXCLUDED.expires_at;
+
+-- name: DeleteUserRolesBySource :exec
+DELETE FROM user_roles
+WHERE user_id = $1
+  AND source = $2;
+
+-- name: GrantUserRoleFromSource :exec
+-- Leaves existing grants alone so a local grant is never taken over by a provider
+INSERT INTO user_roles (
+    user_id,
+    role_id,
+    source
+) VALUES (
+    $1, $2, $3
+)
+ON CONFLICT (user_id, role_id) DO NOTHING;
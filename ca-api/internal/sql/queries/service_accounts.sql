@@ -0,0 +1,74 @@
+-- name: CreateServiceAccount :one
+INSERT INTO users (
+    first_name,
+    last_name,
+    email,
+    password_hash,
+    created_by,
+    kind
+) VALUES (
+    $1, $2, $3, $4, $5, 'service'
+)
+RETURNING *;
+
+-- name: ListServiceAccounts :many
+SELECT *
+FROM users
+WHERE kind = 'service'
+ORDER BY created_at DESC;
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+    user_id,
+    name,
+    prefix,
+    secret_hash,
+    permissions,
+    rotated_from,
+    created_by,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8
+)
+RETURNING *;
+
+-- name: GetActiveAPIKeyByPrefix :one
+SELECT *
+FROM api_keys
+WHERE prefix = $1
+  AND revoked_at IS NULL
+  AND expires_at > NOW();
+
+-- name: GetActiveAPIKey :one
+SELECT *
+FROM api_keys
+WHERE id = $1
+  AND user_id = $2
+  AND revoked_at IS NULL
+  AND expires_at > NOW();
+
+-- name: ListAPIKeys :many
+SELECT *
+FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: TouchAPIKey :exec
+-- Written at most once a minute per key so busy pipelines don't turn every request into a write
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1
+  AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: ShortenAPIKey :exec
+-- Rotation leaves the old key working until the overlap ends, never longer than it already would
+UPDATE api_keys
+SET expires_at = LEAST(expires_at, @expires_at)
+WHERE id = @id;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1
+  AND user_id = $2
+  AND revoked_at IS NULL;
@@ -0,0 +1,43 @@
+-- name: CreateSession :exec
+INSERT INTO sessions (
+    family_id,
+    user_id,
+    user_agent,
+    ip_address
+) VALUES (
+    $1, $2, $3, $4
+);
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = NOW(),
+    user_agent = $2,
+    ip_address = $3
+WHERE family_id = $1;
+
+-- name: ListActiveSessionsByUser :many
+SELECT s.family_id, s.user_id, s.user_agent, s.ip_address, s.created_at, s.last_seen_at
+FROM sessions s
+JOIN refresh_token_families f ON f.id = s.family_id
+WHERE s.user_id = @user_id
+  AND f.revoked_at IS NULL
+  AND s.last_seen_at > @seen_after
+ORDER BY s.last_seen_at DESC;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_token_families
+SET revoked_at = NOW(),
+    revoked_reason = $3
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllUserSessions :many
+UPDATE refresh_token_families
+SET revoked_at = NOW(),
+    revoked_reason = $2
+WHERE user_id = $1 AND revoked_at IS NULL
+RETURNING id;
+
+-- name: IsRefreshTokenFamilyRevoked :one
+SELECT revoked_at IS NOT NULL AS revoked
+FROM refresh_token_families
+WHERE id = $1;
@@ -0,0 +1,41 @@
+-- name: EnsureLoginThrottle :exec
+-- Gives a key a row to lock before its first attempt
+INSERT INTO login_throttles (key, failures, last_failure_at)
+VALUES ($1, 0, NOW())
+ON CONFLICT (key) DO NOTHING;
+
+-- name: GetLoginThrottleForUpdate :one
+SELECT *
+FROM login_throttles
+WHERE key = $1
+FOR UPDATE;
+
+-- name: RecordLoginFailure :one
+-- Failures older than reset_before no longer count; the streak starts over
+INSERT INTO login_throttles (key, failures, last_failure_at)
+VALUES (@key, 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < @reset_before THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    previous_failure_at = login_throttles.last_failure_at,
+    last_failure_at = NOW()
+RETURNING *;
+
+-- name: RefundLoginAttempt :exec
+-- Takes back an attempt counted in advance that turned out to succeed, along
+-- with the time it stamped, so a success doesn't extend the current delay
+UPDATE login_throttles
+SET failures = GREATEST(failures - 1, 0),
+    last_failure_at = COALESCE(previous_failure_at, last_failure_at),
+    previous_failure_at = NULL
+WHERE key = $1;
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
+
+-- name: DeleteStaleLoginThrottles :exec
+DELETE FROM login_throttles
+WHERE last_failure_at < $1;
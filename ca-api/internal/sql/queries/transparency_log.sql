@@ -0,0 +1,56 @@
+-- name: LockTransparencyLog :exec
+SELECT pg_advisory_xact_lock(6962);
+
+-- name: GetTransparencyLogSize :one
+-- leaf indexes are dense, so this reads the primary key instead of counting every row
+SELECT COALESCE(MAX(leaf_index) + 1, 0)::BIGINT AS tree_size
+FROM transparency_log;
+
+-- name: AppendTransparencyLogEntry :one
+INSERT INTO transparency_log (
+    leaf_index,
+    certificate,
+    leaf_hash
+) VALUES (
+    $1, $2, $3
+)
+RETURNING *;
+
+-- name: GetTransparencyLogEntry :one
+SELECT *
+FROM transparency_log
+WHERE leaf_index = $1;
+
+-- name: GetTransparencyLogEntryByHash :one
+SELECT *
+FROM transparency_log
+WHERE leaf_hash = $1;
+
+-- name: ListTransparencyLogEntries :many
+SELECT *
+FROM transparency_log
+WHERE leaf_index >= @start_index AND leaf_index < @end_index
+ORDER BY leaf_index;
+
+-- name: ListTransparencyLogLeafHashes :many
+SELECT leaf_hash
+FROM transparency_log
+WHERE leaf_index >= @start_index AND leaf_index < @end_index
+ORDER BY leaf_index;
+
+-- name: CreateTransparencyLogHead :exec
+-- a head already signed for this size wins, so concurrent signers agree
+INSERT INTO transparency_log_heads (
+    tree_size,
+    timestamp_ms,
+    root_hash,
+    signature
+) VALUES (
+    $1, $2, $3, $4
+)
+ON CONFLICT (tree_size) DO NOTHING;
+
+-- name: GetTransparencyLogHead :one
+SELECT *
+FROM transparency_log_heads
+WHERE tree_size = $1;
@@ -0,0 +1,67 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+    user_id,
+    name,
+    credential_id,
+    public_key,
+    sign_count,
+    aaguid,
+    attestation_format,
+    attestation_type,
+    backup_eligible
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: ListWebAuthnCredentialsByUser :many
+SELECT *
+FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CountWebAuthnCredentialsByUser :one
+SELECT COUNT(*)
+FROM webauthn_credentials
+WHERE user_id = $1;
+
+-- name: GetWebAuthnCredentialByCredentialID :one
+SELECT *
+FROM webauthn_credentials
+WHERE credential_id = $1;
+
+-- name: UpdateWebAuthnSignCount :execrows
+-- Fails when another assertion already advanced the counter
+UPDATE webauthn_credentials
+SET sign_count = @sign_count,
+    last_used_at = NOW()
+WHERE id = @id
+  AND (sign_count < @sign_count OR (sign_count = 0 AND @sign_count = 0));
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1
+  AND user_id = $2;
+
+-- name: CreateWebAuthnChallenge :exec
+INSERT INTO webauthn_challenges (
+    challenge,
+    ceremony,
+    user_id,
+    mfa_token_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4, $5
+);
+
+-- name: ConsumeWebAuthnChallenge :one
+UPDATE webauthn_challenges
+SET used_at = NOW()
+WHERE challenge = $1
+  AND used_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges
+WHERE expires_at < NOW();
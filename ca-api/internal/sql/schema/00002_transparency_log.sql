@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS transparency_log (
+    -- position in the merkle tree; dense, starting at 0
+    leaf_index BIGINT PRIMARY KEY CHECK (leaf_index >= 0),
+
+    -- the issued certificate (authorized_keys format) and its RFC 6962 leaf hash
+    certificate TEXT NOT NULL,
+    leaf_hash BYTEA NOT NULL UNIQUE,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- the log is append-only: refuse any attempt to rewrite history
+CREATE OR REPLACE FUNCTION transparency_log_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'transparency_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_transparency_log_append_only
+BEFORE UPDATE OR DELETE ON transparency_log
+FOR EACH ROW
+EXECUTE FUNCTION transparency_log_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS trg_transparency_log_append_only ON transparency_log;
+DROP FUNCTION IF EXISTS transparency_log_append_only;
+DROP TABLE IF EXISTS transparency_log;
+-- +goose StatementEnd
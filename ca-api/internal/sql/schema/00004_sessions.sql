@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- one session per refresh token family; revocation lives on the family
+CREATE TABLE IF NOT EXISTS sessions (
+    family_id UUID PRIMARY KEY REFERENCES refresh_token_families(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- device info captured at login and refreshed on every token rotation
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sessions;
+-- +goose StatementEnd
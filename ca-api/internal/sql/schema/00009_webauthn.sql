@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+
+    -- credential as produced by the authenticator
+    credential_id BYTEA UNIQUE NOT NULL,
+    public_key BYTEA NOT NULL, -- COSE_Key
+    sign_count BIGINT NOT NULL DEFAULT 0,
+
+    -- attestation info captured at registration
+    aaguid BYTEA NOT NULL,
+    attestation_format VARCHAR(32) NOT NULL,
+    attestation_type VARCHAR(32) NOT NULL,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    challenge BYTEA PRIMARY KEY,
+    ceremony VARCHAR(20) NOT NULL, -- registration, login or mfa
+
+    -- NULL for passwordless login, where the user is only known from the response
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    -- ties an mfa ceremony to the login it completes
+    mfa_token_hash BYTEA,
+
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS webauthn_credentials;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+-- where a role grant came from: 'local' for grants made in Signee, otherwise
+-- the identity provider that manages it (e.g. 'oidc:corp') and re-syncs it on login
+ALTER TABLE user_roles ADD COLUMN IF NOT EXISTS source VARCHAR(100) NOT NULL DEFAULT 'local';
+
+-- accounts at external identity providers linked to Signee users
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider VARCHAR(100) NOT NULL,
+    subject VARCHAR(255) NOT NULL, -- the provider's stable id for the user
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- in-flight OIDC authorization requests
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash BYTEA PRIMARY KEY,
+    provider VARCHAR(100) NOT NULL,
+    nonce VARCHAR(255) NOT NULL,
+    code_verifier VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS oidc_login_states;
+DROP TABLE IF EXISTS user_identities;
+ALTER TABLE user_roles DROP COLUMN IF EXISTS source;
+-- +goose StatementEnd
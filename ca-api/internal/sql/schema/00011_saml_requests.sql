@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- in-flight SAML AuthnRequests, keyed by the RelayState that comes back with the response
+CREATE TABLE IF NOT EXISTS saml_requests (
+    relay_state_hash BYTEA PRIMARY KEY,
+    request_id VARCHAR(64) NOT NULL, -- must match the assertion's InResponseTo
+    provider VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS saml_requests;
+-- +goose StatementEnd
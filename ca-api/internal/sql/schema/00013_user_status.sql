@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- same states as the draft in internal/sql/00001_orgs_and_users_column.sql; self sign-ups
+-- stay 'pending' until they prove they own their email
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status VARCHAR(50) NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'suspended', 'pending', 'disabled'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- admin-issued invitations; the emailed token is only stored hashed
+CREATE TABLE IF NOT EXISTS invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    token_hash BYTEA UNIQUE NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    -- no foreign key until organizations are part of the live schema
+    organization_id UUID,
+    roles JSONB NOT NULL, -- role names granted on acceptance
+    invited_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+-- at most one open invitation per address
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_open_email ON invitations(LOWER(email))
+    WHERE accepted_at IS NULL AND revoked_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS invitations;
+-- +goose StatementEnd
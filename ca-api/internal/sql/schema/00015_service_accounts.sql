@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+-- service accounts are users with no usable password that authenticate with API keys only
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'human'
+    CHECK (kind IN ('human', 'service'));
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+
+    -- the public part of the key, used to find it; only a hash of the secret is kept
+    prefix VARCHAR(16) UNIQUE NOT NULL,
+    secret_hash BYTEA NOT NULL,
+    permissions JSONB NOT NULL, -- subset of auth.Permission values the key may use
+
+    rotated_from UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_keys;
+ALTER TABLE users DROP COLUMN IF EXISTS kind;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- versions of the token signing key, shared by every API instance
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    kid VARCHAR(64) PRIMARY KEY, -- RFC 7638 thumbprint of the public key
+    private_key TEXT NOT NULL, -- PEM, sealed with the claim encryption key
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    -- NULL while the key is published ahead of use; the newest activated key signs
+    activated_at TIMESTAMPTZ,
+    -- retired keys are neither published nor trusted
+    retired_at TIMESTAMPTZ
+);
+
+-- at most one key waiting to take over, however many instances try to rotate at once
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jwt_signing_keys_one_pending ON jwt_signing_keys((TRUE))
+    WHERE activated_at IS NULL AND retired_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS jwt_signing_keys;
+-- +goose StatementEnd
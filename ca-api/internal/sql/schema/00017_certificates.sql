@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- every certificate issued online or ingested from the offline CA; each one
+-- is appended to the transparency log in the same transaction
+CREATE TABLE IF NOT EXISTS certificates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    serial NUMERIC(20, 0) NOT NULL, -- unsigned 64-bit, too large for BIGINT
+    cert_type VARCHAR(10) NOT NULL CHECK (cert_type IN ('user', 'host')),
+    key_id TEXT NOT NULL,
+    principals JSONB NOT NULL,
+    key_fingerprint VARCHAR(64) NOT NULL, -- SHA256 fingerprint of the certified key
+    ca_fingerprint VARCHAR(64) NOT NULL, -- SHA256 fingerprint of the signing CA key
+    certificate TEXT NOT NULL, -- authorized_keys format, exactly as logged
+    source VARCHAR(20) NOT NULL, -- issuance path, see internal/domain/ca/types.go
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    leaf_index BIGINT UNIQUE NOT NULL REFERENCES transparency_log(leaf_index),
+    valid_after TIMESTAMPTZ NOT NULL,
+    valid_before TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_certificates_ca_serial ON certificates(ca_fingerprint, serial);
+CREATE INDEX IF NOT EXISTS idx_certificates_key_fingerprint ON certificates(key_fingerprint);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS certificates;
+-- +goose StatementEnd
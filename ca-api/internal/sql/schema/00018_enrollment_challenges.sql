@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- hosts proving control of a hostname before they get a host certificate
+CREATE TABLE IF NOT EXISTS enrollment_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    type VARCHAR(20) NOT NULL CHECK (type IN ('http-01', 'ssh-hostkey')),
+    hostname VARCHAR(253) NOT NULL,
+    public_key TEXT NOT NULL, -- host key to certify, authorized_keys format
+    token VARCHAR(64) UNIQUE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'valid', 'invalid', 'expired')),
+    error TEXT, -- why verification failed
+    certificate_id UUID REFERENCES certificates(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    validated_at TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS enrollment_challenges;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- request bundles exported to the air-gapped CA
+CREATE TABLE IF NOT EXISTS offline_bundles (
+    id VARCHAR(32) PRIMARY KEY, -- bundle id carried in the export
+    payload BYTEA NOT NULL, -- exact signed bytes; the response must answer them
+    exported_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    imported_at TIMESTAMPTZ
+);
+
+-- certificate requests for the offline CA: pending until approved, then
+-- exported in a bundle and finally issued when its response is imported
+CREATE TABLE IF NOT EXISTS offline_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    public_key TEXT NOT NULL, -- authorized_keys format
+    cert_type VARCHAR(10) NOT NULL CHECK (cert_type IN ('user', 'host')),
+    key_id TEXT NOT NULL,
+    principals JSONB NOT NULL,
+    validity_seconds INTEGER NOT NULL CHECK (validity_seconds > 0), -- counted from export
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'exported', 'issued')),
+    requested_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    bundle_id VARCHAR(32) REFERENCES offline_bundles(id),
+    certificate_id UUID REFERENCES certificates(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_offline_requests_status ON offline_requests(status, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS offline_requests;
+DROP TABLE IF EXISTS offline_bundles;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- signed tree heads, one per tree size: the log is signed once per size and
+-- every instance serves the same head for it
+CREATE TABLE IF NOT EXISTS transparency_log_heads (
+    tree_size BIGINT PRIMARY KEY CHECK (tree_size >= 0),
+    timestamp_ms BIGINT NOT NULL, -- signed timestamp, milliseconds since epoch
+    root_hash BYTEA NOT NULL,
+    signature BYTEA NOT NULL, -- Ed25519 over the RFC 6962 TreeHeadSignature
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS transparency_log_heads;
+-- +goose StatementEnd
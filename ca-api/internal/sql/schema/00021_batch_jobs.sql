@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+-- bulk host signing jobs; items are signed by a shared worker pool and survive restarts
+CREATE TABLE IF NOT EXISTS batch_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    template VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'done')),
+    total INTEGER NOT NULL CHECK (total > 0),
+    signed INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    submitted_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS batch_items (
+    job_id UUID NOT NULL REFERENCES batch_jobs(id) ON DELETE CASCADE,
+    line INTEGER NOT NULL, -- line of the upload the item came from
+    hostname TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'signed', 'failed')),
+    error TEXT, -- why the item was not signed
+    certificate_id UUID REFERENCES certificates(id),
+    PRIMARY KEY (job_id, line)
+);
+
+-- workers only ever look for pending items
+CREATE INDEX IF NOT EXISTS idx_batch_items_pending ON batch_items(job_id, line) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_batch_jobs_finished_at ON batch_jobs(finished_at) WHERE finished_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS batch_items;
+DROP TABLE IF EXISTS batch_jobs;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- set when a signed-in user started the flow to link the provider to their own account
+ALTER TABLE oidc_login_states
+    ADD COLUMN IF NOT EXISTS link_user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE oidc_login_states DROP COLUMN IF EXISTS link_user_id;
+-- +goose StatementEnd
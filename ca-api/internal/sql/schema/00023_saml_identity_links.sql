@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- set when a signed-in user started the flow to link the IdP to their own account
+ALTER TABLE saml_requests
+    ADD COLUMN IF NOT EXISTS link_user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE saml_requests DROP COLUMN IF EXISTS link_user_id;
+-- +goose StatementEnd
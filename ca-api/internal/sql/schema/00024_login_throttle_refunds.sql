@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- when the failure before the last one was recorded, so refunding the last attempt can put its time back
+ALTER TABLE login_throttles
+    ADD COLUMN IF NOT EXISTS previous_failure_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE login_throttles DROP COLUMN IF EXISTS previous_failure_at;
+-- +goose StatementEnd
@@ -2,21 +2,48 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/fs"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/dhruvpatel-10/signee/ca-api/cmd/api"
 	"github.com/dhruvpatel-10/signee/ca-api/db"
 	"github.com/dhruvpatel-10/signee/ca-api/internal/config"
+	batchcfg "github.com/dhruvpatel-10/signee/ca-api/internal/domain/batch"
+	gitsigncfg "github.com/dhruvpatel-10/signee/ca-api/internal/domain/gitsign"
+	mailcfg "github.com/dhruvpatel-10/signee/ca-api/internal/domain/mail"
+	passwordcfg "github.com/dhruvpatel-10/signee/ca-api/internal/domain/password"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/jwt"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/ldap"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/oidc"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/password"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/saml"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/auth/webauthn"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/batch"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/ca"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/enroll"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/gitsign"
 	"github.com/dhruvpatel-10/signee/ca-api/internal/service/logger"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/mail"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/notify"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/offline"
+	"github.com/dhruvpatel-10/signee/ca-api/internal/service/translog"
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
+	"golang.org/x/crypto/ssh"
 )
 
 func initializeApp() {
@@ -29,7 +56,8 @@ func CORSMiddleware() gin.HandlerFunc {
 		// Fix: Origin should be the frontend domain, not the API path
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Content-Length, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Content-Length, X-Requested-With, DPoP")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "DPoP-Nonce, WWW-Authenticate")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 		if c.Request.Method == "OPTIONS" {
@@ -55,15 +83,411 @@ func openDatabase() (*sql.DB, *db.Queries, error) {
 	return conn, db.New(conn), nil
 }
 
-func newRouter(queries *db.Queries) *gin.Engine {
+func newJWTManager() (*jwt.JWTManager, error) {
+	privateKeyPath := os.Getenv("ECDSA_PRIVATE_KEY_PATH")
+	if privateKeyPath == "" {
+		privateKeyPath = "ecdsa_private.pem" // Default path
+	}
+
+	encryptionKeyPath := os.Getenv("CHACHA20_KEY_PATH")
+	if encryptionKeyPath == "" {
+		encryptionKeyPath = "chacha20_key.bin" // Default path
+	}
+
+	return jwt.NewJWTManager("signee", privateKeyPath, encryptionKeyPath)
+}
+
+// keyRotation reads how often the token signing key is replaced; 0 days turns rotation off
+func keyRotation() (jwt.KeyRotation, error) {
+	rotation := jwt.DefaultKeyRotation
+	value := os.Getenv("JWT_KEY_ROTATION_DAYS")
+	if value == "" {
+		return rotation, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return rotation, fmt.Errorf("JWT_KEY_ROTATION_DAYS must be a non-negative integer")
+	}
+	rotation.Interval = time.Duration(days) * 24 * time.Hour
+	return rotation, nil
+}
+
+// newRelyingParty describes this deployment to WebAuthn authenticators
+func newRelyingParty() *webauthn.RelyingParty {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost" // Default RP ID
+	}
+
+	origins := strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",")
+	if origins[0] == "" {
+		origins = []string{"http://localhost:3000"} // Default frontend origin
+	}
+	for i := range origins {
+		origins[i] = strings.TrimSpace(origins[i])
+	}
+
+	return &webauthn.RelyingParty{ID: rpID, Name: "Signee", Origins: origins}
+}
+
+// newOIDCProviders loads the single sign-on providers, if any are configured
+func newOIDCProviders() (map[string]*oidc.Provider, error) {
+	providers := make(map[string]*oidc.Provider)
+	path := os.Getenv("OIDC_PROVIDERS_FILE")
+	if path == "" {
+		return providers, nil
+	}
+
+	configs, err := oidc.LoadProviders(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, cfg := range configs {
+		providers[cfg.Name] = oidc.NewProvider(cfg, nil)
+	}
+	return providers, nil
+}
+
+// newSAMLProviders loads the SAML identity providers, if any are configured
+func newSAMLProviders() (map[string]*saml.ServiceProvider, error) {
+	providers := make(map[string]*saml.ServiceProvider)
+	path := os.Getenv("SAML_PROVIDERS_FILE")
+	if path == "" {
+		return providers, nil
+	}
+
+	configs, err := saml.LoadProviders(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, cfg := range configs {
+		sp, err := saml.NewServiceProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		providers[cfg.Name] = sp
+	}
+	return providers, nil
+}
+
+// newDirectories loads the LDAP directories, keyed by the email domains they own
+func newDirectories() (map[string]*ldap.Directory, error) {
+	directories := make(map[string]*ldap.Directory)
+	path := os.Getenv("LDAP_DIRECTORIES_FILE")
+	if path == "" {
+		return directories, nil
+	}
+
+	configs, err := ldap.LoadDirectories(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, cfg := range configs {
+		dir, err := ldap.NewDirectory(cfg)
+		if err != nil {
+			return nil, err
+		}
+		for _, domain := range cfg.Domains {
+			directories[domain] = dir
+		}
+	}
+	return directories, nil
+}
+
+// newPasswordPolicy loads the password policy, falling back to the defaults
+func newPasswordPolicy() (*password.Policy, error) {
+	path := os.Getenv("PASSWORD_POLICY_FILE")
+	if path == "" {
+		return password.NewPolicy(passwordcfg.PolicyConfig{})
+	}
+
+	cfg, err := password.LoadPolicy(path)
+	if err != nil {
+		return nil, err
+	}
+	return password.NewPolicy(cfg)
+}
+
+// loadPeppers reads the password pepper keyring, if one is configured
+func loadPeppers() (*auth.PepperRing, error) {
+	path := os.Getenv("PASSWORD_PEPPER_FILE")
+	if path == "" {
+		log.Println("PASSWORD_PEPPER_FILE not set; password hashes are not peppered")
+		return nil, nil
+	}
+	return auth.LoadPeppers(path)
+}
+
+// newHashLimiter sizes argon2id concurrency from memory unless PASSWORD_HASH_CONCURRENCY overrides it
+func newHashLimiter() (*auth.HashLimiter, error) {
+	n := auth.DefaultHashConcurrency()
+	if value := os.Getenv("PASSWORD_HASH_CONCURRENCY"); value != "" {
+		var err error
+		if n, err = strconv.Atoi(value); err != nil || n < 1 {
+			return nil, fmt.Errorf("PASSWORD_HASH_CONCURRENCY must be a positive integer")
+		}
+	}
+	log.Printf("Password hashing concurrency: %d", n)
+
+	limiter := auth.NewHashLimiter(n)
+	expvar.Publish("password_hashing", expvar.Func(func() any {
+		return limiter.Stats()
+	}))
+	return limiter, nil
+}
+
+// newMailer sends through SMTP when SMTP_HOST is set, otherwise writes .eml files for development
+func newMailer() (mail.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Signee <no-reply@localhost>" // Default sender
+	}
+
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail" // Default mail drop
+		}
+		log.Printf("SMTP_HOST not set; writing outgoing mail to %s", dir)
+		return mail.FileMailer{Dir: dir, From: from}, nil
+	}
+
+	port := 0
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		var err error
+		if port, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("SMTP_PORT must be a number")
+		}
+	}
+	return mail.NewSMTPMailer(mailcfg.SMTPConfig{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	})
+}
+
+// loadEmailTokenKey reads the key that signs emailed links, generating one on first run
+func loadEmailTokenKey() ([]byte, error) {
+	path := os.Getenv("EMAIL_TOKEN_KEY_PATH")
+	if path == "" {
+		path = "email_token_key.bin" // Default path
+	}
+
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) < 32 {
+			return nil, fmt.Errorf("email token key in %s is shorter than 32 bytes", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save email token key: %v", err)
+	}
+	return key, nil
+}
+
+func newAuthService(conn *sql.DB, queries *db.Queries, jwtManager *jwt.JWTManager) (*auth.AuthService, error) {
+	oidcProviders, err := newOIDCProviders()
+	if err != nil {
+		return nil, err
+	}
+	samlProviders, err := newSAMLProviders()
+	if err != nil {
+		return nil, err
+	}
+	directories, err := newDirectories()
+	if err != nil {
+		return nil, err
+	}
+	passwords, err := newPasswordPolicy()
+	if err != nil {
+		return nil, err
+	}
+	peppers, err := loadPeppers()
+	if err != nil {
+		return nil, err
+	}
+	hashLimit, err := newHashLimiter()
+	if err != nil {
+		return nil, err
+	}
+	mailer, err := newMailer()
+	if err != nil {
+		return nil, err
+	}
+	emailTokenKey, err := loadEmailTokenKey()
+	if err != nil {
+		return nil, err
+	}
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:3000" // Default frontend origin
+	}
+
+	return &auth.AuthService{
+		Conn:     conn,
+		DB:       queries,
+		JWT:      jwtManager,
+		Notifier: notify.MailNotifier{Mailer: mailer},
+		WebAuthn: newRelyingParty(),
+		OIDC:     oidcProviders,
+		SAML:     samlProviders,
+
+		Directories: directories,
+		Passwords:   passwords,
+
+		HashLimit: hashLimit,
+		Peppers:   peppers,
+
+		Mailer:        mailer,
+		EmailTokenKey: emailTokenKey,
+		AppURL:        strings.TrimSuffix(appURL, "/"),
+
+		OpenSignup: os.Getenv("OPEN_SIGNUP") != "false",
+	}, nil
+}
+
+// newAuthority loads the online CA key, generating one on first run
+func newAuthority(tlog *translog.Log) (*ca.Authority, error) {
+	path := os.Getenv("CA_KEY_PATH")
+	if path == "" {
+		path = "ca_ed25519" // Default path
+	}
+	return ca.NewAuthority(tlog, path)
+}
+
+// newEnrollService lets hosts under ENROLL_ALLOWED_DOMAINS enroll themselves
+func newEnrollService(conn *sql.DB, queries *db.Queries, authority *ca.Authority) *enroll.Service {
+	domains := envList("ENROLL_ALLOWED_DOMAINS")
+	if len(domains) == 0 {
+		log.Println("ENROLL_ALLOWED_DOMAINS not set; host enrollment is disabled")
+	}
+	return &enroll.Service{
+		Conn:           conn,
+		DB:             queries,
+		CA:             authority,
+		Verifier:       enroll.NewVerifier(),
+		AllowedDomains: domains,
+	}
+}
+
+// newGitSignService issues commit signing certificates valid for GIT_SIGNING_CERT_VALIDITY
+func newGitSignService(conn *sql.DB, queries *db.Queries, authority *ca.Authority) (*gitsign.Service, error) {
+	validity := 12 * time.Hour // Default: one working day
+	if value := os.Getenv("GIT_SIGNING_CERT_VALIDITY"); value != "" {
+		var err error
+		if validity, err = time.ParseDuration(value); err != nil || validity <= 0 {
+			return nil, fmt.Errorf("GIT_SIGNING_CERT_VALIDITY must be a positive duration such as 12h")
+		}
+	}
+	return &gitsign.Service{
+		Conn: conn,
+		DB:   queries,
+		CA:   authority,
+		Template: gitsigncfg.SigningTemplate{
+			Name:      gitsigncfg.TemplateType,
+			Namespace: gitsigncfg.DefaultNamespace,
+			Validity:  validity,
+		},
+	}, nil
+}
+
+// newBatchManager signs bulk host uploads against the templates in BATCH_TEMPLATES_FILE
+func newBatchManager(conn *sql.DB, queries *db.Queries, authority *ca.Authority) (*batch.Manager, error) {
+	workers := 4 // Default pool size
+	if value := os.Getenv("BATCH_WORKERS"); value != "" {
+		var err error
+		if workers, err = strconv.Atoi(value); err != nil || workers < 1 {
+			return nil, fmt.Errorf("BATCH_WORKERS must be a positive integer")
+		}
+	}
+
+	var templates []batchcfg.HostTemplate
+	if path := os.Getenv("BATCH_TEMPLATES_FILE"); path != "" {
+		var err error
+		if templates, err = batch.LoadTemplates(path); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Println("BATCH_TEMPLATES_FILE not set; batch issuance is disabled")
+	}
+	return batch.NewManager(conn, queries, authority, workers, templates), nil
+}
+
+// newOfflineService sets up the air-gapped CA workflow when OFFLINE_CA_PUBLIC_KEY_PATH names its public key
+func newOfflineService(conn *sql.DB, queries *db.Queries, tlog *translog.Log) (*offline.Service, error) {
+	exportKeyPath := os.Getenv("OFFLINE_EXPORT_KEY_PATH")
+	if exportKeyPath == "" {
+		exportKeyPath = "offline_export_ed25519" // Default path
+	}
+	exportKey, err := ca.LoadOrGenerateKey(exportKeyPath, "signee-offline-export")
+	if err != nil {
+		return nil, err
+	}
+	service := &offline.Service{Conn: conn, DB: queries, Log: tlog, ExportKey: exportKey}
+
+	path := os.Getenv("OFFLINE_CA_PUBLIC_KEY_PATH")
+	if path == "" {
+		log.Println("OFFLINE_CA_PUBLIC_KEY_PATH not set; offline CA signing is disabled")
+		return service, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if service.CAKey, _, _, _, err = ssh.ParseAuthorizedKey(data); err != nil {
+		return nil, fmt.Errorf("invalid offline CA public key in %s: %v", path, err)
+	}
+	return service, nil
+}
+
+func newRouter(queries *db.Queries, jwtManager *jwt.JWTManager, tlog *translog.Log, authService *auth.AuthService, enroller *enroll.Service, offlineCA *offline.Service, gitSigner *gitsign.Service, batchManager *batch.Manager) (*gin.Engine, error) {
 	r := gin.New()
 
+	// Client IPs drive login throttling, so forwarding headers are only
+	// believed from proxies we were told about
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	// Behind a unix socket the peer has no address; trust the header the proxy sets instead
+	r.TrustedPlatform = os.Getenv("CLIENT_IP_HEADER")
+
 	r.Use(CORSMiddleware())
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
 
-	api.SetupRoutes(r, queries)
-	return r
+	api.SetupRoutes(r, queries, jwtManager, tlog, authService, enroller, offlineCA, gitSigner, batchManager)
+	return r, nil
+}
+
+// trustedProxies lists the proxies allowed to report a client's address; nil trusts none
+func trustedProxies() []string {
+	return envList("TRUSTED_PROXIES")
+}
+
+// envList reads a comma-separated environment variable; nil when unset
+func envList(name string) []string {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
 }
 
 func serveUnixSocket(handler http.Handler, socketPath string) (*http.Server, net.Listener, error) {
@@ -96,7 +520,71 @@ func main() {
 	}
 	defer conn.Close()
 
-	router := newRouter(queries)
+	tlogKeyPath := os.Getenv("TLOG_SIGNING_KEY_PATH")
+	if tlogKeyPath == "" {
+		tlogKeyPath = "tlog_ed25519.pem" // Default path
+	}
+	tlog, err := translog.NewLog(conn, queries, tlogKeyPath)
+	if err != nil {
+		log.Fatal("cannot initialize transparency log:", err)
+	}
+	authority, err := newAuthority(tlog)
+	if err != nil {
+		log.Fatal("cannot initialize certificate authority:", err)
+	}
+
+	jwtManager, err := newJWTManager()
+	if err != nil {
+		log.Fatal("cannot initialize jwt manager:", err)
+	}
+	if err := auth.SyncSystemRoles(context.Background(), queries); err != nil {
+		log.Fatal("cannot sync system roles:", err)
+	}
+
+	jwtManager.SetRevocationChecker(jwt.NewRevocationCache(auth.FamilyRevocationLookup(queries), 30*time.Second))
+	if err := jwtManager.SetTokenBinding(jwt.TokenBinding{
+		DPoPBaseURL:       os.Getenv("API_URL"),
+		DPoPRequired:      os.Getenv("DPOP_REQUIRED") == "true",
+		LegacyFingerprint: os.Getenv("LEGACY_FINGERPRINT_CHECK") == "true",
+	}); err != nil {
+		log.Fatal("cannot configure token binding:", err)
+	}
+
+	rotation, err := keyRotation()
+	if err != nil {
+		log.Fatal("cannot configure signing key rotation:", err)
+	}
+	if err := jwtManager.UseKeyStore(context.Background(), auth.SigningKeyStore(queries), rotation); err != nil {
+		log.Fatal("cannot load signing keys:", err)
+	}
+	go jwtManager.RunKeyRotation(context.Background())
+	go jwtManager.WatchKeyring(context.Background(), 30*time.Second, auth.ResealMFASecrets(queries, jwtManager))
+
+	authService, err := newAuthService(conn, queries, jwtManager)
+	if err != nil {
+		log.Fatal("cannot initialize auth service:", err)
+	}
+
+	offlineCA, err := newOfflineService(conn, queries, tlog)
+	if err != nil {
+		log.Fatal("cannot initialize offline CA:", err)
+	}
+
+	gitSigner, err := newGitSignService(conn, queries, authority)
+	if err != nil {
+		log.Fatal("cannot initialize git signing:", err)
+	}
+
+	batchManager, err := newBatchManager(conn, queries, authority)
+	if err != nil {
+		log.Fatal("cannot initialize batch issuance:", err)
+	}
+	go batchManager.Run(context.Background())
+
+	router, err := newRouter(queries, jwtManager, tlog, authService, newEnrollService(conn, queries, authority), offlineCA, gitSigner, batchManager)
+	if err != nil {
+		log.Fatal("cannot set up router:", err)
+	}
 
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)